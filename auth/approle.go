@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"errors"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// AppRole logs in to vault approle auth method
+type AppRole struct {
+	mount    string
+	roleID   string
+	secretID string
+}
+
+// NewAppRole creates new AppRole auth method mounted at mount which logs in with roleID and secretID
+// and returns it. secretID may be empty if the role doesn't require it. If mount is empty, approle is used.
+// It returns error if roleID is empty.
+func NewAppRole(mount, roleID, secretID string) (*AppRole, error) {
+	if roleID == "" {
+		return nil, errors.New("approle role ID not specified")
+	}
+
+	return &AppRole{
+		mount:    MountOrDefault(mount, "approle"),
+		roleID:   roleID,
+		secretID: secretID,
+	}, nil
+}
+
+// Login logs in to vault via client c and returns the secret which holds the client token
+func (a *AppRole) Login(c *api.Client) (*api.Secret, error) {
+	data := map[string]interface{}{
+		"role_id": a.roleID,
+	}
+	if a.secretID != "" {
+		data["secret_id"] = a.secretID
+	}
+
+	return Login(c, a.mount, data)
+}
@@ -0,0 +1,46 @@
+// Package auth provides vault auth methods vaultops can log in with
+// instead of using the token stored in the key store.
+package auth
+
+import (
+	"errors"
+	"path"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// Method is vault auth method
+type Method interface {
+	// Login logs in to vault via client c and returns the secret which holds the client token
+	Login(c *api.Client) (*api.Secret, error)
+}
+
+// LoginPath returns the path of the login endpoint of the auth method mounted at mount
+func LoginPath(mount string) string {
+	return path.Join("auth", strings.Trim(mount, "/"), "login")
+}
+
+// Login writes data to the login endpoint of the auth method mounted at mount and returns the secret
+// which holds the client token. It returns error if the auth method doesn't return any client token.
+func Login(c *api.Client, mount string, data map[string]interface{}) (*api.Secret, error) {
+	secret, err := c.Logical().Write(LoginPath(mount), data)
+	if err != nil {
+		return nil, err
+	}
+
+	if secret == nil || secret.Auth == nil || secret.Auth.ClientToken == "" {
+		return nil, errors.New("no client token returned")
+	}
+
+	return secret, nil
+}
+
+// MountOrDefault returns mount without leading and trailing slashes or def if mount is empty
+func MountOrDefault(mount, def string) string {
+	if m := strings.Trim(mount, "/"); m != "" {
+		return m
+	}
+
+	return def
+}
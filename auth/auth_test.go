@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/milosgajdos/vaultops/vaulttest"
+	"github.com/stretchr/testify/assert"
+)
+
+// makeTestServer starts unsealed fake vault server with auth method mounted at mount.
+// The auth method stores the login data in data.
+func makeTestServer(t *testing.T, mount string, data *map[string]interface{}) (*vaulttest.Server, *api.Client) {
+	s := vaulttest.NewServer()
+	s.Initialize(1, 1)
+	s.SetSealed(false)
+	s.EnableAuth(mount, func(d map[string]interface{}) (*vaulttest.Token, error) {
+		*data = d
+		if d["role"] == "invalid" {
+			return nil, errors.New("invalid role")
+		}
+		return &vaulttest.Token{Policies: []string{"default"}, TTL: time.Hour}, nil
+	})
+
+	config := api.DefaultConfig()
+	config.Address = s.URL
+	config.MaxRetries = 0
+	c, err := api.NewClient(config)
+	assert.NoError(t, err)
+	c.ClearToken()
+
+	return s, c
+}
+
+func TestLoginPath(t *testing.T) {
+	assert.Equal(t, "auth/approle/login", LoginPath("approle"))
+	assert.Equal(t, "auth/aws/prod/login", LoginPath("/aws/prod/"))
+}
+
+func TestMountOrDefault(t *testing.T) {
+	assert.Equal(t, "aws/prod", MountOrDefault("/aws/prod/", "aws"))
+	assert.Equal(t, "aws", MountOrDefault("/", "aws"))
+	assert.Equal(t, "aws", MountOrDefault("", "aws"))
+}
+
+func TestAppRole(t *testing.T) {
+	_, err := NewAppRole("", "", "secret")
+	assert.EqualError(t, err, "approle role ID not specified")
+
+	var data map[string]interface{}
+	s, c := makeTestServer(t, "ci", &data)
+	defer s.Close()
+
+	a, err := NewAppRole("ci/", "role", "secret")
+	assert.NoError(t, err)
+	secret, err := a.Login(c)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"role_id": "role", "secret_id": "secret"}, data)
+	_, ok := s.Token(secret.Auth.ClientToken)
+	assert.True(t, ok)
+
+	// the secret ID is optional
+	a, err = NewAppRole("ci", "role", "")
+	assert.NoError(t, err)
+	_, err = a.Login(c)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"role_id": "role"}, data)
+
+	// the auth method is mounted at approle by default
+	a, err = NewAppRole("", "role", "")
+	assert.NoError(t, err)
+	_, err = a.Login(c)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "no handler for route 'auth/approle/login'")
+}
+
+func TestKubernetes(t *testing.T) {
+	_, err := NewKubernetes("", "", "")
+	assert.EqualError(t, err, "kubernetes role not specified")
+
+	k, err := NewKubernetes("", "vaultops", "")
+	assert.NoError(t, err)
+	assert.Equal(t, &Kubernetes{mount: "kubernetes", role: "vaultops", jwtPath: DefaultJWTPath}, k)
+
+	dir, err := ioutil.TempDir("", "auth")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	jwtPath := filepath.Join(dir, "token")
+
+	var data map[string]interface{}
+	s, c := makeTestServer(t, "kubernetes", &data)
+	defer s.Close()
+
+	k, err = NewKubernetes("", "vaultops", jwtPath)
+	assert.NoError(t, err)
+	_, err = k.Login(c)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to read service account token")
+
+	// the token is read on every login
+	for _, jwt := range []string{"jwt-0", "jwt-1"} {
+		assert.NoError(t, ioutil.WriteFile(jwtPath, []byte(jwt+"\n"), 0600))
+		_, err = k.Login(c)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{"role": "vaultops", "jwt": jwt}, data)
+	}
+
+	k, err = NewKubernetes("", "invalid", jwtPath)
+	assert.NoError(t, err)
+	_, err = k.Login(c)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid role")
+}
+
+func TestCert(t *testing.T) {
+	var data map[string]interface{}
+	s, c := makeTestServer(t, "cert", &data)
+	defer s.Close()
+
+	_, err := NewCert("", "vaultops").Login(c)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"name": "vaultops"}, data)
+
+	_, err = NewCert("/cert/", "").Login(c)
+	assert.NoError(t, err)
+	assert.Empty(t, data)
+}
@@ -0,0 +1,31 @@
+package auth
+
+import (
+	"github.com/hashicorp/vault/api"
+)
+
+// Cert logs in to vault cert auth method with the TLS client certificate of vault client
+type Cert struct {
+	mount string
+	name  string
+}
+
+// NewCert creates new Cert auth method mounted at mount which logs in with the certificate role name
+// and returns it. If name is empty, vault tries all the certificate roles. If mount is empty, cert is used.
+func NewCert(mount, name string) *Cert {
+	return &Cert{
+		mount: MountOrDefault(mount, "cert"),
+		name:  name,
+	}
+}
+
+// Login logs in to vault via client c and returns the secret which holds the client token.
+// The client must be configured with the TLS client certificate, e.g. via -client-cert and -client-key.
+func (a *Cert) Login(c *api.Client) (*api.Secret, error) {
+	data := make(map[string]interface{})
+	if a.name != "" {
+		data["name"] = a.name
+	}
+
+	return Login(c, a.mount, data)
+}
@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+)
+
+const (
+	// DefaultJWTPath is the path to the token of the service account pods run as
+	DefaultJWTPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+)
+
+// Kubernetes logs in to vault kubernetes auth method with Kubernetes service account token
+type Kubernetes struct {
+	mount   string
+	role    string
+	jwtPath string
+}
+
+// NewKubernetes creates new Kubernetes auth method mounted at mount which logs in as role
+// with the service account token stored in jwtPath and returns it.
+// If mount is empty, kubernetes is used. If jwtPath is empty, DefaultJWTPath is used.
+// It returns error if role is empty.
+func NewKubernetes(mount, role, jwtPath string) (*Kubernetes, error) {
+	if role == "" {
+		return nil, errors.New("kubernetes role not specified")
+	}
+
+	if jwtPath == "" {
+		jwtPath = DefaultJWTPath
+	}
+
+	return &Kubernetes{
+		mount:   MountOrDefault(mount, "kubernetes"),
+		role:    role,
+		jwtPath: jwtPath,
+	}, nil
+}
+
+// Login logs in to vault via client c and returns the secret which holds the client token.
+// The service account token is read on every login as Kubernetes rotates projected tokens.
+func (k *Kubernetes) Login(c *api.Client) (*api.Secret, error) {
+	jwt, err := ioutil.ReadFile(k.jwtPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service account token: %v", err)
+	}
+
+	return Login(c, k.mount, map[string]interface{}{
+		"role": k.role,
+		"jwt":  strings.TrimSpace(string(jwt)),
+	})
+}
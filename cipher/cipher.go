@@ -1,5 +1,7 @@
 package cipher
 
+import "io"
+
 // Cipher allows to encrypt and decrypt arbitrary data
 type Cipher interface {
 	// Encrypt encrypts data in io.Reader
@@ -7,3 +9,12 @@ type Cipher interface {
 	// Decrypt decrypts data in io.Reader
 	Decrypt([]byte) ([]byte, error)
 }
+
+// StreamCipher allows to encrypt and decrypt data streams of arbitrary size
+type StreamCipher interface {
+	// EncryptStream returns writer which encrypts the data written to it into w
+	// The writer must be closed once all the data has been written to it.
+	EncryptStream(w io.Writer) (io.WriteCloser, error)
+	// DecryptStream returns reader which decrypts the data read from r
+	DecryptStream(r io.Reader) (io.Reader, error)
+}
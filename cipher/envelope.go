@@ -0,0 +1,132 @@
+package cipher
+
+import (
+	"bytes"
+	"crypto/aes"
+	gcipher "crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const (
+	// dataKeySize is the size of envelope data encryption key in bytes
+	dataKeySize = 32
+)
+
+// envelopeMagic identifies envelope encrypted data
+var envelopeMagic = []byte("VOENV1")
+
+// Envelope implements envelope encryption
+// The data is encrypted with a random AES-256-GCM data key which is
+// encrypted with the key encryption cipher and stored alongside the data.
+// This allows to encrypt data of arbitrary size with KMS ciphers which
+// limit the size of the data they can encrypt.
+type Envelope struct {
+	kek Cipher
+}
+
+// NewEnvelope creates new envelope cipher which encrypts data keys with kek and returns it
+func NewEnvelope(kek Cipher) *Envelope {
+	return &Envelope{kek: kek}
+}
+
+// newDataKey generates a random data key and returns it along with the data key encrypted with kek
+func (e *Envelope) newDataKey() (dataKey, encKey []byte, err error) {
+	dataKey = make([]byte, dataKeySize)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return nil, nil, err
+	}
+
+	encKey, err = e.kek.Encrypt(dataKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encrypt data key: %v", err)
+	}
+
+	return dataKey, encKey, nil
+}
+
+// Encrypt encrypts plainText data and returns it
+func (e *Envelope) Encrypt(plainText []byte) ([]byte, error) {
+	dataKey, encKey, err := e.newDataKey()
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	// magic | encrypted data key length | encrypted data key | nonce | encrypted data
+	var buf bytes.Buffer
+	buf.Write(envelopeMagic)
+	// nolint:errcheck
+	binary.Write(&buf, binary.BigEndian, uint32(len(encKey)))
+	buf.Write(encKey)
+	buf.Write(nonce)
+	buf.Write(gcm.Seal(nil, nonce, plainText, envelopeMagic))
+
+	return buf.Bytes(), nil
+}
+
+// Decrypt decrypts cipherText data and returns it
+func (e *Envelope) Decrypt(cipherText []byte) ([]byte, error) {
+	if !bytes.HasPrefix(cipherText, envelopeMagic) {
+		return nil, fmt.Errorf("invalid envelope: missing header")
+	}
+	data := cipherText[len(envelopeMagic):]
+
+	if len(data) < 4 {
+		return nil, fmt.Errorf("invalid envelope: missing data key")
+	}
+	keyLen := binary.BigEndian.Uint32(data)
+	data = data[4:]
+
+	if uint64(len(data)) < uint64(keyLen) {
+		return nil, fmt.Errorf("invalid envelope: truncated data key")
+	}
+	encKey, data := data[:keyLen], data[keyLen:]
+
+	dataKey, err := e.kek.Decrypt(encKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt data key: %v", err)
+	}
+
+	gcm, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < gcm.NonceSize() {
+		return nil, fmt.Errorf("invalid envelope: missing nonce")
+	}
+	nonce, data := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+
+	plainText, err := gcm.Open(nil, nonce, data, envelopeMagic)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt data: %v", err)
+	}
+
+	return plainText, nil
+}
+
+// newGCM returns AES-GCM cipher for the given key
+func newGCM(key []byte) (gcipher.AEAD, error) {
+	if len(key) != dataKeySize {
+		return nil, fmt.Errorf("invalid data key size: %d", len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return gcipher.NewGCM(block)
+}
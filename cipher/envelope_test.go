@@ -0,0 +1,90 @@
+package cipher
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// xorCipher is a toy key encryption cipher
+type xorCipher struct {
+	key byte
+	err error
+}
+
+func (x *xorCipher) xor(data []byte) ([]byte, error) {
+	if x.err != nil {
+		return nil, x.err
+	}
+
+	out := make([]byte, len(data))
+	for i := range data {
+		out[i] = data[i] ^ x.key
+	}
+
+	return out, nil
+}
+
+func (x *xorCipher) Encrypt(data []byte) ([]byte, error) { return x.xor(data) }
+func (x *xorCipher) Decrypt(data []byte) ([]byte, error) { return x.xor(data) }
+
+func TestEnvelope(t *testing.T) {
+	e := NewEnvelope(&xorCipher{key: 0x42})
+
+	data := bytes.Repeat([]byte("vault snapshot"), 10000)
+	enc, err := e.Encrypt(data)
+	assert.NoError(t, err)
+	assert.False(t, bytes.Contains(enc, []byte("vault snapshot")))
+
+	// data keys are random
+	enc2, err := e.Encrypt(data)
+	assert.NoError(t, err)
+	assert.NotEqual(t, enc, enc2)
+
+	dec, err := e.Decrypt(enc)
+	assert.NoError(t, err)
+	assert.Equal(t, data, dec)
+
+	// empty data
+	enc, err = e.Encrypt(nil)
+	assert.NoError(t, err)
+	dec, err = e.Decrypt(enc)
+	assert.NoError(t, err)
+	assert.Empty(t, dec)
+}
+
+func TestEnvelopeErrors(t *testing.T) {
+	e := NewEnvelope(&xorCipher{key: 0x42})
+
+	enc, err := e.Encrypt([]byte("testdata"))
+	assert.NoError(t, err)
+
+	tampered := append([]byte(nil), enc...)
+	tampered[len(tampered)-1] ^= 0xff
+
+	testCases := [][]byte{
+		[]byte("foobar"),
+		envelopeMagic,
+		append(append([]byte(nil), envelopeMagic...), 0, 0, 1, 0),
+		enc[:len(envelopeMagic)+4+dataKeySize+4],
+		tampered,
+	}
+
+	for _, tc := range testCases {
+		_, err := e.Decrypt(tc)
+		assert.Error(t, err)
+	}
+
+	// wrong key encryption key
+	_, err = NewEnvelope(&xorCipher{key: 0x43}).Decrypt(enc)
+	assert.Error(t, err)
+
+	// key encryption cipher errors
+	e = NewEnvelope(&xorCipher{err: fmt.Errorf("KMS error")})
+	_, err = e.Encrypt([]byte("testdata"))
+	assert.Error(t, err)
+	_, err = e.Decrypt(enc)
+	assert.Error(t, err)
+}
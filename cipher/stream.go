@@ -0,0 +1,255 @@
+package cipher
+
+import (
+	"bufio"
+	gcipher "crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	// segmentSize is the size of plain text segments of envelope streams in bytes
+	segmentSize = 64 * 1024
+	// maxKeySize is the maximum size of encrypted data keys in bytes
+	maxKeySize = 64 * 1024
+)
+
+// streamMagic identifies envelope encrypted streams
+var streamMagic = []byte("VOSTR1")
+
+// EncryptStream returns writer which envelope encrypts the data written to it into w.
+// The data is encrypted in segments so that streams of arbitrary size can be encrypted
+// without holding them in memory. The writer must be closed once all the data has been
+// written to it, otherwise the stream can't be decrypted.
+func (e *Envelope) EncryptStream(w io.Writer) (io.WriteCloser, error) {
+	dataKey, encKey, err := e.newDataKey()
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	// magic | encrypted data key length | encrypted data key | nonce | encrypted segments
+	header := append([]byte(nil), streamMagic...)
+	header = append(header, make([]byte, 4)...)
+	binary.BigEndian.PutUint32(header[len(streamMagic):], uint32(len(encKey)))
+	header = append(header, encKey...)
+	header = append(header, nonce...)
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+
+	return &encryptWriter{
+		w:     w,
+		seg:   newSegmenter(gcm, nonce),
+		plain: make([]byte, 0, segmentSize),
+	}, nil
+}
+
+// DecryptStream returns reader which decrypts envelope encrypted stream read from r
+func (e *Envelope) DecryptStream(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+
+	magic := make([]byte, len(streamMagic)+4)
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic[:len(streamMagic)]) != string(streamMagic) {
+		return nil, fmt.Errorf("invalid envelope: missing header")
+	}
+
+	keyLen := binary.BigEndian.Uint32(magic[len(streamMagic):])
+	if keyLen > maxKeySize {
+		return nil, fmt.Errorf("invalid envelope: invalid data key size: %d", keyLen)
+	}
+
+	encKey := make([]byte, keyLen)
+	if _, err := io.ReadFull(br, encKey); err != nil {
+		return nil, fmt.Errorf("invalid envelope: truncated data key")
+	}
+
+	dataKey, err := e.kek.Decrypt(encKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt data key: %v", err)
+	}
+
+	gcm, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(br, nonce); err != nil {
+		return nil, fmt.Errorf("invalid envelope: missing nonce")
+	}
+
+	return &decryptReader{
+		r:   br,
+		seg: newSegmenter(gcm, nonce),
+		buf: make([]byte, segmentSize+gcm.Overhead()),
+	}, nil
+}
+
+// segmenter seals and opens stream segments
+// Every segment is sealed with a unique nonce derived from the stream nonce
+// and the segment number. The last segment is marked as final so that
+// truncated streams can't be decrypted.
+type segmenter struct {
+	gcm   gcipher.AEAD
+	nonce []byte
+	n     uint64
+}
+
+// newSegmenter returns segmenter which seals the segments with gcm
+func newSegmenter(gcm gcipher.AEAD, nonce []byte) *segmenter {
+	return &segmenter{gcm: gcm, nonce: nonce}
+}
+
+// next returns the nonce and additional data of the next segment
+func (s *segmenter) next(final bool) (nonce, ad []byte) {
+	nonce = append([]byte(nil), s.nonce...)
+	counter := make([]byte, 8)
+	binary.BigEndian.PutUint64(counter, s.n)
+	for i := range counter {
+		nonce[len(nonce)-len(counter)+i] ^= counter[i]
+	}
+	s.n++
+
+	ad = append(append([]byte(nil), streamMagic...), 0)
+	if final {
+		ad[len(ad)-1] = 1
+	}
+
+	return nonce, ad
+}
+
+// seal seals the next segment
+func (s *segmenter) seal(dst, plain []byte, final bool) []byte {
+	nonce, ad := s.next(final)
+	return s.gcm.Seal(dst, nonce, plain, ad)
+}
+
+// open opens the next segment
+func (s *segmenter) open(dst, data []byte, final bool) ([]byte, error) {
+	nonce, ad := s.next(final)
+	return s.gcm.Open(dst, nonce, data, ad)
+}
+
+// encryptWriter encrypts the data written to it in segments
+type encryptWriter struct {
+	w      io.Writer
+	seg    *segmenter
+	plain  []byte
+	sealed []byte
+	closed bool
+}
+
+// Write buffers p and writes all the complete segments
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	if e.closed {
+		return 0, errors.New("write to closed envelope stream")
+	}
+
+	n := len(p)
+	for len(p) > 0 {
+		// the segment is only written once more data follows so that the last segment can be marked as final
+		if len(e.plain) == segmentSize {
+			if err := e.flush(false); err != nil {
+				return n - len(p), err
+			}
+		}
+
+		c := copy(e.plain[len(e.plain):segmentSize], p)
+		e.plain = e.plain[:len(e.plain)+c]
+		p = p[c:]
+	}
+
+	return n, nil
+}
+
+// Close writes the final segment
+func (e *encryptWriter) Close() error {
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+
+	return e.flush(true)
+}
+
+// flush writes the buffered data as a segment
+func (e *encryptWriter) flush(final bool) error {
+	e.sealed = e.seg.seal(e.sealed[:0], e.plain, final)
+	e.plain = e.plain[:0]
+
+	_, err := e.w.Write(e.sealed)
+	return err
+}
+
+// decryptReader decrypts the data read from envelope stream
+type decryptReader struct {
+	r     *bufio.Reader
+	seg   *segmenter
+	buf   []byte
+	plain []byte
+	err   error
+}
+
+// Read reads decrypted data into p
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		d.next()
+	}
+
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+
+	return n, nil
+}
+
+// next decrypts the next segment
+func (d *decryptReader) next() {
+	n, err := io.ReadFull(d.r, d.buf)
+
+	var final bool
+	switch err {
+	case nil:
+		// full segment is the last one unless more data follows
+		if _, perr := d.r.Peek(1); perr != nil {
+			if perr != io.EOF {
+				d.err = perr
+				return
+			}
+			final = true
+		}
+	case io.ErrUnexpectedEOF:
+		final = true
+	case io.EOF:
+		d.err = errors.New("invalid envelope: truncated data")
+		return
+	default:
+		d.err = err
+		return
+	}
+
+	d.plain, err = d.seg.open(d.plain[:0], d.buf[:n], final)
+	if err != nil {
+		d.err = fmt.Errorf("failed to decrypt data: %v", err)
+		return
+	}
+
+	if final {
+		d.err = io.EOF
+	}
+}
@@ -0,0 +1,130 @@
+package cipher
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// encryptStream encrypts data with e writing it in chunks of the given size
+func encryptStream(t *testing.T, e *Envelope, data []byte, chunk int) []byte {
+	var buf bytes.Buffer
+	w, err := e.EncryptStream(&buf)
+	assert.NoError(t, err)
+
+	for len(data) > 0 {
+		n := chunk
+		if n > len(data) {
+			n = len(data)
+		}
+		_, err := w.Write(data[:n])
+		assert.NoError(t, err)
+		data = data[n:]
+	}
+	assert.NoError(t, w.Close())
+
+	return buf.Bytes()
+}
+
+func TestEnvelopeStream(t *testing.T) {
+	e := NewEnvelope(&xorCipher{key: 0x42})
+
+	for _, size := range []int{0, 1, segmentSize - 1, segmentSize, segmentSize + 1, 3*segmentSize + 17} {
+		data := make([]byte, size)
+		_, err := rand.Read(data)
+		assert.NoError(t, err)
+
+		enc := encryptStream(t, e, data, 1000)
+
+		r, err := e.DecryptStream(bytes.NewReader(enc))
+		assert.NoError(t, err, size)
+		dec, err := ioutil.ReadAll(r)
+		assert.NoError(t, err, size)
+		assert.Equal(t, len(data), len(dec), size)
+		assert.True(t, bytes.Equal(data, dec), size)
+	}
+
+	// the stream is not readable as a single envelope and vice versa
+	enc := encryptStream(t, e, []byte("testdata"), 3)
+	_, err := e.Decrypt(enc)
+	assert.Error(t, err)
+	enc, err = e.Encrypt([]byte("testdata"))
+	assert.NoError(t, err)
+	_, err = e.DecryptStream(bytes.NewReader(enc))
+	assert.Error(t, err)
+
+	// closed stream
+	w, err := e.EncryptStream(ioutil.Discard)
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+	_, err = w.Write([]byte("testdata"))
+	assert.Error(t, err)
+}
+
+func TestEnvelopeStreamErrors(t *testing.T) {
+	e := NewEnvelope(&xorCipher{key: 0x42})
+
+	data := bytes.Repeat([]byte("vault snapshot"), segmentSize/5)
+	enc := encryptStream(t, e, data, segmentSize)
+	header := len(streamMagic) + 4 + dataKeySize + 12
+	segment := segmentSize + 16
+
+	tampered := append([]byte(nil), enc...)
+	tampered[header+10] ^= 0xff
+
+	// swapped segments
+	swapped := append([]byte(nil), enc[:header]...)
+	swapped = append(swapped, enc[header+segment:header+2*segment]...)
+	swapped = append(swapped, enc[header:header+segment]...)
+	swapped = append(swapped, enc[header+2*segment:]...)
+
+	testCases := [][]byte{
+		[]byte("foobar"),
+		streamMagic,
+		append(append([]byte(nil), streamMagic...), 0xff, 0xff, 0xff, 0xff),
+		enc[:len(streamMagic)+4+dataKeySize+4],
+		// truncated at the segment boundary
+		enc[:header+segment],
+		// truncated in the middle of a segment
+		enc[:len(enc)-1],
+		tampered,
+		swapped,
+	}
+
+	for i, tc := range testCases {
+		r, err := e.DecryptStream(bytes.NewReader(tc))
+		if err == nil {
+			_, err = ioutil.ReadAll(r)
+		}
+		assert.Error(t, err, i)
+	}
+
+	// wrong key encryption key
+	r, err := NewEnvelope(&xorCipher{key: 0x43}).DecryptStream(bytes.NewReader(enc))
+	assert.NoError(t, err)
+	_, err = ioutil.ReadAll(r)
+	assert.Error(t, err)
+
+	// key encryption cipher errors
+	e = NewEnvelope(&xorCipher{err: fmt.Errorf("KMS error")})
+	_, err = e.EncryptStream(ioutil.Discard)
+	assert.Error(t, err)
+	_, err = e.DecryptStream(bytes.NewReader(enc))
+	assert.Error(t, err)
+
+	// read errors
+	r, err = NewEnvelope(&xorCipher{key: 0x42}).DecryptStream(io.MultiReader(bytes.NewReader(enc[:header]), errReader{}))
+	assert.NoError(t, err)
+	_, err = ioutil.ReadAll(r)
+	assert.EqualError(t, err, "read error")
+}
+
+// errReader fails all reads
+type errReader struct{}
+
+func (errReader) Read(p []byte) (int, error) { return 0, fmt.Errorf("read error") }
@@ -0,0 +1,78 @@
+package aws
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/hashicorp/vault/api"
+	"github.com/milosgajdos/vaultops/auth"
+)
+
+const (
+	// iamServerIDHeader is the header which binds the login request to vault server
+	iamServerIDHeader = "X-Vault-AWS-IAM-Server-ID"
+)
+
+// IAMAuth logs in to vault aws auth method with AWS IAM credentials.
+// It sends vault signed sts:GetCallerIdentity request which vault sends to AWS STS
+// to verify the identity of the caller.
+type IAMAuth struct {
+	client interface {
+		GetCallerIdentityRequest(input *sts.GetCallerIdentityInput) (*request.Request, *sts.GetCallerIdentityOutput)
+	}
+	mount       string
+	role        string
+	headerValue string
+}
+
+// NewIAMAuthWithSession creates new aws auth method mounted at mount which logs in as role
+// with the credentials of session sess and returns it. If headerValue is not empty, it's sent
+// in X-Vault-AWS-IAM-Server-ID header of the signed request. If mount is empty, aws is used.
+// If role is empty, vault uses the role named after the IAM principal.
+func NewIAMAuthWithSession(sess *session.Session, mount, role, headerValue string) *IAMAuth {
+	return &IAMAuth{
+		client:      sts.New(sess),
+		mount:       auth.MountOrDefault(mount, "aws"),
+		role:        role,
+		headerValue: headerValue,
+	}
+}
+
+// Login logs in to vault via client c and returns the secret which holds the client token
+func (a *IAMAuth) Login(c *api.Client) (*api.Secret, error) {
+	req, _ := a.client.GetCallerIdentityRequest(&sts.GetCallerIdentityInput{})
+	if a.headerValue != "" {
+		req.HTTPRequest.Header.Add(iamServerIDHeader, a.headerValue)
+	}
+
+	if err := req.Sign(); err != nil {
+		return nil, fmt.Errorf("failed to sign sts:GetCallerIdentity request: %v", err)
+	}
+
+	headers, err := json.Marshal(req.HTTPRequest.Header)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := ioutil.ReadAll(req.HTTPRequest.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	data := map[string]interface{}{
+		"iam_http_request_method": req.HTTPRequest.Method,
+		"iam_request_url":         base64.StdEncoding.EncodeToString([]byte(req.HTTPRequest.URL.String())),
+		"iam_request_headers":     base64.StdEncoding.EncodeToString(headers),
+		"iam_request_body":        base64.StdEncoding.EncodeToString(body),
+	}
+	if a.role != "" {
+		data["role"] = a.role
+	}
+
+	return auth.Login(c, a.mount, data)
+}
@@ -0,0 +1,76 @@
+package aws
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/hashicorp/vault/api"
+	"github.com/milosgajdos/vaultops/vaulttest"
+	"github.com/stretchr/testify/assert"
+)
+
+// decodeLoginValue decodes base64 encoded value of aws auth method login data
+func decodeLoginValue(t *testing.T, v interface{}) string {
+	s, ok := v.(string)
+	assert.True(t, ok)
+	b, err := base64.StdEncoding.DecodeString(s)
+	assert.NoError(t, err)
+
+	return string(b)
+}
+
+func TestIAMAuth(t *testing.T) {
+	s := vaulttest.NewServer()
+	defer s.Close()
+	s.Initialize(1, 1)
+	s.SetSealed(false)
+
+	var data map[string]interface{}
+	s.EnableAuth("aws/prod", func(d map[string]interface{}) (*vaulttest.Token, error) {
+		data = d
+		return &vaulttest.Token{Policies: []string{"default"}, TTL: time.Hour}, nil
+	})
+
+	config := api.DefaultConfig()
+	config.Address = s.URL
+	c, err := api.NewClient(config)
+	assert.NoError(t, err)
+	c.ClearToken()
+
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String("us-east-1"),
+		Credentials: credentials.NewStaticCredentials("AKIDEXAMPLE", "secret", ""),
+	})
+	assert.NoError(t, err)
+
+	a := NewIAMAuthWithSession(sess, "/aws/prod/", "vaultops", "vault.example.com")
+	secret, err := a.Login(c)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, secret.Auth.ClientToken)
+
+	assert.Equal(t, "vaultops", data["role"])
+	assert.Equal(t, http.MethodPost, data["iam_http_request_method"])
+	assert.Equal(t, "https://sts.amazonaws.com/", decodeLoginValue(t, data["iam_request_url"]))
+	assert.Equal(t, "Action=GetCallerIdentity&Version=2011-06-15", decodeLoginValue(t, data["iam_request_body"]))
+
+	var headers http.Header
+	assert.NoError(t, json.Unmarshal([]byte(decodeLoginValue(t, data["iam_request_headers"])), &headers))
+	assert.Equal(t, "vault.example.com", headers.Get(iamServerIDHeader))
+	assert.Contains(t, headers.Get("Authorization"), "Credential=AKIDEXAMPLE/")
+	assert.Contains(t, headers.Get("Authorization"), "x-vault-aws-iam-server-id")
+
+	// the role is optional and the auth method is mounted at aws by default
+	a = NewIAMAuthWithSession(sess, "", "", "")
+	_, err = a.Login(c)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "no handler for route 'auth/aws/login'")
+
+	a = NewIAMAuthWithSession(sess, "/", "", "")
+	assert.Equal(t, "aws", a.mount)
+}
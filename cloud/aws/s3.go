@@ -2,14 +2,29 @@ package aws
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/milosgajdos/vaultops/store"
 )
 
+// S3Config configures S3 client
+type S3Config struct {
+	// Endpoint is a custom S3 endpoint e.g. MinIO or Ceph URL
+	Endpoint string
+	// ForcePathStyle enables path-style bucket addressing
+	ForcePathStyle bool
+	// SSE is server-side encryption algorithm: AES256 (SSE-S3) or aws:kms (SSE-KMS)
+	SSE string
+	// SSEKMSKeyID is AWS KMS key ID used for SSE-KMS encryption
+	SSEKMSKeyID string
+}
+
 // S3 is AWS S3 client
 type S3 struct {
 	uploader interface {
@@ -18,26 +33,63 @@ type S3 struct {
 	downloader interface {
 		Download(io.WriterAt, *s3.GetObjectInput, ...func(*s3manager.Downloader)) (int64, error)
 	}
-	bucket string
-	key    string
-	ready  bool
-	reader *bytes.Buffer
+	getter interface {
+		GetObject(*s3.GetObjectInput) (*s3.GetObjectOutput, error)
+	}
+	bucket      string
+	key         string
+	sse         string
+	sseKMSKeyID string
+	ready       bool
+	reader      *bytes.Buffer
 }
 
-// NewS3WithSession creates new AWS S3 client with session sess
-func NewS3WithSession(bucket, key string, sess *session.Session) (*S3, error) {
-	uploader := s3manager.NewUploader(sess)
-	downloader := s3manager.NewDownloader(sess)
+// NewS3WithConfig creates new AWS S3 client with session sess configured with c.
+// It returns error if the server-side encryption settings in c are invalid.
+func NewS3WithConfig(bucket, key string, sess *session.Session, c *S3Config) (*S3, error) {
+	if c == nil {
+		c = &S3Config{}
+	}
+
+	sse := c.SSE
+	// KMS key ID implies SSE-KMS encryption
+	if sse == "" && c.SSEKMSKeyID != "" {
+		sse = s3.ServerSideEncryptionAwsKms
+	}
+
+	switch sse {
+	case "", s3.ServerSideEncryptionAes256:
+		if c.SSEKMSKeyID != "" {
+			return nil, fmt.Errorf("SSE KMS key ID requires %s encryption", s3.ServerSideEncryptionAwsKms)
+		}
+	case s3.ServerSideEncryptionAwsKms:
+	default:
+		return nil, fmt.Errorf("unsupported S3 server-side encryption: %s", sse)
+	}
+
+	cfg := aws.NewConfig().WithS3ForcePathStyle(c.ForcePathStyle)
+	if c.Endpoint != "" {
+		cfg = cfg.WithEndpoint(c.Endpoint)
+	}
+	client := s3.New(sess, cfg)
 
 	return &S3{
-		uploader:   uploader,
-		downloader: downloader,
-		bucket:     bucket,
-		key:        key,
-		ready:      false,
+		uploader:    s3manager.NewUploaderWithClient(client),
+		downloader:  s3manager.NewDownloaderWithClient(client),
+		getter:      client,
+		bucket:      bucket,
+		key:         key,
+		sse:         sse,
+		sseKMSKeyID: c.SSEKMSKeyID,
+		ready:       false,
 	}, nil
 }
 
+// NewS3WithSession creates new AWS S3 client with session sess
+func NewS3WithSession(bucket, key string, sess *session.Session) (*S3, error) {
+	return NewS3WithConfig(bucket, key, sess, nil)
+}
+
 // NewS3 returns new AWS S3 client
 func NewS3(bucket, key string) (*S3, error) {
 	sess, err := session.NewSession()
@@ -48,20 +100,73 @@ func NewS3(bucket, key string) (*S3, error) {
 	return NewS3WithSession(bucket, key, sess)
 }
 
+// uploadInput returns the input of body upload
+func (s *S3) uploadInput(body io.Reader) *s3manager.UploadInput {
+	input := &s3manager.UploadInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.key),
+		Body:   body,
+	}
+
+	if s.sse != "" {
+		input.ServerSideEncryption = aws.String(s.sse)
+	}
+
+	if s.sseKMSKeyID != "" {
+		input.SSEKMSKeyId = aws.String(s.sseKMSKeyID)
+	}
+
+	return input
+}
+
 // Write writes data to S3 bucket
 func (s *S3) Write(data []byte) (int, error) {
-	body := bytes.NewBuffer(data)
 	// Upload the file to S3.
-	_, err := s.uploader.Upload(&s3manager.UploadInput{
+	_, err := s.uploader.Upload(s.uploadInput(bytes.NewBuffer(data)))
+	if err != nil {
+		return 0, err
+	}
+
+	return len(data), nil
+}
+
+// countingReader counts the bytes read from the underlying reader
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// WriteFrom replaces the data stored in S3 bucket with the data read from r
+// The data is uploaded in parts, so it's never read into memory as a whole.
+func (s *S3) WriteFrom(r io.Reader) (int64, error) {
+	body := &countingReader{r: r}
+	if _, err := s.uploader.Upload(s.uploadInput(body)); err != nil {
+		return 0, err
+	}
+
+	return body.n, nil
+}
+
+// Open returns reader which reads the data stored in S3 bucket
+func (s *S3) Open() (io.ReadCloser, error) {
+	out, err := s.getter.GetObject(&s3.GetObjectInput{
 		Bucket: aws.String(s.bucket),
 		Key:    aws.String(s.key),
-		Body:   body,
 	})
 	if err != nil {
-		return 0, err
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+			return nil, &store.Error{Code: store.ErrNotFound, Msg: err}
+		}
+		return nil, err
 	}
 
-	return len(data), nil
+	return out.Body, nil
 }
 
 // Read reads data from S3 bucket
@@ -74,6 +179,9 @@ func (s *S3) Read(data []byte) (int, error) {
 			Key:    aws.String(s.key),
 		})
 		if err != nil {
+			if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+				return 0, &store.Error{Code: store.ErrNotFound, Msg: err}
+			}
 			return 0, err
 		}
 
@@ -3,10 +3,16 @@ package aws
 import (
 	"fmt"
 	"io"
+	"io/ioutil"
+	"strings"
 	"testing"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/milosgajdos/vaultops/store"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -16,9 +22,47 @@ func TestNewS3(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestNewS3WithConfig(t *testing.T) {
+	sess, err := session.NewSession()
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		config *S3Config
+		sse    string
+		err    bool
+	}{
+		{nil, "", false},
+		{&S3Config{SSE: s3.ServerSideEncryptionAes256}, s3.ServerSideEncryptionAes256, false},
+		{&S3Config{SSE: s3.ServerSideEncryptionAwsKms, SSEKMSKeyID: "id"}, s3.ServerSideEncryptionAwsKms, false},
+		{&S3Config{SSEKMSKeyID: "id"}, s3.ServerSideEncryptionAwsKms, false},
+		{&S3Config{SSE: s3.ServerSideEncryptionAes256, SSEKMSKeyID: "id"}, "", true},
+		{&S3Config{SSE: "foobar"}, "", true},
+	}
+
+	for _, tc := range testCases {
+		s, err := NewS3WithConfig("bucket", "key", sess, tc.config)
+		if tc.err {
+			assert.Error(t, err)
+			assert.Nil(t, s)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, tc.sse, s.sse)
+	}
+
+	// custom endpoint with path-style addressing
+	endpoint := "http://127.0.0.1:9000"
+	s, err := NewS3WithConfig("bucket", "key", sess, &S3Config{Endpoint: endpoint, ForcePathStyle: true})
+	assert.NoError(t, err)
+	client := s.uploader.(*s3manager.Uploader).S3.(*s3.S3)
+	assert.Equal(t, endpoint, client.Endpoint)
+	assert.True(t, aws.BoolValue(client.Config.S3ForcePathStyle))
+}
+
 type mockS3 struct {
-	UploadFunc   func(*s3manager.UploadInput, ...func(*s3manager.Uploader)) (*s3manager.UploadOutput, error)
-	DownloadFunc func(io.WriterAt, *s3.GetObjectInput, ...func(*s3manager.Downloader)) (int64, error)
+	UploadFunc    func(*s3manager.UploadInput, ...func(*s3manager.Uploader)) (*s3manager.UploadOutput, error)
+	DownloadFunc  func(io.WriterAt, *s3.GetObjectInput, ...func(*s3manager.Downloader)) (int64, error)
+	GetObjectFunc func(*s3.GetObjectInput) (*s3.GetObjectOutput, error)
 }
 
 func (m *mockS3) Upload(in *s3manager.UploadInput, opts ...func(*s3manager.Uploader)) (*s3manager.UploadOutput, error) {
@@ -29,6 +73,10 @@ func (m *mockS3) Download(w io.WriterAt, in *s3.GetObjectInput, opts ...func(*s3
 	return m.DownloadFunc(w, in, opts...)
 }
 
+func (m *mockS3) GetObject(in *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	return m.GetObjectFunc(in)
+}
+
 func TestWrite(t *testing.T) {
 	c := &mockS3{}
 	s3Client := S3{uploader: c, bucket: "bucket", key: "key"}
@@ -42,6 +90,17 @@ func TestWrite(t *testing.T) {
 	_, err := s3Client.Write(data)
 	assert.NoError(t, err)
 
+	// server-side encryption settings are sent with uploads
+	s3Client.sse = s3.ServerSideEncryptionAwsKms
+	s3Client.sseKMSKeyID = "id"
+	c.UploadFunc = func(in *s3manager.UploadInput, opts ...func(*s3manager.Uploader)) (*s3manager.UploadOutput, error) {
+		assert.Equal(t, s3.ServerSideEncryptionAwsKms, aws.StringValue(in.ServerSideEncryption))
+		assert.Equal(t, "id", aws.StringValue(in.SSEKMSKeyId))
+		return &s3manager.UploadOutput{Location: "awsLocation"}, nil
+	}
+	_, err = s3Client.Write(data)
+	assert.NoError(t, err)
+
 	// error uploading
 	c.UploadFunc = func(in *s3manager.UploadInput, opts ...func(*s3manager.Uploader)) (*s3manager.UploadOutput, error) {
 		return nil, fmt.Errorf("Upload Error")
@@ -73,4 +132,56 @@ func TestRead(t *testing.T) {
 	}
 	_, err = s3Client.Read(data)
 	assert.EqualError(t, err, "Download Error")
+
+	// non-existent key
+	c.DownloadFunc = func(w io.WriterAt, in *s3.GetObjectInput, opts ...func(*s3manager.Downloader)) (int64, error) {
+		return 0, awserr.New(s3.ErrCodeNoSuchKey, "The specified key does not exist.", nil)
+	}
+	_, err = s3Client.Read(data)
+	serr, ok := err.(*store.Error)
+	assert.True(t, ok)
+	assert.Equal(t, store.ErrNotFound, serr.Code)
+}
+
+func TestWriteFromOpen(t *testing.T) {
+	c := &mockS3{}
+	s3Client := S3{uploader: c, getter: c, bucket: "bucket", key: "key", sse: s3.ServerSideEncryptionAes256}
+
+	var uploaded []byte
+	c.UploadFunc = func(in *s3manager.UploadInput, opts ...func(*s3manager.Uploader)) (*s3manager.UploadOutput, error) {
+		assert.Equal(t, s3.ServerSideEncryptionAes256, aws.StringValue(in.ServerSideEncryption))
+		var err error
+		uploaded, err = ioutil.ReadAll(in.Body)
+		return &s3manager.UploadOutput{Location: "awsLocation"}, err
+	}
+
+	n, err := s3Client.WriteFrom(strings.NewReader("testdata"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len("testdata")), n)
+	assert.Equal(t, "testdata", string(uploaded))
+
+	c.UploadFunc = func(in *s3manager.UploadInput, opts ...func(*s3manager.Uploader)) (*s3manager.UploadOutput, error) {
+		return nil, fmt.Errorf("Upload Error")
+	}
+	_, err = s3Client.WriteFrom(strings.NewReader("testdata"))
+	assert.EqualError(t, err, "Upload Error")
+
+	c.GetObjectFunc = func(in *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+		assert.Equal(t, "key", aws.StringValue(in.Key))
+		return &s3.GetObjectOutput{Body: ioutil.NopCloser(strings.NewReader("testdata"))}, nil
+	}
+	r, err := s3Client.Open()
+	assert.NoError(t, err)
+	data, err := ioutil.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "testdata", string(data))
+
+	// non-existent key
+	c.GetObjectFunc = func(in *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+		return nil, awserr.New(s3.ErrCodeNoSuchKey, "The specified key does not exist.", nil)
+	}
+	_, err = s3Client.Open()
+	serr, ok := err.(*store.Error)
+	assert.True(t, ok)
+	assert.Equal(t, store.ErrNotFound, serr.Code)
 }
@@ -0,0 +1,141 @@
+package aws
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/milosgajdos/vaultops/store"
+)
+
+const (
+	// DefaultVersionStage is the version stage AWS Secrets Manager assigns to the latest secret version
+	DefaultVersionStage = "AWSCURRENT"
+)
+
+// SecretsManager is AWS Secrets Manager client
+type SecretsManager struct {
+	client interface {
+		GetSecretValue(*secretsmanager.GetSecretValueInput) (*secretsmanager.GetSecretValueOutput, error)
+		PutSecretValue(*secretsmanager.PutSecretValueInput) (*secretsmanager.PutSecretValueOutput, error)
+		CreateSecret(*secretsmanager.CreateSecretInput) (*secretsmanager.CreateSecretOutput, error)
+	}
+	secret   string
+	stage    string
+	kmsKeyID string
+	ready    bool
+	reader   *bytes.Buffer
+}
+
+// NewSecretsManagerWithSession creates new AWS Secrets Manager client with session sess.
+// The data are stored in secret with version stage. If stage is empty DefaultVersionStage is used.
+// If the secret does not exist it is created and encrypted with KMS key kmsKeyID.
+// If kmsKeyID is empty, the default AWS managed key is used.
+// It returns error if the secret name is empty.
+func NewSecretsManagerWithSession(secret, stage, kmsKeyID string, sess *session.Session) (*SecretsManager, error) {
+	if secret == "" {
+		return nil, fmt.Errorf("invalid AWS Secrets Manager secret name: %q", secret)
+	}
+
+	if stage == "" {
+		stage = DefaultVersionStage
+	}
+
+	return &SecretsManager{
+		client:   secretsmanager.New(sess),
+		secret:   secret,
+		stage:    stage,
+		kmsKeyID: kmsKeyID,
+		ready:    false,
+	}, nil
+}
+
+// NewSecretsManager returns new AWS Secrets Manager client
+func NewSecretsManager(secret, stage, kmsKeyID string) (*SecretsManager, error) {
+	sess, err := session.NewSession()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewSecretsManagerWithSession(secret, stage, kmsKeyID, sess)
+}
+
+// Write stores data as a new version of the secret.
+// The secret is created if it does not exist.
+func (s *SecretsManager) Write(data []byte) (int, error) {
+	input := &secretsmanager.PutSecretValueInput{
+		SecretId:     aws.String(s.secret),
+		SecretBinary: data,
+	}
+
+	// AWS moves AWSCURRENT stage to the new version automatically
+	if s.stage != DefaultVersionStage {
+		input.VersionStages = []*string{aws.String(s.stage)}
+	}
+
+	_, err := s.client.PutSecretValue(input)
+	if err == nil {
+		return len(data), nil
+	}
+
+	if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != secretsmanager.ErrCodeResourceNotFoundException {
+		return 0, err
+	}
+
+	create := &secretsmanager.CreateSecretInput{
+		Name:         aws.String(s.secret),
+		SecretBinary: data,
+		Description:  aws.String("Vault keys managed by vaultops"),
+	}
+
+	if s.kmsKeyID != "" {
+		create.KmsKeyId = aws.String(s.kmsKeyID)
+	}
+
+	if _, err := s.client.CreateSecret(create); err != nil {
+		return 0, err
+	}
+
+	// new secrets are always labeled as AWSCURRENT
+	if s.stage != DefaultVersionStage {
+		if _, err := s.client.PutSecretValue(input); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(data), nil
+}
+
+// Read reads data from the secret version labeled with the configured version stage
+func (s *SecretsManager) Read(data []byte) (int, error) {
+	if !s.ready {
+		out, err := s.client.GetSecretValue(&secretsmanager.GetSecretValueInput{
+			SecretId:     aws.String(s.secret),
+			VersionStage: aws.String(s.stage),
+		})
+		if err != nil {
+			if aerr, ok := err.(awserr.Error); ok && aerr.Code() == secretsmanager.ErrCodeResourceNotFoundException {
+				return 0, &store.Error{Code: store.ErrNotFound, Msg: err}
+			}
+			return 0, err
+		}
+
+		secret := out.SecretBinary
+		if secret == nil {
+			secret = []byte(aws.StringValue(out.SecretString))
+		}
+
+		s.reader = bytes.NewBuffer(secret)
+		s.ready = true
+	}
+
+	n, err := s.reader.Read(data)
+	if err != nil {
+		s.ready = false
+	}
+
+	return n, err
+}
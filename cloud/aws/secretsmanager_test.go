@@ -0,0 +1,144 @@
+package aws
+
+import (
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/milosgajdos/vaultops/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSecretsManager(t *testing.T) {
+	s, err := NewSecretsManager("", "", "")
+	assert.Nil(t, s)
+	assert.Error(t, err)
+
+	s, err = NewSecretsManager("secret", "", "")
+	assert.NotNil(t, s)
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultVersionStage, s.stage)
+}
+
+type mockSecretsManager struct {
+	GetSecretValueFunc func(*secretsmanager.GetSecretValueInput) (*secretsmanager.GetSecretValueOutput, error)
+	PutSecretValueFunc func(*secretsmanager.PutSecretValueInput) (*secretsmanager.PutSecretValueOutput, error)
+	CreateSecretFunc   func(*secretsmanager.CreateSecretInput) (*secretsmanager.CreateSecretOutput, error)
+}
+
+func (m *mockSecretsManager) GetSecretValue(in *secretsmanager.GetSecretValueInput) (*secretsmanager.GetSecretValueOutput, error) {
+	return m.GetSecretValueFunc(in)
+}
+
+func (m *mockSecretsManager) PutSecretValue(in *secretsmanager.PutSecretValueInput) (*secretsmanager.PutSecretValueOutput, error) {
+	return m.PutSecretValueFunc(in)
+}
+
+func (m *mockSecretsManager) CreateSecret(in *secretsmanager.CreateSecretInput) (*secretsmanager.CreateSecretOutput, error) {
+	return m.CreateSecretFunc(in)
+}
+
+func TestSecretsManagerWrite(t *testing.T) {
+	c := &mockSecretsManager{}
+	sm := &SecretsManager{client: c, secret: "secret", stage: DefaultVersionStage, kmsKeyID: "key"}
+	data := []byte("testdata")
+
+	// existing secret gets a new version
+	c.PutSecretValueFunc = func(in *secretsmanager.PutSecretValueInput) (*secretsmanager.PutSecretValueOutput, error) {
+		assert.Equal(t, "secret", aws.StringValue(in.SecretId))
+		assert.Equal(t, data, in.SecretBinary)
+		assert.Nil(t, in.VersionStages)
+		return &secretsmanager.PutSecretValueOutput{}, nil
+	}
+	n, err := sm.Write(data)
+	assert.NoError(t, err)
+	assert.Equal(t, len(data), n)
+
+	// missing secret is created
+	var created bool
+	c.PutSecretValueFunc = func(in *secretsmanager.PutSecretValueInput) (*secretsmanager.PutSecretValueOutput, error) {
+		return nil, awserr.New(secretsmanager.ErrCodeResourceNotFoundException, "not found", nil)
+	}
+	c.CreateSecretFunc = func(in *secretsmanager.CreateSecretInput) (*secretsmanager.CreateSecretOutput, error) {
+		assert.Equal(t, "secret", aws.StringValue(in.Name))
+		assert.Equal(t, "key", aws.StringValue(in.KmsKeyId))
+		created = true
+		return &secretsmanager.CreateSecretOutput{}, nil
+	}
+	n, err = sm.Write(data)
+	assert.NoError(t, err)
+	assert.Equal(t, len(data), n)
+	assert.True(t, created)
+
+	// custom version stage is labeled on the new version
+	sm.stage = "vaultops"
+	var puts int
+	c.PutSecretValueFunc = func(in *secretsmanager.PutSecretValueInput) (*secretsmanager.PutSecretValueOutput, error) {
+		puts++
+		assert.Equal(t, []*string{aws.String("vaultops")}, in.VersionStages)
+		if puts == 1 {
+			return nil, awserr.New(secretsmanager.ErrCodeResourceNotFoundException, "not found", nil)
+		}
+		return &secretsmanager.PutSecretValueOutput{}, nil
+	}
+	_, err = sm.Write(data)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, puts)
+
+	// other errors are returned
+	c.PutSecretValueFunc = func(in *secretsmanager.PutSecretValueInput) (*secretsmanager.PutSecretValueOutput, error) {
+		return nil, fmt.Errorf("Put Error")
+	}
+	n, err = sm.Write(data)
+	assert.EqualError(t, err, "Put Error")
+	assert.Equal(t, 0, n)
+
+	c.PutSecretValueFunc = func(in *secretsmanager.PutSecretValueInput) (*secretsmanager.PutSecretValueOutput, error) {
+		return nil, awserr.New(secretsmanager.ErrCodeResourceNotFoundException, "not found", nil)
+	}
+	c.CreateSecretFunc = func(in *secretsmanager.CreateSecretInput) (*secretsmanager.CreateSecretOutput, error) {
+		return nil, fmt.Errorf("Create Error")
+	}
+	_, err = sm.Write(data)
+	assert.EqualError(t, err, "Create Error")
+}
+
+func TestSecretsManagerRead(t *testing.T) {
+	c := &mockSecretsManager{}
+	sm := &SecretsManager{client: c, secret: "secret", stage: "vaultops"}
+	data := []byte("testdata")
+
+	c.GetSecretValueFunc = func(in *secretsmanager.GetSecretValueInput) (*secretsmanager.GetSecretValueOutput, error) {
+		assert.Equal(t, "vaultops", aws.StringValue(in.VersionStage))
+		return &secretsmanager.GetSecretValueOutput{SecretBinary: data}, nil
+	}
+	out, err := ioutil.ReadAll(sm)
+	assert.NoError(t, err)
+	assert.Equal(t, data, out)
+
+	// secrets created outside of vaultops might be strings
+	c.GetSecretValueFunc = func(in *secretsmanager.GetSecretValueInput) (*secretsmanager.GetSecretValueOutput, error) {
+		return &secretsmanager.GetSecretValueOutput{SecretString: aws.String(string(data))}, nil
+	}
+	out, err = ioutil.ReadAll(sm)
+	assert.NoError(t, err)
+	assert.Equal(t, data, out)
+
+	c.GetSecretValueFunc = func(in *secretsmanager.GetSecretValueInput) (*secretsmanager.GetSecretValueOutput, error) {
+		return nil, awserr.New(secretsmanager.ErrCodeResourceNotFoundException, "not found", nil)
+	}
+	_, err = sm.Read(make([]byte, 5))
+	assert.Error(t, err)
+	serr, ok := err.(*store.Error)
+	assert.True(t, ok)
+	assert.Equal(t, store.ErrNotFound, serr.Code)
+
+	c.GetSecretValueFunc = func(in *secretsmanager.GetSecretValueInput) (*secretsmanager.GetSecretValueOutput, error) {
+		return nil, fmt.Errorf("Get Error")
+	}
+	_, err = sm.Read(make([]byte, 5))
+	assert.EqualError(t, err, "Get Error")
+}
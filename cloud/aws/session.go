@@ -0,0 +1,54 @@
+package aws
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// Config configures AWS client session
+type Config struct {
+	// Region is AWS region
+	Region string
+	// Profile is the name of AWS shared config profile
+	Profile string
+	// RoleARN is ARN of IAM role to assume
+	RoleARN string
+	// ExternalID is the external ID used when assuming RoleARN
+	ExternalID string
+}
+
+// NewSession creates new AWS session configured with c and returns it.
+// If c is nil the session is created using the default AWS SDK settings.
+func NewSession(c *Config) (*session.Session, error) {
+	if c == nil {
+		return session.NewSession()
+	}
+
+	opts := session.Options{}
+	if c.Region != "" {
+		opts.Config.Region = aws.String(c.Region)
+	}
+
+	// profiles are read from shared config files
+	if c.Profile != "" {
+		opts.Profile = c.Profile
+		opts.SharedConfigState = session.SharedConfigEnable
+	}
+
+	sess, err := session.NewSessionWithOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.RoleARN != "" {
+		creds := stscreds.NewCredentials(sess, c.RoleARN, func(p *stscreds.AssumeRoleProvider) {
+			if c.ExternalID != "" {
+				p.ExternalID = aws.String(c.ExternalID)
+			}
+		})
+		sess = sess.Copy(&aws.Config{Credentials: creds})
+	}
+
+	return sess, nil
+}
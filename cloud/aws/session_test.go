@@ -0,0 +1,22 @@
+package aws
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSession(t *testing.T) {
+	sess, err := NewSession(nil)
+	assert.NoError(t, err)
+	assert.NotNil(t, sess)
+
+	sess, err = NewSession(&Config{Region: "eu-west-1"})
+	assert.NoError(t, err)
+	assert.Equal(t, "eu-west-1", aws.StringValue(sess.Config.Region))
+
+	sess, err = NewSession(&Config{Region: "eu-west-1", RoleARN: "arn:aws:iam::123456789012:role/vaultops", ExternalID: "ext"})
+	assert.NoError(t, err)
+	assert.NotNil(t, sess.Config.Credentials)
+}
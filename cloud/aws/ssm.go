@@ -0,0 +1,111 @@
+package aws
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/milosgajdos/vaultops/store"
+)
+
+// SSM is AWS SSM Parameter Store client
+// It stores the data base64 encoded in SecureString parameter.
+type SSM struct {
+	client interface {
+		GetParameter(*ssm.GetParameterInput) (*ssm.GetParameterOutput, error)
+		PutParameter(*ssm.PutParameterInput) (*ssm.PutParameterOutput, error)
+	}
+	name     string
+	kmsKeyID string
+	ready    bool
+	reader   *bytes.Buffer
+}
+
+// NewSSMWithSession creates new AWS SSM Parameter Store client with session sess.
+// The data are stored in SecureString parameter name encrypted with KMS key kmsKeyID.
+// If kmsKeyID is empty, the default AWS managed key is used.
+// It returns error if the parameter name is empty.
+func NewSSMWithSession(name, kmsKeyID string, sess *session.Session) (*SSM, error) {
+	if name == "" {
+		return nil, fmt.Errorf("invalid AWS SSM parameter name: %q", name)
+	}
+
+	return &SSM{
+		client:   ssm.New(sess),
+		name:     name,
+		kmsKeyID: kmsKeyID,
+		ready:    false,
+	}, nil
+}
+
+// NewSSM returns new AWS SSM Parameter Store client
+func NewSSM(name, kmsKeyID string) (*SSM, error) {
+	sess, err := session.NewSession()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewSSMWithSession(name, kmsKeyID, sess)
+}
+
+// Write writes data to SSM parameter
+func (s *SSM) Write(data []byte) (int, error) {
+	input := &ssm.PutParameterInput{
+		Name:      aws.String(s.name),
+		Type:      aws.String(ssm.ParameterTypeSecureString),
+		Value:     aws.String(base64.StdEncoding.EncodeToString(data)),
+		Overwrite: aws.Bool(true),
+		// switch to advanced tier only when the value does not fit standard one
+		Tier:        aws.String(ssm.ParameterTierIntelligentTiering),
+		Description: aws.String("Vault keys managed by vaultops"),
+	}
+
+	if s.kmsKeyID != "" {
+		input.KeyId = aws.String(s.kmsKeyID)
+	}
+
+	if _, err := s.client.PutParameter(input); err != nil {
+		return 0, err
+	}
+
+	return len(data), nil
+}
+
+// Read reads data from SSM parameter
+func (s *SSM) Read(data []byte) (int, error) {
+	if !s.ready {
+		out, err := s.client.GetParameter(&ssm.GetParameterInput{
+			Name:           aws.String(s.name),
+			WithDecryption: aws.Bool(true),
+		})
+		if err != nil {
+			if aerr, ok := err.(awserr.Error); ok && aerr.Code() == ssm.ErrCodeParameterNotFound {
+				return 0, &store.Error{Code: store.ErrNotFound, Msg: err}
+			}
+			return 0, err
+		}
+
+		if out.Parameter == nil {
+			return 0, &store.Error{Code: store.ErrNotFound, Msg: fmt.Errorf("empty parameter %s", s.name)}
+		}
+
+		value, err := base64.StdEncoding.DecodeString(aws.StringValue(out.Parameter.Value))
+		if err != nil {
+			return 0, fmt.Errorf("failed to decode parameter %s: %v", s.name, err)
+		}
+
+		s.reader = bytes.NewBuffer(value)
+		s.ready = true
+	}
+
+	n, err := s.reader.Read(data)
+	if err != nil {
+		s.ready = false
+	}
+
+	return n, err
+}
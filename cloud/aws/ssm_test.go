@@ -0,0 +1,99 @@
+package aws
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/milosgajdos/vaultops/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSSM(t *testing.T) {
+	s, err := NewSSM("", "")
+	assert.Nil(t, s)
+	assert.Error(t, err)
+
+	s, err = NewSSM("/vaultops/keys", "")
+	assert.NotNil(t, s)
+	assert.NoError(t, err)
+}
+
+type mockSSM struct {
+	GetParameterFunc func(*ssm.GetParameterInput) (*ssm.GetParameterOutput, error)
+	PutParameterFunc func(*ssm.PutParameterInput) (*ssm.PutParameterOutput, error)
+}
+
+func (m *mockSSM) GetParameter(in *ssm.GetParameterInput) (*ssm.GetParameterOutput, error) {
+	return m.GetParameterFunc(in)
+}
+
+func (m *mockSSM) PutParameter(in *ssm.PutParameterInput) (*ssm.PutParameterOutput, error) {
+	return m.PutParameterFunc(in)
+}
+
+func TestSSMWrite(t *testing.T) {
+	c := &mockSSM{}
+	s := &SSM{client: c, name: "/vaultops/keys", kmsKeyID: "key"}
+	data := []byte("testdata")
+
+	c.PutParameterFunc = func(in *ssm.PutParameterInput) (*ssm.PutParameterOutput, error) {
+		assert.Equal(t, "/vaultops/keys", aws.StringValue(in.Name))
+		assert.Equal(t, ssm.ParameterTypeSecureString, aws.StringValue(in.Type))
+		assert.Equal(t, base64.StdEncoding.EncodeToString(data), aws.StringValue(in.Value))
+		assert.Equal(t, "key", aws.StringValue(in.KeyId))
+		assert.True(t, aws.BoolValue(in.Overwrite))
+		return &ssm.PutParameterOutput{}, nil
+	}
+	n, err := s.Write(data)
+	assert.NoError(t, err)
+	assert.Equal(t, len(data), n)
+
+	c.PutParameterFunc = func(in *ssm.PutParameterInput) (*ssm.PutParameterOutput, error) {
+		return nil, fmt.Errorf("Put Error")
+	}
+	n, err = s.Write(data)
+	assert.EqualError(t, err, "Put Error")
+	assert.Equal(t, 0, n)
+}
+
+func TestSSMRead(t *testing.T) {
+	c := &mockSSM{}
+	s := &SSM{client: c, name: "/vaultops/keys"}
+	data := []byte("testdata")
+
+	c.GetParameterFunc = func(in *ssm.GetParameterInput) (*ssm.GetParameterOutput, error) {
+		assert.True(t, aws.BoolValue(in.WithDecryption))
+		return &ssm.GetParameterOutput{Parameter: &ssm.Parameter{
+			Value: aws.String(base64.StdEncoding.EncodeToString(data)),
+		}}, nil
+	}
+	out, err := ioutil.ReadAll(s)
+	assert.NoError(t, err)
+	assert.Equal(t, data, out)
+
+	// invalid parameter value
+	c.GetParameterFunc = func(in *ssm.GetParameterInput) (*ssm.GetParameterOutput, error) {
+		return &ssm.GetParameterOutput{Parameter: &ssm.Parameter{Value: aws.String("#$%")}}, nil
+	}
+	_, err = s.Read(make([]byte, 5))
+	assert.Error(t, err)
+
+	c.GetParameterFunc = func(in *ssm.GetParameterInput) (*ssm.GetParameterOutput, error) {
+		return nil, awserr.New(ssm.ErrCodeParameterNotFound, "not found", nil)
+	}
+	_, err = s.Read(make([]byte, 5))
+	serr, ok := err.(*store.Error)
+	assert.True(t, ok)
+	assert.Equal(t, store.ErrNotFound, serr.Code)
+
+	c.GetParameterFunc = func(in *ssm.GetParameterInput) (*ssm.GetParameterOutput, error) {
+		return nil, fmt.Errorf("Get Error")
+	}
+	_, err = s.Read(make([]byte, 5))
+	assert.EqualError(t, err, "Get Error")
+}
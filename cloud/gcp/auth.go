@@ -0,0 +1,93 @@
+package gcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/milosgajdos/vaultops/auth"
+	iam "google.golang.org/api/iamcredentials/v1"
+)
+
+const (
+	// serviceAccountPath is GCP IAM service account resource name
+	serviceAccountPath = "projects/-/serviceAccounts/%s"
+	// jwtTTL is the time to live of the login JWT
+	jwtTTL = 15 * time.Minute
+)
+
+// jwtSigner signs JWT with GCP service account
+type jwtSigner interface {
+	// SignJWT signs JWT payload with the service account and returns the signed JWT
+	SignJWT(serviceAccount, payload string) (string, error)
+}
+
+// IAMAuth logs in to vault gcp auth method with JWT signed by GCP service account.
+// The JWT is signed via GCP IAM Credentials API with the application default credentials.
+type IAMAuth struct {
+	signer         jwtSigner
+	mount          string
+	role           string
+	serviceAccount string
+}
+
+// NewIAMAuth creates new gcp auth method mounted at mount which logs in as role with JWT signed
+// by serviceAccount and returns it. If mount is empty, gcp is used. It returns error if either
+// role or serviceAccount is empty or if the IAM Credentials client fails to be created.
+func NewIAMAuth(mount, role, serviceAccount string) (*IAMAuth, error) {
+	if role == "" || serviceAccount == "" {
+		return nil, fmt.Errorf("invalid GCP IAM login: role %q, service account %q", role, serviceAccount)
+	}
+
+	svc, err := iam.NewService(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create GCP IAM Credentials client: %s", err.Error())
+	}
+
+	return &IAMAuth{
+		signer:         &iamCredentialsService{svc: svc},
+		mount:          auth.MountOrDefault(mount, "gcp"),
+		role:           role,
+		serviceAccount: serviceAccount,
+	}, nil
+}
+
+// Login logs in to vault via client c and returns the secret which holds the client token
+func (a *IAMAuth) Login(c *api.Client) (*api.Secret, error) {
+	payload, err := json.Marshal(map[string]interface{}{
+		"sub": a.serviceAccount,
+		"aud": "vault/" + a.role,
+		"exp": time.Now().Add(jwtTTL).Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	jwt, err := a.signer.SignJWT(a.serviceAccount, string(payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign JWT: %v", err)
+	}
+
+	return auth.Login(c, a.mount, map[string]interface{}{
+		"role": a.role,
+		"jwt":  jwt,
+	})
+}
+
+// iamCredentialsService implements jwtSigner using GCP IAM Credentials REST API
+type iamCredentialsService struct {
+	svc *iam.Service
+}
+
+func (s *iamCredentialsService) SignJWT(serviceAccount, payload string) (string, error) {
+	resp, err := s.svc.Projects.ServiceAccounts.SignJwt(fmt.Sprintf(serviceAccountPath, serviceAccount), &iam.SignJwtRequest{
+		Payload: payload,
+	}).Do()
+	if err != nil {
+		return "", err
+	}
+
+	return resp.SignedJwt, nil
+}
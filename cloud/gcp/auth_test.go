@@ -0,0 +1,74 @@
+package gcp
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/milosgajdos/vaultops/vaulttest"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockSigner "signs" JWT by returning its payload
+type mockSigner struct {
+	serviceAccount string
+	err            error
+}
+
+func (m *mockSigner) SignJWT(serviceAccount, payload string) (string, error) {
+	m.serviceAccount = serviceAccount
+	return payload, m.err
+}
+
+func TestNewIAMAuth(t *testing.T) {
+	a, err := NewIAMAuth("", "", "vaultops@project.iam.gserviceaccount.com")
+	assert.Nil(t, a)
+	assert.Error(t, err)
+
+	a, err = NewIAMAuth("", "vaultops", "")
+	assert.Nil(t, a)
+	assert.Error(t, err)
+}
+
+func TestIAMAuth(t *testing.T) {
+	s := vaulttest.NewServer()
+	defer s.Close()
+	s.Initialize(1, 1)
+	s.SetSealed(false)
+
+	var data map[string]interface{}
+	s.EnableAuth("gcp", func(d map[string]interface{}) (*vaulttest.Token, error) {
+		data = d
+		return &vaulttest.Token{Policies: []string{"default"}, TTL: time.Hour}, nil
+	})
+
+	config := api.DefaultConfig()
+	config.Address = s.URL
+	c, err := api.NewClient(config)
+	assert.NoError(t, err)
+	c.ClearToken()
+
+	signer := &mockSigner{}
+	a := &IAMAuth{signer: signer, mount: "gcp", role: "vaultops", serviceAccount: "vaultops@project.iam.gserviceaccount.com"}
+	secret, err := a.Login(c)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, secret.Auth.ClientToken)
+	assert.Equal(t, "vaultops@project.iam.gserviceaccount.com", signer.serviceAccount)
+	assert.Equal(t, "vaultops", data["role"])
+
+	var claims struct {
+		Sub string `json:"sub"`
+		Aud string `json:"aud"`
+		Exp int64  `json:"exp"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(data["jwt"].(string)), &claims))
+	assert.Equal(t, "vaultops@project.iam.gserviceaccount.com", claims.Sub)
+	assert.Equal(t, "vault/vaultops", claims.Aud)
+	assert.InDelta(t, time.Now().Add(jwtTTL).Unix(), claims.Exp, 5)
+
+	signer.err = errors.New("permission denied")
+	_, err = a.Login(c)
+	assert.EqualError(t, err, "failed to sign JWT: permission denied")
+}
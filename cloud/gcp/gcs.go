@@ -2,8 +2,10 @@ package gcp
 
 import (
 	"context"
+	"io"
 
 	"cloud.google.com/go/storage"
+	"github.com/milosgajdos/vaultops/store"
 )
 
 // GCS is Google Cloud Storage client
@@ -34,9 +36,20 @@ func NewGCS(bucket, key string) (*GCS, error) {
 func (s *GCS) Write(data []byte) (int, error) {
 	ctx := context.Background()
 	w := s.client.Bucket(s.bucket).Object(s.key).NewWriter(ctx)
-	defer w.Close()
 
-	return w.Write(data)
+	n, err := w.Write(data)
+	if err != nil {
+		// nolint:errcheck
+		w.Close()
+		return n, err
+	}
+
+	// the object is only uploaded once the writer is closed
+	if err := w.Close(); err != nil {
+		return 0, err
+	}
+
+	return n, nil
 }
 
 // Read reads data from GCS bucket
@@ -46,6 +59,9 @@ func (s *GCS) Read(data []byte) (int, error) {
 		ctx := context.Background()
 		s.reader, err = s.client.Bucket(s.bucket).Object(s.key).NewReader(ctx)
 		if err != nil {
+			if err == storage.ErrObjectNotExist {
+				return 0, &store.Error{Code: store.ErrNotFound, Msg: err}
+			}
 			return 0, err
 		}
 		s.readReady = true
@@ -58,3 +74,37 @@ func (s *GCS) Read(data []byte) (int, error) {
 
 	return n, err
 }
+
+// WriteFrom replaces the data stored in GCS bucket with the data read from r
+func (s *GCS) WriteFrom(r io.Reader) (int64, error) {
+	ctx := context.Background()
+	w := s.client.Bucket(s.bucket).Object(s.key).NewWriter(ctx)
+
+	n, err := io.Copy(w, r)
+	if err != nil {
+		// nolint:errcheck
+		w.Close()
+		return n, err
+	}
+
+	// the object is only uploaded once the writer is closed
+	if err := w.Close(); err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+// Open returns reader which reads the data stored in GCS bucket
+func (s *GCS) Open() (io.ReadCloser, error) {
+	ctx := context.Background()
+	r, err := s.client.Bucket(s.bucket).Object(s.key).NewReader(ctx)
+	if err != nil {
+		if err == storage.ErrObjectNotExist {
+			return nil, &store.Error{Code: store.ErrNotFound, Msg: err}
+		}
+		return nil, err
+	}
+
+	return r, nil
+}
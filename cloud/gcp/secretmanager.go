@@ -0,0 +1,199 @@
+package gcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+
+	"github.com/milosgajdos/vaultops/store"
+	"google.golang.org/api/googleapi"
+	sm "google.golang.org/api/secretmanager/v1"
+)
+
+const (
+	// LatestVersion is an alias of the most recently created secret version
+	LatestVersion = "latest"
+	// secretPath is GCP Secret Manager secret resource name
+	secretPath = "projects/%s/secrets/%s"
+	// versionEnabled is the state of enabled secret version
+	versionEnabled = "ENABLED"
+)
+
+// secretManager is a subset of GCP Secret Manager API used by SecretManager store
+type secretManager interface {
+	// Create creates a new secret with automatic replication in project
+	Create(project, secret string) error
+	// AddVersion adds a new secret version with payload data and returns its name
+	AddVersion(secret string, data []byte) (string, error)
+	// Access returns payload of the secret version
+	Access(version string) ([]byte, error)
+	// List returns the names of secret versions in state
+	List(secret, state string) ([]string, error)
+	// Disable disables the secret version
+	Disable(version string) error
+}
+
+// SecretManager is GCP Secret Manager client
+// Every Write stores the data as a new secret version.
+type SecretManager struct {
+	client     secretManager
+	project    string
+	secret     string
+	version    string
+	disableOld bool
+	ready      bool
+	reader     *bytes.Buffer
+}
+
+// NewSecretManager creates new GCP Secret Manager client which stores the data in secret in project.
+// Read reads the data from the given secret version; if version is empty LatestVersion is read.
+// If disableOld is true all the previous secret versions are disabled when a new version is written.
+// It returns error if either project or secret is empty or if the Secret Manager client fails to be created.
+func NewSecretManager(project, secret, version string, disableOld bool) (*SecretManager, error) {
+	if project == "" || secret == "" {
+		return nil, fmt.Errorf("invalid GCP Secret Manager secret: project %q, secret %q", project, secret)
+	}
+
+	if version == "" {
+		version = LatestVersion
+	}
+
+	svc, err := sm.NewService(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create GCP Secret Manager client: %s", err.Error())
+	}
+
+	return &SecretManager{
+		client:     &secretManagerService{svc: svc},
+		project:    project,
+		secret:     secret,
+		version:    version,
+		disableOld: disableOld,
+		ready:      false,
+	}, nil
+}
+
+// Write writes data to a new secret version.
+// The secret is created if it does not exist.
+func (s *SecretManager) Write(data []byte) (int, error) {
+	name := fmt.Sprintf(secretPath, s.project, s.secret)
+
+	version, err := s.client.AddVersion(name, data)
+	if isNotFound(err) {
+		if err := s.client.Create(s.project, s.secret); err != nil {
+			return 0, fmt.Errorf("Failed to create secret %s: %s", name, err.Error())
+		}
+		version, err = s.client.AddVersion(name, data)
+	}
+
+	if err != nil {
+		return 0, fmt.Errorf("Failed to add version of secret %s: %s", name, err.Error())
+	}
+
+	if s.disableOld {
+		versions, err := s.client.List(name, versionEnabled)
+		if err != nil {
+			return 0, fmt.Errorf("Failed to list versions of secret %s: %s", name, err.Error())
+		}
+
+		for _, v := range versions {
+			if v == version {
+				continue
+			}
+
+			if err := s.client.Disable(v); err != nil {
+				return 0, fmt.Errorf("Failed to disable secret version %s: %s", v, err.Error())
+			}
+		}
+	}
+
+	return len(data), nil
+}
+
+// Read reads data from the configured secret version
+func (s *SecretManager) Read(data []byte) (int, error) {
+	if !s.ready {
+		name := fmt.Sprintf(secretPath, s.project, s.secret) + "/versions/" + s.version
+
+		payload, err := s.client.Access(name)
+		if err != nil {
+			if isNotFound(err) {
+				return 0, &store.Error{Code: store.ErrNotFound, Msg: err}
+			}
+			return 0, fmt.Errorf("Failed to access secret version %s: %s", name, err.Error())
+		}
+
+		s.reader = bytes.NewBuffer(payload)
+		s.ready = true
+	}
+
+	n, err := s.reader.Read(data)
+	if err != nil {
+		s.ready = false
+	}
+
+	return n, err
+}
+
+// isNotFound returns true if err is GCP API not found error
+func isNotFound(err error) bool {
+	gerr, ok := err.(*googleapi.Error)
+
+	return ok && gerr.Code == http.StatusNotFound
+}
+
+// secretManagerService implements secretManager using GCP Secret Manager REST API
+type secretManagerService struct {
+	svc *sm.Service
+}
+
+func (s *secretManagerService) Create(project, secret string) error {
+	_, err := s.svc.Projects.Secrets.Create("projects/"+project, &sm.Secret{
+		Replication: &sm.Replication{Automatic: &sm.Automatic{}},
+		Labels:      map[string]string{"tool": "vaultops"},
+	}).SecretId(secret).Do()
+
+	return err
+}
+
+func (s *secretManagerService) AddVersion(secret string, data []byte) (string, error) {
+	v, err := s.svc.Projects.Secrets.AddVersion(secret, &sm.AddSecretVersionRequest{
+		Payload: &sm.SecretPayload{Data: base64.StdEncoding.EncodeToString(data)},
+	}).Do()
+	if err != nil {
+		return "", err
+	}
+
+	return v.Name, nil
+}
+
+func (s *secretManagerService) Access(version string) ([]byte, error) {
+	resp, err := s.svc.Projects.Secrets.Versions.Access(version).Do()
+	if err != nil {
+		return nil, err
+	}
+
+	return base64.StdEncoding.DecodeString(resp.Payload.Data)
+}
+
+func (s *secretManagerService) List(secret, state string) ([]string, error) {
+	var versions []string
+	err := s.svc.Projects.Secrets.Versions.List(secret).Pages(context.Background(), func(resp *sm.ListSecretVersionsResponse) error {
+		for _, v := range resp.Versions {
+			if v.State == state {
+				versions = append(versions, v.Name)
+			}
+		}
+		return nil
+	})
+
+	return versions, err
+}
+
+func (s *secretManagerService) Disable(version string) error {
+	_, err := s.svc.Projects.Secrets.Versions.Disable(version, &sm.DisableSecretVersionRequest{}).Do()
+
+	return err
+}
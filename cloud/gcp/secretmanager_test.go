@@ -0,0 +1,136 @@
+package gcp
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/milosgajdos/vaultops/store"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/googleapi"
+)
+
+func TestNewSecretManager(t *testing.T) {
+	s, err := NewSecretManager("", "secret", "", false)
+	assert.Nil(t, s)
+	assert.Error(t, err)
+
+	s, err = NewSecretManager("project", "", "", false)
+	assert.Nil(t, s)
+	assert.Error(t, err)
+}
+
+// mockSecretManager is in-memory secretManager
+type mockSecretManager struct {
+	secrets  map[string][]string
+	payloads map[string][]byte
+	disabled map[string]bool
+	err      error
+}
+
+func newMockSecretManager() *mockSecretManager {
+	return &mockSecretManager{
+		secrets:  make(map[string][]string),
+		payloads: make(map[string][]byte),
+		disabled: make(map[string]bool),
+	}
+}
+
+func (m *mockSecretManager) Create(project, secret string) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.secrets[fmt.Sprintf(secretPath, project, secret)] = []string{}
+	return nil
+}
+
+func (m *mockSecretManager) AddVersion(secret string, data []byte) (string, error) {
+	if m.err != nil {
+		return "", m.err
+	}
+	versions, ok := m.secrets[secret]
+	if !ok {
+		return "", &googleapi.Error{Code: http.StatusNotFound}
+	}
+	name := fmt.Sprintf("%s/versions/%d", secret, len(versions)+1)
+	m.secrets[secret] = append(versions, name)
+	m.payloads[name] = data
+	m.payloads[secret+"/versions/"+LatestVersion] = data
+	return name, nil
+}
+
+func (m *mockSecretManager) Access(version string) ([]byte, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	data, ok := m.payloads[version]
+	if !ok {
+		return nil, &googleapi.Error{Code: http.StatusNotFound}
+	}
+	return data, nil
+}
+
+func (m *mockSecretManager) List(secret, state string) ([]string, error) {
+	var versions []string
+	for _, v := range m.secrets[secret] {
+		if !m.disabled[v] {
+			versions = append(versions, v)
+		}
+	}
+	return versions, nil
+}
+
+func (m *mockSecretManager) Disable(version string) error {
+	m.disabled[version] = true
+	return nil
+}
+
+func TestSecretManagerWriteRead(t *testing.T) {
+	c := newMockSecretManager()
+	s := &SecretManager{client: c, project: "project", secret: "secret", version: LatestVersion}
+	name := fmt.Sprintf(secretPath, "project", "secret")
+
+	// missing secret is created
+	n, err := s.Write([]byte("v1"))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Len(t, c.secrets[name], 1)
+
+	_, err = s.Write([]byte("v2"))
+	assert.NoError(t, err)
+	assert.Len(t, c.secrets[name], 2)
+	assert.Empty(t, c.disabled)
+
+	data, err := ioutil.ReadAll(s)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("v2"), data)
+
+	// pinned version
+	s.version = "1"
+	data, err = ioutil.ReadAll(s)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("v1"), data)
+
+	// non-existent version
+	s.version = "10"
+	_, err = s.Read(make([]byte, 5))
+	serr, ok := err.(*store.Error)
+	assert.True(t, ok)
+	assert.Equal(t, store.ErrNotFound, serr.Code)
+
+	// old versions are disabled
+	s.disableOld = true
+	_, err = s.Write([]byte("v3"))
+	assert.NoError(t, err)
+	assert.True(t, c.disabled[name+"/versions/1"])
+	assert.True(t, c.disabled[name+"/versions/2"])
+	assert.False(t, c.disabled[name+"/versions/3"])
+
+	c.err = fmt.Errorf("API Error")
+	_, err = s.Write([]byte("v4"))
+	assert.Error(t, err)
+	s.version = LatestVersion
+	_, err = s.Read(make([]byte, 5))
+	assert.Error(t, err)
+}
@@ -0,0 +1,238 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/milosgajdos/vaultops/cipher"
+	"github.com/milosgajdos/vaultops/manifest"
+	"github.com/milosgajdos/vaultops/store"
+)
+
+const (
+	// adminPolicy is the default name of the admin token policy
+	adminPolicy = "vaultops-admin"
+	// adminTokenPeriod is the default admin token period
+	adminTokenPeriod = 768 * time.Hour
+)
+
+// adminRules are the default rules of the admin token policy.
+// They grant access to the endpoints vaultops talks to, as well as to the
+// policies, auth methods and secrets engines the operators manage with the
+// admin token, on top of which the KV secrets listed in the manifest can be written.
+const adminRules = `# raft cluster management and snapshots
+path "sys/storage/raft/*" {
+  capabilities = ["create", "read", "update", "delete", "list", "sudo"]
+}
+
+# maintenance
+path "sys/seal" {
+  capabilities = ["update", "sudo"]
+}
+
+path "sys/step-down" {
+  capabilities = ["update", "sudo"]
+}
+
+# audit devices
+path "sys/audit" {
+  capabilities = ["read", "sudo"]
+}
+
+path "sys/audit/*" {
+  capabilities = ["create", "read", "update", "delete", "sudo"]
+}
+
+# policies
+path "sys/policy" {
+  capabilities = ["read", "list"]
+}
+
+path "sys/policy/*" {
+  capabilities = ["create", "read", "update", "delete", "list"]
+}
+
+path "sys/policies/acl" {
+  capabilities = ["read", "list"]
+}
+
+path "sys/policies/acl/*" {
+  capabilities = ["create", "read", "update", "delete", "list"]
+}
+
+# auth methods
+path "sys/auth" {
+  capabilities = ["read"]
+}
+
+path "sys/auth/*" {
+  capabilities = ["create", "read", "update", "delete", "sudo"]
+}
+
+# secrets engines
+path "sys/mounts" {
+  capabilities = ["read"]
+}
+
+path "sys/mounts/*" {
+  capabilities = ["create", "read", "update", "delete"]
+}
+
+# admin token renewal
+path "auth/token/lookup-self" {
+  capabilities = ["read"]
+}
+
+path "auth/token/renew-self" {
+  capabilities = ["update"]
+}
+`
+
+// adminConfig returns the admin token configuration read from the admin section of the manifest.
+// Unless -revoke-root is set on the command line, the root token is only revoked if the manifest
+// enables it. The unset settings default to vaultops-admin policy with the rules required by vaultops
+// and 768h token period.
+func (m *Meta) adminConfig(revokeRoot bool) *manifest.Admin {
+	a := new(manifest.Admin)
+	if m.manifest != nil && m.manifest.Admin != nil {
+		*a = *m.manifest.Admin
+	}
+
+	if m.setFlags()["revoke-root"] {
+		a.RevokeRoot = revokeRoot
+	}
+	if a.Policy == "" {
+		a.Policy = adminPolicy
+	}
+	if a.Rules == "" {
+		a.Rules = m.adminRules()
+	}
+	if a.Period == 0 {
+		a.Period = adminTokenPeriod
+	}
+
+	return a
+}
+
+// adminRules returns the default rules of the admin token policy
+// extended with the rules of the KV secrets listed in the manifest
+func (m *Meta) adminRules() string {
+	if m.manifest == nil || len(m.manifest.Secrets) == 0 {
+		return adminRules
+	}
+
+	var sb strings.Builder
+	sb.WriteString(adminRules)
+	sb.WriteString("\n# KV secrets\n")
+
+	seen := make(map[string]bool)
+	for _, s := range m.manifest.Secrets {
+		mount := strings.Trim(s.Mount, "/")
+		if seen[mount] {
+			continue
+		}
+		seen[mount] = true
+
+		fmt.Fprintf(&sb, "path %q {\n  capabilities = [\"create\", \"read\", \"update\"]\n}\n", mount+"/*")
+	}
+
+	return sb.String()
+}
+
+// checkRewritable returns error if the vault keys stored in key store ks can't be rewritten.
+// Revoking the root token rewrites the vault keys, so the keys must not be stored in immutable k8s secret.
+func checkRewritable(ks *manifest.KeyStore) error {
+	if ks.Type == "k8s" && ks.Kubernetes.Immutable {
+		return errors.New("revoking the root token rewrites the vault keys, " +
+			"but the k8s key store creates immutable secret: unset -kube-immutable")
+	}
+
+	return nil
+}
+
+// revokeRoot replaces the root token stored in vault keys vk with periodic orphan admin token.
+// It writes the admin policy to vault running at host, creates the admin token and stores it in s
+// along with the vault keys encrypted with cphr. Only then it revokes the root token and records
+// the revocation in s, so the vault keys never lack a valid token. Rerunning revokeRoot after
+// a failure reuses the already stored admin token and leaves its policy alone, so the changes
+// operators have made to the policy in the meantime are kept.
+func (m *Meta) revokeRoot(host string, vk *VaultKeys, a *manifest.Admin, s store.Store, cphr cipher.Cipher) error {
+	if vk.RootRevoked {
+		m.UI.Info("Root token already revoked")
+		return nil
+	}
+
+	if vk.RootToken == "" {
+		return errors.New("no root token stored")
+	}
+
+	v, err := m.Client(host, vk.RootToken)
+	if err != nil {
+		return err
+	}
+
+	if vk.AdminToken == "" {
+		if err := v.Sys().PutPolicy(a.Policy, a.Rules); err != nil {
+			return fmt.Errorf("failed to write admin policy: %v", err)
+		}
+		m.UI.Info(fmt.Sprintf("Policy: %s written", a.Policy))
+
+		secret, err := v.Auth().Token().CreateOrphan(&api.TokenCreateRequest{
+			Policies:    []string{a.Policy},
+			Period:      a.Period.String(),
+			DisplayName: a.Policy,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create admin token: %v", err)
+		}
+		if secret == nil || secret.Auth == nil || secret.Auth.ClientToken == "" {
+			return errors.New("failed to create admin token: no token returned")
+		}
+
+		vk.AdminToken = secret.Auth.ClientToken
+		if _, err := vk.Write(s, cphr); err != nil {
+			vk.AdminToken = ""
+			return fmt.Errorf("failed to store admin token: %v", err)
+		}
+
+		token := vk.AdminToken
+		if m.flagRedact {
+			token = Redact(rune('X'), len(token))
+		}
+		m.UI.Info(fmt.Sprintf("Admin Token: %s Policy: %s Period: %s", token, a.Policy, a.Period))
+		m.UI.Warn(fmt.Sprintf("Admin token expires unless it's renewed within %s: vaultops renews it "+
+			"whenever it uses it, otherwise renew it with: vault token renew", a.Period))
+	}
+
+	if err := v.Auth().Token().RevokeSelf(""); err != nil {
+		return fmt.Errorf("failed to revoke root token: %v", err)
+	}
+
+	vk.RootToken, vk.RootRevoked = "", true
+	if _, err := vk.Write(s, cphr); err != nil {
+		return fmt.Errorf("failed to record root token revocation: %v", err)
+	}
+	m.UI.Info("Root token revoked")
+
+	return nil
+}
+
+// renewAdminToken renews the admin token stored in vault keys vk on the active server found in hosts.
+// The admin token is periodic so it expires unless it's renewed within its period. Renewal failures
+// are only reported as warnings since the token remains valid until its period elapses.
+func (m *Meta) renewAdminToken(hosts []string, vk *VaultKeys) {
+	if vk.AdminToken == "" {
+		return
+	}
+
+	v, err := m.activeClient(hosts, vk.AdminToken)
+	if err == nil {
+		_, err = v.Auth().Token().RenewSelf(0)
+	}
+	if err != nil {
+		m.UI.Warn(fmt.Sprintf("Failed to renew admin token: %v", err))
+	}
+}
@@ -0,0 +1,146 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// ApplyCommand implements applying the vault configuration stored in the manifest
+// It fulfills cli.Command interface
+type ApplyCommand struct {
+	// meta flags contain vault client config
+	Meta
+}
+
+// Run runs apply command which applies the configuration stored in the manifest
+// to the active vault server. If apply fails Run returns non-zero integer
+func (c *ApplyCommand) Run(args []string) int {
+	var config, token string
+	var strict, prune bool
+
+	flags := c.Meta.FlagSet("apply", FlagSetDefault)
+	flags.Usage = func() { c.UI.Info(c.Help()) }
+	flags.StringVar(&config, "config", "", "")
+	flags.StringVar(&token, "token", "", "")
+	flags.BoolVar(&strict, "strict", false, "")
+	flags.BoolVar(&prune, "prune", false, "")
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+	defer c.stopRenewal()
+
+	if config == "" {
+		c.UI.Error("No config file provided")
+		return 1
+	}
+
+	hosts, err := c.unsealHosts(config)
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Failed to read vault hosts: %v", err))
+		return 1
+	}
+
+	token, ok := c.maintenanceToken(token, hosts)
+	if !ok {
+		return 1
+	}
+
+	v, err := c.activeClient(hosts, token)
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Failed to find active vault server: %v", err))
+		return 1
+	}
+
+	c.UI.Info(fmt.Sprintf("Attempting to apply configuration to vault: %s", v.Address()))
+
+	devices, err := c.applyAudit(v, c.manifest.Audit, prune)
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Failed to apply audit devices: %v", err))
+		return 1
+	}
+
+	// without an audit device the requests to vault are not audited
+	if strict && devices == 0 {
+		c.UI.Error("No audit device enabled: refusing to apply the remaining configuration")
+		return 1
+	}
+
+	if len(c.manifest.Secrets) > 0 {
+		src, err := c.newSecretSources()
+		if err != nil {
+			c.UI.Error(fmt.Sprintf("Failed to read key store configuration: %v", err))
+			return 1
+		}
+
+		if err := c.applySecrets(v, c.manifest.Secrets, src); err != nil {
+			c.UI.Error(fmt.Sprintf("Failed to apply secrets: %v", err))
+			return 1
+		}
+	}
+
+	c.UI.Info("Vault configuration successfully applied")
+
+	return 0
+}
+
+// activeClient returns vault client of the first active server found in hosts
+func (m *Meta) activeClient(hosts []string, token string) (*api.Client, error) {
+	for _, host := range hosts {
+		v, err := m.Client(host, token)
+		if err != nil {
+			return nil, err
+		}
+
+		h, err := checkHealth(context.Background(), v)
+		if err != nil {
+			continue
+		}
+
+		if h.Initialized && !h.Sealed && !h.Standby {
+			return v, nil
+		}
+	}
+
+	return nil, errors.New("no unsealed active server found")
+}
+
+// Synopsis provides a simple command description
+func (c *ApplyCommand) Synopsis() string {
+	return "Apply Vault configuration stored in the manifest"
+}
+
+// Help returns detailed command help
+func (c *ApplyCommand) Help() string {
+	helpText := `
+Usage: vaultops apply [options]
+
+    Apply Vault configuration stored in the manifest to the active Vault server.
+
+    The audit devices listed in the audit section of the manifest are enabled and
+    verified first. Vault can't reconfigure enabled audit devices, so the command
+    fails if an enabled device differs from the manifest unless -prune is set.
+
+    If -strict is set, the command refuses to apply the remaining configuration
+    unless at least one audit device is enabled.
+
+    The KV secrets listed in the secrets section of the manifest are written next
+    unless vault already stores the same data. KV version 2 secrets are written
+    with check-and-set. The secret values are only printed if -redact=false.
+
+General Options:
+` + GeneralOptionsUsage() + `
+apply Options:
+
+  -config			Path to a config file which contains a list of vault servers
+  -token			Vault token; if neither -token nor VAULT_TOKEN is set,
+				the root token is read from the key store
+  -strict			Refuse to proceed unless at least one audit device is enabled
+  -prune			Disable the audit devices which are not listed in the manifest
+				and re-enable the devices whose settings differ from the manifest
+`
+	return strings.TrimSpace(helpText)
+}
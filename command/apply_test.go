@@ -0,0 +1,218 @@
+package command
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/mitchellh/cli"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyCommand(t *testing.T) {
+	dir := makeTestDir(t)
+	defer os.RemoveAll(dir)
+	keyPath := filepath.Join(dir, "vault.json")
+
+	servers := makeTestCluster(t, 2, keyPath)
+	defer closeTestCluster(servers)
+	active := servers[0]
+	// the standby server is listed first, but the configuration is applied to the active server
+	hosts := []string{servers[1].URL, active.URL}
+
+	config := makeTestManifest(t, dir, hosts[:1], hosts)
+	appendTestManifest(t, config, `audit:
+  - type: file
+    description: audit log
+    options:
+      file_path: /var/log/vault/audit.log
+  - type: syslog
+    path: syslog/local
+    local: true
+`)
+
+	active.EnableAudit("socket", &api.EnableAuditOptions{Type: "socket", Options: map[string]string{"address": "127.0.0.1:9090"}})
+
+	ui := cli.NewMockUi()
+	c := &ApplyCommand{Meta: Meta{UI: ui}}
+	code := c.Run([]string{"-config", config, "-key-local-path", keyPath})
+	assert.Equal(t, 0, code, ui.ErrorWriter.String())
+
+	out := ui.OutputWriter.String()
+	assert.Contains(t, out, "Attempting to apply configuration to vault: "+active.URL)
+	assert.Contains(t, out, "Audit device: file Type: file enabled")
+	assert.Contains(t, out, "Audit device: syslog/local Type: syslog enabled")
+	assert.Contains(t, out, "Vault configuration successfully applied")
+
+	devices := active.AuditDevices()
+	assert.Len(t, devices, 3)
+	assert.Equal(t, &api.Audit{Type: "file", Description: "audit log", Path: "file/",
+		Options: map[string]string{"file_path": "/var/log/vault/audit.log"}}, devices["file/"])
+	assert.True(t, devices["syslog/local/"].Local)
+	assert.Empty(t, servers[1].AuditDevices())
+
+	// applying the manifest again doesn't change anything
+	ui = cli.NewMockUi()
+	c = &ApplyCommand{Meta: Meta{UI: ui}}
+	code = c.Run([]string{"-config", config, "-key-local-path", keyPath})
+	assert.Equal(t, 0, code, ui.ErrorWriter.String())
+	assert.Contains(t, ui.OutputWriter.String(), "Audit device: file Type: file unchanged")
+	assert.Equal(t, devices, active.AuditDevices())
+
+	// the devices which differ from the manifest are not reconfigured without -prune
+	assert.NoError(t, os.Setenv("VAULT_TOKEN", active.RootToken()))
+	defer os.Unsetenv("VAULT_TOKEN")
+	v, err := c.Client(active.URL, active.RootToken())
+	assert.NoError(t, err)
+	assert.NoError(t, v.Sys().DisableAudit("file"))
+	active.EnableAudit("file", &api.EnableAuditOptions{Type: "file", Options: map[string]string{"file_path": "stdout"}})
+
+	ui = cli.NewMockUi()
+	c = &ApplyCommand{Meta: Meta{UI: ui}}
+	code = c.Run([]string{"-config", config})
+	assert.Equal(t, 1, code)
+	assert.Contains(t, ui.ErrorWriter.String(),
+		`audit device file differs from the manifest: description "", expected "audit log", option file_path "stdout", expected "/var/log/vault/audit.log"`)
+
+	// -prune re-enables the changed devices and disables the devices not listed in the manifest
+	ui = cli.NewMockUi()
+	c = &ApplyCommand{Meta: Meta{UI: ui}}
+	code = c.Run([]string{"-config", config, "-prune"})
+	assert.Equal(t, 0, code, ui.ErrorWriter.String())
+	out = ui.OutputWriter.String()
+	assert.Contains(t, out, "Audit device: file Type: file re-enabled")
+	assert.Contains(t, out, "Audit device: socket Type: socket disabled")
+
+	devices = active.AuditDevices()
+	assert.Len(t, devices, 2)
+	assert.Equal(t, "/var/log/vault/audit.log", devices["file/"].Options["file_path"])
+	assert.NotContains(t, devices, "socket/")
+}
+
+func TestApplyCommandStrict(t *testing.T) {
+	dir := makeTestDir(t)
+	defer os.RemoveAll(dir)
+	keyPath := filepath.Join(dir, "vault.json")
+
+	servers := makeTestCluster(t, 1, keyPath)
+	defer closeTestCluster(servers)
+
+	// no audit section: the audit devices are not managed
+	config := makeTestManifest(t, dir, []string{servers[0].URL}, []string{servers[0].URL})
+
+	ui := cli.NewMockUi()
+	c := &ApplyCommand{Meta: Meta{UI: ui}}
+	code := c.Run([]string{"-config", config, "-key-local-path", keyPath, "-strict"})
+	assert.Equal(t, 1, code)
+	assert.Contains(t, ui.ErrorWriter.String(), "No audit device enabled: refusing to apply the remaining configuration")
+	assert.NotContains(t, ui.OutputWriter.String(), "Vault configuration successfully applied")
+
+	// any enabled audit device satisfies -strict
+	servers[0].EnableAudit("syslog", &api.EnableAuditOptions{Type: "syslog"})
+
+	ui = cli.NewMockUi()
+	c = &ApplyCommand{Meta: Meta{UI: ui}}
+	code = c.Run([]string{"-config", config, "-key-local-path", keyPath, "-strict", "-prune"})
+	assert.Equal(t, 0, code, ui.ErrorWriter.String())
+	assert.Contains(t, servers[0].AuditDevices(), "syslog/")
+
+	// empty audit section disables all the audit devices with -prune
+	appendTestManifest(t, config, "audit: []\n")
+
+	ui = cli.NewMockUi()
+	c = &ApplyCommand{Meta: Meta{UI: ui}}
+	code = c.Run([]string{"-config", config, "-key-local-path", keyPath, "-strict", "-prune"})
+	assert.Equal(t, 1, code)
+	assert.Contains(t, ui.OutputWriter.String(), "Audit device: syslog Type: syslog disabled")
+	assert.Contains(t, ui.ErrorWriter.String(), "No audit device enabled")
+}
+
+func TestApplyCommandErrors(t *testing.T) {
+	dir := makeTestDir(t)
+	defer os.RemoveAll(dir)
+	keyPath := filepath.Join(dir, "vault.json")
+
+	servers := makeTestCluster(t, 2, keyPath)
+	defer closeTestCluster(servers)
+	servers[0].SetSealed(true)
+
+	ui := cli.NewMockUi()
+	c := &ApplyCommand{Meta: Meta{UI: ui}}
+	code := c.Run([]string{"-key-local-path", keyPath})
+	assert.Equal(t, 1, code)
+	assert.Contains(t, ui.ErrorWriter.String(), "No config file provided")
+
+	// no active server
+	config := makeTestManifest(t, dir, []string{servers[0].URL}, []string{servers[0].URL, servers[1].URL})
+
+	ui = cli.NewMockUi()
+	c = &ApplyCommand{Meta: Meta{UI: ui}}
+	code = c.Run([]string{"-config", config, "-key-local-path", keyPath})
+	assert.Equal(t, 1, code)
+	assert.Contains(t, ui.ErrorWriter.String(), "Failed to find active vault server: no unsealed active server found")
+
+	// wrong token
+	servers[0].SetSealed(false)
+	ui = cli.NewMockUi()
+	c = &ApplyCommand{Meta: Meta{UI: ui}}
+	code = c.Run([]string{"-config", config, "-token", "foobar"})
+	assert.Equal(t, 1, code)
+	assert.Contains(t, ui.ErrorWriter.String(), "Failed to apply audit devices: failed to list audit devices")
+}
+
+func TestApplyCommandSecrets(t *testing.T) {
+	dir := makeTestDir(t)
+	defer os.RemoveAll(dir)
+	keyPath := filepath.Join(dir, "vault.json")
+	tokenPath := filepath.Join(dir, "api-token")
+	assert.NoError(t, ioutil.WriteFile(tokenPath, []byte("t0k3n"), 0600))
+
+	servers := makeTestCluster(t, 1, keyPath)
+	defer closeTestCluster(servers)
+	servers[0].MountKV("secret", 2)
+
+	config := makeTestManifest(t, dir, []string{servers[0].URL}, []string{servers[0].URL})
+	appendTestManifest(t, config, fmt.Sprintf(`secrets:
+  - mount: secret
+    path: api
+    data:
+      user:
+        value: app
+      token:
+        store: %s
+`, tokenPath))
+
+	// -strict stops before the secrets are written
+	ui := cli.NewMockUi()
+	c := &ApplyCommand{Meta: Meta{UI: ui}}
+	code := c.Run([]string{"-config", config, "-key-local-path", keyPath, "-strict"})
+	assert.Equal(t, 1, code)
+	_, _, ok := servers[0].KVSecret("secret/api")
+	assert.False(t, ok)
+
+	// the values are redacted by default
+	ui = cli.NewMockUi()
+	c = &ApplyCommand{Meta: Meta{UI: ui}}
+	code = c.Run([]string{"-config", config, "-key-local-path", keyPath})
+	assert.Equal(t, 0, code, ui.ErrorWriter.String())
+	out := ui.OutputWriter.String()
+	assert.Contains(t, out, "Secret: secret/api Version: 1 written")
+	assert.Contains(t, out, "\ttoken: XXXXX\n")
+	assert.NotContains(t, out, "t0k3n")
+
+	data, _, ok := servers[0].KVSecret("secret/api")
+	assert.True(t, ok)
+	assert.Equal(t, map[string]interface{}{"user": "app", "token": "t0k3n"}, data)
+
+	assert.NoError(t, ioutil.WriteFile(tokenPath, []byte("n3wt0k3n"), 0600))
+	ui = cli.NewMockUi()
+	c = &ApplyCommand{Meta: Meta{UI: ui}}
+	code = c.Run([]string{"-config", config, "-key-local-path", keyPath, "-redact=false"})
+	assert.Equal(t, 0, code, ui.ErrorWriter.String())
+	out = ui.OutputWriter.String()
+	assert.Contains(t, out, "Secret: secret/api Version: 2 written")
+	assert.Contains(t, out, "\ttoken: n3wt0k3n\n")
+}
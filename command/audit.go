@@ -0,0 +1,134 @@
+package command
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/milosgajdos/vaultops/manifest"
+)
+
+// auditOptions returns vault options of manifest audit device a
+func auditOptions(a *manifest.Audit) *api.EnableAuditOptions {
+	return &api.EnableAuditOptions{
+		Type:        a.Type,
+		Description: a.Description,
+		Options:     a.Options,
+		Local:       a.Local,
+	}
+}
+
+// auditDiff returns the settings of audit device enabled in vault which differ from manifest audit device a.
+// Only the options listed in the manifest are compared as vault may report extra options.
+func auditDiff(enabled *api.Audit, a *manifest.Audit) []string {
+	var diff []string
+	if enabled.Type != a.Type {
+		diff = append(diff, fmt.Sprintf("type %q, expected %q", enabled.Type, a.Type))
+	}
+	if enabled.Description != a.Description {
+		diff = append(diff, fmt.Sprintf("description %q, expected %q", enabled.Description, a.Description))
+	}
+	if enabled.Local != a.Local {
+		diff = append(diff, fmt.Sprintf("local %v, expected %v", enabled.Local, a.Local))
+	}
+
+	names := make([]string, 0, len(a.Options))
+	for name := range a.Options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if value, ok := enabled.Options[name]; !ok || value != a.Options[name] {
+			diff = append(diff, fmt.Sprintf("option %s %q, expected %q", name, value, a.Options[name]))
+		}
+	}
+
+	return diff
+}
+
+// applyAudit enables the audit devices listed in the manifest which are not enabled in vault.
+// Vault can't reconfigure enabled audit devices, so the devices whose settings differ from
+// the manifest are disabled and enabled again if prune is true; otherwise applyAudit fails.
+// If prune is true and the manifest declares the audit section, the audit devices which are
+// not listed in it are disabled. Once the devices are applied, applyAudit verifies they are
+// enabled as listed in the manifest and returns the number of the enabled audit devices.
+func (m *Meta) applyAudit(v *api.Client, devices []manifest.Audit, prune bool) (int, error) {
+	enabled, err := v.Sys().ListAudit()
+	if err != nil {
+		return 0, fmt.Errorf("failed to list audit devices: %v", err)
+	}
+
+	listed := make(map[string]bool)
+	for i := range devices {
+		a := &devices[i]
+		path := a.GetPath()
+		listed[path+"/"] = true
+
+		status := "enabled"
+		if cur, ok := enabled[path+"/"]; ok {
+			diff := auditDiff(cur, a)
+			switch {
+			case len(diff) == 0:
+				m.UI.Info(fmt.Sprintf("Audit device: %s Type: %s unchanged", path, a.Type))
+				continue
+			case !prune:
+				return 0, fmt.Errorf("audit device %s differs from the manifest: %s", path, strings.Join(diff, ", "))
+			}
+
+			if err := v.Sys().DisableAudit(path); err != nil {
+				return 0, fmt.Errorf("failed to disable audit device %s: %v", path, err)
+			}
+			status = "re-enabled"
+		}
+
+		if err := v.Sys().EnableAuditWithOptions(path, auditOptions(a)); err != nil {
+			return 0, fmt.Errorf("failed to enable audit device %s: %v", path, err)
+		}
+		m.UI.Info(fmt.Sprintf("Audit device: %s Type: %s %s", path, a.Type, status))
+	}
+
+	if prune && devices != nil {
+		paths := make([]string, 0, len(enabled))
+		for path := range enabled {
+			if !listed[path] {
+				paths = append(paths, path)
+			}
+		}
+		sort.Strings(paths)
+
+		for _, path := range paths {
+			path = strings.TrimSuffix(path, "/")
+			if err := v.Sys().DisableAudit(path); err != nil {
+				return 0, fmt.Errorf("failed to disable audit device %s: %v", path, err)
+			}
+			m.UI.Info(fmt.Sprintf("Audit device: %s Type: %s disabled", path, enabled[path+"/"].Type))
+		}
+	}
+
+	return verifyAudit(v, devices)
+}
+
+// verifyAudit verifies the audit devices listed in the manifest are enabled in vault
+// with the settings listed in the manifest and returns the number of enabled audit devices
+func verifyAudit(v *api.Client, devices []manifest.Audit) (int, error) {
+	enabled, err := v.Sys().ListAudit()
+	if err != nil {
+		return 0, fmt.Errorf("failed to list audit devices: %v", err)
+	}
+
+	for i := range devices {
+		a := &devices[i]
+		path := a.GetPath()
+		cur, ok := enabled[path+"/"]
+		if !ok {
+			return 0, fmt.Errorf("audit device %s is not enabled", path)
+		}
+		if diff := auditDiff(cur, a); len(diff) > 0 {
+			return 0, fmt.Errorf("audit device %s differs from the manifest: %s", path, strings.Join(diff, ", "))
+		}
+	}
+
+	return len(enabled), nil
+}
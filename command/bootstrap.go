@@ -0,0 +1,493 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/milosgajdos/vaultops/cipher"
+	"github.com/milosgajdos/vaultops/store"
+)
+
+const (
+	// raftConfigPath is vault raft configuration API path
+	raftConfigPath = "/v1/sys/storage/raft/configuration"
+	// raftPollInterval is raft configuration polling interval
+	raftPollInterval = time.Second
+)
+
+// raftServer is vault raft cluster member
+type raftServer struct {
+	NodeID  string `json:"node_id"`
+	Address string `json:"address"`
+	Leader  bool   `json:"leader"`
+	Voter   bool   `json:"voter"`
+}
+
+// raftConfig is vault raft cluster configuration
+type raftConfig struct {
+	Servers []raftServer `json:"servers"`
+}
+
+// BootstrapCommand implements bootstrap of vault integrated storage (raft) cluster
+// It fulfills cli.Command interface
+type BootstrapCommand struct {
+	// meta flags contain vault client config
+	Meta
+	// pollInterval is raft configuration polling interval
+	pollInterval time.Duration
+}
+
+// Run runs bootstrap command which initializes raft cluster leader,
+// joins the followers to the leader and unseals all the cluster nodes
+// If bootstrap fails it returns non-zero integer
+func (c *BootstrapCommand) Run(args []string) int {
+	var threshold, shares int
+	var config, leader, leaderAPIAddr string
+	var leaderCACert, leaderClientCert, leaderClientKey string
+	var timeout time.Duration
+	var revokeRoot bool
+	var wf waitFlags
+
+	flags := c.Meta.FlagSet("bootstrap", FlagSetDefault)
+	flags.Usage = func() { c.UI.Info(c.Help()) }
+	flags.IntVar(&shares, "key-shares", 5, "")
+	flags.IntVar(&threshold, "key-threshold", 3, "")
+	flags.StringVar(&config, "config", "", "")
+	flags.StringVar(&leader, "leader", "", "")
+	flags.StringVar(&leaderAPIAddr, "leader-api-addr", "", "")
+	flags.StringVar(&leaderCACert, "leader-ca-cert", "", "")
+	flags.StringVar(&leaderClientCert, "leader-client-cert", "", "")
+	flags.StringVar(&leaderClientKey, "leader-client-key", "", "")
+	flags.DurationVar(&timeout, "join-timeout", 2*time.Minute, "")
+	flags.BoolVar(&revokeRoot, "revoke-root", false, "")
+	wf.register(flags)
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	if err := wf.validate(); err != nil {
+		c.UI.Error(fmt.Sprintf("Failed to parse options: %v", err))
+		return 1
+	}
+
+	leader, followers, err := c.getRunHosts(config, leader)
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Failed to read vault hosts: %v", err))
+		return 1
+	}
+
+	// -timeout bounds waiting for the hosts as well as the init, join and unseal requests
+	ctx, cancel := wf.context()
+	defer cancel()
+
+	if wf.wait && !c.waitForHosts(ctx, append([]string{leader}, followers...), &wf) {
+		return 1
+	}
+
+	shares, threshold = c.keyShares(shares, threshold)
+
+	// followers join the leader via its API address
+	join := &api.RaftJoinRequest{LeaderAPIAddr: leaderAPIAddr}
+	if join.LeaderAPIAddr == "" {
+		join.LeaderAPIAddr = leader
+	}
+
+	for _, f := range []struct {
+		path string
+		dst  *string
+	}{
+		{leaderCACert, &join.LeaderCACert},
+		{leaderClientCert, &join.LeaderClientCert},
+		{leaderClientKey, &join.LeaderClientKey},
+	} {
+		if f.path == "" {
+			continue
+		}
+		data, err := ioutil.ReadFile(f.path)
+		if err != nil {
+			c.UI.Error(fmt.Sprintf("Failed to read leader TLS file: %v", err))
+			return 1
+		}
+		*f.dst = string(data)
+	}
+
+	ks, cc, err := c.keysConfig()
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Failed to read key store configuration: %v", err))
+		return 1
+	}
+
+	// the vault keys are rewritten when the root token is revoked
+	if c.adminConfig(revokeRoot).RevokeRoot {
+		if err := checkRewritable(ks); err != nil {
+			c.UI.Error(fmt.Sprintf("Invalid key store configuration: %v", err))
+			return 1
+		}
+	}
+
+	// create vault key store handle
+	s, err := VaultKeyStore(ks)
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Failed to create %s store: %v", ks.Type, err))
+		return 1
+	}
+
+	// if kms provider not empty, initialize cipher
+	var cphr cipher.Cipher
+	if cc.Provider != "" {
+		cphr, err = VaultKeyCipher(cc)
+		if err != nil {
+			c.UI.Error(fmt.Sprintf("Failed to create %s cipher: %v", cc.Provider, err))
+			return 1
+		}
+	}
+
+	c.UI.Info(fmt.Sprintf("Attempting to bootstrap vault raft cluster with leader: %s", leader))
+	for _, host := range followers {
+		c.UI.Info(fmt.Sprintf("\tfollower: %s", host))
+	}
+
+	req := &api.InitRequest{
+		SecretShares:      shares,
+		SecretThreshold:   threshold,
+		RecoveryShares:    shares,
+		RecoveryThreshold: threshold,
+	}
+
+	vk, err := c.initLeader(ctx, leader, req, ks.Type, s, cphr)
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Failed to initialize leader %s: %v", leader, err))
+		return 1
+	}
+
+	if vk.Token() == "" || vk.MasterKeys == nil {
+		c.UI.Error("No vault keys provided")
+		return 1
+	}
+
+	if err := c.unseal(ctx, leader, vk); err != nil {
+		c.UI.Error(fmt.Sprintf("Failed to unseal leader %s: %v", leader, err))
+		return 1
+	}
+
+	// followers are joined and unsealed in order
+	for _, host := range followers {
+		if err := c.joinFollower(ctx, host, join); err != nil {
+			c.UI.Error(fmt.Sprintf("Failed to join %s to raft cluster: %v", host, err))
+			return 1
+		}
+
+		if err := c.unseal(ctx, host, vk); err != nil {
+			c.UI.Error(fmt.Sprintf("Failed to unseal follower %s: %v", host, err))
+			return 1
+		}
+	}
+
+	c.UI.Info(fmt.Sprintf("Waiting for %d raft voters", len(followers)+1))
+	servers, err := c.waitForVoters(leader, vk.Token(), len(followers)+1, timeout)
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Failed to bootstrap raft cluster: %v", err))
+		return 1
+	}
+
+	for _, srv := range servers {
+		c.UI.Info(fmt.Sprintf("Node: %s Address: %s Leader: %v Voter: %v", srv.NodeID, srv.Address, srv.Leader, srv.Voter))
+	}
+
+	// audit devices are enabled right after the cluster is bootstrapped
+	if c.manifest != nil && len(c.manifest.Audit) > 0 {
+		v, err := c.Client(leader, vk.Token())
+		if err != nil {
+			c.UI.Error(fmt.Sprintf("Failed to fetch Vault client: %v", err))
+			return 1
+		}
+
+		if _, err := c.applyAudit(v, c.manifest.Audit, false); err != nil {
+			c.UI.Error(fmt.Sprintf("Failed to enable audit devices: %v", err))
+			return 1
+		}
+	}
+
+	// the root token is revoked last as the previous steps may require it
+	if admin := c.adminConfig(revokeRoot); admin.RevokeRoot {
+		if err := c.revokeRoot(leader, vk, admin, s, cphr); err != nil {
+			c.UI.Error(fmt.Sprintf("Failed to revoke root token: %v", err))
+			return 1
+		}
+	}
+
+	c.UI.Info("Vault raft cluster successfully bootstrapped")
+
+	return 0
+}
+
+// getRunHosts returns raft cluster leader and followers
+// Unless overridden by leader, the leader is the first init host of the manifest
+// and the followers are the remaining unseal hosts of the manifest.
+func (c *BootstrapCommand) getRunHosts(config, leader string) (string, []string, error) {
+	if config == "" {
+		if leader != "" {
+			return leader, nil, nil
+		}
+
+		// if no config is supplied read environment
+		cfg, err := c.Config("")
+		if err != nil {
+			return "", nil, err
+		}
+
+		return cfg.Address, nil, nil
+	}
+
+	m, err := c.parseManifest(config)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if leader == "" {
+		hosts, err := c.manifestHosts(m, "init")
+		if err != nil {
+			return "", nil, err
+		}
+
+		if len(hosts) == 0 {
+			return "", nil, fmt.Errorf("no raft leader found in %s", config)
+		}
+		leader = hosts[0]
+	}
+
+	hosts, err := c.manifestHosts(m, "unseal")
+	if err != nil {
+		return "", nil, err
+	}
+
+	var followers []string
+	for _, host := range hosts {
+		if strings.TrimSuffix(host, "/") != strings.TrimSuffix(leader, "/") {
+			followers = append(followers, host)
+		}
+	}
+
+	return leader, followers, nil
+}
+
+// initLeader initializes the leader and stores the vault keys in s.
+// If the leader has already been initialized the vault keys are read from s.
+// The init requests fail once ctx is done.
+func (c *BootstrapCommand) initLeader(ctx context.Context, leader string, req *api.InitRequest, storeType string, s store.Store, cphr cipher.Cipher) (*VaultKeys, error) {
+	v, err := c.Client(leader, "")
+	if err != nil {
+		return nil, err
+	}
+
+	initialized, err := initStatus(ctx, v)
+	if err != nil {
+		return nil, err
+	}
+
+	vk := new(VaultKeys)
+	if initialized {
+		c.UI.Info(fmt.Sprintf("Host: %s already initialized. Reading vault keys from store: %s", leader, storeType))
+		if _, err := vk.Read(s, cphr); err != nil {
+			return nil, fmt.Errorf("failed to read vault keys: %v", err)
+		}
+
+		return vk, nil
+	}
+
+	resp, err := initVault(ctx, v, req)
+	if err != nil {
+		return nil, err
+	}
+
+	c.UI.Info(fmt.Sprintf("Host: %s initialized. Master keys:", leader))
+	for i, key := range resp.Keys {
+		if c.flagRedact {
+			key = Redact(rune('X'), len(key))
+		}
+		c.UI.Info(fmt.Sprintf("Key %d: %s", i+1, key))
+	}
+
+	rootToken := resp.RootToken
+	if c.flagRedact {
+		rootToken = Redact(rune('X'), len(rootToken))
+	}
+	c.UI.Info(fmt.Sprintf("Initial Root Token: %s", rootToken))
+
+	vk.RootToken, vk.MasterKeys = resp.RootToken, resp.Keys
+	c.UI.Info(fmt.Sprintf("Attempting to store the vault keys in store: %s", storeType))
+	if _, err := vk.Write(s, cphr); err != nil {
+		return nil, fmt.Errorf("failed to store vault keys: %v", err)
+	}
+
+	return vk, nil
+}
+
+// joinFollower joins the follower to the raft cluster unless it's already initialized.
+// The join requests fail once ctx is done.
+func (c *BootstrapCommand) joinFollower(ctx context.Context, host string, join *api.RaftJoinRequest) error {
+	v, err := c.Client(host, "")
+	if err != nil {
+		return err
+	}
+
+	initialized, err := initStatus(ctx, v)
+	if err != nil {
+		return err
+	}
+
+	if initialized {
+		c.UI.Info(fmt.Sprintf("Host: %s already initialized. Skipping raft join", host))
+		return nil
+	}
+
+	c.UI.Info(fmt.Sprintf("Attempting to join host: %s to %s", host, join.LeaderAPIAddr))
+	resp, err := raftJoin(ctx, v, join)
+	if err != nil {
+		return err
+	}
+
+	if !resp.Joined {
+		return fmt.Errorf("join request rejected")
+	}
+
+	return nil
+}
+
+// unseal unseals vault host using the vault keys
+// The unseal requests fail once ctx is done.
+func (c *BootstrapCommand) unseal(ctx context.Context, host string, vk *VaultKeys) error {
+	v, err := c.Client(host, vk.Token())
+	if err != nil {
+		return err
+	}
+
+	c.UI.Info(fmt.Sprintf("Attempting to unseal host: %s", host))
+	report, err := unsealHost(ctx, v, vk.MasterKeys, false)
+	c.reportUnseal(host, report)
+	if err != nil {
+		return err
+	}
+
+	resp := report.status
+	if resp.Sealed {
+		return fmt.Errorf("not enough keys: unseal progress %d/%d", resp.Progress, resp.T)
+	}
+
+	return nil
+}
+
+// waitForVoters polls raft configuration of the leader until it lists
+// the given number of voters or until timeout expires
+func (c *BootstrapCommand) waitForVoters(leader, token string, voters int, timeout time.Duration) ([]raftServer, error) {
+	v, err := c.Client(leader, token)
+	if err != nil {
+		return nil, err
+	}
+
+	interval := c.pollInterval
+	if interval <= 0 {
+		interval = raftPollInterval
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		config, err := readRaftConfig(v)
+		if err == nil {
+			var count int
+			for _, srv := range config.Servers {
+				if srv.Voter {
+					count++
+				}
+			}
+
+			if count >= voters {
+				return config.Servers, nil
+			}
+			err = fmt.Errorf("%d out of %d raft voters found", count, voters)
+		}
+
+		if time.Now().Add(interval).After(deadline) {
+			return nil, fmt.Errorf("timed out after %s: %v", timeout, err)
+		}
+
+		time.Sleep(interval)
+	}
+}
+
+// readRaftConfig reads raft cluster configuration
+func readRaftConfig(v *api.Client) (*raftConfig, error) {
+	resp, err := v.RawRequest(v.NewRequest("GET", raftConfigPath))
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var out struct {
+		Data struct {
+			Config raftConfig `json:"config"`
+		} `json:"data"`
+	}
+
+	if err := resp.DecodeJSON(&out); err != nil {
+		return nil, err
+	}
+
+	return &out.Data.Config, nil
+}
+
+// Synopsis provides a simple command description
+func (c *BootstrapCommand) Synopsis() string {
+	return "Bootstrap Vault integrated storage (raft) cluster"
+}
+
+// Help returns detailed command help
+func (c *BootstrapCommand) Help() string {
+	helpText := `
+Usage: vaultops bootstrap [options]
+
+    Bootstrap a new Vault integrated storage (raft) cluster.
+
+    This command initializes the raft cluster leader and stores the vault keys,
+    joins the followers to the leader and unseals all the cluster nodes in order.
+    It then waits until the raft configuration of the leader lists all nodes as voters
+    and enables the audit devices listed in the audit section of the manifest.
+    If -revoke-root is set, the root token is replaced with an admin token
+    as described in the help of the revoke-root command.
+
+    The leader is the first init host of the manifest, followers are the unseal hosts.
+    Already initialized nodes are not initialized or joined again, which means the
+    command can be safely rerun e.g. when adding new nodes to the cluster.
+
+General Options:
+` + GeneralOptionsUsage() + `
+bootstrap Options:
+
+  -key-shares=5 		Number of key shares to split the master key into
+				Overrides the keys section of the config file
+  -key-threshold=3		Number of key shares required to reconstruct the master key
+				Overrides the keys section of the config file
+  -config			Path to a config file which contains a list of vault servers
+  -leader			Address of the raft leader (overrides the manifest)
+  -leader-api-addr		Address the followers use to reach the leader (default: leader address)
+  -leader-ca-cert		Path to a PEM encoded CA cert used by followers to verify the leader
+  -leader-client-cert		Path to a PEM encoded client cert used by followers to talk to the leader
+  -leader-client-key		Path to a PEM encoded client key used by followers to talk to the leader
+  -join-timeout=2m		Maximum time to wait for all nodes to become raft voters
+  -revoke-root			Replace the root token with an admin token once the cluster
+				is bootstrapped; overrides the admin section of the config file
+  -wait				Wait until all vault servers are reachable before proceeding
+  -timeout=5m			Maximum time to wait for vault servers to become reachable
+				and to initialize, join and unseal them
+  -retry-interval=1s		Initial interval between reachability checks; it grows
+				exponentially with each failed check
+
+`
+	return strings.TrimSpace(helpText)
+}
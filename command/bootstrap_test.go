@@ -0,0 +1,193 @@
+package command
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/milosgajdos/vaultops/vaulttest"
+	"github.com/mitchellh/cli"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBootstrapCommand(t *testing.T) {
+	dir := makeTestDir(t)
+	defer os.RemoveAll(dir)
+	keyPath := filepath.Join(dir, "vault.json")
+	caPath := filepath.Join(dir, "ca.pem")
+	assert.NoError(t, ioutil.WriteFile(caPath, []byte("CA"), 0600))
+
+	var nodes []*vaulttest.Server
+	var hosts []string
+	for i := 0; i < 3; i++ {
+		s := vaulttest.NewServer()
+		defer s.Close()
+		nodes = append(nodes, s)
+		hosts = append(hosts, s.URL)
+	}
+	config := makeTestManifest(t, dir, hosts[:1], hosts)
+	appendTestManifest(t, config, "audit:\n  - type: syslog\n")
+
+	ui := cli.NewMockUi()
+	c := &BootstrapCommand{Meta: Meta{UI: ui}, pollInterval: 10 * time.Millisecond}
+	code := c.Run([]string{"-config", config, "-key-local-path", keyPath, "-key-shares", "3", "-key-threshold", "2",
+		"-leader-ca-cert", caPath})
+	assert.Equal(t, 0, code, ui.ErrorWriter.String())
+	assert.Contains(t, ui.OutputWriter.String(), "Vault raft cluster successfully bootstrapped")
+
+	vk := readTestKeys(t, keyPath)
+	assert.Equal(t, nodes[0].Keys(), vk.MasterKeys)
+	assert.Equal(t, nodes[0].RootToken(), vk.RootToken)
+
+	// audit devices are enabled on the leader once the cluster is bootstrapped
+	assert.Contains(t, ui.OutputWriter.String(), "Audit device: syslog Type: syslog enabled")
+	assert.Contains(t, nodes[0].AuditDevices(), "syslog/")
+
+	for _, s := range nodes {
+		assert.False(t, s.Sealed())
+	}
+
+	for _, s := range nodes[1:] {
+		assert.Equal(t, nodes[0].URL, s.JoinRequest().LeaderAPIAddr)
+		assert.Equal(t, "CA", s.JoinRequest().LeaderCACert)
+		// followers are joined, not initialized: only their init status is read
+		assert.Equal(t, 1, s.Requests("/v1/sys/init"))
+	}
+
+	servers := nodes[0].RaftServers()
+	assert.Len(t, servers, 3)
+	for i, srv := range servers {
+		assert.Equal(t, nodes[i].NodeID(), srv.NodeID)
+		assert.True(t, srv.Voter)
+	}
+
+	// bootstrap is idempotent
+	ui = cli.NewMockUi()
+	c = &BootstrapCommand{Meta: Meta{UI: ui}, pollInterval: 10 * time.Millisecond}
+	code = c.Run([]string{"-config", config, "-key-local-path", keyPath})
+	assert.Equal(t, 0, code, ui.ErrorWriter.String())
+	assert.Contains(t, ui.OutputWriter.String(), "already initialized")
+	assert.Len(t, nodes[0].RaftServers(), 3)
+}
+
+func TestBootstrapCommandRevokeRoot(t *testing.T) {
+	dir := makeTestDir(t)
+	defer os.RemoveAll(dir)
+	keyPath := filepath.Join(dir, "vault.json")
+
+	var nodes []*vaulttest.Server
+	var hosts []string
+	for i := 0; i < 2; i++ {
+		s := vaulttest.NewServer()
+		defer s.Close()
+		nodes = append(nodes, s)
+		hosts = append(hosts, s.URL)
+	}
+	config := makeTestManifest(t, dir, hosts[:1], hosts)
+	appendTestManifest(t, config, "admin:\n  revoke_root: true\n  period: 24h\n")
+
+	// the root token can't be revoked if the vault keys can't be rewritten
+	ui := cli.NewMockUi()
+	c := &BootstrapCommand{Meta: Meta{UI: ui}, pollInterval: 10 * time.Millisecond}
+	code := c.Run([]string{"-config", config, "-key-store", "k8s", "-kube-immutable"})
+	assert.Equal(t, 1, code)
+	assert.Contains(t, ui.ErrorWriter.String(), "Invalid key store configuration: revoking the root token rewrites the vault keys")
+	assert.Equal(t, 0, nodes[0].Requests("/v1/sys/init"))
+
+	// -revoke-root=false overrides the manifest
+	ui = cli.NewMockUi()
+	c = &BootstrapCommand{Meta: Meta{UI: ui}, pollInterval: 10 * time.Millisecond}
+	code = c.Run([]string{"-config", config, "-key-local-path", keyPath, "-revoke-root=false"})
+	assert.Equal(t, 0, code, ui.ErrorWriter.String())
+	assert.NotContains(t, ui.OutputWriter.String(), "Root token revoked")
+	assert.NotEmpty(t, nodes[0].RootToken())
+
+	// the root token is revoked once the cluster is bootstrapped
+	ui = cli.NewMockUi()
+	c = &BootstrapCommand{Meta: Meta{UI: ui}, pollInterval: 10 * time.Millisecond}
+	code = c.Run([]string{"-config", config, "-key-local-path", keyPath})
+	assert.Equal(t, 0, code, ui.ErrorWriter.String())
+	assert.Contains(t, ui.OutputWriter.String(), "Root token revoked")
+	assert.Empty(t, nodes[0].RootToken())
+
+	vk := readTestKeys(t, keyPath)
+	assert.True(t, vk.RootRevoked)
+	token, ok := nodes[0].Token(vk.AdminToken)
+	assert.True(t, ok)
+	assert.Equal(t, 24*time.Hour, token.Period)
+	_, ok = nodes[0].Policy(adminPolicy)
+	assert.True(t, ok)
+
+	// bootstrap keeps working with the admin token
+	ui = cli.NewMockUi()
+	c = &BootstrapCommand{Meta: Meta{UI: ui}, pollInterval: 10 * time.Millisecond}
+	code = c.Run([]string{"-config", config, "-key-local-path", keyPath})
+	assert.Equal(t, 0, code, ui.ErrorWriter.String())
+	assert.Contains(t, ui.OutputWriter.String(), "Root token already revoked")
+}
+
+func TestBootstrapCommandTimeout(t *testing.T) {
+	dir := makeTestDir(t)
+	defer os.RemoveAll(dir)
+	keyPath := filepath.Join(dir, "vault.json")
+
+	leader := vaulttest.NewServer()
+	defer leader.Close()
+	follower := vaulttest.NewServer()
+	defer follower.Close()
+	follower.SetNonVoter(true)
+
+	config := makeTestManifest(t, dir, []string{leader.URL}, []string{leader.URL, follower.URL})
+
+	ui := cli.NewMockUi()
+	c := &BootstrapCommand{Meta: Meta{UI: ui}, pollInterval: 10 * time.Millisecond}
+	code := c.Run([]string{"-config", config, "-key-local-path", keyPath, "-join-timeout", "50ms"})
+	assert.Equal(t, 1, code)
+	assert.Contains(t, ui.ErrorWriter.String(), "1 out of 2 raft voters found")
+	assert.False(t, follower.Sealed())
+}
+
+func TestBootstrapCommandErrors(t *testing.T) {
+	dir := makeTestDir(t)
+	defer os.RemoveAll(dir)
+	keyPath := filepath.Join(dir, "vault.json")
+
+	leader := vaulttest.NewServer()
+	defer leader.Close()
+	follower := vaulttest.NewServer()
+	defer follower.Close()
+
+	config := makeTestManifest(t, dir, []string{leader.URL}, []string{leader.URL, follower.URL})
+
+	testCases := []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"-foobar"}, ""},
+		{[]string{"-config", filepath.Join(dir, "foobar.yaml")}, "Failed to read vault hosts"},
+		{[]string{"-config", config, "-leader-ca-cert", filepath.Join(dir, "foobar.pem")}, "Failed to read leader TLS file"},
+		{[]string{"-config", config, "-key-store", "foobar"}, "Failed to create foobar store"},
+		{[]string{"-config", config, "-key-local-path", keyPath, "-kms-provider", "foobar"}, "Failed to create foobar cipher"},
+	}
+
+	for _, tc := range testCases {
+		ui := cli.NewMockUi()
+		c := &BootstrapCommand{Meta: Meta{UI: ui}}
+		code := c.Run(tc.args)
+		assert.Equal(t, 1, code)
+		assert.Contains(t, ui.ErrorWriter.String(), tc.err)
+	}
+
+	// failed raft join
+	follower.Fail("/v1/sys/storage/raft/join", http.StatusInternalServerError, 1)
+	ui := cli.NewMockUi()
+	c := &BootstrapCommand{Meta: Meta{UI: ui}}
+	code := c.Run([]string{"-config", config, "-key-local-path", keyPath})
+	assert.Equal(t, 1, code)
+	assert.Contains(t, ui.ErrorWriter.String(), "Failed to join "+follower.URL)
+	assert.False(t, leader.Sealed())
+	assert.False(t, follower.Initialized())
+}
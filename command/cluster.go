@@ -0,0 +1,149 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/milosgajdos/vaultops/manifest"
+	"github.com/mitchellh/cli"
+)
+
+// clusterRun runs a command against the hosts of a single cluster
+// using the command meta of the cluster and returns the command exit code
+type clusterRun func(m *Meta, hosts []string) int
+
+// bufferedUI buffers the messages of a cluster so the output
+// of the clusters which run concurrently doesn't interleave.
+// It doesn't support reading user input.
+type bufferedUI struct {
+	mu   sync.Mutex
+	msgs []func(cli.Ui)
+}
+
+// add buffers the message
+func (u *bufferedUI) add(msg func(cli.Ui)) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.msgs = append(u.msgs, msg)
+}
+
+// Ask fails as reading user input is not supported
+func (u *bufferedUI) Ask(string) (string, error) {
+	return "", errors.New("reading input is not supported when running against all clusters")
+}
+
+// AskSecret fails as reading user input is not supported
+func (u *bufferedUI) AskSecret(string) (string, error) {
+	return u.Ask("")
+}
+
+// Output buffers output message
+func (u *bufferedUI) Output(s string) { u.add(func(ui cli.Ui) { ui.Output(s) }) }
+
+// Info buffers info message
+func (u *bufferedUI) Info(s string) { u.add(func(ui cli.Ui) { ui.Info(s) }) }
+
+// Error buffers error message
+func (u *bufferedUI) Error(s string) { u.add(func(ui cli.Ui) { ui.Error(s) }) }
+
+// Warn buffers warning message
+func (u *bufferedUI) Warn(s string) { u.add(func(ui cli.Ui) { ui.Warn(s) }) }
+
+// flush writes the buffered messages to ui
+func (u *bufferedUI) flush(ui cli.Ui) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for _, msg := range u.msgs {
+		msg(ui)
+	}
+	u.msgs = nil
+}
+
+// manifestHosts returns the hosts of manifest mf against which cmd should be run.
+// It fails if the manifest declares named clusters, but no cluster is selected
+// and the manifest doesn't list any hosts outside of the named clusters.
+func (m *Meta) manifestHosts(mf *manifest.Manifest, cmd string) ([]string, error) {
+	hosts, err := mf.GetHosts(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(hosts) == 0 && len(mf.Clusters) > 0 {
+		return nil, fmt.Errorf("no cluster selected: manifest declares clusters %s, select one with -cluster",
+			strings.Join(mf.ClusterNames(), ", "))
+	}
+
+	return hosts, nil
+}
+
+// allClusters returns true if the manifest stored in config declares named clusters
+// and none of them is selected via -cluster, i.e. the command should run against all of them.
+// Manifest errors are not reported here: they're reported when the hosts are read.
+func (m *Meta) allClusters(config string) bool {
+	if config == "" || m.flagCluster != "" {
+		return false
+	}
+
+	mf, err := m.readManifest(config)
+	if err != nil {
+		return false
+	}
+
+	return len(mf.Clusters) > 0
+}
+
+// runClusters runs cmd against the hosts of all the clusters declared
+// in the manifest stored in config concurrently. The output of each cluster
+// is reported grouped under the cluster name once all the clusters are done.
+// It returns the highest exit code returned by run.
+func (m *Meta) runClusters(config, cmd string, run clusterRun) int {
+	mf, err := m.readManifest(config)
+	if err != nil {
+		m.UI.Error(fmt.Sprintf("Failed to read vault hosts: %v", err))
+		return 1
+	}
+
+	names := mf.ClusterNames()
+	uis := make([]*bufferedUI, len(names))
+	codes := make([]int, len(names))
+
+	var wg sync.WaitGroup
+	for i, name := range names {
+		sel, err := mf.Select(name)
+		if err != nil {
+			m.UI.Error(fmt.Sprintf("Failed to select cluster %s: %v", name, err))
+			return 1
+		}
+
+		// every cluster runs with its own manifest and key store
+		c := *m
+		uis[i] = new(bufferedUI)
+		c.UI, c.manifest = uis[i], sel
+
+		wg.Add(1)
+		go func(i int, c *Meta) {
+			defer wg.Done()
+			hosts, err := c.manifest.GetHosts(cmd)
+			if err != nil {
+				c.UI.Error(fmt.Sprintf("Failed to read vault hosts: %v", err))
+				codes[i] = 1
+				return
+			}
+			codes[i] = run(c, hosts)
+		}(i, &c)
+	}
+	wg.Wait()
+
+	var code int
+	for i, name := range names {
+		m.UI.Output(fmt.Sprintf("Cluster: %s", name))
+		uis[i].flush(m.UI)
+		if codes[i] > code {
+			code = codes[i]
+		}
+	}
+
+	return code
+}
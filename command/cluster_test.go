@@ -0,0 +1,124 @@
+package command
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/milosgajdos/vaultops/vaulttest"
+	"github.com/mitchellh/cli"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClusters(t *testing.T) {
+	dir := makeTestDir(t)
+	defer os.RemoveAll(dir)
+
+	staging := vaulttest.NewServer()
+	defer staging.Close()
+	staging.Initialize(3, 2)
+
+	prod := vaulttest.NewServer()
+	defer prod.Close()
+	prod.Initialize(3, 2)
+
+	config := filepath.Join(dir, "vaultops.yaml")
+	data := fmt.Sprintf(`clusters:
+  staging:
+    hosts:
+      init:
+        - %s
+      unseal:
+        - %s
+  prod:
+    hosts:
+      init:
+        - %s
+      unseal:
+        - %s
+`, staging.URL, staging.URL, prod.URL, prod.URL)
+	assert.NoError(t, ioutil.WriteFile(config, []byte(data), 0600))
+
+	// the status of all the clusters is grouped by cluster
+	ui := cli.NewMockUi()
+	c := &UnsealCommand{Meta: Meta{UI: ui}}
+	code := c.Run([]string{"-config", config, "-status"})
+	assert.Equal(t, 0, code, ui.ErrorWriter.String())
+	out := ui.OutputWriter.String()
+	order := []string{
+		"Cluster: prod",
+		fmt.Sprintf("Host: %s Sealed: true", prod.URL),
+		"Cluster: staging",
+		fmt.Sprintf("Host: %s Sealed: true", staging.URL),
+	}
+	for i := 1; i < len(order); i++ {
+		assert.True(t, strings.Index(out, order[i-1]) < strings.Index(out, order[i]), out)
+	}
+
+	ui = cli.NewMockUi()
+	ic := &InitCommand{Meta: Meta{UI: ui}}
+	code = ic.Run([]string{"-config", config, "-status"})
+	assert.Equal(t, 0, code, ui.ErrorWriter.String())
+	assert.Contains(t, ui.OutputWriter.String(), "Cluster: prod")
+	assert.Contains(t, ui.OutputWriter.String(), fmt.Sprintf("Host: %s Initialized: true", staging.URL))
+
+	// the failure of a single cluster fails the command
+	prod.Fail("/v1/sys/seal-status", http.StatusInternalServerError, 1)
+	ui = cli.NewMockUi()
+	c = &UnsealCommand{Meta: Meta{UI: ui}}
+	code = c.Run([]string{"-config", config, "-status"})
+	assert.Equal(t, 1, code)
+	assert.Contains(t, ui.ErrorWriter.String(), fmt.Sprintf("Failed to read seal status of %s", prod.URL))
+	assert.Contains(t, ui.OutputWriter.String(), fmt.Sprintf("Host: %s Sealed: true", staging.URL))
+
+	// selected cluster
+	ui = cli.NewMockUi()
+	c = &UnsealCommand{Meta: Meta{UI: ui}}
+	code = c.Run([]string{"-config", config, "-cluster", "staging", "-status"})
+	assert.Equal(t, 0, code, ui.ErrorWriter.String())
+	assert.NotContains(t, ui.OutputWriter.String(), "Cluster:")
+	assert.NotContains(t, ui.OutputWriter.String(), prod.URL)
+	assert.Contains(t, ui.OutputWriter.String(), fmt.Sprintf("Host: %s Sealed: true", staging.URL))
+
+	os.Setenv("VAULTOPS_CLUSTER", "prod-us")
+	ui = cli.NewMockUi()
+	c = &UnsealCommand{Meta: Meta{UI: ui}}
+	code = c.Run([]string{"-config", config, "-status"})
+	os.Unsetenv("VAULTOPS_CLUSTER")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, ui.ErrorWriter.String(), "cluster prod-us not found: expected one of prod, staging")
+
+	// commands which change the cluster state require a cluster to be selected
+	ui = cli.NewMockUi()
+	c = &UnsealCommand{Meta: Meta{UI: ui}}
+	code = c.Run([]string{"-config", config})
+	assert.Equal(t, 1, code)
+	assert.Contains(t, ui.ErrorWriter.String(), "no cluster selected: manifest declares clusters prod, staging, select one with -cluster")
+}
+
+func TestBufferedUI(t *testing.T) {
+	ui := new(bufferedUI)
+	ui.Output("output")
+	ui.Info("info")
+	ui.Warn("warn")
+	ui.Error("error")
+
+	_, err := ui.Ask("key")
+	assert.Error(t, err)
+	_, err = ui.AskSecret("key")
+	assert.Error(t, err)
+
+	mock := cli.NewMockUi()
+	ui.flush(mock)
+	assert.Equal(t, "output\ninfo\n", mock.OutputWriter.String())
+	assert.Equal(t, "warn\nerror\n", mock.ErrorWriter.String())
+
+	// flushed messages are discarded
+	mock = cli.NewMockUi()
+	ui.flush(mock)
+	assert.Empty(t, mock.OutputWriter.String())
+}
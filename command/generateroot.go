@@ -0,0 +1,289 @@
+package command
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// GenerateRootCommand implements generating a new vault root token using the unseal keys
+// It fulfills cli.Command interface
+type GenerateRootCommand struct {
+	// meta flags contain vault client config
+	Meta
+}
+
+// Run runs generate-root command which generates a new vault root token
+// using the unseal keys read from the key store or entered by the key share custodians.
+// If generate-root fails Run returns non-zero integer
+func (c *GenerateRootCommand) Run(args []string) int {
+	var reset, interactive, storedKeys bool
+	var otp, config string
+	// create command flags
+	flags := c.Meta.FlagSet("generate-root", FlagSetDefault)
+	flags.Usage = func() { c.UI.Error(c.Help()) }
+	flags.BoolVar(&reset, "reset", false, "")
+	flags.BoolVar(&interactive, "interactive", false, "")
+	flags.BoolVar(&storedKeys, "stored-keys", false, "")
+	flags.StringVar(&otp, "otp", "", "")
+	flags.StringVar(&config, "config", "", "")
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	hosts, err := c.unsealHosts(config)
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Failed to read vault hosts: %v", err))
+		return 1
+	}
+
+	// interactive generate-root only uses the stored keys when asked to
+	vk := new(VaultKeys)
+	if !interactive || storedKeys {
+		if vk = c.readKeys(); vk == nil {
+			return 1
+		}
+	}
+
+	// generate-root endpoints don't require a token
+	v, err := c.activeClient(hosts, "")
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Failed to find active vault server: %v", err))
+		return 1
+	}
+	host := v.Address()
+
+	c.UI.Info(fmt.Sprintf("Attempting to generate root token of vault: %s", host))
+
+	status, otp, err := c.startGenerateRoot(v, otp, reset)
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Failed to start root token generation: %v", err))
+		return 1
+	}
+
+	status, err = c.updateGenerateRoot(v, status, vk.MasterKeys)
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Failed to generate root token: %v", err))
+		return 1
+	}
+
+	for interactive && !status.Complete {
+		key, err := c.UI.AskSecret("Unseal key share (leave empty to stop):")
+		if err != nil && err != io.EOF {
+			c.UI.Error(fmt.Sprintf("Failed to read key share: %v", err))
+			return 1
+		}
+
+		key = strings.TrimSpace(key)
+		if key == "" {
+			break
+		}
+
+		if err := validateKeyShare(key); err != nil {
+			c.UI.Error(fmt.Sprintf("Invalid key share: %v", err))
+			continue
+		}
+
+		if status, err = c.updateGenerateRoot(v, status, []string{key}); err != nil {
+			c.UI.Error(fmt.Sprintf("Failed to generate root token: %v", err))
+			return 1
+		}
+	}
+
+	if !status.Complete {
+		// partial generation must not be mistaken for success by scripts
+		if interactive {
+			c.UI.Error(fmt.Sprintf("Root token generation remains in progress at %d/%d: more key shares are required",
+				status.Progress, status.Required))
+			return 2
+		}
+		c.UI.Error(fmt.Sprintf("Not enough keys: root token generation progress %d/%d", status.Progress, status.Required))
+		return 1
+	}
+
+	encoded := status.EncodedToken
+	if encoded == "" {
+		encoded = status.EncodedRootToken
+	}
+
+	// the attempt was started by another run which holds the one-time password
+	if otp == "" {
+		c.UI.Info(fmt.Sprintf("Encoded root token: %s", encoded))
+		c.UI.Warn("Decode the root token with the one-time password the attempt was started with")
+		return 0
+	}
+
+	token, err := decodeRootToken(encoded, otp)
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Failed to decode root token: %v", err))
+		return 1
+	}
+
+	c.UI.Info(fmt.Sprintf("Root token: %s", token))
+	c.UI.Warn("Revoke the root token once it's no longer needed")
+
+	return 0
+}
+
+// startGenerateRoot starts a new root token generation attempt on vault server and returns its status
+// along with the one-time password which encodes the generated root token. If otp is empty,
+// a random one-time password is generated. The attempt in progress is resumed unless reset is true,
+// in which case it's discarded first. The resumed attempt is encoded with the one-time password
+// it was started with, which is only known if it's supplied via otp.
+func (c *GenerateRootCommand) startGenerateRoot(v *api.Client, otp string, reset bool) (*api.GenerateRootStatusResponse, string, error) {
+	status, err := v.Sys().GenerateRootStatus()
+	if err != nil {
+		return nil, "", err
+	}
+
+	if status.Started && reset {
+		if err := v.Sys().GenerateRootCancel(); err != nil {
+			return nil, "", fmt.Errorf("failed to reset root token generation: %v", err)
+		}
+		c.UI.Info(fmt.Sprintf("Host %s: discarded root token generation in progress", v.Address()))
+		status.Started = false
+	}
+
+	if status.Started {
+		c.UI.Info(fmt.Sprintf("Host %s: resuming root token generation at progress %d/%d",
+			v.Address(), status.Progress, status.Required))
+		return status, otp, nil
+	}
+
+	if otp == "" {
+		if otp, err = generateOTP(status.OTPLength); err != nil {
+			return nil, "", err
+		}
+		// the custodians who complete the attempt in another run need the one-time password
+		c.UI.Info(fmt.Sprintf("One-time password: %s", otp))
+	}
+
+	status, err = v.Sys().GenerateRootInit(otp, "")
+	if err != nil {
+		return nil, "", err
+	}
+
+	return status, otp, nil
+}
+
+// updateGenerateRoot submits distinct keys to the root token generation in progress one by one
+// until the root token is generated, reports the outcome of each key share and returns the
+// generation status. The keys which have already been submitted in the current attempt are
+// reported as duplicates and don't count towards the threshold.
+func (c *GenerateRootCommand) updateGenerateRoot(v *api.Client, status *api.GenerateRootStatusResponse, keys []string) (*api.GenerateRootStatusResponse, error) {
+	seen := make(map[string]bool)
+	for i, key := range keys {
+		if status.Complete {
+			break
+		}
+
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		share := unsealShare{key: i, progress: status.Progress}
+		next, err := v.Sys().GenerateRootUpdate(key, status.Nonce)
+		switch {
+		// unlike unseal, vault rejects the key shares which have already been submitted
+		case err != nil && strings.Contains(err.Error(), "already been provided"):
+			share.duplicate = true
+		case err != nil:
+			return status, fmt.Errorf("key share %d: %v", i+1, err)
+		default:
+			share.progress = next.Progress
+			if next.Complete {
+				share.progress = status.Required
+			}
+			status = next
+		}
+
+		c.UI.Info(fmt.Sprintf("Host %s: key share %s. Root token generation progress: %d/%d",
+			v.Address(), share.outcome(), share.progress, status.Required))
+	}
+
+	return status, nil
+}
+
+// generateOTP generates a random base62 one-time password of length n
+func generateOTP(n int) (string, error) {
+	const chars = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+	if n <= 0 {
+		return "", fmt.Errorf("vault does not report the one-time password length: set -otp")
+	}
+
+	otp := make([]byte, n)
+	for i := range otp {
+		idx, err := rand.Int(rand.Reader, big.NewInt(int64(len(chars))))
+		if err != nil {
+			return "", fmt.Errorf("failed to generate one-time password: %v", err)
+		}
+		otp[i] = chars[idx.Int64()]
+	}
+
+	return string(otp), nil
+}
+
+// decodeRootToken decodes the root token encoded with the one-time password otp
+func decodeRootToken(encoded, otp string) (string, error) {
+	raw, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(encoded, "="))
+	if err != nil {
+		return "", err
+	}
+
+	if len(raw) != len(otp) {
+		return "", fmt.Errorf("encoded root token length %d does not match one-time password length %d", len(raw), len(otp))
+	}
+
+	token := make([]byte, len(raw))
+	for i := range raw {
+		token[i] = raw[i] ^ otp[i]
+	}
+
+	return string(token), nil
+}
+
+// Synopsis provides a simple command description
+func (c *GenerateRootCommand) Synopsis() string {
+	return "Generate a new Vault root token using the unseal keys"
+}
+
+// Help returns detailed command help
+func (c *GenerateRootCommand) Help() string {
+	helpText := `
+Usage: vaultops generate-root [options]
+
+    Generate a new Vault root token using the unseal keys.
+
+    This command starts a root token generation attempt on the active Vault
+    server, submits the unseal keys read from the key store and prints the
+    generated root token. In interactive mode it prompts for the unseal key
+    shares instead, so each key share custodian can enter their key share on
+    their own terminal.
+
+    The root token is encoded with a one-time password which is generated
+    unless it's set via -otp. The attempt in progress is resumed, so the key
+    share custodians can complete it in several runs: the root token can only
+    be decoded with the one-time password the attempt was started with, so
+    pass it via -otp when resuming the attempt.
+
+General Options:
+` + GeneralOptionsUsage() + `
+generate-root Options:
+
+    -reset			Discard the attempt in progress before submitting the keys
+    -interactive		Prompt for the unseal key shares instead of reading them from key store;
+				exits with 2 if the root token is not generated
+    -stored-keys		Submit the stored keys before prompting for the key shares
+				in interactive mode
+    -otp			One-time password which encodes the root token
+    -config			Path to a config file which contains a list of vault servers
+`
+	return strings.TrimSpace(helpText)
+}
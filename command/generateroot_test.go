@@ -0,0 +1,182 @@
+package command
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/milosgajdos/vaultops/vaulttest"
+	"github.com/mitchellh/cli"
+	"github.com/stretchr/testify/assert"
+)
+
+// testRootToken returns the root token printed in out and checks it's valid on server s
+func testRootToken(t *testing.T, s *vaulttest.Server, out string) string {
+	m := regexp.MustCompile(`Root token: (\S+)`).FindStringSubmatch(out)
+	if !assert.Len(t, m, 2, out) {
+		return ""
+	}
+
+	token, ok := s.Token(m[1])
+	assert.True(t, ok)
+	if ok {
+		assert.Equal(t, []string{"root"}, token.Policies)
+	}
+
+	return m[1]
+}
+
+func TestGenerateRootCommand(t *testing.T) {
+	dir := makeTestDir(t)
+	defer os.RemoveAll(dir)
+	keyPath := filepath.Join(dir, "vault.json")
+
+	s := vaulttest.NewServer()
+	defer s.Close()
+	keys, token := s.Initialize(5, 3)
+	s.SetSealed(false)
+
+	// not enough keys
+	writeTestKeys(t, keyPath, &VaultKeys{RootToken: token, MasterKeys: keys[:2]})
+	ui := cli.NewMockUi()
+	c := &GenerateRootCommand{Meta: Meta{UI: ui}}
+	code := c.Run([]string{"-address", s.URL, "-key-local-path", keyPath})
+	assert.Equal(t, 1, code)
+	assert.Contains(t, ui.ErrorWriter.String(), "Not enough keys: root token generation progress 2/3")
+
+	// the attempt in progress is resumed: the submitted keys are ignored
+	writeTestKeys(t, keyPath, &VaultKeys{RootToken: token, MasterKeys: keys})
+	ui = cli.NewMockUi()
+	c = &GenerateRootCommand{Meta: Meta{UI: ui}}
+	code = c.Run([]string{"-address", s.URL, "-key-local-path", keyPath})
+	assert.Equal(t, 0, code, ui.ErrorWriter.String())
+
+	out := ui.OutputWriter.String()
+	assert.Contains(t, out, fmt.Sprintf("Host %s: resuming root token generation at progress 2/3", s.URL))
+	assert.Contains(t, out, fmt.Sprintf("Host %s: key share ignored: already submitted. Root token generation progress: 2/3", s.URL))
+	assert.Contains(t, out, fmt.Sprintf("Host %s: key share accepted. Root token generation progress: 3/3", s.URL))
+	assert.Contains(t, out, "Encoded root token: ")
+	assert.NotContains(t, out, "Root token: ")
+
+	// the attempt is started with the given one-time password
+	otp := strings.Repeat("x", vaulttest.OTPLength)
+	ui = cli.NewMockUi()
+	c = &GenerateRootCommand{Meta: Meta{UI: ui}}
+	code = c.Run([]string{"-address", s.URL, "-key-local-path", keyPath, "-otp", otp})
+	assert.Equal(t, 0, code, ui.ErrorWriter.String())
+	assert.NotContains(t, ui.OutputWriter.String(), "One-time password")
+	assert.NotEqual(t, token, testRootToken(t, s, ui.OutputWriter.String()))
+}
+
+func TestGenerateRootCommandInteractive(t *testing.T) {
+	dir := makeTestDir(t)
+	defer os.RemoveAll(dir)
+	keyPath := filepath.Join(dir, "vault.json")
+
+	s := vaulttest.NewServer()
+	defer s.Close()
+	keys, token := s.Initialize(5, 3)
+	s.SetSealed(false)
+
+	// the stored keys are not read unless requested
+	ui := cli.NewMockUi()
+	ui.InputReader = iotest.OneByteReader(strings.NewReader(keys[0] + "\n\n"))
+	c := &GenerateRootCommand{Meta: Meta{UI: ui}}
+	code := c.Run([]string{"-address", s.URL, "-interactive", "-key-local-path", filepath.Join(dir, "missing.json")})
+	assert.Equal(t, 2, code, ui.ErrorWriter.String())
+	assert.Contains(t, ui.ErrorWriter.String(), "Root token generation remains in progress at 1/3")
+
+	out := ui.OutputWriter.String()
+	assert.Contains(t, out, fmt.Sprintf("Host %s: key share accepted. Root token generation progress: 1/3", s.URL))
+	m := regexp.MustCompile(`One-time password: (\S+)`).FindStringSubmatch(out)
+	if !assert.Len(t, m, 2, out) {
+		return
+	}
+	otp := m[1]
+	assert.Len(t, otp, vaulttest.OTPLength)
+
+	// the next custodian tops up the stored keys and completes the attempt
+	writeTestKeys(t, keyPath, &VaultKeys{RootToken: token, MasterKeys: keys[:2]})
+	ui = cli.NewMockUi()
+	ui.InputReader = iotest.OneByteReader(strings.NewReader("foo!bar\n" + keys[4] + "\n"))
+	c = &GenerateRootCommand{Meta: Meta{UI: ui}}
+	code = c.Run([]string{"-address", s.URL, "-interactive", "-stored-keys", "-key-local-path", keyPath, "-otp", otp})
+	assert.Equal(t, 0, code, ui.ErrorWriter.String())
+	assert.Contains(t, ui.ErrorWriter.String(), "Invalid key share")
+
+	out = ui.OutputWriter.String()
+	assert.Contains(t, out, fmt.Sprintf("Host %s: resuming root token generation at progress 1/3", s.URL))
+	assert.Contains(t, out, fmt.Sprintf("Host %s: key share ignored: already submitted. Root token generation progress: 1/3", s.URL))
+	assert.Contains(t, out, fmt.Sprintf("Host %s: key share accepted. Root token generation progress: 3/3", s.URL))
+	testRootToken(t, s, out)
+
+	// the attempt in progress is discarded
+	ui = cli.NewMockUi()
+	ui.InputReader = iotest.OneByteReader(strings.NewReader(keys[0] + "\n\n"))
+	c = &GenerateRootCommand{Meta: Meta{UI: ui}}
+	code = c.Run([]string{"-address", s.URL, "-interactive"})
+	assert.Equal(t, 2, code, ui.ErrorWriter.String())
+
+	ui = cli.NewMockUi()
+	ui.InputReader = iotest.OneByteReader(strings.NewReader(strings.Join(keys[:3], "\n") + "\n"))
+	c = &GenerateRootCommand{Meta: Meta{UI: ui}}
+	code = c.Run([]string{"-address", s.URL, "-interactive", "-reset"})
+	assert.Equal(t, 0, code, ui.ErrorWriter.String())
+	assert.Contains(t, ui.OutputWriter.String(), fmt.Sprintf("Host %s: discarded root token generation in progress", s.URL))
+	testRootToken(t, s, ui.OutputWriter.String())
+}
+
+func TestGenerateRootCommandFailure(t *testing.T) {
+	s := vaulttest.NewServer()
+	defer s.Close()
+	keys, _ := s.Initialize(3, 2)
+
+	// no active server
+	ui := cli.NewMockUi()
+	c := &GenerateRootCommand{Meta: Meta{UI: ui}}
+	code := c.Run([]string{"-address", s.URL, "-interactive"})
+	assert.Equal(t, 1, code)
+	assert.Contains(t, ui.ErrorWriter.String(), "Failed to find active vault server")
+
+	// invalid one-time password
+	s.SetSealed(false)
+	ui = cli.NewMockUi()
+	ui.InputReader = strings.NewReader(keys[0] + "\n")
+	c = &GenerateRootCommand{Meta: Meta{UI: ui}}
+	code = c.Run([]string{"-address", s.URL, "-interactive", "-otp", "foo"})
+	assert.Equal(t, 1, code)
+	assert.Contains(t, ui.ErrorWriter.String(), "Failed to start root token generation")
+}
+
+func TestDecodeRootToken(t *testing.T) {
+	otp, err := generateOTP(vaulttest.OTPLength)
+	assert.NoError(t, err)
+	assert.Len(t, otp, vaulttest.OTPLength)
+
+	_, err = generateOTP(0)
+	assert.Error(t, err)
+
+	token := "s." + strings.Repeat("t", vaulttest.OTPLength-2)
+	encoded := make([]byte, len(token))
+	for i := range encoded {
+		encoded[i] = token[i] ^ otp[i]
+	}
+
+	// vault may pad the encoded token
+	for _, enc := range []string{
+		base64.RawStdEncoding.EncodeToString(encoded),
+		base64.StdEncoding.EncodeToString(encoded),
+	} {
+		decoded, err := decodeRootToken(enc, otp)
+		assert.NoError(t, err)
+		assert.Equal(t, token, decoded)
+	}
+
+	_, err = decodeRootToken(base64.RawStdEncoding.EncodeToString(encoded), otp[1:])
+	assert.Error(t, err)
+}
@@ -2,63 +2,173 @@ package command
 
 import (
 	"fmt"
+	"strings"
 
+	"github.com/milosgajdos/vaultops/auth"
 	"github.com/milosgajdos/vaultops/cipher"
 	"github.com/milosgajdos/vaultops/cloud/aws"
 	"github.com/milosgajdos/vaultops/cloud/gcp"
+	"github.com/milosgajdos/vaultops/manifest"
 	"github.com/milosgajdos/vaultops/store"
 	"github.com/milosgajdos/vaultops/store/k8s"
 	"github.com/milosgajdos/vaultops/store/local"
 )
 
-// VaultKeyStore creates vault keys store
-func VaultKeyStore(storeType string, m *Meta) (s store.Store, err error) {
-	switch storeType {
+// VaultKeyStore creates vault keys store configured by ks
+func VaultKeyStore(ks *manifest.KeyStore) (s store.Store, err error) {
+	switch ks.Type {
 	case "local":
-		s, err = local.NewStore(m.flagKeyLocalPath)
+		s, err = local.NewStore(ks.LocalPath)
 		if err != nil {
 			return nil, err
 		}
 	case "s3":
-		s, err = aws.NewS3(m.flagStorageBucket, m.flagStorageKey)
+		sess, err := aws.NewSession(awsConfig(&ks.AWS))
+		if err != nil {
+			return nil, err
+		}
+		s, err = aws.NewS3WithConfig(ks.Bucket, ks.Key, sess, &aws.S3Config{
+			Endpoint:       ks.S3.Endpoint,
+			ForcePathStyle: ks.S3.ForcePathStyle,
+			SSE:            ks.S3.SSE,
+			SSEKMSKeyID:    ks.S3.SSEKMSKeyID,
+		})
+		if err != nil {
+			return nil, err
+		}
+	case "secretsmanager":
+		sess, err := aws.NewSession(awsConfig(&ks.AWS))
+		if err != nil {
+			return nil, err
+		}
+		s, err = aws.NewSecretsManagerWithSession(ks.Key, ks.SecretsManager.VersionStage, ks.SecretsManager.KMSKeyID, sess)
+		if err != nil {
+			return nil, err
+		}
+	case "ssm":
+		sess, err := aws.NewSession(awsConfig(&ks.AWS))
+		if err != nil {
+			return nil, err
+		}
+		s, err = aws.NewSSMWithSession(ks.Key, ks.SSM.KMSKeyID, sess)
 		if err != nil {
 			return nil, err
 		}
 	case "gcs":
-		s, err = gcp.NewGCS(m.flagStorageBucket, m.flagStorageKey)
+		s, err = gcp.NewGCS(ks.Bucket, ks.Key)
+		if err != nil {
+			return nil, err
+		}
+	case "gcpsm":
+		sm := ks.GCPSecretManager
+		s, err = gcp.NewSecretManager(sm.Project, ks.Key, sm.Version, sm.DisableOld)
 		if err != nil {
 			return nil, err
 		}
 	case "k8s":
-		s, err = k8s.NewStore(m.flagStorageBucket, m.flagStorageKey, m.flagNamespace)
+		kube := ks.Kubernetes
+		s, err = k8s.NewStore(ks.Bucket, ks.Key, kube.Namespace, &k8s.Config{
+			Kubeconfig:  kube.Kubeconfig,
+			Context:     kube.Context,
+			Timeout:     kube.Timeout,
+			Labels:      kube.Labels,
+			Annotations: kube.Annotations,
+			Owner:       kube.Owner,
+			Immutable:   kube.Immutable,
+		})
 		if err != nil {
 			return nil, err
 		}
 	default:
-		return nil, fmt.Errorf("unsupported store: %s", storeType)
+		return nil, fmt.Errorf("unsupported store: %s", ks.Type)
 	}
 
 	return s, nil
 }
 
-// VaultKeyCipher returns KMS key handle to use for encrypting and decrypting keys
-func VaultKeyCipher(m *Meta) (c cipher.Cipher, err error) {
-	switch m.flagKMSProvider {
+// VaultKeyCipher returns KMS key handle configured by c to use for encrypting and decrypting keys
+func VaultKeyCipher(c *manifest.Cipher) (cphr cipher.Cipher, err error) {
+	switch c.Provider {
+	case "aws":
+		sess, err := aws.NewSession(awsConfig(&c.AWS.AWS))
+		if err != nil {
+			return nil, err
+		}
+		cphr, err = aws.NewKMSWithSession(sess, c.AWS.KeyID)
+		if err != nil {
+			return nil, err
+		}
+	case "gcp":
+		cphr, err = gcp.NewKMS(c.GCP.Project, c.GCP.Region, c.GCP.KeyRing, c.GCP.CryptoKey)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported cipher provider: %s", c.Provider)
+	}
+
+	return cphr, nil
+}
+
+// VaultAuthMethod creates vault auth method configured by a
+func VaultAuthMethod(a *manifest.Auth) (m auth.Method, err error) {
+	switch a.Method {
+	case "approle":
+		m, err = auth.NewAppRole(a.Mount, a.RoleID, a.SecretID)
+		if err != nil {
+			return nil, err
+		}
+	case "kubernetes":
+		m, err = auth.NewKubernetes(a.Mount, a.Role, a.JWTPath)
+		if err != nil {
+			return nil, err
+		}
 	case "aws":
-		c, err = aws.NewKMS(m.flagAwsKmsID)
+		sess, err := aws.NewSession(awsConfig(&a.AWS.AWS))
 		if err != nil {
 			return nil, err
 		}
+		m = aws.NewIAMAuthWithSession(sess, a.Mount, a.Role, a.AWS.HeaderValue)
 	case "gcp":
-		c, err = gcp.NewKMS(m.flagGcpKmsProject, m.flagGcpKmsRegion, m.flagGcpKmsKeyRing, m.flagGcpKmsCryptoKey)
+		m, err = gcp.NewIAMAuth(a.Mount, a.Role, a.GCP.ServiceAccount)
 		if err != nil {
 			return nil, err
 		}
+	case "cert":
+		m = auth.NewCert(a.Mount, a.Role)
 	default:
-		return nil, fmt.Errorf("unsupported cipher provider: %s", m.flagKMSProvider)
+		return nil, fmt.Errorf("unsupported auth method: %s", a.Method)
+	}
+
+	return m, nil
+}
+
+// awsConfig returns AWS session configuration
+func awsConfig(a *manifest.AWS) *aws.Config {
+	return &aws.Config{
+		Region:     a.Region,
+		Profile:    a.Profile,
+		RoleARN:    a.RoleARN,
+		ExternalID: a.ExternalID,
+	}
+}
+
+// parseKeyValues parses comma separated list of key=value pairs and returns them in a map
+func parseKeyValues(s string) (map[string]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	kv := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("invalid key=value pair: %q", pair)
+		}
+		kv[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
 	}
 
-	return c, nil
+	return kv, nil
 }
 
 // Redact returns string of characters ch of length long
@@ -6,39 +6,34 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/milosgajdos/vaultops/manifest"
 	"github.com/stretchr/testify/assert"
 )
 
-func makeTestMeta() *Meta {
-	return &Meta{
-		flagKMSProvider:     "aws",
-		flagAwsKmsID:        "id",
-		flagGcpKmsCryptoKey: "key",
-		flagGcpKmsKeyRing:   "ring",
-		flagGcpKmsRegion:    "region",
-		flagGcpKmsProject:   "project",
-		flagStorageBucket:   "bucket",
-		flagStorageKey:      "somekey",
-		flagKeyLocalPath:    filepath.Join(localDir, localFile),
+func makeTestKeyStore(storeType string) *manifest.KeyStore {
+	return &manifest.KeyStore{
+		Type:      storeType,
+		Bucket:    "bucket",
+		Key:       "somekey",
+		LocalPath: filepath.Join(localDir, localFile),
 	}
 }
 
 func TestVaultKeyStore(t *testing.T) {
-	m := makeTestMeta()
-
 	testCases := []struct {
 		storeType string
-		meta      *Meta
 		result    error
 	}{
-		{"local", m, nil},
-		{"s3", m, nil},
-		{"foobar", m, fmt.Errorf("unsupported store: foobar")},
+		{"local", nil},
+		{"s3", nil},
+		{"secretsmanager", nil},
+		{"ssm", nil},
+		{"foobar", fmt.Errorf("unsupported store: foobar")},
 	}
 	defer os.Remove(filepath.Join(localDir, localFile))
 
 	for _, tc := range testCases {
-		s, err := VaultKeyStore(tc.storeType, m)
+		s, err := VaultKeyStore(makeTestKeyStore(tc.storeType))
 		if tc.result == nil {
 			assert.NotNil(t, s)
 		} else {
@@ -48,20 +43,62 @@ func TestVaultKeyStore(t *testing.T) {
 	}
 }
 
+func TestVaultKeyStoreS3(t *testing.T) {
+	ks := makeTestKeyStore("s3")
+	ks.S3 = manifest.S3{
+		Endpoint:       "http://127.0.0.1:9000",
+		ForcePathStyle: true,
+		SSE:            "aws:kms",
+		SSEKMSKeyID:    "id",
+	}
+
+	s, err := VaultKeyStore(ks)
+	assert.NoError(t, err)
+	assert.NotNil(t, s)
+
+	ks.S3.SSE = "foobar"
+	s, err = VaultKeyStore(ks)
+	assert.Error(t, err)
+	assert.Nil(t, s)
+}
+
 func TestVaultKeyCipher(t *testing.T) {
-	m := makeTestMeta()
+	c := &manifest.Cipher{
+		Provider: "aws",
+		AWS:      manifest.AWSKMS{KeyID: "id"},
+		GCP: manifest.GCPKMS{
+			Project:   "project",
+			Region:    "region",
+			KeyRing:   "ring",
+			CryptoKey: "key",
+		},
+	}
 
-	m.flagKMSProvider = "aws"
-	k, err := VaultKeyCipher(m)
+	k, err := VaultKeyCipher(c)
 	assert.NoError(t, err)
 	assert.NotNil(t, k)
 
-	m.flagKMSProvider = "foobar"
-	k, err = VaultKeyCipher(m)
+	c.Provider = "foobar"
+	k, err = VaultKeyCipher(c)
 	assert.Error(t, err)
 	assert.Nil(t, k)
 }
 
+func TestParseKeyValues(t *testing.T) {
+	kv, err := parseKeyValues("")
+	assert.NoError(t, err)
+	assert.Nil(t, kv)
+
+	kv, err = parseKeyValues("app=vault, team = ops,empty=")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"app": "vault", "team": "ops", "empty": ""}, kv)
+
+	for _, s := range []string{"foo", "=bar", "app=vault,"} {
+		_, err = parseKeyValues(s)
+		assert.Error(t, err)
+	}
+}
+
 func TestRedact(t *testing.T) {
 	ch := rune('X')
 	length := 5
@@ -1,13 +1,13 @@
 package command
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"strings"
 
 	"github.com/hashicorp/vault/api"
 	"github.com/milosgajdos/vaultops/cipher"
-	"github.com/milosgajdos/vaultops/manifest"
 	"github.com/milosgajdos/vaultops/store"
 )
 
@@ -24,6 +24,7 @@ func (c *InitCommand) Run(args []string) int {
 	var status bool
 	var threshold, shares int
 	var config string
+	var wf waitFlags
 
 	flags := c.Meta.FlagSet("init", FlagSetDefault)
 	flags.Usage = func() { c.UI.Info(c.Help()) }
@@ -31,10 +32,30 @@ func (c *InitCommand) Run(args []string) int {
 	flags.IntVar(&shares, "key-shares", 5, "")
 	flags.IntVar(&threshold, "key-threshold", 3, "")
 	flags.StringVar(&config, "config", "", "")
+	wf.register(flags)
 	if err := flags.Parse(args); err != nil {
 		return 1
 	}
 
+	if err := wf.validate(); err != nil {
+		c.UI.Error(fmt.Sprintf("Failed to parse options: %v", err))
+		return 1
+	}
+
+	// -timeout bounds waiting for the hosts as well as the init itself
+	ctx, cancel := wf.context()
+	defer cancel()
+
+	// report the init status of all the clusters declared in the manifest
+	if status && c.allClusters(config) {
+		return c.runClusters(config, "init", func(m *Meta, hosts []string) int {
+			if wf.wait && !m.waitForHosts(ctx, hosts, &wf) {
+				return 1
+			}
+			return (&InitCommand{Meta: *m}).runInitStatus(ctx, hosts)
+		})
+	}
+
 	// get hosts against which we want to run init command
 	hosts, err := c.getRunHosts(config)
 	if err != nil {
@@ -42,10 +63,16 @@ func (c *InitCommand) Run(args []string) int {
 		return 1
 	}
 
+	if wf.wait && !c.waitForHosts(ctx, hosts, &wf) {
+		return 1
+	}
+
 	if status {
-		return c.runInitStatus(hosts)
+		return c.runInitStatus(ctx, hosts)
 	}
 
+	shares, threshold = c.keyShares(shares, threshold)
+
 	// init request options
 	req := &api.InitRequest{
 		SecretShares:      shares,
@@ -54,19 +81,25 @@ func (c *InitCommand) Run(args []string) int {
 		RecoveryThreshold: threshold,
 	}
 
+	ks, cc, err := c.keysConfig()
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("failed to read key store configuration: %v", err))
+		return 1
+	}
+
 	// create vault key store handle
-	s, err := VaultKeyStore(c.flagKeyStore, &c.Meta)
+	s, err := VaultKeyStore(ks)
 	if err != nil {
-		c.UI.Error(fmt.Sprintf("failed to initialize %s store: %v", c.flagKeyStore, err))
+		c.UI.Error(fmt.Sprintf("failed to initialize %s store: %v", ks.Type, err))
 		return 1
 	}
 
 	// if kms provider not empty, initialize cipher
 	var cphr cipher.Cipher
-	if c.flagKMSProvider != "" {
-		cphr, err = VaultKeyCipher(&c.Meta)
+	if cc.Provider != "" {
+		cphr, err = VaultKeyCipher(cc)
 		if err != nil {
-			c.UI.Error(fmt.Sprintf("failed to create %s cipher: %v", c.flagKMSProvider, err))
+			c.UI.Error(fmt.Sprintf("failed to create %s cipher: %v", cc.Provider, err))
 			return 1
 		}
 	}
@@ -76,18 +109,18 @@ func (c *InitCommand) Run(args []string) int {
 		c.UI.Info(fmt.Sprintf("\t%s", host))
 	}
 
-	return c.runInit(hosts, req, s, cphr, c.flagRedact)
+	return c.runInit(ctx, hosts, req, ks.Type, s, cphr, c.flagRedact)
 }
 
 // runHosts retrieves a list of hosts agsints which the Init cmd should be run from configuration and returns it
 func (c *InitCommand) getRunHosts(config string) ([]string, error) {
 	if config != "" {
-		m, err := manifest.Parse(config)
+		m, err := c.parseManifest(config)
 		if err != nil {
 			return nil, err
 		}
 
-		hosts, err := m.GetHosts("init")
+		hosts, err := c.manifestHosts(m, "init")
 		if err != nil {
 			return nil, err
 		}
@@ -105,7 +138,7 @@ func (c *InitCommand) getRunHosts(config string) ([]string, error) {
 }
 
 // runInitStatus checks init status of vault server
-func (c *InitCommand) runInitStatus(hosts []string) int {
+func (c *InitCommand) runInitStatus(ctx context.Context, hosts []string) int {
 	// status response
 	type res struct {
 		host   string
@@ -122,7 +155,7 @@ func (c *InitCommand) runInitStatus(hosts []string) int {
 		}
 		go func(h string) {
 			c.UI.Info(fmt.Sprintf("Reading init status for host: %s", h))
-			status, err := v.Sys().InitStatus()
+			status, err := initStatus(ctx, v)
 			statChan <- &res{host: h, status: status, err: err}
 		}(host)
 	}
@@ -146,7 +179,8 @@ func (c *InitCommand) runInitStatus(hosts []string) int {
 }
 
 // runInit initializes vault server and returns 0 if successful
-func (c *InitCommand) runInit(hosts []string, req *api.InitRequest, s store.Store, cphr cipher.Cipher, redact bool) int {
+// The init requests fail once ctx is done.
+func (c *InitCommand) runInit(ctx context.Context, hosts []string, req *api.InitRequest, storeType string, s store.Store, cphr cipher.Cipher, redact bool) int {
 	// init response
 	type res struct {
 		host string
@@ -167,7 +201,7 @@ func (c *InitCommand) runInit(hosts []string, req *api.InitRequest, s store.Stor
 		}
 		go func(h string) {
 			// initialize vault server
-			resp, err := v.Sys().Init(req)
+			resp, err := initVault(ctx, v, req)
 			initChan <- &res{host: h, resp: resp, err: err}
 		}(host)
 	}
@@ -196,7 +230,7 @@ func (c *InitCommand) runInit(hosts []string, req *api.InitRequest, s store.Stor
 
 		// write the retrieved vault keys into .local/vault.json
 		vk := &VaultKeys{RootToken: initRes.resp.RootToken, MasterKeys: initRes.resp.Keys}
-		c.UI.Info(fmt.Sprintf("Attempting to store the vault keys in store: %s", c.Meta.flagKeyStore))
+		c.UI.Info(fmt.Sprintf("Attempting to store the vault keys in store: %s", storeType))
 		if _, err := vk.Write(s, cphr); err != nil {
 			c.UI.Error(fmt.Sprintf("Failed to store vault keys: %v", err))
 			return 1
@@ -235,9 +269,17 @@ General Options:
 init Options:
 
   -status 			Don't initialize the server, only check the init status
+				of all the clusters in the config file unless -cluster is set
   -key-shares=5 		Number of key shares to split the master key into
+				Overrides the keys section of the config file
   -key-threshold=3		Number of key shares required to reconstruct the master key
+				Overrides the keys section of the config file
   -config			Path to a config file which contains a list of vault servers
+  -wait				Wait until all vault servers are reachable before proceeding
+  -timeout=5m			Maximum time to wait for vault servers to become reachable
+				and to initialize them
+  -retry-interval=1s		Initial interval between reachability checks; it grows
+				exponentially with each failed check
 
 `
 	return strings.TrimSpace(helpText)
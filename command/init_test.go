@@ -0,0 +1,173 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/milosgajdos/vaultops/vaulttest"
+	"github.com/mitchellh/cli"
+	"github.com/stretchr/testify/assert"
+)
+
+// makeTestDir creates a temporary directory for the command test artifacts
+func makeTestDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "vaultops")
+	assert.NoError(t, err)
+
+	return dir
+}
+
+// makeTestManifest writes a manifest which lists init and unseal hosts into dir and returns its path
+func makeTestManifest(t *testing.T, dir string, init, unseal []string) string {
+	data := "hosts:\n  init:\n"
+	for _, h := range init {
+		data += fmt.Sprintf("    - %s\n", h)
+	}
+	data += "  unseal:\n"
+	for _, h := range unseal {
+		data += fmt.Sprintf("    - %s\n", h)
+	}
+
+	path := filepath.Join(dir, "manifest.yaml")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(data), 0600))
+
+	return path
+}
+
+// appendTestManifest appends data to the manifest stored in path
+func appendTestManifest(t *testing.T, path, data string) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	assert.NoError(t, err)
+	defer f.Close()
+
+	_, err = f.WriteString(data)
+	assert.NoError(t, err)
+}
+
+// readTestKeys reads unencrypted vault keys stored in path
+func readTestKeys(t *testing.T, path string) *VaultKeys {
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+
+	vk := new(VaultKeys)
+	assert.NoError(t, json.Unmarshal(data, vk))
+
+	return vk
+}
+
+func TestInitCommandStatus(t *testing.T) {
+	s := vaulttest.NewServer()
+	defer s.Close()
+
+	ui := cli.NewMockUi()
+	c := &InitCommand{Meta: Meta{UI: ui}}
+	code := c.Run([]string{"-address", s.URL, "-status"})
+	assert.Equal(t, 0, code)
+	assert.Contains(t, ui.OutputWriter.String(), fmt.Sprintf("Host: %s Initialized: false", s.URL))
+
+	s.Initialize(5, 3)
+	ui = cli.NewMockUi()
+	c = &InitCommand{Meta: Meta{UI: ui}}
+	code = c.Run([]string{"-address", s.URL, "-status"})
+	assert.Equal(t, 0, code)
+	assert.Contains(t, ui.OutputWriter.String(), fmt.Sprintf("Host: %s Initialized: true", s.URL))
+
+	s.Fail("/v1/sys/init", http.StatusInternalServerError, 1)
+	ui = cli.NewMockUi()
+	c = &InitCommand{Meta: Meta{UI: ui}}
+	code = c.Run([]string{"-address", s.URL, "-status"})
+	assert.Equal(t, 1, code)
+	assert.Contains(t, ui.ErrorWriter.String(), "Failed to read init status")
+}
+
+func TestInitCommand(t *testing.T) {
+	dir := makeTestDir(t)
+	defer os.RemoveAll(dir)
+	keyPath := filepath.Join(dir, "vault.json")
+
+	s := vaulttest.NewServer()
+	defer s.Close()
+
+	ui := cli.NewMockUi()
+	c := &InitCommand{Meta: Meta{UI: ui}}
+	code := c.Run([]string{"-address", s.URL, "-key-local-path", keyPath, "-key-shares", "3", "-key-threshold", "2"})
+	assert.Equal(t, 0, code, ui.ErrorWriter.String())
+	assert.True(t, s.Initialized())
+	assert.Contains(t, ui.OutputWriter.String(), "Vault successfully initialized")
+	// keys are redacted by default
+	for _, key := range s.Keys() {
+		assert.NotContains(t, ui.OutputWriter.String(), key)
+	}
+	assert.NotContains(t, ui.OutputWriter.String(), s.RootToken())
+
+	vk := readTestKeys(t, keyPath)
+	assert.Equal(t, s.Keys(), vk.MasterKeys)
+	assert.Equal(t, s.RootToken(), vk.RootToken)
+
+	// initialized server fails to initialize
+	ui = cli.NewMockUi()
+	c = &InitCommand{Meta: Meta{UI: ui}}
+	code = c.Run([]string{"-address", s.URL, "-key-local-path", filepath.Join(dir, "other.json")})
+	assert.Equal(t, 1, code)
+	assert.Contains(t, ui.ErrorWriter.String(), "Failed to initialize")
+}
+
+func TestInitCommandManifest(t *testing.T) {
+	dir := makeTestDir(t)
+	defer os.RemoveAll(dir)
+	keyPath := filepath.Join(dir, "vault.json")
+
+	s := vaulttest.NewServer()
+	defer s.Close()
+
+	config := makeTestManifest(t, dir, []string{s.URL}, nil)
+
+	ui := cli.NewMockUi()
+	c := &InitCommand{Meta: Meta{UI: ui}}
+	code := c.Run([]string{"-config", config, "-key-local-path", keyPath, "-redact=false"})
+	assert.Equal(t, 0, code, ui.ErrorWriter.String())
+	assert.True(t, s.Initialized())
+	for _, key := range s.Keys() {
+		assert.Contains(t, ui.OutputWriter.String(), key)
+	}
+	assert.Contains(t, ui.OutputWriter.String(), s.RootToken())
+
+	// non-existent manifest
+	ui = cli.NewMockUi()
+	c = &InitCommand{Meta: Meta{UI: ui}}
+	code = c.Run([]string{"-config", filepath.Join(dir, "foobar.yaml")})
+	assert.Equal(t, 1, code)
+	assert.Contains(t, ui.ErrorWriter.String(), "failed to read vault hosts")
+}
+
+func TestInitCommandErrors(t *testing.T) {
+	dir := makeTestDir(t)
+	defer os.RemoveAll(dir)
+	keyPath := filepath.Join(dir, "vault.json")
+
+	s := vaulttest.NewServer()
+	defer s.Close()
+
+	testCases := []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"-foobar"}, ""},
+		{[]string{"-address", s.URL, "-key-store", "foobar"}, "failed to initialize foobar store"},
+		{[]string{"-address", s.URL, "-key-local-path", keyPath, "-kms-provider", "foobar"}, "failed to create foobar cipher"},
+	}
+
+	for _, tc := range testCases {
+		ui := cli.NewMockUi()
+		c := &InitCommand{Meta: Meta{UI: ui}}
+		code := c.Run(tc.args)
+		assert.Equal(t, 1, code)
+		assert.Contains(t, ui.ErrorWriter.String(), tc.err)
+	}
+	assert.False(t, s.Initialized())
+}
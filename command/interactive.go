@@ -0,0 +1,113 @@
+package command
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// validateKeyShare checks if key is hex or base64 encoded key share
+func validateKeyShare(key string) error {
+	if key == "" {
+		return fmt.Errorf("empty key share")
+	}
+
+	if _, err := hex.DecodeString(key); err == nil {
+		return nil
+	}
+
+	if _, err := base64.StdEncoding.DecodeString(key); err == nil {
+		return nil
+	}
+
+	return fmt.Errorf("key share must be hex or base64 encoded")
+}
+
+// runInteractiveUnseal prompts for unseal key shares and submits them to vault hosts
+// until all the hosts are unsealed or until no key share is entered.
+// It returns 2 if any of the hosts remains sealed. The unseal is not bounded by -timeout
+// as it takes as long as the key share custodians need to enter their key shares.
+// The keys in vk, if any, are submitted before prompting for the key shares so
+// a partial set of stored keys can be topped up by the key share custodians.
+func (c *UnsealCommand) runInteractiveUnseal(hosts []string, vk *VaultKeys, reset bool) int {
+	clients := make(map[string]*api.Client)
+	var sealed []string
+
+	for _, host := range hosts {
+		v, err := c.Client(host, vk.Token())
+		if err != nil {
+			c.UI.Error(fmt.Sprintf("Failed to fetch Vault client: %v", err))
+			return 1
+		}
+		clients[host] = v
+
+		report, err := unsealHost(context.Background(), v, vk.MasterKeys, reset)
+		c.reportUnseal(host, report)
+		if err != nil {
+			c.UI.Error(fmt.Sprintf("Failed to unseal %s: %v", host, err))
+			return 1
+		}
+
+		if !report.status.Sealed {
+			c.UI.Info(fmt.Sprintf("Host %s: unsealed", host))
+			continue
+		}
+
+		c.UI.Info(fmt.Sprintf("Host %s: unseal progress: %d/%d", host, report.status.Progress, report.status.T))
+		sealed = append(sealed, host)
+	}
+
+	for len(sealed) > 0 {
+		key, err := c.UI.AskSecret("Unseal key share (leave empty to stop):")
+		if err != nil && err != io.EOF {
+			c.UI.Error(fmt.Sprintf("Failed to read key share: %v", err))
+			return 1
+		}
+
+		key = strings.TrimSpace(key)
+		if key == "" {
+			break
+		}
+
+		if err := validateKeyShare(key); err != nil {
+			c.UI.Error(fmt.Sprintf("Invalid key share: %v", err))
+			continue
+		}
+
+		var remaining []string
+		for _, host := range sealed {
+			report, err := unsealHost(context.Background(), clients[host], []string{key}, false)
+			if err != nil {
+				c.UI.Error(fmt.Sprintf("Failed to unseal %s: %v", host, err))
+				return 1
+			}
+
+			for _, share := range report.shares {
+				c.UI.Info(fmt.Sprintf("Host %s: key share %s. Unseal progress: %d/%d",
+					host, share.outcome(), share.progress, report.status.T))
+			}
+
+			if !report.status.Sealed {
+				c.UI.Info(fmt.Sprintf("Host %s: unsealed", host))
+				continue
+			}
+			remaining = append(remaining, host)
+		}
+		sealed = remaining
+	}
+
+	// partial unseal must not be mistaken for success by scripts
+	if len(sealed) > 0 {
+		c.UI.Error(fmt.Sprintf("%d vault hosts remain sealed: more key shares are required", len(sealed)))
+		return 2
+	}
+
+	c.UI.Info("Vault successfully unsealed")
+
+	return 0
+}
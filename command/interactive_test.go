@@ -0,0 +1,83 @@
+package command
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/milosgajdos/vaultops/vaulttest"
+	"github.com/mitchellh/cli"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateKeyShare(t *testing.T) {
+	assert.NoError(t, validateKeyShare("0a1b2c"))
+	assert.NoError(t, validateKeyShare("CisOwA=="))
+	assert.Error(t, validateKeyShare(""))
+	assert.Error(t, validateKeyShare("foo!bar"))
+}
+
+func TestUnsealCommandInteractive(t *testing.T) {
+	dir := makeTestDir(t)
+	defer os.RemoveAll(dir)
+
+	s := vaulttest.NewServer()
+	defer s.Close()
+	keys, _ := s.Initialize(5, 3)
+
+	// the stored keys are not read unless requested
+	ui := cli.NewMockUi()
+	ui.InputReader = iotest.OneByteReader(strings.NewReader(keys[0] + "\n\n"))
+	c := &UnsealCommand{Meta: Meta{UI: ui}}
+	code := c.Run([]string{"-address", s.URL, "-interactive", "-key-local-path", filepath.Join(dir, "missing.json")})
+	assert.Equal(t, 2, code, ui.ErrorWriter.String())
+	assert.True(t, s.Sealed())
+	assert.Equal(t, 1, s.Progress())
+	assert.Contains(t, ui.OutputWriter.String(), fmt.Sprintf("Host %s: key share accepted. Unseal progress: 1/3", s.URL))
+	assert.Contains(t, ui.ErrorWriter.String(), "1 vault hosts remain sealed")
+
+	// the next custodian resumes the unseal
+	ui = cli.NewMockUi()
+	ui.InputReader = iotest.OneByteReader(strings.NewReader(strings.Join([]string{"foo!bar", keys[0], keys[1], keys[2]}, "\n") + "\n"))
+	c = &UnsealCommand{Meta: Meta{UI: ui}}
+	code = c.Run([]string{"-address", s.URL, "-interactive"})
+	assert.Equal(t, 0, code, ui.ErrorWriter.String())
+	assert.False(t, s.Sealed())
+
+	out := ui.OutputWriter.String()
+	assert.Contains(t, ui.ErrorWriter.String(), "Invalid key share")
+	assert.Contains(t, out, fmt.Sprintf("Host %s: unseal progress: 1/3", s.URL))
+	assert.Contains(t, out, fmt.Sprintf("Host %s: key share ignored: already submitted. Unseal progress: 1/3", s.URL))
+	assert.Contains(t, out, fmt.Sprintf("Host %s: key share accepted. Unseal progress: 3/3", s.URL))
+	assert.Contains(t, out, "Vault successfully unsealed")
+}
+
+func TestUnsealCommandInteractiveStoredKeys(t *testing.T) {
+	dir := makeTestDir(t)
+	defer os.RemoveAll(dir)
+	keyPath := filepath.Join(dir, "vault.json")
+
+	s := vaulttest.NewServer()
+	defer s.Close()
+	keys, token := s.Initialize(5, 3)
+	writeTestKeys(t, keyPath, &VaultKeys{RootToken: token, MasterKeys: keys[:2]})
+
+	// the stored keys are topped up with the entered key share
+	ui := cli.NewMockUi()
+	ui.InputReader = iotest.OneByteReader(strings.NewReader(keys[4] + "\n"))
+	c := &UnsealCommand{Meta: Meta{UI: ui}}
+	code := c.Run([]string{"-address", s.URL, "-interactive", "-stored-keys", "-key-local-path", keyPath})
+	assert.Equal(t, 0, code, ui.ErrorWriter.String())
+	assert.False(t, s.Sealed())
+	assert.Equal(t, 3, s.Requests("/v1/sys/unseal"))
+
+	// the stored keys must be readable
+	ui = cli.NewMockUi()
+	c = &UnsealCommand{Meta: Meta{UI: ui}}
+	code = c.Run([]string{"-address", s.URL, "-interactive", "-stored-keys", "-key-local-path", filepath.Join(dir, "missing.json")})
+	assert.Equal(t, 1, code)
+	assert.Contains(t, ui.ErrorWriter.String(), "Failed to read vault keys")
+}
@@ -0,0 +1,244 @@
+package command
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/milosgajdos/vaultops/manifest"
+)
+
+const (
+	// envPrefix is the prefix of environment variables which set key store and cipher flags
+	envPrefix = "VAULTOPS_"
+)
+
+// setting binds key store or cipher setting to its command line flag
+type setting struct {
+	// flag is the flag name
+	flag string
+	// dst points to the setting value
+	dst interface{}
+}
+
+// settingEnv returns the name of environment variable which sets the flag:
+// VAULTOPS_ followed by upper cased flag name with dashes replaced by underscores
+func settingEnv(flag string) string {
+	return envPrefix + strings.ToUpper(strings.Replace(flag, "-", "_", -1))
+}
+
+// keyStoreSettings returns key store settings bound to their flags
+func keyStoreSettings(ks *manifest.KeyStore) []setting {
+	return []setting{
+		{"key-store", &ks.Type},
+		{"storage-bucket", &ks.Bucket},
+		{"storage-key", &ks.Key},
+		{"key-local-path", &ks.LocalPath},
+		{"aws-region", &ks.AWS.Region},
+		{"aws-profile", &ks.AWS.Profile},
+		{"aws-role-arn", &ks.AWS.RoleARN},
+		{"aws-external-id", &ks.AWS.ExternalID},
+		{"s3-endpoint", &ks.S3.Endpoint},
+		{"s3-force-path-style", &ks.S3.ForcePathStyle},
+		{"s3-sse", &ks.S3.SSE},
+		{"s3-sse-kms-key-id", &ks.S3.SSEKMSKeyID},
+		{"aws-sm-version-stage", &ks.SecretsManager.VersionStage},
+		{"aws-sm-kms-key-id", &ks.SecretsManager.KMSKeyID},
+		{"aws-ssm-kms-key-id", &ks.SSM.KMSKeyID},
+		{"gcp-sm-project", &ks.GCPSecretManager.Project},
+		{"gcp-sm-version", &ks.GCPSecretManager.Version},
+		{"gcp-sm-disable-old", &ks.GCPSecretManager.DisableOld},
+		{"namespace", &ks.Kubernetes.Namespace},
+		{"kubeconfig", &ks.Kubernetes.Kubeconfig},
+		{"kube-context", &ks.Kubernetes.Context},
+		{"kube-timeout", &ks.Kubernetes.Timeout},
+		{"kube-labels", &ks.Kubernetes.Labels},
+		{"kube-annotations", &ks.Kubernetes.Annotations},
+		{"kube-owner", &ks.Kubernetes.Owner},
+		{"kube-immutable", &ks.Kubernetes.Immutable},
+	}
+}
+
+// cipherSettings returns cipher settings bound to their flags
+func cipherSettings(c *manifest.Cipher) []setting {
+	return []setting{
+		{"kms-provider", &c.Provider},
+		{"aws-kms-id", &c.AWS.KeyID},
+		{"aws-region", &c.AWS.Region},
+		{"aws-profile", &c.AWS.Profile},
+		{"aws-role-arn", &c.AWS.RoleARN},
+		{"aws-external-id", &c.AWS.ExternalID},
+		{"gcp-kms-project", &c.GCP.Project},
+		{"gcp-kms-region", &c.GCP.Region},
+		{"gcp-kms-key-ring", &c.GCP.KeyRing},
+		{"gcp-kms-crypto-key", &c.GCP.CryptoKey},
+	}
+}
+
+// keysConfig returns the configuration of vault keys store and cipher.
+// Each setting is read from the command line flag if it's set, then from
+// VAULTOPS_<FLAG> environment variable, then from the keystore and cipher
+// sections of the parsed manifest; otherwise the flag default value is used.
+func (m *Meta) keysConfig() (*manifest.KeyStore, *manifest.Cipher, error) {
+	ks, c := new(manifest.KeyStore), new(manifest.Cipher)
+	if m.manifest != nil && m.manifest.KeyStore != nil {
+		*ks = *m.manifest.KeyStore
+	}
+	if m.manifest != nil && m.manifest.Cipher != nil {
+		*c = *m.manifest.Cipher
+	}
+
+	if err := m.resolve(keyStoreSettings(ks)); err != nil {
+		return nil, nil, err
+	}
+
+	if err := m.resolve(cipherSettings(c)); err != nil {
+		return nil, nil, err
+	}
+
+	return ks, c, nil
+}
+
+// resolve overrides the settings with the values of command line flags
+// and environment variables and fills in the flag defaults of the unset settings
+func (m *Meta) resolve(settings []setting) error {
+	set := m.setFlags()
+	for _, s := range settings {
+		var f *flag.Flag
+		if m.flags != nil {
+			f = m.flags.Lookup(s.flag)
+		}
+
+		var value string
+		switch env := os.Getenv(settingEnv(s.flag)); {
+		case set[s.flag]:
+			value = f.Value.String()
+		case env != "":
+			value = env
+		case !isZeroSetting(s.dst):
+			continue
+		case f != nil:
+			value = f.DefValue
+		default:
+			continue
+		}
+
+		if err := setSetting(s.dst, value); err != nil {
+			return fmt.Errorf("invalid %s: %v", s.flag, err)
+		}
+	}
+
+	return nil
+}
+
+// keyStoreResolver resolves manifest references to vault keys stored in the key store
+type keyStoreResolver struct {
+	meta *Meta
+	keys *VaultKeys
+}
+
+// Resolve returns the vault key stored in the key store:
+// root_token, admin_token or master_keys.<index> where index starts at 0
+func (r *keyStoreResolver) Resolve(source, key string) (string, error) {
+	if source != manifest.RefKeyStore {
+		return "", fmt.Errorf("unsupported source: %s", source)
+	}
+
+	if r.keys == nil {
+		vk, err := r.meta.loadKeys()
+		if err != nil {
+			return "", err
+		}
+		r.keys = vk
+	}
+
+	switch {
+	case key == "root_token":
+		if r.keys.RootRevoked {
+			return "", fmt.Errorf("root token has been revoked: use admin_token")
+		}
+		if r.keys.RootToken == "" {
+			return "", fmt.Errorf("no root token stored")
+		}
+		return r.keys.RootToken, nil
+	case key == "admin_token":
+		if r.keys.AdminToken == "" {
+			return "", fmt.Errorf("no admin token stored")
+		}
+		return r.keys.AdminToken, nil
+	case strings.HasPrefix(key, "master_keys."):
+		i, err := strconv.Atoi(strings.TrimPrefix(key, "master_keys."))
+		if err != nil || i < 0 || i >= len(r.keys.MasterKeys) {
+			return "", fmt.Errorf("no master key %s stored", strings.TrimPrefix(key, "master_keys."))
+		}
+		return r.keys.MasterKeys[i], nil
+	}
+
+	return "", fmt.Errorf("unknown key %q: expected root_token, admin_token or master_keys.<index>", key)
+}
+
+// setFlags returns the names of the flags set on the command line
+func (m *Meta) setFlags() map[string]bool {
+	set := make(map[string]bool)
+	if m.flags != nil {
+		m.flags.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	}
+
+	return set
+}
+
+// keyShares returns the number of key shares and the key threshold.
+// Unless they're set via -key-shares and -key-threshold flags,
+// they're read from the keys section of the parsed manifest.
+func (m *Meta) keyShares(shares, threshold int) (int, int) {
+	if m.manifest == nil || m.manifest.Keys == nil {
+		return shares, threshold
+	}
+
+	set := m.setFlags()
+	if k := m.manifest.Keys; k.Shares > 0 && !set["key-shares"] {
+		shares = k.Shares
+	}
+	if k := m.manifest.Keys; k.Threshold > 0 && !set["key-threshold"] {
+		threshold = k.Threshold
+	}
+
+	return shares, threshold
+}
+
+// isZeroSetting returns true if the setting dst points to is not set
+func isZeroSetting(dst interface{}) bool {
+	switch v := dst.(type) {
+	case *string:
+		return *v == ""
+	case *bool:
+		return !*v
+	case *time.Duration:
+		return *v == 0
+	case *map[string]string:
+		return len(*v) == 0
+	}
+
+	return true
+}
+
+// setSetting parses value and stores it in the setting dst points to
+func setSetting(dst interface{}, value string) (err error) {
+	switch v := dst.(type) {
+	case *string:
+		*v = value
+	case *bool:
+		*v, err = strconv.ParseBool(value)
+	case *time.Duration:
+		*v, err = time.ParseDuration(value)
+	case *map[string]string:
+		*v, err = parseKeyValues(value)
+	default:
+		err = fmt.Errorf("unsupported setting type: %T", dst)
+	}
+
+	return err
+}
@@ -0,0 +1,260 @@
+package command
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/milosgajdos/vaultops/manifest"
+	"github.com/milosgajdos/vaultops/store/k8s"
+	"github.com/mitchellh/cli"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSettingEnv(t *testing.T) {
+	assert.Equal(t, "VAULTOPS_KEY_STORE", settingEnv("key-store"))
+	assert.Equal(t, "VAULTOPS_S3_SSE_KMS_KEY_ID", settingEnv("s3-sse-kms-key-id"))
+}
+
+func TestKeysConfig(t *testing.T) {
+	dir := makeTestDir(t)
+	defer os.RemoveAll(dir)
+
+	data := `keystore:
+  type: s3
+  bucket: file-bucket
+  key: file-key
+  aws:
+    region: eu-west-1
+    profile: file-profile
+  s3:
+    force_path_style: true
+  kubernetes:
+    labels:
+      app: vault
+cipher:
+  provider: gcp
+  gcp:
+    project: file-project
+    key_ring: file-ring
+`
+	path := filepath.Join(dir, "manifest.yaml")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(data), 0600))
+
+	// flags and the environment override the manifest
+	os.Setenv("VAULTOPS_STORAGE_BUCKET", "env-bucket")
+	defer os.Unsetenv("VAULTOPS_STORAGE_BUCKET")
+	os.Setenv("VAULTOPS_STORAGE_KEY", "env-key")
+	defer os.Unsetenv("VAULTOPS_STORAGE_KEY")
+	os.Setenv("VAULTOPS_GCP_KMS_KEY_RING", "env-ring")
+	defer os.Unsetenv("VAULTOPS_GCP_KMS_KEY_RING")
+
+	m := new(Meta)
+	flags := m.FlagSet("test", FlagSetDefault)
+	assert.NoError(t, flags.Parse([]string{"-storage-key", "flag-key", "-aws-region", "us-east-1"}))
+	_, err := m.parseManifest(path)
+	assert.NoError(t, err)
+
+	ks, c, err := m.keysConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, &manifest.KeyStore{
+		Type:      "s3",
+		Bucket:    "env-bucket",
+		Key:       "flag-key",
+		LocalPath: filepath.Join(localDir, localFile),
+		AWS:       manifest.AWS{Region: "us-east-1", Profile: "file-profile"},
+		S3:        manifest.S3{ForcePathStyle: true},
+		GCPSecretManager: manifest.GCPSecretManager{
+			Version: "latest",
+		},
+		Kubernetes: manifest.KubernetesSecret{
+			Namespace: "default",
+			Timeout:   k8s.DefaultTimeout,
+			Labels:    map[string]string{"app": "vault"},
+		},
+	}, ks)
+	assert.Equal(t, &manifest.Cipher{
+		Provider: "gcp",
+		AWS:      manifest.AWSKMS{AWS: manifest.AWS{Region: "us-east-1"}},
+		GCP:      manifest.GCPKMS{Project: "file-project", KeyRing: "env-ring"},
+	}, c)
+
+	// the manifest is not modified
+	assert.Equal(t, "file-bucket", m.manifest.KeyStore.Bucket)
+
+	// without manifest the flag defaults are used
+	m = new(Meta)
+	flags = m.FlagSet("test", FlagSetDefault)
+	assert.NoError(t, flags.Parse([]string{"-kube-timeout", "1m", "-kube-labels", "team=ops"}))
+	ks, c, err = m.keysConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, "local", ks.Type)
+	assert.Equal(t, time.Minute, ks.Kubernetes.Timeout)
+	assert.Equal(t, map[string]string{"team": "ops"}, ks.Kubernetes.Labels)
+	assert.Empty(t, c.Provider)
+
+	// invalid environment value
+	os.Setenv("VAULTOPS_KUBE_IMMUTABLE", "maybe")
+	defer os.Unsetenv("VAULTOPS_KUBE_IMMUTABLE")
+	_, _, err = m.keysConfig()
+	assert.Error(t, err)
+}
+
+func TestKeySharesManifest(t *testing.T) {
+	dir := makeTestDir(t)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "manifest.yaml")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("keys:\n  shares: 7\n  threshold: 4\n"), 0600))
+
+	m := new(Meta)
+	flags := m.FlagSet("test", FlagSetNone)
+	flags.Int("key-shares", 5, "")
+	flags.Int("key-threshold", 3, "")
+	assert.NoError(t, flags.Parse([]string{"-key-threshold", "2"}))
+	_, err := m.parseManifest(path)
+	assert.NoError(t, err)
+
+	shares, threshold := m.keyShares(5, 2)
+	assert.Equal(t, 7, shares)
+	assert.Equal(t, 2, threshold)
+}
+
+func TestKeyStoreReferences(t *testing.T) {
+	dir := makeTestDir(t)
+	defer os.RemoveAll(dir)
+
+	keyPath := filepath.Join(dir, "vault.json")
+	assert.NoError(t, ioutil.WriteFile(keyPath, []byte(`{"root_token":"s.root","master_keys":["key-0"]}`), 0600))
+
+	data := `hosts:
+  unseal:
+    - address: https://vault-0:8200
+      token: ${keystore:root_token}
+    - address: https://vault-1:8200
+      token: ${keystore:master_keys.0}
+`
+	path := filepath.Join(dir, "manifest.yaml")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(data), 0600))
+
+	m := new(Meta)
+	flags := m.FlagSet("test", FlagSetDefault)
+	assert.NoError(t, flags.Parse([]string{"-key-local-path", keyPath}))
+	_, err := m.parseManifest(path)
+	assert.NoError(t, err)
+
+	client, err := m.Client("https://vault-0:8200", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "s.root", client.Token())
+
+	client, err = m.Client("https://vault-1:8200", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "key-0", client.Token())
+
+	// unresolved references
+	for _, ref := range []string{"master_keys.1", "unseal_key"} {
+		data := "hosts:\n  unseal:\n    - address: https://vault-0:8200\n      token: ${keystore:" + ref + "}\n"
+		assert.NoError(t, ioutil.WriteFile(path, []byte(data), 0600))
+
+		m := new(Meta)
+		flags := m.FlagSet("test", FlagSetDefault)
+		assert.NoError(t, flags.Parse([]string{"-key-local-path", keyPath}))
+		_, err := m.parseManifest(path)
+		assert.NoError(t, err)
+
+		client, err = m.Client("https://vault-0:8200", "")
+		assert.Nil(t, client)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "line 4, column 14: unresolved reference ${keystore:"+ref+"}")
+	}
+}
+
+func TestKeyStoreReferencesConcurrent(t *testing.T) {
+	dir := makeTestDir(t)
+	defer os.RemoveAll(dir)
+	keyPath := filepath.Join(dir, "vault.json")
+
+	servers := makeTestCluster(t, 4, keyPath)
+	defer closeTestCluster(servers)
+
+	data := "hosts:\n  unseal:\n"
+	for _, s := range servers {
+		s.SetSealed(true)
+		data += fmt.Sprintf("    - address: %s\n      token: ${keystore:root_token}\n", s.URL)
+	}
+	path := filepath.Join(dir, "manifest.yaml")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(data), 0600))
+
+	// the manifest is resolved by one of the goroutines which wait for the hosts
+	ui := cli.NewMockUi()
+	c := &UnsealCommand{Meta: Meta{UI: ui}}
+	code := c.Run([]string{"-config", path, "-key-local-path", keyPath, "-wait", "-retry-interval", "10ms"})
+	assert.Equal(t, 0, code, ui.ErrorWriter.String())
+	for _, s := range servers {
+		assert.False(t, s.Sealed())
+	}
+
+	m := new(Meta)
+	flags := m.FlagSet("test", FlagSetDefault)
+	assert.NoError(t, flags.Parse([]string{"-key-local-path", keyPath}))
+	_, err := m.parseManifest(path)
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+	tokens := make([]string, len(servers))
+	for i, s := range servers {
+		wg.Add(1)
+		go func(i int, host string) {
+			defer wg.Done()
+			client, err := m.Client(host, "")
+			if assert.NoError(t, err) {
+				tokens[i] = client.Token()
+			}
+		}(i, s.URL)
+	}
+	wg.Wait()
+
+	for _, token := range tokens {
+		assert.Equal(t, servers[0].RootToken(), token)
+	}
+}
+
+func TestKeyStoreAdminToken(t *testing.T) {
+	dir := makeTestDir(t)
+	defer os.RemoveAll(dir)
+
+	keyPath := filepath.Join(dir, "vault.json")
+	assert.NoError(t, ioutil.WriteFile(keyPath, []byte(`{"admin_token":"s.admin","root_revoked":true,"master_keys":["key-0"]}`), 0600))
+
+	path := filepath.Join(dir, "manifest.yaml")
+	data := "hosts:\n  unseal:\n    - address: https://vault-0:8200\n      token: ${keystore:admin_token}\n"
+	assert.NoError(t, ioutil.WriteFile(path, []byte(data), 0600))
+
+	m := new(Meta)
+	flags := m.FlagSet("test", FlagSetDefault)
+	assert.NoError(t, flags.Parse([]string{"-key-local-path", keyPath}))
+	_, err := m.parseManifest(path)
+	assert.NoError(t, err)
+
+	client, err := m.Client("https://vault-0:8200", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "s.admin", client.Token())
+
+	// revoked root token can't be referenced
+	data = "hosts:\n  unseal:\n    - address: https://vault-0:8200\n      token: ${keystore:root_token}\n"
+	assert.NoError(t, ioutil.WriteFile(path, []byte(data), 0600))
+
+	m = new(Meta)
+	flags = m.FlagSet("test", FlagSetDefault)
+	assert.NoError(t, flags.Parse([]string{"-key-local-path", keyPath}))
+	_, err = m.parseManifest(path)
+	assert.NoError(t, err)
+
+	_, err = m.Client("https://vault-0:8200", "")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "root token has been revoked: use admin_token")
+}
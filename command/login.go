@@ -0,0 +1,153 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/milosgajdos/vaultops/manifest"
+)
+
+// login is vault token obtained by logging in with an auth method
+type login struct {
+	// token is the client token
+	token string
+	// renewer renews the token; nil if the token is not renewable
+	renewer *api.Renewer
+	// done is closed once the renewer stops
+	done chan struct{}
+}
+
+// stop stops renewing the token and waits until the renewer stops
+func (l *login) stop() {
+	if l.renewer != nil {
+		l.renewer.Stop()
+		<-l.done
+	}
+}
+
+// authSettings returns auth method settings bound to their flags
+func authSettings(a *manifest.Auth) []setting {
+	return []setting{
+		{"auth-method", &a.Method},
+		{"auth-mount", &a.Mount},
+		{"auth-role", &a.Role},
+		{"auth-role-id", &a.RoleID},
+		{"auth-secret-id", &a.SecretID},
+		{"auth-jwt-path", &a.JWTPath},
+		{"aws-region", &a.AWS.Region},
+		{"aws-profile", &a.AWS.Profile},
+		{"aws-role-arn", &a.AWS.RoleARN},
+		{"aws-external-id", &a.AWS.ExternalID},
+		{"auth-aws-header-value", &a.AWS.HeaderValue},
+		{"auth-gcp-service-account", &a.GCP.ServiceAccount},
+	}
+}
+
+// authConfig returns the configuration of the auth method vaultops logs in with.
+// Each setting is read from the command line flag if it's set, then from
+// VAULTOPS_<FLAG> environment variable, then from the auth section of the parsed manifest.
+func (m *Meta) authConfig() (*manifest.Auth, error) {
+	a := new(manifest.Auth)
+	if m.manifest != nil {
+		if err := m.manifest.Resolve(&keyStoreResolver{meta: m}); err != nil {
+			return nil, err
+		}
+		if m.manifest.Auth != nil {
+			*a = *m.manifest.Auth
+		}
+	}
+
+	if err := m.resolve(authSettings(a)); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// loginToken logs in to the first of hosts which accepts the login with the configured auth method
+// and returns the client token. It returns empty string if no auth method is configured.
+// The token is obtained once per command and renewed in the background until stopRenewal is called.
+func (m *Meta) loginToken(hosts []string) (string, error) {
+	if m.login != nil {
+		return m.login.token, nil
+	}
+
+	a, err := m.authConfig()
+	if err != nil {
+		return "", err
+	}
+
+	if a.Method == "" {
+		return "", nil
+	}
+
+	method, err := VaultAuthMethod(a)
+	if err != nil {
+		return "", err
+	}
+
+	if len(hosts) == 0 {
+		return "", errors.New("no vault hosts to log in to")
+	}
+
+	var errs []string
+	for _, host := range hosts {
+		v, err := m.Client(host, "")
+		if err != nil {
+			return "", err
+		}
+		// the login endpoints must not be sent any token
+		v.ClearToken()
+
+		secret, err := method.Login(v)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", v.Address(), err))
+			continue
+		}
+
+		m.login = m.renewLogin(v, secret)
+		m.UI.Info(fmt.Sprintf("Logged in to %s via %s auth method Policies: %s TTL: %ds", v.Address(), a.Method,
+			strings.Join(secret.Auth.Policies, ","), secret.Auth.LeaseDuration))
+
+		return m.login.token, nil
+	}
+
+	return "", fmt.Errorf("%s auth method login failed: %s", a.Method, strings.Join(errs, ", "))
+}
+
+// renewLogin returns the login which holds the client token of secret.
+// Renewable tokens are renewed via vault client v in the background.
+func (m *Meta) renewLogin(v *api.Client, secret *api.Secret) *login {
+	l := &login{token: secret.Auth.ClientToken}
+	if !secret.Auth.Renewable {
+		return l
+	}
+
+	v.SetToken(l.token)
+	r, err := v.NewRenewer(&api.RenewerInput{Secret: secret})
+	if err != nil {
+		m.UI.Warn(fmt.Sprintf("Failed to renew login token: %v", err))
+		return l
+	}
+	l.renewer, l.done = r, make(chan struct{})
+
+	go r.Renew()
+	go func() {
+		defer close(l.done)
+		if err := <-r.DoneCh(); err != nil {
+			m.UI.Warn(fmt.Sprintf("Failed to renew login token: %v", err))
+		}
+	}()
+
+	return l
+}
+
+// stopRenewal stops renewing the token obtained by loginToken.
+// The token is not revoked: it expires once its TTL elapses.
+func (m *Meta) stopRenewal() {
+	if m.login != nil {
+		m.login.stop()
+	}
+}
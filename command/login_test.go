@@ -0,0 +1,238 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/milosgajdos/vaultops/manifest"
+	"github.com/milosgajdos/vaultops/vaulttest"
+	"github.com/mitchellh/cli"
+	"github.com/stretchr/testify/assert"
+)
+
+// enableTestAppRole enables approle auth method on s which accepts role ID role and secret ID secret
+func enableTestAppRole(s *vaulttest.Server, role, secret string) {
+	s.EnableAuth("approle", func(data map[string]interface{}) (*vaulttest.Token, error) {
+		if data["role_id"] != role || data["secret_id"] != secret {
+			return nil, errors.New("invalid role or secret ID")
+		}
+		return &vaulttest.Token{Policies: []string{"default", "vaultops"}, TTL: time.Hour}, nil
+	})
+}
+
+func TestAuthConfig(t *testing.T) {
+	m := &Meta{UI: cli.NewMockUi()}
+	a, err := m.authConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, &manifest.Auth{}, a)
+
+	m.manifest = &manifest.Manifest{Cluster: manifest.Cluster{
+		Auth: &manifest.Auth{Method: "aws", Role: "vaultops", AWS: manifest.AWSAuth{HeaderValue: "vault.example.com"}},
+	}}
+
+	assert.NoError(t, os.Setenv("VAULTOPS_AUTH_ROLE", "ci"))
+	defer os.Unsetenv("VAULTOPS_AUTH_ROLE")
+
+	flags := m.FlagSet("test", FlagSetDefault)
+	assert.NoError(t, flags.Parse([]string{"-aws-region", "eu-west-1", "-auth-mount", "aws/prod"}))
+
+	a, err = m.authConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, &manifest.Auth{Method: "aws", Mount: "aws/prod", Role: "ci",
+		AWS: manifest.AWSAuth{AWS: manifest.AWS{Region: "eu-west-1"}, HeaderValue: "vault.example.com"}}, a)
+	// the manifest is not modified
+	assert.Equal(t, "vaultops", m.manifest.Auth.Role)
+}
+
+func TestVaultAuthMethod(t *testing.T) {
+	for _, a := range []*manifest.Auth{
+		{Method: "approle", RoleID: "role"},
+		{Method: "kubernetes", Role: "vaultops"},
+		{Method: "aws"},
+		{Method: "cert"},
+	} {
+		m, err := VaultAuthMethod(a)
+		assert.NoError(t, err, a.Method)
+		assert.NotNil(t, m, a.Method)
+	}
+
+	for _, a := range []*manifest.Auth{
+		{Method: "approle"},
+		{Method: "kubernetes"},
+		{Method: "gcp", Role: "vaultops"},
+		{Method: "ldap"},
+	} {
+		m, err := VaultAuthMethod(a)
+		assert.Error(t, err, a.Method)
+		assert.Nil(t, m, a.Method)
+	}
+}
+
+func TestLoginToken(t *testing.T) {
+	dir := makeTestDir(t)
+	defer os.RemoveAll(dir)
+
+	sealed := vaulttest.NewServer()
+	defer sealed.Close()
+	sealed.Initialize(1, 1)
+	enableTestAppRole(sealed, "role", "secret")
+
+	s := vaulttest.NewServer()
+	defer s.Close()
+	s.Initialize(1, 1)
+	s.SetSealed(false)
+	enableTestAppRole(s, "role", "secret")
+
+	// no auth method configured
+	m := &Meta{UI: cli.NewMockUi()}
+	token, err := m.loginToken([]string{s.URL})
+	assert.NoError(t, err)
+	assert.Empty(t, token)
+
+	assert.NoError(t, os.Setenv("VAULTOPS_AUTH_SECRET_ID", "secret"))
+	defer os.Unsetenv("VAULTOPS_AUTH_SECRET_ID")
+
+	// the token is renewed until the renewal is stopped
+	ui := cli.NewMockUi()
+	m = &Meta{UI: ui}
+	flags := m.FlagSet("test", FlagSetDefault)
+	assert.NoError(t, flags.Parse([]string{"-auth-method", "approle", "-auth-role-id", "role"}))
+	token, err = m.loginToken([]string{sealed.URL, s.URL})
+	assert.NoError(t, err)
+	assert.Contains(t, ui.OutputWriter.String(), fmt.Sprintf("Logged in to %s via approle auth method Policies: default,vaultops TTL: 3600s", s.URL))
+
+	tok, ok := s.Token(token)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"default", "vaultops"}, tok.Policies)
+	assert.Eventually(t, func() bool { return s.Requests("/v1/auth/token/renew-self") > 0 }, time.Second, 10*time.Millisecond)
+
+	// the token is obtained once per command
+	again, err := m.loginToken([]string{s.URL})
+	assert.NoError(t, err)
+	assert.Equal(t, token, again)
+	assert.Equal(t, 1, s.Requests("/v1/auth/approle/login"))
+
+	m.stopRenewal()
+	assert.Empty(t, ui.ErrorWriter.String())
+
+	// the login errors of all the hosts are reported
+	m = &Meta{UI: cli.NewMockUi()}
+	flags = m.FlagSet("test", FlagSetDefault)
+	assert.NoError(t, flags.Parse([]string{"-auth-method", "approle", "-auth-role-id", "foo"}))
+	_, err = m.loginToken([]string{sealed.URL, s.URL})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "approle auth method login failed: "+sealed.URL)
+	assert.Contains(t, err.Error(), "Vault is sealed")
+	assert.Contains(t, err.Error(), "invalid role or secret ID")
+	m.stopRenewal()
+
+	// the auth method is read from the manifest
+	jwtPath := filepath.Join(dir, "token")
+	assert.NoError(t, ioutil.WriteFile(jwtPath, []byte("jwt"), 0600))
+	var data map[string]interface{}
+	s.EnableAuth("k8s", func(d map[string]interface{}) (*vaulttest.Token, error) {
+		data = d
+		return &vaulttest.Token{Policies: []string{"default"}}, nil
+	})
+
+	m = &Meta{UI: cli.NewMockUi()}
+	m.manifest = &manifest.Manifest{Cluster: manifest.Cluster{
+		Auth: &manifest.Auth{Method: "kubernetes", Mount: "k8s", Role: "vaultops", JWTPath: jwtPath},
+	}}
+	token, err = m.loginToken([]string{s.URL})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, token)
+	assert.Equal(t, map[string]interface{}{"role": "vaultops", "jwt": "jwt"}, data)
+	// tokens without TTL are not renewed
+	assert.Nil(t, m.login.renewer)
+	m.stopRenewal()
+}
+
+func TestApplyCommandLogin(t *testing.T) {
+	dir := makeTestDir(t)
+	defer os.RemoveAll(dir)
+	keyPath := filepath.Join(dir, "vault.json")
+
+	servers := makeTestCluster(t, 2, keyPath)
+	defer closeTestCluster(servers)
+	active := servers[0]
+	for _, s := range servers {
+		enableTestAppRole(s, "role", "secret")
+	}
+	// the fake servers don't share the issued tokens: the login falls back to the active server
+	servers[1].SetSealed(true)
+	// the token stored in the key store is not used
+	writeTestKeys(t, keyPath, &VaultKeys{RootToken: "foobar", MasterKeys: active.Keys()})
+
+	config := makeTestManifest(t, dir, []string{active.URL}, []string{servers[1].URL, active.URL})
+	appendTestManifest(t, config, `audit:
+  - type: syslog
+auth:
+  method: approle
+  role_id: role
+  secret_id: ${VAULTOPS_TEST_SECRET_ID}
+`)
+	assert.NoError(t, os.Setenv("VAULTOPS_TEST_SECRET_ID", "secret"))
+	defer os.Unsetenv("VAULTOPS_TEST_SECRET_ID")
+
+	ui := cli.NewMockUi()
+	c := &ApplyCommand{Meta: Meta{UI: ui}}
+	code := c.Run([]string{"-config", config, "-key-local-path", keyPath})
+	assert.Equal(t, 0, code, ui.ErrorWriter.String())
+	out := ui.OutputWriter.String()
+	assert.Contains(t, out, fmt.Sprintf("Logged in to %s via approle auth method", active.URL))
+	assert.Contains(t, out, "Audit device: syslog Type: syslog enabled")
+	assert.Contains(t, active.AuditDevices(), "syslog/")
+
+	// -token takes precedence over the auth method
+	ui = cli.NewMockUi()
+	c = &ApplyCommand{Meta: Meta{UI: ui}}
+	code = c.Run([]string{"-config", config, "-key-local-path", keyPath, "-token", active.RootToken()})
+	assert.Equal(t, 0, code, ui.ErrorWriter.String())
+	assert.NotContains(t, ui.OutputWriter.String(), "Logged in")
+
+	// the flags override the manifest
+	ui = cli.NewMockUi()
+	c = &ApplyCommand{Meta: Meta{UI: ui}}
+	code = c.Run([]string{"-config", config, "-key-local-path", keyPath, "-auth-secret-id", "foo"})
+	assert.Equal(t, 1, code)
+	assert.Contains(t, ui.ErrorWriter.String(), "Failed to log in: approle auth method login failed")
+}
+
+func TestSnapshotCommandLogin(t *testing.T) {
+	dir := makeTestDir(t)
+	defer os.RemoveAll(dir)
+	snapKey := filepath.Join(dir, "vault.snap")
+
+	s := vaulttest.NewServer()
+	defer s.Close()
+	s.Initialize(1, 1)
+	s.SetSealed(false)
+	enableTestAppRole(s, "role", "secret")
+
+	args := []string{"-address", s.URL, "-snapshot-key", snapKey, "-auth-method", "approle", "-auth-role-id", "role", "-auth-secret-id", "secret"}
+
+	ui := cli.NewMockUi()
+	c := &SnapshotSaveCommand{Meta: Meta{UI: ui}}
+	code := c.Run(args)
+	assert.Equal(t, 0, code, ui.ErrorWriter.String())
+	assert.Contains(t, ui.OutputWriter.String(), "Logged in to "+s.URL)
+	assert.Equal(t, 1, s.Requests("/v1/auth/approle/login"))
+
+	// VAULT_TOKEN takes precedence over the auth method
+	assert.NoError(t, os.Setenv(api.EnvVaultToken, "token"))
+	defer os.Unsetenv(api.EnvVaultToken)
+
+	ui = cli.NewMockUi()
+	rc := &SnapshotRestoreCommand{Meta: Meta{UI: ui}}
+	code = rc.Run(args)
+	assert.Equal(t, 0, code, ui.ErrorWriter.String())
+	assert.NotContains(t, ui.OutputWriter.String(), "Logged in")
+	assert.Equal(t, 1, s.Requests("/v1/auth/approle/login"))
+}
@@ -0,0 +1,189 @@
+package command
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/hashicorp/vault/api"
+)
+
+const (
+	// orderStandbyFirst runs maintenance actions on the standby nodes before the active nodes
+	orderStandbyFirst = "standby-first"
+	// orderParallel runs maintenance actions on all the nodes at once
+	orderParallel = "parallel"
+)
+
+// maintenanceFlags configure maintenance commands
+type maintenanceFlags struct {
+	config string
+	token  string
+	order  string
+}
+
+// register registers maintenance flags in flag set f
+func (mf *maintenanceFlags) register(f *flag.FlagSet) {
+	f.StringVar(&mf.config, "config", "", "")
+	f.StringVar(&mf.token, "token", "", "")
+	f.StringVar(&mf.order, "order", orderStandbyFirst, "")
+}
+
+// hostAction is a maintenance action run against vault hosts
+type hostAction struct {
+	// name is the action name
+	name string
+	// skip returns the reason why the action is not run against the host
+	// or empty string if the action should be run against it
+	skip func(h *api.HealthResponse) string
+	// run runs the action; the action fails once ctx is done
+	run func(ctx context.Context, v *api.Client) error
+}
+
+// maintenanceToken returns vault token used by maintenance actions.
+// Unless the token is supplied via -token flag or VAULT_TOKEN environment
+// variable, the token is obtained by logging in to one of hosts with the
+// configured auth method. If no auth method is configured, the root token
+// is read from the vault keys store. The admin token read from the vault keys
+// store is renewed before it's returned.
+func (m *Meta) maintenanceToken(token string, hosts []string) (string, bool) {
+	if token != "" || os.Getenv(api.EnvVaultToken) != "" {
+		return token, true
+	}
+
+	token, err := m.loginToken(hosts)
+	if err != nil {
+		m.UI.Error(fmt.Sprintf("Failed to log in: %v", err))
+		return "", false
+	}
+	if token != "" {
+		return token, true
+	}
+
+	vk := m.readKeys()
+	if vk == nil {
+		return "", false
+	}
+
+	if vk.Token() == "" {
+		m.UI.Error("No vault root token provided")
+		return "", false
+	}
+
+	m.renewAdminToken(hosts, vk)
+
+	return vk.Token(), true
+}
+
+// runMaintenance runs action against vault hosts concurrently and reports the results.
+// If order is orderStandbyFirst the action is run against the active nodes only once
+// it has succeeded on all the standby nodes. If the action fails on any of the hosts
+// runMaintenance returns non-zero integer. The vault requests fail once ctx is done.
+func (m *Meta) runMaintenance(ctx context.Context, hosts []string, token, order string, action *hostAction) int {
+	if order != orderStandbyFirst && order != orderParallel {
+		m.UI.Error(fmt.Sprintf("Unsupported order: %s", order))
+		return 1
+	}
+
+	type target struct {
+		host   string
+		client *api.Client
+		health *api.HealthResponse
+		err    error
+	}
+
+	targetChan := make(chan *target, len(hosts))
+	for _, host := range hosts {
+		v, err := m.Client(host, token)
+		if err != nil {
+			m.UI.Error(fmt.Sprintf("Failed to fetch Vault client: %v", err))
+			return 1
+		}
+
+		go func(h string, v *api.Client) {
+			health, err := checkHealth(ctx, v)
+			targetChan <- &target{host: h, client: v, health: health, err: err}
+		}(host, v)
+	}
+
+	var errStatus bool
+	var standbys, actives []*target
+	for i := 0; i < len(hosts); i++ {
+		t := <-targetChan
+		if t.err != nil {
+			m.UI.Error(fmt.Sprintf("Failed to read status of %s: %v", t.host, t.err))
+			errStatus = true
+			continue
+		}
+
+		if reason := action.skip(t.health); reason != "" {
+			m.UI.Info(fmt.Sprintf("Host: %s skipped: %s", t.host, reason))
+			continue
+		}
+
+		if t.health.Standby {
+			standbys = append(standbys, t)
+			continue
+		}
+		actives = append(actives, t)
+	}
+	// don't do anything unless the status of all the hosts is known
+	if errStatus {
+		return 1
+	}
+
+	batches := [][]*target{append(standbys, actives...)}
+	if order == orderStandbyFirst {
+		batches = [][]*target{standbys, actives}
+	}
+
+	type res struct {
+		host   string
+		health *api.HealthResponse
+		err    error
+	}
+
+	for _, batch := range batches {
+		resChan := make(chan *res, len(batch))
+		for _, t := range batch {
+			go func(t *target) {
+				if err := action.run(ctx, t.client); err != nil {
+					resChan <- &res{host: t.host, err: err}
+					return
+				}
+				health, err := checkHealth(ctx, t.client)
+				resChan <- &res{host: t.host, health: health, err: err}
+			}(t)
+		}
+
+		for i := 0; i < len(batch); i++ {
+			r := <-resChan
+			if r.err != nil {
+				m.UI.Error(fmt.Sprintf("Failed to %s %s: %v", action.name, r.host, r.err))
+				errStatus = true
+				continue
+			}
+			m.UI.Info(fmt.Sprintf("Host: %s Sealed: %v Standby: %v", r.host, r.health.Sealed, r.health.Standby))
+		}
+		// leave the remaining nodes alone if the action failed
+		if errStatus {
+			return 1
+		}
+	}
+
+	return 0
+}
+
+// maintenanceOptionsUsage returns the usage documentation of maintenance options
+func maintenanceOptionsUsage() string {
+	return `
+  -config			Path to a config file which contains a list of vault servers
+  -token			Vault token; if neither -token nor VAULT_TOKEN is set,
+				the root token is read from the key store
+  -order=standby-first		Order in which the vault servers are processed:
+				standby-first processes the active servers only once
+				all the standby servers have been processed;
+				parallel processes all the servers at once
+`
+}
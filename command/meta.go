@@ -3,9 +3,12 @@ package command
 import (
 	"flag"
 	"fmt"
+	"os"
 	"path/filepath"
 
 	"github.com/hashicorp/vault/api"
+	"github.com/milosgajdos/vaultops/manifest"
+	"github.com/milosgajdos/vaultops/store/k8s"
 	"github.com/mitchellh/cli"
 )
 
@@ -47,27 +50,24 @@ const (
 type Meta struct {
 	// vault client token
 	token string
+	// manifest is the parsed manifest which provides per-host client settings
+	manifest *manifest.Manifest
+	// flags are the parsed command line flags
+	flags *flag.FlagSet
+	// login is the token obtained by logging in with the configured auth method
+	login *login
 	// UI is the cli UI
 	UI cli.Ui
 	// These are set by the command line flags.
-	flagAddress         string
-	flagCACert          string
-	flagCAPath          string
-	flagClientCert      string
-	flagClientKey       string
-	flagInsecure        bool
-	flagRedact          bool
-	flagKeyStore        string
-	flagKMSProvider     string
-	flagAwsKmsID        string
-	flagGcpKmsCryptoKey string
-	flagGcpKmsKeyRing   string
-	flagGcpKmsRegion    string
-	flagGcpKmsProject   string
-	flagStorageBucket   string
-	flagStorageKey      string
-	flagKeyLocalPath    string
-	flagNamespace       string
+	flagAddress    string
+	flagCACert     string
+	flagCAPath     string
+	flagClientCert string
+	flagClientKey  string
+	flagInsecure   bool
+	flagRedact     bool
+	flagCluster    string
+	flagFormat     string
 }
 
 // FlagSet returns a FlagSet with the common flags that every
@@ -87,18 +87,52 @@ func (m *Meta) FlagSet(name string, fs FlagSetFlags) *flag.FlagSet {
 		f.StringVar(&m.flagClientKey, "client-key", "", "")
 		f.BoolVar(&m.flagInsecure, "tls-skip-verify", false, "")
 		f.BoolVar(&m.flagRedact, "redact", true, "")
-		f.StringVar(&m.flagKeyStore, "key-store", "local", "")
-		f.StringVar(&m.flagKMSProvider, "kms-provider", "", "")
-		f.StringVar(&m.flagAwsKmsID, "aws-kms-id", "", "")
-		f.StringVar(&m.flagGcpKmsCryptoKey, "gcp-kms-crypto-key", "", "")
-		f.StringVar(&m.flagGcpKmsKeyRing, "gcp-kms-key-ring", "", "")
-		f.StringVar(&m.flagGcpKmsRegion, "gcp-kms-region", "", "")
-		f.StringVar(&m.flagGcpKmsProject, "gcp-kms-project", "", "")
-		f.StringVar(&m.flagStorageBucket, "storage-bucket", "", "")
-		f.StringVar(&m.flagStorageKey, "storage-key", "", "")
-		f.StringVar(&m.flagKeyLocalPath, "key-local-path", storageLocalPath, "")
-		f.StringVar(&m.flagNamespace, "namespace", "default", "")
+		f.StringVar(&m.flagCluster, "cluster", os.Getenv(settingEnv("cluster")), "")
+		f.StringVar(&m.flagFormat, "config-format", "", "")
+		// key store and cipher flags are merged with the environment and the manifest by keysConfig
+		f.String("key-store", "local", "")
+		f.String("kms-provider", "", "")
+		f.String("aws-kms-id", "", "")
+		f.String("aws-region", "", "")
+		f.String("aws-profile", "", "")
+		f.String("aws-role-arn", "", "")
+		f.String("aws-external-id", "", "")
+		f.String("s3-endpoint", "", "")
+		f.Bool("s3-force-path-style", false, "")
+		f.String("s3-sse", "", "")
+		f.String("s3-sse-kms-key-id", "", "")
+		f.String("aws-sm-version-stage", "", "")
+		f.String("aws-sm-kms-key-id", "", "")
+		f.String("aws-ssm-kms-key-id", "", "")
+		f.String("gcp-kms-crypto-key", "", "")
+		f.String("gcp-kms-key-ring", "", "")
+		f.String("gcp-kms-region", "", "")
+		f.String("gcp-kms-project", "", "")
+		f.String("gcp-sm-project", "", "")
+		f.String("gcp-sm-version", "latest", "")
+		f.Bool("gcp-sm-disable-old", false, "")
+		f.String("storage-bucket", "", "")
+		f.String("storage-key", "", "")
+		f.String("key-local-path", storageLocalPath, "")
+		f.String("namespace", "default", "")
+		f.String("kubeconfig", "", "")
+		f.String("kube-context", "", "")
+		f.Duration("kube-timeout", k8s.DefaultTimeout, "")
+		f.String("kube-labels", "", "")
+		f.String("kube-annotations", "", "")
+		f.String("kube-owner", "", "")
+		f.Bool("kube-immutable", false, "")
+		// auth method flags are merged with the environment and the manifest by authConfig
+		f.String("auth-method", "", "")
+		f.String("auth-mount", "", "")
+		f.String("auth-role", "", "")
+		f.String("auth-role-id", "", "")
+		f.String("auth-secret-id", "", "")
+		f.String("auth-jwt-path", "", "")
+		f.String("auth-aws-header-value", "", "")
+		f.String("auth-gcp-service-account", "", "")
 	}
+	m.flags = f
 
 	return f
 }
@@ -121,16 +155,43 @@ func (m *Meta) Config(address string) (*api.Config, error) {
 		config.Address = address
 	}
 
-	// If we need custom TLS configuration, then set it
-	if m.flagCACert != "" || m.flagCAPath != "" || m.flagClientCert != "" || m.flagClientKey != "" || m.flagInsecure {
-		t := &api.TLSConfig{
-			CACert:        m.flagCACert,
-			CAPath:        m.flagCAPath,
-			ClientCert:    m.flagClientCert,
-			ClientKey:     m.flagClientKey,
-			TLSServerName: "",
-			Insecure:      m.flagInsecure,
+	t := &api.TLSConfig{
+		CACert:     m.flagCACert,
+		CAPath:     m.flagCAPath,
+		ClientCert: m.flagClientCert,
+		ClientKey:  m.flagClientKey,
+		Insecure:   m.flagInsecure,
+	}
+
+	h, err := m.manifestHost(config.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	// manifest host settings override the flags
+	if h != nil {
+		if h.CACert != "" {
+			t.CACert = h.CACert
+		}
+		if h.CAPath != "" {
+			t.CAPath = h.CAPath
+		}
+		if h.ClientCert != "" {
+			t.ClientCert = h.ClientCert
+		}
+		if h.ClientKey != "" {
+			t.ClientKey = h.ClientKey
+		}
+		if h.TLSServerName != "" {
+			t.TLSServerName = h.TLSServerName
+		}
+		if h.TLSSkipVerify != nil {
+			t.Insecure = *h.TLSSkipVerify
 		}
+	}
+
+	// If we need custom TLS configuration, then set it
+	if *t != (api.TLSConfig{}) {
 		if err := config.ConfigureTLS(t); err != nil {
 			return nil, err
 		}
@@ -161,6 +222,15 @@ func (m *Meta) Client(address, token string) (*api.Client, error) {
 		t = client.Token()
 	}
 
+	h, err := m.manifestHost(client.Address())
+	if err != nil {
+		return nil, err
+	}
+	// manifest host token overrides VAULT_TOKEN
+	if h != nil && h.Token != "" {
+		t = h.Token
+	}
+
 	// if we pass in token, override VAULT_TOKEN
 	if token != "" {
 		t = token
@@ -168,9 +238,58 @@ func (m *Meta) Client(address, token string) (*api.Client, error) {
 	}
 	client.SetToken(t)
 
+	if h != nil && h.Namespace != "" {
+		client.SetNamespace(h.Namespace)
+	}
+
 	return client, nil
 }
 
+// parseManifest parses manifest stored in path and returns it.
+// If a cluster is selected via -cluster, the manifest of the cluster is returned.
+// The client settings of the hosts listed in the manifest are applied
+// to the vault clients of the hosts.
+func (m *Meta) parseManifest(path string) (*manifest.Manifest, error) {
+	mf, err := m.readManifest(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if m.flagCluster != "" {
+		if mf, err = mf.Select(m.flagCluster); err != nil {
+			return nil, err
+		}
+	}
+	m.manifest = mf
+
+	return mf, nil
+}
+
+// readManifest parses manifest stored in path in the format set via -config-format.
+// Unless the format is set, it's detected by the file extension.
+func (m *Meta) readManifest(path string) (*manifest.Manifest, error) {
+	return manifest.ParseFormat(path, manifest.Format(m.flagFormat))
+}
+
+// manifestHost returns manifest settings of vault host or nil if the host is not listed in manifest.
+// The manifest references to vault keys are resolved from the key store when the settings are first requested.
+func (m *Meta) manifestHost(address string) (*manifest.Host, error) {
+	if m.manifest == nil {
+		return nil, nil
+	}
+
+	if err := m.manifest.Resolve(&keyStoreResolver{meta: m}); err != nil {
+		return nil, err
+	}
+
+	h, ok := m.manifest.Host(address)
+	if !ok {
+		return nil, nil
+	}
+
+	return h, nil
+}
+
 // Token returns client token
 func (m *Meta) Token() string {
 	return m.token
@@ -207,18 +326,71 @@ func GeneralOptionsUsage() string {
                           if VAULT_SKIP_VERIFY is set.
 
   -redact=true 		  Redacts sensitive information when printing into stdout
+  -config-format          Format of the -config file: yaml, json or hcl. Unless set, the format
+                          is detected by the file extension: .json files are JSON, .hcl files
+                          are HCL and all the other files are YAML.
+  -cluster                Name of the cluster declared in the clusters section of the -config
+                          file to operate on. Overrides the VAULTOPS_CLUSTER environment variable.
+                          Unless set, status checks run against all the declared clusters.
   -kms-provider 	  KMS provider (aws, gcp)
   -aws-kms-id		  AWS KMS ID. KMS keys with given ID will be used to encrypt vault keys
+  -aws-region             AWS region (overrides AWS_REGION)
+  -aws-profile            AWS shared config profile
+  -aws-role-arn           ARN of AWS IAM role to assume
+  -aws-external-id        External ID to use when assuming -aws-role-arn
+  -s3-endpoint            Custom S3 endpoint (eg. MinIO or Ceph URL)
+  -s3-force-path-style    Use path-style S3 bucket addressing (required by most S3-compatible stores)
+  -s3-sse                 S3 server-side encryption of stored keys (AES256, aws:kms)
+  -s3-sse-kms-key-id      AWS KMS key ID used for aws:kms S3 server-side encryption
+  -aws-sm-version-stage   AWS Secrets Manager version stage to write and read (default: AWSCURRENT)
+  -aws-sm-kms-key-id      AWS KMS key ID used to encrypt newly created AWS Secrets Manager secret
+  -aws-ssm-kms-key-id     AWS KMS key ID used to encrypt AWS SSM SecureString parameter
   -gcp-kms-crypto-key	  GCP KMS crypto key id
   -gcp-kms-key-ring       GCP KMS key ring
   -gcp-kms-region     	  GCP region (eg. 'global', 'europe-west1')
   -gcp-kms-project  	  GCP project name
+  -gcp-sm-project         GCP project of GCP Secret Manager secret
+  -gcp-sm-version=latest  GCP Secret Manager secret version to read vault keys from
+  -gcp-sm-disable-old     Disable previous GCP Secret Manager secret versions when storing vault keys
   -storage-bucket         Remote storage bucket (in case of K8s this means K8s Secret name)
-  -storage-key            Remote storage key (in case of K8s this means K8s Secret key)
+  -storage-key            Remote storage key (in case of K8s this means K8s Secret key,
+                          in case of AWS Secrets Manager, SSM and GCP Secret Manager this means
+                          secret or parameter name)
   -key-store=local	  Type of store where to loook up vault keys (default: local)
-                          Available stores: s3, gcp, k8s (k8s means Kubernetes secret)
+                          Available stores: s3, gcs, k8s (k8s means Kubernetes secret),
+                          secretsmanager (AWS Secrets Manager), ssm (AWS SSM Parameter Store),
+                          gcpsm (GCP Secret Manager)
   -key-local-path         Path to locally stored keys
   -namespace              Kubernetes namespace (only used when k8s store is requested)
+  -kubeconfig             Path to kubeconfig file. Unless set, in-cluster service account
+                          configuration is used when running inside Kubernetes
+  -kube-context           Kubeconfig context to use
+  -kube-timeout=5s        Kubernetes API request timeout
+  -kube-labels            Comma separated list of key=value labels added to the k8s secret
+  -kube-annotations       Comma separated list of key=value annotations added to the k8s secret
+  -kube-owner             Owner of the k8s secret in Kind/name format (eg. Job/vault-init)
+                          Supported kinds: Pod, Job, StatefulSet, Deployment
+  -kube-immutable         Create immutable k8s secret. The vault keys stored in immutable
+                          secret can't be rewritten, so the root token can't be revoked
+
+  -auth-method            Auth method to log in with instead of using the token stored in
+                          the key store: approle, kubernetes, aws, gcp or cert. Used by apply,
+                          seal, step-down, status and snapshot unless VAULT_TOKEN is set
+  -auth-mount             Path the auth method is mounted at (default: the auth method type)
+  -auth-role              Role to log in as (in case of cert it's the certificate role name)
+  -auth-role-id           AppRole role ID
+  -auth-secret-id         AppRole secret ID
+  -auth-jwt-path          Path to Kubernetes service account token
+                          (default: /var/run/secrets/kubernetes.io/serviceaccount/token)
+  -auth-aws-header-value  Value of X-Vault-AWS-IAM-Server-ID header of AWS IAM login
+  -auth-gcp-service-account
+                          Email of GCP service account which signs the GCP IAM login JWT
+
+                          The key store, KMS and auth options can also be set via
+                          VAULTOPS_<OPTION> environment variables (eg. VAULTOPS_KEY_STORE)
+                          or the keystore, cipher and auth sections of the -config file.
+                          The options take precedence over the environment variables,
+                          which take precedence over the config file.
 `
 
 	return general
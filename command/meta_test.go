@@ -2,7 +2,10 @@ package command
 
 import (
 	"flag"
+	"io/ioutil"
+	"net/http"
 	"os"
+	"path/filepath"
 	"sort"
 	"testing"
 
@@ -22,6 +25,9 @@ var (
 )
 
 func setup() {
+	// don't retry failed requests to fake vault servers
+	os.Setenv("VAULT_MAX_RETRIES", "0")
+
 	metaTest = &Meta{
 		UI:             &cli.BasicUi{},
 		flagAddress:    fAddr,
@@ -58,7 +64,7 @@ func TestFlagSet(t *testing.T) {
 		},
 		{
 			FlagSetServer,
-			[]string{"address", "ca-cert", "ca-path", "client-cert", "client-key", "tls-skip-verify", "redact", "key-store", "kms-provider", "aws-kms-id", "gcp-kms-crypto-key", "gcp-kms-key-ring", "gcp-kms-region", "gcp-kms-project", "storage-bucket", "storage-key", "key-local-path", "namespace"},
+			[]string{"address", "ca-cert", "ca-path", "client-cert", "client-key", "tls-skip-verify", "redact", "cluster", "config-format", "key-store", "kms-provider", "aws-kms-id", "aws-region", "aws-profile", "aws-role-arn", "aws-external-id", "s3-endpoint", "s3-force-path-style", "s3-sse", "s3-sse-kms-key-id", "aws-sm-version-stage", "aws-sm-kms-key-id", "aws-ssm-kms-key-id", "gcp-kms-crypto-key", "gcp-kms-key-ring", "gcp-kms-region", "gcp-kms-project", "gcp-sm-project", "gcp-sm-version", "gcp-sm-disable-old", "storage-bucket", "storage-key", "key-local-path", "namespace", "kubeconfig", "kube-context", "kube-timeout", "kube-labels", "kube-annotations", "kube-owner", "kube-immutable", "auth-method", "auth-mount", "auth-role", "auth-role-id", "auth-secret-id", "auth-jwt-path", "auth-aws-header-value", "auth-gcp-service-account"},
 		},
 	}
 
@@ -126,3 +132,59 @@ func TestClient(t *testing.T) {
 	assert.Nil(t, client)
 	assert.Error(t, err)
 }
+
+func TestManifestHostSettings(t *testing.T) {
+	dir := makeTestDir(t)
+	defer os.RemoveAll(dir)
+
+	data := `hosts:
+  init:
+    - address: https://vault-0:8200
+      tls_server_name: vault.internal
+      tls_skip_verify: false
+      token: host-token
+      namespace: team-a
+  unseal:
+    - https://vault-1:8200
+    - address: https://vault-2:8200
+      ca_cert: ` + filepath.Join(dir, "missing.pem") + `
+`
+	path := filepath.Join(dir, "manifest.yaml")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(data), 0600))
+
+	m := &Meta{flagInsecure: true}
+	_, err := m.parseManifest(path)
+	assert.NoError(t, err)
+
+	// host settings override the flags
+	client, err := m.Client("https://vault-0:8200/", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "host-token", client.Token())
+	assert.Equal(t, "team-a", client.Headers().Get("X-Vault-Namespace"))
+
+	config, err := m.Config("https://vault-0:8200")
+	assert.NoError(t, err)
+	tlsConfig := config.HttpClient.Transport.(*http.Transport).TLSClientConfig
+	assert.Equal(t, "vault.internal", tlsConfig.ServerName)
+	assert.False(t, tlsConfig.InsecureSkipVerify)
+
+	// supplied token overrides the host token
+	client, err = m.Client("https://vault-0:8200", "token")
+	assert.NoError(t, err)
+	assert.Equal(t, "token", client.Token())
+
+	// hosts without settings fall back to the flags
+	config, err = m.Config("https://vault-1:8200")
+	assert.NoError(t, err)
+	tlsConfig = config.HttpClient.Transport.(*http.Transport).TLSClientConfig
+	assert.Empty(t, tlsConfig.ServerName)
+	assert.True(t, tlsConfig.InsecureSkipVerify)
+
+	client, err = m.Client("https://vault-1:8200", "")
+	assert.NoError(t, err)
+	assert.Empty(t, client.Headers().Get("X-Vault-Namespace"))
+
+	// host CA cert is loaded
+	_, err = m.Config("https://vault-2:8200")
+	assert.Error(t, err)
+}
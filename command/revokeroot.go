@@ -0,0 +1,113 @@
+package command
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RevokeRootCommand implements replacing vault root token with an admin token
+// It fulfills cli.Command interface
+type RevokeRootCommand struct {
+	// meta flags contain vault client config
+	Meta
+}
+
+// Run runs revoke-root command which creates an admin token, stores it
+// in the key store and revokes the root token stored in the key store.
+// If revoke-root fails Run returns non-zero integer
+func (c *RevokeRootCommand) Run(args []string) int {
+	var config string
+
+	flags := c.Meta.FlagSet("revoke-root", FlagSetDefault)
+	flags.Usage = func() { c.UI.Info(c.Help()) }
+	flags.StringVar(&config, "config", "", "")
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	hosts, err := c.unsealHosts(config)
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Failed to read vault hosts: %v", err))
+		return 1
+	}
+
+	ks, _, err := c.keysConfig()
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Failed to read key store configuration: %v", err))
+		return 1
+	}
+
+	if err := checkRewritable(ks); err != nil {
+		c.UI.Error(fmt.Sprintf("Invalid key store configuration: %v", err))
+		return 1
+	}
+
+	s, cphr, err := c.keyStore()
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Failed to read vault keys: %v", err))
+		return 1
+	}
+
+	vk := new(VaultKeys)
+	if _, err := vk.Read(s, cphr); err != nil {
+		c.UI.Error(fmt.Sprintf("Failed to read vault keys: %v", err))
+		return 1
+	}
+
+	v, err := c.activeClient(hosts, vk.Token())
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Failed to find active vault server: %v", err))
+		return 1
+	}
+
+	// the admin token stored by a previous run is kept alive
+	c.renewAdminToken(hosts, vk)
+
+	c.UI.Info(fmt.Sprintf("Attempting to revoke root token of vault: %s", v.Address()))
+
+	// running the command opts in to revoking the root token
+	admin := c.adminConfig(true)
+	if err := c.revokeRoot(v.Address(), vk, admin, s, cphr); err != nil {
+		c.UI.Error(fmt.Sprintf("Failed to revoke root token: %v", err))
+		return 1
+	}
+
+	return 0
+}
+
+// Synopsis provides a simple command description
+func (c *RevokeRootCommand) Synopsis() string {
+	return "Replace Vault root token with an admin token"
+}
+
+// Help returns detailed command help
+func (c *RevokeRootCommand) Help() string {
+	helpText := `
+Usage: vaultops revoke-root [options]
+
+    Replace the Vault root token stored in the key store with an admin token.
+
+    This command writes the admin policy, creates a periodic orphan token with
+    the admin policy and stores it in the key store. Once the admin token is
+    stored, the root token is revoked and the revocation is recorded in the
+    key store. All commands use the admin token once it's stored. If the admin
+    token has already been stored by a previous run, neither the token nor its
+    policy are written again.
+
+    The policy name, its rules and the token period are read from the admin
+    section of the config file. By default the vaultops-admin policy grants
+    access to the endpoints used by vaultops, the policies, auth methods and
+    secrets engines, and the KV secrets listed in the config file, and the
+    token period is 768h. The admin token expires unless
+    it's renewed within its period: vaultops renews it whenever it uses it,
+    so a cluster which is left alone for longer than the period needs the
+    admin token renewed by other means, e.g. vault token renew.
+
+General Options:
+` + GeneralOptionsUsage() + `
+revoke-root Options:
+
+  -config			Path to a config file which contains a list of vault servers
+`
+	return strings.TrimSpace(helpText)
+}
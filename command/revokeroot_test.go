@@ -0,0 +1,198 @@
+package command
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/milosgajdos/vaultops/manifest"
+	"github.com/milosgajdos/vaultops/vaulttest"
+	"github.com/mitchellh/cli"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRevokeRootCommand(t *testing.T) {
+	dir := makeTestDir(t)
+	defer os.RemoveAll(dir)
+	keyPath := filepath.Join(dir, "vault.json")
+
+	servers := makeTestCluster(t, 2, keyPath)
+	defer closeTestCluster(servers)
+	active := servers[0]
+
+	config := makeTestManifest(t, dir, []string{active.URL}, []string{servers[1].URL, active.URL})
+
+	ui := cli.NewMockUi()
+	c := &RevokeRootCommand{Meta: Meta{UI: ui}}
+	code := c.Run([]string{"-config", config, "-key-local-path", keyPath})
+	assert.Equal(t, 0, code, ui.ErrorWriter.String())
+
+	vk := readTestKeys(t, keyPath)
+	assert.Empty(t, vk.RootToken)
+	assert.True(t, vk.RootRevoked)
+	assert.NotEmpty(t, vk.AdminToken)
+	assert.Equal(t, vk.AdminToken, vk.Token())
+
+	out := ui.OutputWriter.String()
+	assert.Contains(t, out, "Attempting to revoke root token of vault: "+active.URL)
+	assert.Contains(t, out, "Policy: vaultops-admin written")
+	assert.Contains(t, out, "Admin Token: "+Redact(rune('X'), len(vk.AdminToken))+" Policy: vaultops-admin Period: 768h0m0s")
+	assert.Contains(t, out, "Root token revoked")
+	assert.NotContains(t, out, vk.AdminToken)
+	assert.Contains(t, ui.ErrorWriter.String(), "Admin token expires unless it's renewed within 768h0m0s")
+
+	rules, ok := active.Policy("vaultops-admin")
+	assert.True(t, ok)
+	assert.Equal(t, adminRules, rules)
+
+	token, ok := active.Token(vk.AdminToken)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"default", "vaultops-admin"}, token.Policies)
+	assert.Equal(t, 768*time.Hour, token.Period)
+	assert.True(t, token.Orphan)
+
+	assert.Empty(t, active.RootToken())
+
+	// revoking the root token again is a no-op
+	ui = cli.NewMockUi()
+	c = &RevokeRootCommand{Meta: Meta{UI: ui}}
+	code = c.Run([]string{"-config", config, "-key-local-path", keyPath})
+	assert.Equal(t, 0, code, ui.ErrorWriter.String())
+	assert.Contains(t, ui.OutputWriter.String(), "Root token already revoked")
+	assert.Equal(t, vk, readTestKeys(t, keyPath))
+	// the stored admin token is renewed whenever it's used
+	assert.Equal(t, 1, active.Requests("/v1/auth/token/renew-self"))
+
+	// the other commands authenticate with the admin token and
+	// renewal failures don't stop them
+	active.Fail("/v1/auth/token/renew-self", 500, 1)
+	ui = cli.NewMockUi()
+	sd := &StepDownCommand{Meta: Meta{UI: ui}}
+	code = sd.Run([]string{"-config", config, "-key-local-path", keyPath})
+	assert.Equal(t, 0, code, ui.ErrorWriter.String())
+	assert.Contains(t, ui.ErrorWriter.String(), "Failed to renew admin token")
+	assert.True(t, active.Standby())
+	assert.Equal(t, 2, active.Requests("/v1/auth/token/renew-self"))
+}
+
+func TestRevokeRootCommandRerun(t *testing.T) {
+	dir := makeTestDir(t)
+	defer os.RemoveAll(dir)
+	keyPath := filepath.Join(dir, "vault.json")
+
+	servers := makeTestCluster(t, 1, keyPath)
+	defer closeTestCluster(servers)
+	s := servers[0]
+	config := makeTestManifest(t, dir, []string{s.URL}, []string{s.URL})
+
+	// the previous run stored the admin token but failed to revoke the root token
+	// and the operators have changed the admin policy in the meantime
+	rules := `path "sys/*" { capabilities = ["read"] }`
+	v, err := api.NewClient(&api.Config{Address: s.URL})
+	assert.NoError(t, err)
+	v.SetToken(s.RootToken())
+	assert.NoError(t, v.Sys().PutPolicy(adminPolicy, rules))
+
+	s.AddToken("s.admin", &vaulttest.Token{Policies: []string{adminPolicy}, Period: adminTokenPeriod, Orphan: true})
+	vk := readTestKeys(t, keyPath)
+	vk.AdminToken = "s.admin"
+	writeTestKeys(t, keyPath, vk)
+
+	ui := cli.NewMockUi()
+	c := &RevokeRootCommand{Meta: Meta{UI: ui}}
+	code := c.Run([]string{"-config", config, "-key-local-path", keyPath})
+	assert.Equal(t, 0, code, ui.ErrorWriter.String())
+	assert.Contains(t, ui.OutputWriter.String(), "Root token revoked")
+	assert.NotContains(t, ui.OutputWriter.String(), "Policy: vaultops-admin written")
+
+	stored, ok := s.Policy(adminPolicy)
+	assert.True(t, ok)
+	assert.Equal(t, rules, stored)
+
+	vk = readTestKeys(t, keyPath)
+	assert.Equal(t, "s.admin", vk.AdminToken)
+	assert.True(t, vk.RootRevoked)
+	assert.Empty(t, s.RootToken())
+}
+
+func TestRevokeRootCommandErrors(t *testing.T) {
+	dir := makeTestDir(t)
+	defer os.RemoveAll(dir)
+	keyPath := filepath.Join(dir, "vault.json")
+
+	servers := makeTestCluster(t, 1, keyPath)
+	defer closeTestCluster(servers)
+	config := makeTestManifest(t, dir, []string{servers[0].URL}, []string{servers[0].URL})
+
+	// no root token stored
+	writeTestKeys(t, keyPath, &VaultKeys{MasterKeys: servers[0].Keys()})
+
+	ui := cli.NewMockUi()
+	c := &RevokeRootCommand{Meta: Meta{UI: ui}}
+	code := c.Run([]string{"-config", config, "-key-local-path", keyPath})
+	assert.Equal(t, 1, code)
+	assert.Contains(t, ui.ErrorWriter.String(), "Failed to revoke root token: no root token stored")
+
+	// wrong root token: neither the policy nor the admin token are created
+	writeTestKeys(t, keyPath, &VaultKeys{RootToken: "foobar", MasterKeys: servers[0].Keys()})
+
+	ui = cli.NewMockUi()
+	c = &RevokeRootCommand{Meta: Meta{UI: ui}}
+	code = c.Run([]string{"-config", config, "-key-local-path", keyPath, "-address", servers[0].URL})
+	assert.Equal(t, 1, code)
+	assert.Contains(t, ui.ErrorWriter.String(), "Failed to revoke root token: failed to write admin policy")
+	_, ok := servers[0].Policy(adminPolicy)
+	assert.False(t, ok)
+	assert.Empty(t, readTestKeys(t, keyPath).AdminToken)
+
+	// the vault keys stored in immutable k8s secret can't be rewritten
+	ui = cli.NewMockUi()
+	c = &RevokeRootCommand{Meta: Meta{UI: ui}}
+	code = c.Run([]string{"-config", config, "-key-store", "k8s", "-kube-immutable"})
+	assert.Equal(t, 1, code)
+	assert.Contains(t, ui.ErrorWriter.String(), "Invalid key store configuration: revoking the root token rewrites the vault keys")
+}
+
+func TestAdminConfig(t *testing.T) {
+	m := &Meta{UI: cli.NewMockUi()}
+	a := m.adminConfig(false)
+	assert.Equal(t, &manifest.Admin{Policy: adminPolicy, Rules: adminRules, Period: adminTokenPeriod}, a)
+
+	m.manifest = &manifest.Manifest{Cluster: manifest.Cluster{
+		Admin: &manifest.Admin{RevokeRoot: true, Period: 24 * time.Hour},
+		Secrets: []manifest.Secret{
+			{Mount: "secret", Path: "db"},
+			{Mount: "secret/", Path: "api"},
+			{Mount: "kv", Path: "app", Version: 1},
+		},
+	}}
+	a = m.adminConfig(false)
+	assert.True(t, a.RevokeRoot)
+	assert.Equal(t, adminPolicy, a.Policy)
+	assert.Equal(t, 24*time.Hour, a.Period)
+	assert.Equal(t, adminRules+`
+# KV secrets
+path "secret/*" {
+  capabilities = ["create", "read", "update"]
+}
+path "kv/*" {
+  capabilities = ["create", "read", "update"]
+}
+`, a.Rules)
+	// the manifest is not modified
+	assert.Empty(t, m.manifest.Admin.Policy)
+
+	// -revoke-root overrides the manifest
+	var revokeRoot bool
+	flags := m.FlagSet("test", FlagSetDefault)
+	flags.BoolVar(&revokeRoot, "revoke-root", false, "")
+	assert.NoError(t, flags.Parse([]string{"-revoke-root=false"}))
+	assert.False(t, m.adminConfig(revokeRoot).RevokeRoot)
+
+	m.manifest.Admin = &manifest.Admin{Policy: "ops", Rules: `path "*" { capabilities = ["sudo"] }`}
+	a = m.adminConfig(revokeRoot)
+	assert.Equal(t, "ops", a.Policy)
+	assert.Equal(t, `path "*" { capabilities = ["sudo"] }`, a.Rules)
+}
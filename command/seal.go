@@ -0,0 +1,173 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// SealCommand implements vault sealing
+// It fulfills cli.Command interface
+type SealCommand struct {
+	// meta flags contain vault client config
+	Meta
+}
+
+// Run runs seal command which seals vault servers
+// If seal fails Run returns non-zero integer
+func (c *SealCommand) Run(args []string) int {
+	var mf maintenanceFlags
+	var wf waitFlags
+
+	flags := c.Meta.FlagSet("seal", FlagSetDefault)
+	flags.Usage = func() { c.UI.Info(c.Help()) }
+	mf.register(flags)
+	wf.register(flags)
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	if err := wf.validate(); err != nil {
+		c.UI.Error(fmt.Sprintf("Failed to parse options: %v", err))
+		return 1
+	}
+	defer c.stopRenewal()
+
+	hosts, err := c.unsealHosts(mf.config)
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Failed to read vault hosts: %v", err))
+		return 1
+	}
+
+	// -timeout bounds waiting for the hosts as well as sealing all of them
+	ctx, cancel := wf.context()
+	defer cancel()
+
+	if wf.wait && !c.waitForHosts(ctx, hosts, &wf) {
+		return 1
+	}
+
+	token, ok := c.maintenanceToken(mf.token, hosts)
+	if !ok {
+		return 1
+	}
+
+	c.UI.Info("Attempting to seal vault cluster:")
+	for _, host := range hosts {
+		c.UI.Info(fmt.Sprintf("\t%s", host))
+	}
+
+	// vault rejects seal requests sent to the standby servers: only the active
+	// server can be sealed, so the servers are sealed one active server at a time
+	remaining := hosts
+	for {
+		var standbys int
+		action := &hostAction{
+			name: "seal",
+			skip: func(h *api.HealthResponse) string {
+				switch {
+				case h.Sealed:
+					return "already sealed"
+				case h.Standby:
+					standbys++
+					return "standby servers are sealed once they take over"
+				}
+				return ""
+			},
+			run: func(ctx context.Context, v *api.Client) error {
+				return sealVault(ctx, v)
+			},
+		}
+
+		if code := c.runMaintenance(ctx, remaining, token, mf.order, action); code != 0 {
+			return code
+		}
+
+		if standbys == 0 {
+			break
+		}
+
+		c.UI.Info(fmt.Sprintf("Waiting for one of %d standby servers to take over", standbys))
+		if remaining, err = c.waitForTakeover(ctx, remaining, token, wf.retryInterval); err != nil {
+			c.UI.Error(fmt.Sprintf("Failed to seal vault cluster: %v", err))
+			return 1
+		}
+	}
+
+	c.UI.Info("Vault successfully sealed")
+
+	return 0
+}
+
+// waitForTakeover waits until one of the unsealed hosts becomes active and returns the unsealed hosts.
+// The hosts are checked with exponential backoff starting at interval. If none of the hosts
+// becomes active before ctx is done, waitForTakeover fails and reports the unsealed hosts.
+func (c *SealCommand) waitForTakeover(ctx context.Context, hosts []string, token string, interval time.Duration) ([]string, error) {
+	clients := make([]*api.Client, len(hosts))
+	for i, host := range hosts {
+		v, err := c.Client(host, token)
+		if err != nil {
+			return nil, err
+		}
+		clients[i] = v
+	}
+
+	for attempt := 0; ; attempt++ {
+		var unsealed []string
+		var active bool
+		for i, v := range clients {
+			health, err := checkHealth(ctx, v)
+			// unreachable hosts are reported unless they become sealed
+			if err != nil || !health.Sealed {
+				unsealed = append(unsealed, hosts[i])
+			}
+			if err == nil && !health.Sealed && !health.Standby {
+				active = true
+			}
+		}
+
+		if active || len(unsealed) == 0 {
+			return unsealed, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("no standby server took over: %s remain unsealed: %v", strings.Join(unsealed, ", "), ctx.Err())
+		case <-time.After(backoff(interval, attempt)):
+		}
+	}
+}
+
+// Synopsis provides a simple command description
+func (c *SealCommand) Synopsis() string {
+	return "Seal Vault servers"
+}
+
+// Help returns detailed command help
+func (c *SealCommand) Help() string {
+	helpText := `
+Usage: vaultops seal [options]
+
+    Seal Vault servers.
+
+    Only the active servers can be sealed via the Vault API. Once the active
+    server is sealed, one of the unsealed standby servers takes over: the
+    command waits until it does and seals it, too, until all the servers
+    are sealed. It fails if any of the servers remains unsealed once
+    -timeout elapses.
+
+General Options:
+` + GeneralOptionsUsage() + `
+seal Options:
+` + maintenanceOptionsUsage() + `
+  -wait				Wait until all vault servers are reachable before proceeding
+  -timeout=5m			Maximum time to wait for vault servers to become reachable
+				and to seal all of them
+  -retry-interval=1s		Initial interval between reachability checks; it grows
+				exponentially with each failed check
+`
+	return strings.TrimSpace(helpText)
+}
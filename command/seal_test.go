@@ -0,0 +1,188 @@
+package command
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/milosgajdos/vaultops/vaulttest"
+	"github.com/mitchellh/cli"
+	"github.com/stretchr/testify/assert"
+)
+
+// makeTestCluster starts n unsealed fake vault servers sharing the same keys.
+// The first server is the active node, the remaining servers are standby nodes.
+// The vault keys are stored in keyPath.
+func makeTestCluster(t *testing.T, n int, keyPath string) []*vaulttest.Server {
+	servers := make([]*vaulttest.Server, n)
+	servers[0] = vaulttest.NewServer()
+	keys, token := servers[0].Initialize(3, 2)
+	servers[0].SetSealed(false)
+
+	for i := 1; i < n; i++ {
+		servers[i] = vaulttest.NewServer()
+		servers[i].InitializeWithKeys(keys, 2, token)
+		servers[i].SetSealed(false)
+		servers[i].SetStandby(true)
+	}
+	writeTestKeys(t, keyPath, &VaultKeys{RootToken: token, MasterKeys: keys})
+
+	return servers
+}
+
+func closeTestCluster(servers []*vaulttest.Server) {
+	for _, s := range servers {
+		s.Close()
+	}
+}
+
+// promoteOnSeal makes standby server the active server once active server is sealed,
+// like vault does. The returned function stops the promotion.
+func promoteOnSeal(active, standby *vaulttest.Server) func() {
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+
+			if active.Sealed() {
+				standby.SetStandby(false)
+				return
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+func TestSealCommand(t *testing.T) {
+	dir := makeTestDir(t)
+	defer os.RemoveAll(dir)
+	keyPath := filepath.Join(dir, "vault.json")
+
+	servers := makeTestCluster(t, 4, keyPath)
+	defer closeTestCluster(servers)
+	servers[3].SetSealed(true)
+	defer promoteOnSeal(servers[0], servers[1])()
+	defer promoteOnSeal(servers[1], servers[2])()
+
+	var hosts []string
+	for _, s := range servers {
+		hosts = append(hosts, s.URL)
+	}
+	config := makeTestManifest(t, dir, hosts[:1], hosts)
+
+	ui := cli.NewMockUi()
+	c := &SealCommand{Meta: Meta{UI: ui}}
+	code := c.Run([]string{"-config", config, "-key-local-path", keyPath, "-retry-interval", "10ms"})
+	assert.Equal(t, 0, code, ui.ErrorWriter.String())
+	for _, s := range servers {
+		assert.True(t, s.Sealed())
+	}
+
+	out := ui.OutputWriter.String()
+	assert.Contains(t, out, fmt.Sprintf("Host: %s skipped: already sealed", servers[3].URL))
+	assert.Contains(t, out, fmt.Sprintf("Host: %s skipped: standby servers are sealed once they take over", servers[1].URL))
+	assert.Contains(t, out, "Waiting for one of 2 standby servers to take over")
+	assert.Contains(t, out, "Waiting for one of 1 standby servers to take over")
+	for _, s := range servers[:3] {
+		assert.Contains(t, out, fmt.Sprintf("Host: %s Sealed: true Standby: false", s.URL))
+		assert.Equal(t, 1, s.Requests("/v1/sys/seal"))
+	}
+	assert.Contains(t, out, "Vault successfully sealed")
+	assert.Zero(t, servers[3].Requests("/v1/sys/seal"))
+}
+
+func TestSealCommandTimeout(t *testing.T) {
+	dir := makeTestDir(t)
+	defer os.RemoveAll(dir)
+	keyPath := filepath.Join(dir, "vault.json")
+
+	servers := makeTestCluster(t, 2, keyPath)
+	defer closeTestCluster(servers)
+	active, standby := servers[0], servers[1]
+
+	config := makeTestManifest(t, dir, []string{active.URL}, []string{active.URL, standby.URL})
+
+	// the standby server never takes over
+	ui := cli.NewMockUi()
+	c := &SealCommand{Meta: Meta{UI: ui}}
+	code := c.Run([]string{"-config", config, "-key-local-path", keyPath, "-timeout", "200ms", "-retry-interval", "10ms"})
+	assert.Equal(t, 1, code)
+	assert.Contains(t, ui.ErrorWriter.String(),
+		fmt.Sprintf("Failed to seal vault cluster: no standby server took over: %s remain unsealed", standby.URL))
+	assert.NotContains(t, ui.OutputWriter.String(), "Vault successfully sealed")
+	assert.True(t, active.Sealed())
+	assert.False(t, standby.Sealed())
+	assert.Zero(t, standby.Requests("/v1/sys/seal"))
+}
+
+func TestSealCommandFailure(t *testing.T) {
+	dir := makeTestDir(t)
+	defer os.RemoveAll(dir)
+	keyPath := filepath.Join(dir, "vault.json")
+
+	servers := makeTestCluster(t, 2, keyPath)
+	defer closeTestCluster(servers)
+	active, standby := servers[0], servers[1]
+
+	config := makeTestManifest(t, dir, []string{active.URL}, []string{active.URL, standby.URL})
+
+	active.Fail("/v1/sys/seal", http.StatusInternalServerError, 1)
+	ui := cli.NewMockUi()
+	c := &SealCommand{Meta: Meta{UI: ui}}
+	code := c.Run([]string{"-config", config, "-token", active.RootToken(), "-order", "parallel"})
+	assert.Equal(t, 1, code)
+	assert.Contains(t, ui.ErrorWriter.String(), fmt.Sprintf("Failed to seal %s", active.URL))
+	assert.False(t, active.Sealed())
+	assert.False(t, standby.Sealed())
+	assert.Zero(t, standby.Requests("/v1/sys/seal"))
+}
+
+func TestSealCommandErrors(t *testing.T) {
+	dir := makeTestDir(t)
+	defer os.RemoveAll(dir)
+	keyPath := filepath.Join(dir, "vault.json")
+	emptyPath := filepath.Join(dir, "empty.json")
+	writeTestKeys(t, emptyPath, &VaultKeys{})
+
+	servers := makeTestCluster(t, 1, keyPath)
+	defer closeTestCluster(servers)
+	s := servers[0]
+
+	testCases := []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"-foobar"}, ""},
+		{[]string{"-config", filepath.Join(dir, "foobar.yaml")}, "Failed to read vault hosts"},
+		{[]string{"-address", s.URL, "-key-local-path", filepath.Join(dir, "missing.json")}, "Failed to read vault keys"},
+		{[]string{"-address", s.URL, "-key-local-path", emptyPath}, "No vault root token provided"},
+		{[]string{"-address", s.URL, "-key-local-path", keyPath, "-order", "foobar"}, "Unsupported order: foobar"},
+		{[]string{"-address", s.URL, "-token", "foobar"}, "permission denied"},
+	}
+
+	for _, tc := range testCases {
+		ui := cli.NewMockUi()
+		c := &SealCommand{Meta: Meta{UI: ui}}
+		code := c.Run(tc.args)
+		assert.Equal(t, 1, code)
+		assert.Contains(t, ui.ErrorWriter.String(), tc.err)
+	}
+	assert.False(t, s.Sealed())
+
+	// unreachable host
+	s.Fail("/v1/sys/health", http.StatusBadGateway, 1)
+	ui := cli.NewMockUi()
+	c := &SealCommand{Meta: Meta{UI: ui}}
+	code := c.Run([]string{"-address", s.URL, "-key-local-path", keyPath})
+	assert.Equal(t, 1, code)
+	assert.Contains(t, ui.ErrorWriter.String(), fmt.Sprintf("Failed to read status of %s", s.URL))
+	assert.False(t, s.Sealed())
+}
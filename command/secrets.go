@@ -0,0 +1,283 @@
+package command
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/milosgajdos/vaultops/cipher"
+	"github.com/milosgajdos/vaultops/manifest"
+	"github.com/milosgajdos/vaultops/store"
+)
+
+// secretSources read the encrypted and stored values of KV secrets
+type secretSources struct {
+	// stores returns the store of values stored under key
+	stores func(key string) (store.Store, error)
+	// newCipher creates the cipher which decrypts the values; it's nil if no cipher is configured
+	newCipher func() (cipher.Cipher, error)
+	// cipher is the cipher created by newCipher
+	cipher cipher.Cipher
+}
+
+// newSecretSources returns the sources of KV secret values: the key store
+// and the cipher configured via the manifest, environment and flags
+func (m *Meta) newSecretSources() (*secretSources, error) {
+	ks, cc, err := m.keysConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	src := &secretSources{
+		stores: func(key string) (store.Store, error) {
+			// the local store creates the missing file, but the values are only read
+			if ks.Type == "local" {
+				if _, err := os.Stat(key); os.IsNotExist(err) {
+					return nil, &store.Error{Code: store.ErrNotFound, Msg: err}
+				}
+			}
+			sks := *ks
+			sks.Key = key
+			sks.LocalPath = key
+			return VaultKeyStore(&sks)
+		},
+	}
+
+	// the cipher is only created when a value needs to be decrypted
+	if cc.Provider != "" {
+		src.newCipher = func() (cipher.Cipher, error) { return VaultKeyCipher(cc) }
+	}
+
+	return src, nil
+}
+
+// decrypt decrypts data with the configured cipher.
+// If required is false and no cipher is configured, data is returned as is.
+func (s *secretSources) decrypt(data []byte, required bool) ([]byte, error) {
+	if s.cipher == nil && s.newCipher != nil {
+		c, err := s.newCipher()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create cipher: %v", err)
+		}
+		s.cipher = c
+	}
+
+	if s.cipher == nil {
+		if required {
+			return nil, errors.New("no cipher configured")
+		}
+		return data, nil
+	}
+
+	return s.cipher.Decrypt(data)
+}
+
+// value returns the plain text value of secret value v
+func (s *secretSources) value(v *manifest.SecretValue) (string, error) {
+	switch {
+	case v.Encrypted != "":
+		data, err := base64.StdEncoding.DecodeString(v.Encrypted)
+		if err != nil {
+			return "", err
+		}
+
+		plain, err := s.decrypt(data, true)
+		if err != nil {
+			return "", fmt.Errorf("failed to decrypt value: %v", err)
+		}
+		return string(plain), nil
+	case v.Store != "":
+		st, err := s.stores(v.Store)
+		if err != nil {
+			return "", storedValueError(v.Store, err)
+		}
+
+		data, err := ioutil.ReadAll(st)
+		if err != nil {
+			return "", storedValueError(v.Store, err)
+		}
+		if len(data) == 0 {
+			return "", fmt.Errorf("no value stored under %s", v.Store)
+		}
+
+		plain, err := s.decrypt(data, false)
+		if err != nil {
+			return "", fmt.Errorf("failed to decrypt value stored under %s: %v", v.Store, err)
+		}
+		return string(plain), nil
+	}
+
+	return v.Value, nil
+}
+
+// storedValueError returns the error of reading the value stored under key
+func storedValueError(key string, err error) error {
+	if serr, ok := err.(*store.Error); ok && serr.Code == store.ErrNotFound {
+		return fmt.Errorf("no value stored under %s", key)
+	}
+
+	return fmt.Errorf("failed to read value stored under %s: %v", key, err)
+}
+
+// data returns the plain text data of secret sec
+func (s *secretSources) data(sec *manifest.Secret) (map[string]string, error) {
+	data := make(map[string]string, len(sec.Data))
+	for name, v := range sec.Data {
+		v := v
+		value, err := s.value(&v)
+		if err != nil {
+			return nil, fmt.Errorf("secret value %s: %v", name, err)
+		}
+		data[name] = value
+	}
+
+	return data, nil
+}
+
+// equalData returns true if secret data read from vault equals data
+func equalData(stored map[string]interface{}, data map[string]string) bool {
+	if len(stored) != len(data) {
+		return false
+	}
+
+	for name, value := range data {
+		if s, ok := stored[name].(string); !ok || s != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+// secretVersion returns the version of KV version 2 secret read from its metadata or response data
+func secretVersion(data map[string]interface{}) (int, error) {
+	n, ok := data["version"].(json.Number)
+	if !ok {
+		return 0, errors.New("no secret version found")
+	}
+
+	version, err := n.Int64()
+	if err != nil {
+		return 0, fmt.Errorf("invalid secret version: %v", err)
+	}
+
+	return int(version), nil
+}
+
+// writeSecret writes data to secret sec unless sec already stores the same data.
+// KV version 2 secrets are written with check-and-set set to the version read
+// before writing, so the secrets modified concurrently are not overwritten.
+// It returns true if the secret was written along with the secret version;
+// the version of KV version 1 secrets is always 0.
+func writeSecret(v *api.Client, sec *manifest.Secret, data map[string]string) (bool, int, error) {
+	values := make(map[string]interface{}, len(data))
+	for name, value := range data {
+		values[name] = value
+	}
+
+	if sec.GetVersion() == 1 {
+		path := sec.GetPath()
+		cur, err := v.Logical().Read(path)
+		if err != nil {
+			return false, 0, fmt.Errorf("failed to read secret: %v", err)
+		}
+		if cur != nil && equalData(cur.Data, data) {
+			return false, 0, nil
+		}
+
+		if _, err := v.Logical().Write(path, values); err != nil {
+			return false, 0, fmt.Errorf("failed to write secret: %v", err)
+		}
+		return true, 0, nil
+	}
+
+	// KV version 2 secret data are read and written via the data path
+	path := fmt.Sprintf("%s/data/%s", strings.Trim(sec.Mount, "/"), strings.Trim(sec.Path, "/"))
+
+	var version int
+	cur, err := v.Logical().Read(path)
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to read secret: %v", err)
+	}
+	// deleted secrets have metadata, but no data
+	if cur != nil {
+		meta, _ := cur.Data["metadata"].(map[string]interface{})
+		if version, err = secretVersion(meta); err != nil {
+			return false, 0, err
+		}
+		if stored, ok := cur.Data["data"].(map[string]interface{}); ok && equalData(stored, data) {
+			return false, version, nil
+		}
+	}
+
+	resp, err := v.Logical().Write(path, map[string]interface{}{
+		"data":    values,
+		"options": map[string]interface{}{"cas": version},
+	})
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to write secret: %v", err)
+	}
+	if resp == nil {
+		return false, 0, errors.New("failed to write secret: empty response")
+	}
+
+	version, err = secretVersion(resp.Data)
+	if err != nil {
+		return false, 0, err
+	}
+
+	return true, version, nil
+}
+
+// applySecrets writes the KV secrets listed in the manifest whose data differ from the data stored in vault.
+// The secret values are only reported if -redact is disabled.
+func (m *Meta) applySecrets(v *api.Client, secrets []manifest.Secret, src *secretSources) error {
+	for i := range secrets {
+		sec := &secrets[i]
+		path := sec.GetPath()
+
+		data, err := src.data(sec)
+		if err != nil {
+			return fmt.Errorf("secret %s: %v", path, err)
+		}
+
+		written, version, err := writeSecret(v, sec, data)
+		if err != nil {
+			return fmt.Errorf("secret %s: %v", path, err)
+		}
+
+		// KV version 1 secrets are not versioned
+		status := fmt.Sprintf("Secret: %s", path)
+		if sec.GetVersion() == 2 {
+			status += fmt.Sprintf(" Version: %d", version)
+		}
+
+		if !written {
+			m.UI.Info(status + " unchanged")
+			continue
+		}
+		m.UI.Info(status + " written")
+
+		names := make([]string, 0, len(data))
+		for name := range data {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			value := data[name]
+			if m.flagRedact {
+				value = Redact(rune('X'), len(value))
+			}
+			m.UI.Info(fmt.Sprintf("\t%s: %s", name, value))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,197 @@
+package command
+
+import (
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/milosgajdos/vaultops/cipher"
+	"github.com/milosgajdos/vaultops/manifest"
+	"github.com/milosgajdos/vaultops/store"
+	"github.com/milosgajdos/vaultops/store/local"
+	"github.com/mitchellh/cli"
+	"github.com/stretchr/testify/assert"
+)
+
+// reverseCipher "encrypts" data by reversing it
+type reverseCipher struct{}
+
+func (reverseCipher) reverse(data []byte) ([]byte, error) {
+	r := make([]byte, len(data))
+	for i, b := range data {
+		r[len(data)-1-i] = b
+	}
+	return r, nil
+}
+
+func (c reverseCipher) Encrypt(data []byte) ([]byte, error) { return c.reverse(data) }
+func (c reverseCipher) Decrypt(data []byte) ([]byte, error) { return c.reverse(data) }
+
+// makeTestSources returns secret sources which read the values stored in dir and decrypt them with c
+func makeTestSources(dir string, c cipher.Cipher) *secretSources {
+	src := &secretSources{
+		stores: func(key string) (store.Store, error) {
+			return local.NewStore(filepath.Join(dir, key))
+		},
+	}
+	if c != nil {
+		src.newCipher = func() (cipher.Cipher, error) { return c, nil }
+	}
+
+	return src
+}
+
+func TestSecretSources(t *testing.T) {
+	dir := makeTestDir(t)
+	defer os.RemoveAll(dir)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "plain"), []byte("s3cr3t"), 0600))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "encrypted"), []byte("t3rc3s"), 0600))
+
+	encrypted := base64.StdEncoding.EncodeToString([]byte("t3rc3s"))
+
+	src := makeTestSources(dir, reverseCipher{})
+	for _, v := range []manifest.SecretValue{
+		{Value: "s3cr3t"},
+		{Encrypted: encrypted},
+		{Store: "encrypted"},
+	} {
+		value, err := src.value(&v)
+		assert.NoError(t, err, v)
+		assert.Equal(t, "s3cr3t", value, v)
+	}
+
+	// stored values are not decrypted if no cipher is configured
+	src = makeTestSources(dir, nil)
+	value, err := src.value(&manifest.SecretValue{Store: "plain"})
+	assert.NoError(t, err)
+	assert.Equal(t, "s3cr3t", value)
+
+	_, err = src.value(&manifest.SecretValue{Encrypted: encrypted})
+	assert.EqualError(t, err, "failed to decrypt value: no cipher configured")
+
+	_, err = src.value(&manifest.SecretValue{Store: "missing"})
+	assert.EqualError(t, err, "no value stored under missing")
+
+	// the cipher is created once
+	var created int
+	src = makeTestSources(dir, nil)
+	src.newCipher = func() (cipher.Cipher, error) {
+		created++
+		return reverseCipher{}, nil
+	}
+	data, err := src.data(&manifest.Secret{Data: map[string]manifest.SecretValue{
+		"password": {Encrypted: encrypted},
+		"token":    {Store: "encrypted"},
+	}})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"password": "s3cr3t", "token": "s3cr3t"}, data)
+	assert.Equal(t, 1, created)
+
+	src = makeTestSources(dir, nil)
+	src.newCipher = func() (cipher.Cipher, error) { return nil, errors.New("no credentials") }
+	_, err = src.value(&manifest.SecretValue{Encrypted: encrypted})
+	assert.EqualError(t, err, "failed to decrypt value: failed to create cipher: no credentials")
+}
+
+func TestSecretSourcesLocalStore(t *testing.T) {
+	dir := makeTestDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "plain")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("s3cr3t"), 0600))
+
+	m := new(Meta)
+	flags := m.FlagSet("test", FlagSetDefault)
+	assert.NoError(t, flags.Parse([]string{"-key-store", "local", "-key-local-path", filepath.Join(dir, "vault.json")}))
+	src, err := m.newSecretSources()
+	assert.NoError(t, err)
+
+	value, err := src.value(&manifest.SecretValue{Store: path})
+	assert.NoError(t, err)
+	assert.Equal(t, "s3cr3t", value)
+
+	// missing value is not created
+	missing := filepath.Join(dir, "missing", "value")
+	_, err = src.value(&manifest.SecretValue{Store: missing})
+	assert.EqualError(t, err, "no value stored under "+missing)
+	_, err = os.Stat(filepath.Dir(missing))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestApplySecrets(t *testing.T) {
+	dir := makeTestDir(t)
+	defer os.RemoveAll(dir)
+	keyPath := filepath.Join(dir, "vault.json")
+
+	servers := makeTestCluster(t, 1, keyPath)
+	defer closeTestCluster(servers)
+	s := servers[0]
+	s.MountKV("kv", 1)
+	s.MountKV("secret", 2)
+
+	encrypted := base64.StdEncoding.EncodeToString([]byte("t3rc3s"))
+	secrets := []manifest.Secret{
+		{Mount: "secret", Path: "db", Data: map[string]manifest.SecretValue{
+			"username": {Value: "app"},
+			"password": {Encrypted: encrypted},
+		}},
+		{Mount: "kv/", Path: "/api", Version: 1, Data: map[string]manifest.SecretValue{
+			"token": {Value: "t0k3n"},
+		}},
+	}
+
+	ui := cli.NewMockUi()
+	m := &Meta{UI: ui, flagRedact: true}
+	v, err := m.Client(s.URL, s.RootToken())
+	assert.NoError(t, err)
+
+	assert.NoError(t, m.applySecrets(v, secrets, makeTestSources(dir, reverseCipher{})))
+	out := ui.OutputWriter.String()
+	assert.Contains(t, out, "Secret: secret/db Version: 1 written\n")
+	assert.Contains(t, out, "\tpassword: XXXXXX\n")
+	assert.Contains(t, out, "Secret: kv/api written\n")
+	assert.NotContains(t, out, "s3cr3t")
+	assert.NotContains(t, out, "t0k3n")
+
+	data, version, ok := s.KVSecret("secret/db")
+	assert.True(t, ok)
+	assert.Equal(t, 1, version)
+	assert.Equal(t, map[string]interface{}{"username": "app", "password": "s3cr3t"}, data)
+	data, _, ok = s.KVSecret("kv/api")
+	assert.True(t, ok)
+	assert.Equal(t, map[string]interface{}{"token": "t0k3n"}, data)
+
+	// the secrets which store the same data are not written again
+	ui = cli.NewMockUi()
+	m.UI = ui
+	assert.NoError(t, m.applySecrets(v, secrets, makeTestSources(dir, reverseCipher{})))
+	out = ui.OutputWriter.String()
+	assert.Contains(t, out, "Secret: secret/db Version: 1 unchanged")
+	assert.Contains(t, out, "Secret: kv/api unchanged")
+	_, version, _ = s.KVSecret("secret/db")
+	assert.Equal(t, 1, version)
+
+	// the changed secrets are written with check-and-set set to the current version
+	assert.NoError(t, s.WriteKV("secret/db", map[string]interface{}{"username": "admin"}))
+	ui = cli.NewMockUi()
+	m.UI, m.flagRedact = ui, false
+	assert.NoError(t, m.applySecrets(v, secrets[:1], makeTestSources(dir, reverseCipher{})))
+	out = ui.OutputWriter.String()
+	assert.Contains(t, out, "Secret: secret/db Version: 3 written")
+	assert.Contains(t, out, "\tpassword: s3cr3t\n")
+	assert.Contains(t, out, "\tusername: app\n")
+	_, version, _ = s.KVSecret("secret/db")
+	assert.Equal(t, 3, version)
+
+	// no KV secrets engine mounted
+	err = m.applySecrets(v, []manifest.Secret{{Mount: "foo", Path: "db", Data: secrets[0].Data}}, makeTestSources(dir, reverseCipher{}))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "secret foo/db: failed to write secret")
+	assert.Contains(t, err.Error(), "no handler for route 'foo/data/db'")
+
+	// values which can't be read are reported
+	err = m.applySecrets(v, secrets[:1], makeTestSources(dir, nil))
+	assert.EqualError(t, err, "secret secret/db: secret value password: failed to decrypt value: no cipher configured")
+}
@@ -0,0 +1,432 @@
+package command
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/milosgajdos/vaultops/cipher"
+	"github.com/milosgajdos/vaultops/manifest"
+	"github.com/milosgajdos/vaultops/snapshot"
+	"github.com/milosgajdos/vaultops/store"
+	"github.com/mitchellh/cli"
+)
+
+const (
+	// snapshotFile is the default snapshot key
+	snapshotFile = "vault.snap"
+)
+
+// snapshotStores are the key stores which can stream snapshots of arbitrary size.
+// The other key stores limit the size of the stored data to a few kilobytes.
+var snapshotStores = []string{"local", "s3", "gcs"}
+
+// SnapshotCommand groups raft snapshot commands
+// It fulfills cli.Command interface
+type SnapshotCommand struct {
+	// meta flags contain vault client config
+	Meta
+}
+
+// Run shows snapshot command help
+func (c *SnapshotCommand) Run(args []string) int {
+	return cli.RunResultHelp
+}
+
+// Synopsis provides a simple command description
+func (c *SnapshotCommand) Synopsis() string {
+	return "Save and restore Vault raft snapshots"
+}
+
+// Help returns detailed command help
+func (c *SnapshotCommand) Help() string {
+	helpText := `
+Usage: vaultops snapshot <subcommand> [options]
+
+    Save and restore Vault integrated storage (raft) snapshots.
+
+    The snapshots are streamed into the same kind of key store as vault keys:
+    local, s3 or gcs; the other key stores can't hold data of snapshot size.
+    If -kms-provider is set, the snapshots are envelope encrypted: each snapshot
+    is encrypted with a random data key which is encrypted with the KMS key.
+
+    Only the given number of the newest snapshots is retained. Snapshot checksums
+    are verified before a snapshot is restored.
+
+Subcommands:
+
+    save       Save a new raft snapshot
+    restore    Restore a stored raft snapshot
+    list       List stored raft snapshots
+`
+	return strings.TrimSpace(helpText)
+}
+
+// snapshotRepository returns snapshot repository which stores snapshots under key in the key store
+// configured via m and the keystore and cipher sections of the manifest stored in config.
+// If key is empty, the default key is used. It also returns the key store configuration.
+func snapshotRepository(m *Meta, config, key string, retain int) (*snapshot.Repository, *manifest.KeyStore, error) {
+	if config != "" {
+		if _, err := m.parseManifest(config); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	ks, cc, err := m.keysConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var streams bool
+	for _, t := range snapshotStores {
+		streams = streams || t == ks.Type
+	}
+	if !streams {
+		return nil, nil, fmt.Errorf("%s key store can't store raft snapshots: expected one of %s",
+			ks.Type, strings.Join(snapshotStores, ", "))
+	}
+
+	if key == "" {
+		key = snapshotFile
+		if ks.Type == "local" {
+			key = filepath.Join(localDir, snapshotFile)
+		}
+	}
+
+	stores := func(key string) (store.Store, error) {
+		sks := *ks
+		sks.Key = key
+		sks.LocalPath = key
+		return VaultKeyStore(&sks)
+	}
+
+	var cphr cipher.StreamCipher
+	if cc.Provider != "" {
+		kek, err := VaultKeyCipher(cc)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create %s cipher: %v", cc.Provider, err)
+		}
+		cphr = cipher.NewEnvelope(kek)
+	}
+
+	repo, err := snapshot.NewRepository(key, retain, stores, cphr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return repo, ks, nil
+}
+
+// snapshotClient returns vault client of the server set via -address or VAULT_ADDR.
+// Unless VAULT_TOKEN is set, the client token is obtained by logging in with
+// the configured auth method, if any.
+func (m *Meta) snapshotClient() (*api.Client, error) {
+	var token string
+	if os.Getenv(api.EnvVaultToken) == "" {
+		var err error
+		if token, err = m.loginToken([]string{""}); err != nil {
+			return nil, fmt.Errorf("failed to log in: %v", err)
+		}
+	}
+
+	return m.Client("", token)
+}
+
+// restoreRaftSnapshot restores raft snapshot read from snap via vault client v.
+// Unlike api.Sys.RaftSnapshotRestore, which reads the whole snapshot into
+// memory so that the request can be retried, it streams the snapshot.
+func (m *Meta) restoreRaftSnapshot(v *api.Client, snap io.Reader, force bool) error {
+	config, err := m.Config(v.Address())
+	if err != nil {
+		return err
+	}
+
+	path := "/v1/sys/storage/raft/snapshot"
+	if force {
+		path = "/v1/sys/storage/raft/snapshot-force"
+	}
+	r := v.NewRequest(http.MethodPost, path)
+
+	req, err := http.NewRequest(http.MethodPost, r.URL.String(), snap)
+	if err != nil {
+		return err
+	}
+
+	for header, vals := range r.Headers {
+		for _, val := range vals {
+			req.Header.Add(header, val)
+		}
+	}
+
+	if r.ClientToken != "" {
+		req.Header.Set("X-Vault-Token", r.ClientToken)
+	}
+
+	resp, err := config.HttpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return (&api.Response{Response: resp}).Error()
+}
+
+// SnapshotSaveCommand implements raft snapshot saving
+// It fulfills cli.Command interface
+type SnapshotSaveCommand struct {
+	// meta flags contain vault client config
+	Meta
+}
+
+// Run runs snapshot save command which stores a new raft snapshot
+// If snapshot save fails it returns non-zero integer
+func (c *SnapshotSaveCommand) Run(args []string) int {
+	var config, key string
+	var retain int
+
+	flags := c.Meta.FlagSet("snapshot save", FlagSetDefault)
+	flags.Usage = func() { c.UI.Info(c.Help()) }
+	flags.StringVar(&config, "config", "", "")
+	flags.StringVar(&key, "snapshot-key", "", "")
+	flags.IntVar(&retain, "retain", snapshot.DefaultRetain, "")
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+	defer c.stopRenewal()
+
+	repo, ks, err := snapshotRepository(&c.Meta, config, key, retain)
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Failed to create snapshot repository: %v", err))
+		return 1
+	}
+
+	// make sure the snapshot store is accessible before taking the snapshot
+	if _, err := repo.Index(); err != nil {
+		c.UI.Error(fmt.Sprintf("Failed to read snapshot index: %v", err))
+		return 1
+	}
+
+	v, err := c.snapshotClient()
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Failed to fetch Vault client: %v", err))
+		return 1
+	}
+
+	c.UI.Info(fmt.Sprintf("Attempting to take raft snapshot of: %s", v.Address()))
+	// the snapshot is streamed into the store as it's being downloaded
+	pr, pw := io.Pipe()
+	defer pr.Close()
+	go func() {
+		pw.CloseWithError(v.Sys().RaftSnapshot(pw))
+	}()
+
+	snap := bufio.NewReader(pr)
+	if _, err := snap.Peek(1); err != nil {
+		// vault client does not report connection errors when taking snapshots
+		if err == io.EOF {
+			err = errors.New("empty snapshot")
+		}
+		c.UI.Error(fmt.Sprintf("Failed to take raft snapshot: %v", err))
+		return 1
+	}
+
+	entry, err := repo.Save(snap, time.Now())
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Failed to save raft snapshot: %v", err))
+		return 1
+	}
+
+	c.UI.Info(fmt.Sprintf("Snapshot saved in store: %s Key: %s Size: %d SHA256: %s Encrypted: %v",
+		ks.Type, entry.Key, entry.Size, entry.SHA256, entry.Encrypted))
+
+	return 0
+}
+
+// Synopsis provides a simple command description
+func (c *SnapshotSaveCommand) Synopsis() string {
+	return "Save a new Vault raft snapshot"
+}
+
+// Help returns detailed command help
+func (c *SnapshotSaveCommand) Help() string {
+	helpText := `
+Usage: vaultops snapshot save [options]
+
+    Take a new Vault raft snapshot and store it in the key store.
+
+    The newest snapshot replaces the oldest one once the number
+    of retained snapshots is reached.
+
+General Options:
+` + GeneralOptionsUsage() + `
+snapshot save Options:
+
+  -config			Path to a config file which configures the key store and cipher
+  -snapshot-key=vault.snap	Key prefix of the stored snapshots (in case of local store
+				it's the path prefix: .local/vault.snap)
+  -retain=5			Number of retained snapshots
+
+`
+	return strings.TrimSpace(helpText)
+}
+
+// SnapshotRestoreCommand implements raft snapshot restore
+// It fulfills cli.Command interface
+type SnapshotRestoreCommand struct {
+	// meta flags contain vault client config
+	Meta
+}
+
+// Run runs snapshot restore command which restores a stored raft snapshot
+// If snapshot restore fails it returns non-zero integer
+func (c *SnapshotRestoreCommand) Run(args []string) int {
+	var config, key string
+	var n int
+	var force bool
+
+	flags := c.Meta.FlagSet("snapshot restore", FlagSetDefault)
+	flags.Usage = func() { c.UI.Info(c.Help()) }
+	flags.StringVar(&config, "config", "", "")
+	flags.StringVar(&key, "snapshot-key", "", "")
+	flags.IntVar(&n, "snapshot", 0, "")
+	flags.BoolVar(&force, "force", false, "")
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+	defer c.stopRenewal()
+
+	repo, _, err := snapshotRepository(&c.Meta, config, key, snapshot.DefaultRetain)
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Failed to create snapshot repository: %v", err))
+		return 1
+	}
+
+	snap, entry, err := repo.Load(n)
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Failed to load raft snapshot: %v", err))
+		return 1
+	}
+	defer snap.Close()
+
+	c.UI.Info(fmt.Sprintf("Snapshot %s created at %s verified", entry.Key, entry.Created.Format(time.RFC3339)))
+
+	v, err := c.snapshotClient()
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Failed to fetch Vault client: %v", err))
+		return 1
+	}
+
+	c.UI.Info(fmt.Sprintf("Attempting to restore raft snapshot of: %s", v.Address()))
+	if err := c.restoreRaftSnapshot(v, snap, force); err != nil {
+		c.UI.Error(fmt.Sprintf("Failed to restore raft snapshot: %v", err))
+		return 1
+	}
+
+	c.UI.Info("Snapshot successfully restored")
+
+	return 0
+}
+
+// Synopsis provides a simple command description
+func (c *SnapshotRestoreCommand) Synopsis() string {
+	return "Restore a stored Vault raft snapshot"
+}
+
+// Help returns detailed command help
+func (c *SnapshotRestoreCommand) Help() string {
+	helpText := `
+Usage: vaultops snapshot restore [options]
+
+    Restore a Vault raft snapshot stored in the key store.
+
+    The snapshot checksum is verified before the snapshot is restored.
+
+General Options:
+` + GeneralOptionsUsage() + `
+snapshot restore Options:
+
+  -config			Path to a config file which configures the key store and cipher
+  -snapshot-key=vault.snap	Key prefix of the stored snapshots (in case of local store
+				it's the path prefix: .local/vault.snap)
+  -snapshot=0			Number of the snapshot to restore: 0 is the newest snapshot
+  -force			Force restore of snapshots taken in a different cluster
+
+`
+	return strings.TrimSpace(helpText)
+}
+
+// SnapshotListCommand implements listing stored raft snapshots
+// It fulfills cli.Command interface
+type SnapshotListCommand struct {
+	// meta flags contain vault client config
+	Meta
+}
+
+// Run runs snapshot list command which lists stored raft snapshots
+// If snapshot list fails it returns non-zero integer
+func (c *SnapshotListCommand) Run(args []string) int {
+	var config, key string
+
+	flags := c.Meta.FlagSet("snapshot list", FlagSetDefault)
+	flags.Usage = func() { c.UI.Info(c.Help()) }
+	flags.StringVar(&config, "config", "", "")
+	flags.StringVar(&key, "snapshot-key", "", "")
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	repo, _, err := snapshotRepository(&c.Meta, config, key, snapshot.DefaultRetain)
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Failed to create snapshot repository: %v", err))
+		return 1
+	}
+
+	index, err := repo.Index()
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Failed to list raft snapshots: %v", err))
+		return 1
+	}
+
+	if len(index.Snapshots) == 0 {
+		c.UI.Info("No snapshots found")
+		return 0
+	}
+
+	for i, e := range index.Snapshots {
+		c.UI.Info(fmt.Sprintf("Snapshot %d: Key: %s Created: %s Size: %d SHA256: %s Encrypted: %v",
+			i, e.Key, e.Created.Format(time.RFC3339), e.Size, e.SHA256, e.Encrypted))
+	}
+
+	return 0
+}
+
+// Synopsis provides a simple command description
+func (c *SnapshotListCommand) Synopsis() string {
+	return "List stored Vault raft snapshots"
+}
+
+// Help returns detailed command help
+func (c *SnapshotListCommand) Help() string {
+	helpText := `
+Usage: vaultops snapshot list [options]
+
+    List Vault raft snapshots stored in the key store from the newest to the oldest.
+
+General Options:
+` + GeneralOptionsUsage() + `
+snapshot list Options:
+
+  -config			Path to a config file which configures the key store and cipher
+  -snapshot-key=vault.snap	Key prefix of the stored snapshots (in case of local store
+				it's the path prefix: .local/vault.snap)
+
+`
+	return strings.TrimSpace(helpText)
+}
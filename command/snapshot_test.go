@@ -0,0 +1,168 @@
+package command
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/milosgajdos/vaultops/vaulttest"
+	"github.com/mitchellh/cli"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshotCommand(t *testing.T) {
+	dir := makeTestDir(t)
+	defer os.RemoveAll(dir)
+	snapKey := filepath.Join(dir, "vault.snap")
+
+	s := vaulttest.NewServer()
+	defer s.Close()
+	s.Initialize(1, 1)
+	s.SetSealed(false)
+
+	var snapshots [][]byte
+	for i := 0; i < 3; i++ {
+		snapshots = append(snapshots, s.RaftSnapshot())
+
+		ui := cli.NewMockUi()
+		c := &SnapshotSaveCommand{Meta: Meta{UI: ui}}
+		code := c.Run([]string{"-address", s.URL, "-snapshot-key", snapKey, "-retain", "2"})
+		assert.Equal(t, 0, code, ui.ErrorWriter.String())
+		assert.Contains(t, ui.OutputWriter.String(), "Snapshot saved in store: local")
+
+		s.SetRaftSnapshot()
+	}
+
+	// the oldest snapshot has been replaced
+	files, err := filepath.Glob(snapKey + "*")
+	assert.NoError(t, err)
+	assert.Len(t, files, 3)
+
+	data, err := ioutil.ReadFile(snapKey + ".0")
+	assert.NoError(t, err)
+	assert.Equal(t, snapshots[2], data)
+
+	ui := cli.NewMockUi()
+	lc := &SnapshotListCommand{Meta: Meta{UI: ui}}
+	code := lc.Run([]string{"-snapshot-key", snapKey})
+	assert.Equal(t, 0, code, ui.ErrorWriter.String())
+	assert.Contains(t, ui.OutputWriter.String(), "Snapshot 0: Key: "+snapKey+".0")
+	assert.Contains(t, ui.OutputWriter.String(), "Snapshot 1: Key: "+snapKey+".1")
+
+	// restore the newest snapshot
+	ui = cli.NewMockUi()
+	rc := &SnapshotRestoreCommand{Meta: Meta{UI: ui}}
+	code = rc.Run([]string{"-address", s.URL, "-snapshot-key", snapKey})
+	assert.Equal(t, 0, code, ui.ErrorWriter.String())
+	assert.Equal(t, snapshots[2], s.RaftSnapshot())
+
+	// restore the older snapshot
+	ui = cli.NewMockUi()
+	rc = &SnapshotRestoreCommand{Meta: Meta{UI: ui}}
+	code = rc.Run([]string{"-address", s.URL, "-snapshot-key", snapKey, "-snapshot", "1"})
+	assert.Equal(t, 0, code, ui.ErrorWriter.String())
+	assert.Equal(t, snapshots[1], s.RaftSnapshot())
+
+	// tampered snapshot is not restored
+	assert.NoError(t, ioutil.WriteFile(snapKey+".0", []byte("foobar"), 0600))
+	ui = cli.NewMockUi()
+	rc = &SnapshotRestoreCommand{Meta: Meta{UI: ui}}
+	code = rc.Run([]string{"-address", s.URL, "-snapshot-key", snapKey})
+	assert.Equal(t, 1, code)
+	assert.Contains(t, ui.ErrorWriter.String(), "integrity check failed")
+	assert.Equal(t, snapshots[1], s.RaftSnapshot())
+}
+
+func TestSnapshotRestoreForce(t *testing.T) {
+	dir := makeTestDir(t)
+	defer os.RemoveAll(dir)
+	snapKey := filepath.Join(dir, "vault.snap")
+
+	s := vaulttest.NewServer()
+	defer s.Close()
+	s.Initialize(1, 1)
+	s.SetSealed(false)
+
+	ui := cli.NewMockUi()
+	c := &SnapshotSaveCommand{Meta: Meta{UI: ui}}
+	code := c.Run([]string{"-address", s.URL, "-snapshot-key", snapKey})
+	assert.Equal(t, 0, code, ui.ErrorWriter.String())
+
+	// snapshot of a different cluster
+	other := vaulttest.NewServer()
+	defer other.Close()
+	other.Initialize(1, 1)
+	other.SetSealed(false)
+
+	ui = cli.NewMockUi()
+	rc := &SnapshotRestoreCommand{Meta: Meta{UI: ui}}
+	code = rc.Run([]string{"-address", other.URL, "-snapshot-key", snapKey})
+	assert.Equal(t, 1, code)
+	assert.Contains(t, ui.ErrorWriter.String(), "Failed to restore raft snapshot")
+
+	ui = cli.NewMockUi()
+	rc = &SnapshotRestoreCommand{Meta: Meta{UI: ui}}
+	code = rc.Run([]string{"-address", other.URL, "-snapshot-key", snapKey, "-force"})
+	assert.Equal(t, 0, code, ui.ErrorWriter.String())
+	assert.Equal(t, s.RaftSnapshot(), other.RaftSnapshot())
+}
+
+func TestSnapshotCommandErrors(t *testing.T) {
+	dir := makeTestDir(t)
+	defer os.RemoveAll(dir)
+	snapKey := filepath.Join(dir, "vault.snap")
+	// local store can't be created in a file
+	notDir := filepath.Join(dir, "file")
+	assert.NoError(t, ioutil.WriteFile(notDir, nil, 0600))
+
+	s := vaulttest.NewServer()
+	defer s.Close()
+	s.Initialize(1, 1)
+
+	testCases := []struct {
+		cmd  cli.Command
+		args []string
+		err  string
+	}{
+		{&SnapshotSaveCommand{}, []string{"-foobar"}, ""},
+		{&SnapshotSaveCommand{}, []string{"-retain", "0"}, "Failed to create snapshot repository"},
+		{&SnapshotSaveCommand{}, []string{"-snapshot-key", snapKey, "-kms-provider", "foobar"}, "failed to create foobar cipher"},
+		{&SnapshotSaveCommand{}, []string{"-key-store", "foobar"}, "foobar key store can't store raft snapshots"},
+		{&SnapshotSaveCommand{}, []string{"-key-store", "k8s"}, "k8s key store can't store raft snapshots: expected one of local, s3, gcs"},
+		{&SnapshotSaveCommand{}, []string{"-key-store", "ssm"}, "ssm key store can't store raft snapshots"},
+		{&SnapshotSaveCommand{}, []string{"-snapshot-key", filepath.Join(notDir, "vault.snap")}, "Failed to read snapshot index"},
+		// sealed server
+		{&SnapshotSaveCommand{}, []string{"-address", s.URL, "-snapshot-key", snapKey}, "Failed to take raft snapshot"},
+		{&SnapshotRestoreCommand{}, []string{"-foobar"}, ""},
+		{&SnapshotRestoreCommand{}, []string{"-address", s.URL, "-snapshot-key", snapKey}, "Failed to load raft snapshot"},
+		{&SnapshotListCommand{}, []string{"-foobar"}, ""},
+		{&SnapshotListCommand{}, []string{"-key-store", "secretsmanager"}, "secretsmanager key store can't store raft snapshots"},
+		{&SnapshotListCommand{}, []string{"-snapshot-key", filepath.Join(notDir, "vault.snap")}, "Failed to list raft snapshots"},
+	}
+
+	for _, tc := range testCases {
+		ui := cli.NewMockUi()
+		switch c := tc.cmd.(type) {
+		case *SnapshotSaveCommand:
+			c.UI = ui
+		case *SnapshotRestoreCommand:
+			c.UI = ui
+		case *SnapshotListCommand:
+			c.UI = ui
+		}
+		code := tc.cmd.Run(tc.args)
+		assert.Equal(t, 1, code, tc.args)
+		assert.Contains(t, ui.ErrorWriter.String(), tc.err)
+	}
+
+	// unreachable server
+	s.SetSealed(false)
+	s.Fail("/v1/sys/storage/raft/snapshot", http.StatusInternalServerError, 1)
+	ui := cli.NewMockUi()
+	c := &SnapshotSaveCommand{Meta: Meta{UI: ui}}
+	code := c.Run([]string{"-address", s.URL, "-snapshot-key", snapKey})
+	assert.Equal(t, 1, code)
+	assert.Contains(t, ui.ErrorWriter.String(), "Failed to take raft snapshot")
+}
@@ -0,0 +1,331 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/hashicorp/vault/api"
+)
+
+const (
+	// statusUnhealthy is the exit code of status command when vault cluster is not healthy
+	statusUnhealthy = 2
+)
+
+// hostStatus is the status of vault host
+type hostStatus struct {
+	host   string
+	health *api.HealthResponse
+	seal   *api.SealStatusResponse
+	leader *api.LeaderResponse
+	raft   *raftConfig
+	err    error
+}
+
+// role returns the role of vault host in vault cluster
+func (s *hostStatus) role() string {
+	switch {
+	case s.health == nil:
+		return "unreachable"
+	case !s.health.Initialized:
+		return "uninitialized"
+	case s.health.Sealed:
+		return "sealed"
+	case s.health.PerformanceStandby:
+		return "perf-standby"
+	case s.health.Standby:
+		return "standby"
+	}
+
+	return "active"
+}
+
+// StatusCommand implements vault cluster status reporting
+// It fulfills cli.Command interface
+type StatusCommand struct {
+	// meta flags contain vault client config
+	Meta
+}
+
+// Run runs status command which reports the status of all vault cluster hosts
+// It returns non-zero integer if the status can't be read or if the cluster is not healthy
+func (c *StatusCommand) Run(args []string) int {
+	var config, token string
+	var raft bool
+
+	flags := c.Meta.FlagSet("status", FlagSetDefault)
+	flags.Usage = func() { c.UI.Info(c.Help()) }
+	flags.StringVar(&config, "config", "", "")
+	flags.StringVar(&token, "token", "", "")
+	flags.BoolVar(&raft, "raft", false, "")
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	// report the status of all the clusters declared in the manifest
+	if c.allClusters(config) {
+		return c.runClusters(config, "unseal", func(m *Meta, hosts []string) int {
+			s := &StatusCommand{Meta: *m}
+			defer s.stopRenewal()
+			return s.runStatus(hosts, token, raft)
+		})
+	}
+	defer c.stopRenewal()
+
+	hosts, err := c.unsealHosts(config)
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Failed to read vault hosts: %v", err))
+		return 1
+	}
+
+	return c.runStatus(hosts, token, raft)
+}
+
+// runStatus reports the status of vault hosts and checks the cluster is healthy.
+// If raft is true, the raft configuration is read using token.
+func (c *StatusCommand) runStatus(hosts []string, token string, raft bool) int {
+	// raft configuration can only be read with a token
+	if raft {
+		var ok bool
+		if token, ok = c.maintenanceToken(token, hosts); !ok {
+			return 1
+		}
+	}
+
+	statusChan := make(chan *hostStatus, len(hosts))
+	for _, host := range hosts {
+		v, err := c.Client(host, token)
+		if err != nil {
+			c.UI.Error(fmt.Sprintf("Failed to fetch Vault client: %v", err))
+			return 1
+		}
+
+		go func(h string, v *api.Client) {
+			statusChan <- readHostStatus(h, v, raft)
+		}(host, v)
+	}
+
+	statuses := make(map[string]*hostStatus)
+	for i := 0; i < len(hosts); i++ {
+		s := <-statusChan
+		statuses[s.host] = s
+	}
+
+	// report the hosts in the order they were supplied
+	ordered := make([]*hostStatus, len(hosts))
+	for i, host := range hosts {
+		ordered[i] = statuses[host]
+	}
+
+	c.UI.Output(renderStatus(ordered))
+	if servers := raftServers(ordered); servers != nil {
+		c.UI.Output(renderRaftServers(servers))
+	}
+
+	warnings, issues := checkClusterStatus(ordered)
+	for _, w := range warnings {
+		c.UI.Warn(w)
+	}
+
+	if len(issues) > 0 {
+		for _, issue := range issues {
+			c.UI.Error(issue)
+		}
+		c.UI.Error("Vault cluster is not healthy")
+		return statusUnhealthy
+	}
+
+	c.UI.Info("Vault cluster is healthy")
+
+	return 0
+}
+
+// readHostStatus reads the status of vault host using vault client v.
+// Leader and raft configuration are only read from unsealed hosts.
+func readHostStatus(host string, v *api.Client, raft bool) *hostStatus {
+	s := &hostStatus{host: host}
+
+	health, err := checkHealth(context.Background(), v)
+	if err != nil {
+		s.err = err
+		return s
+	}
+	s.health = health
+
+	if s.seal, err = v.Sys().SealStatus(); err != nil {
+		s.err = fmt.Errorf("failed to read seal status: %v", err)
+		return s
+	}
+
+	if !health.Initialized || health.Sealed {
+		return s
+	}
+
+	if s.leader, err = v.Sys().Leader(); err != nil {
+		s.err = fmt.Errorf("failed to read leader: %v", err)
+		return s
+	}
+
+	if raft {
+		if s.raft, err = readRaftConfig(v); err != nil {
+			s.err = fmt.Errorf("failed to read raft configuration: %v", err)
+		}
+	}
+
+	return s
+}
+
+// renderStatus renders vault hosts status table
+func renderStatus(statuses []*hostStatus) string {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 8, 2, ' ', 0)
+
+	fmt.Fprintln(w, "HOST\tROLE\tSEALED\tUNSEAL PROGRESS\tVERSION\tLEADER")
+	for _, s := range statuses {
+		sealed, progress, version, leader := "-", "-", "-", "-"
+		if s.health != nil {
+			sealed = fmt.Sprintf("%v", s.health.Sealed)
+			version = s.health.Version
+		}
+		if s.seal != nil && s.seal.Initialized && s.seal.Sealed {
+			progress = fmt.Sprintf("%d/%d", s.seal.Progress, s.seal.T)
+		}
+		if s.leader != nil && s.leader.LeaderAddress != "" {
+			leader = s.leader.LeaderAddress
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", s.host, s.role(), sealed, progress, version, leader)
+	}
+	// nolint:errcheck
+	w.Flush()
+
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// raftServers returns raft cluster members reported by the active host
+// or by any other host if the active host did not report them
+func raftServers(statuses []*hostStatus) []raftServer {
+	var servers []raftServer
+	for _, s := range statuses {
+		if s.raft == nil {
+			continue
+		}
+		if s.role() == "active" {
+			return s.raft.Servers
+		}
+		if servers == nil {
+			servers = s.raft.Servers
+		}
+	}
+
+	return servers
+}
+
+// renderRaftServers renders raft cluster members table
+func renderRaftServers(servers []raftServer) string {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 8, 2, ' ', 0)
+
+	fmt.Fprintln(w, "RAFT NODE\tADDRESS\tLEADER\tVOTER")
+	for _, s := range servers {
+		fmt.Fprintf(w, "%s\t%s\t%v\t%v\n", s.NodeID, s.Address, s.Leader, s.Voter)
+	}
+	// nolint:errcheck
+	w.Flush()
+
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// checkClusterStatus checks the status of vault cluster hosts.
+// It returns warnings which don't affect the cluster health and
+// issues which make the cluster unhealthy.
+func checkClusterStatus(statuses []*hostStatus) ([]string, []string) {
+	var warnings, issues []string
+
+	active := 0
+	versions := make(map[string]int)
+	leaders := make(map[string]bool)
+	for _, s := range statuses {
+		if s.err != nil {
+			issues = append(issues, fmt.Sprintf("Host: %s %v", s.host, s.err))
+		}
+
+		if s.health == nil {
+			continue
+		}
+		versions[s.health.Version]++
+
+		switch s.role() {
+		case "uninitialized", "sealed":
+			issues = append(issues, fmt.Sprintf("Host: %s is %s", s.host, s.role()))
+		case "active":
+			active++
+		}
+
+		if s.leader != nil && s.leader.LeaderAddress != "" {
+			leaders[s.leader.LeaderAddress] = true
+		}
+	}
+
+	if len(versions) > 1 {
+		var skew []string
+		for version, n := range versions {
+			skew = append(skew, fmt.Sprintf("%s (%d hosts)", version, n))
+		}
+		sort.Strings(skew)
+		warnings = append(warnings, fmt.Sprintf("Version skew: %s", strings.Join(skew, ", ")))
+	}
+
+	if active != 1 {
+		issues = append(issues, fmt.Sprintf("Expected 1 active host, found %d", active))
+	}
+
+	if len(leaders) > 1 {
+		var addrs []string
+		for addr := range leaders {
+			addrs = append(addrs, addr)
+		}
+		sort.Strings(addrs)
+		issues = append(issues, fmt.Sprintf("Hosts disagree on the leader: %s", strings.Join(addrs, ", ")))
+	}
+
+	return warnings, issues
+}
+
+// Synopsis provides a simple command description
+func (c *StatusCommand) Synopsis() string {
+	return "Report the status of a Vault cluster"
+}
+
+// Help returns detailed command help
+func (c *StatusCommand) Help() string {
+	helpText := `
+Usage: vaultops status [options]
+
+    Report the health, role, seal state, version and leader of all
+    the Vault servers in a single table.
+
+    The exit code is 0 if the cluster is healthy: all the servers are
+    reachable, initialized and unsealed, exactly one of them is active and
+    all of them agree on the leader. The exit code is 2 if the cluster is not
+    healthy and 1 if the status could not be read at all. Servers running
+    different Vault versions are reported, but don't make the cluster unhealthy.
+
+    If the config file declares named clusters and -cluster is not set,
+    the status of all the clusters is reported grouped by the cluster name.
+    The exit code is then the highest exit code of the clusters.
+
+General Options:
+` + GeneralOptionsUsage() + `
+status Options:
+
+  -config			Path to a config file which contains a list of vault servers
+  -token			Vault token used to read the raft configuration
+  -raft				Report raft cluster members; unless -token or VAULT_TOKEN
+				is set, the root token is read from the key store
+`
+	return strings.TrimSpace(helpText)
+}
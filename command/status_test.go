@@ -0,0 +1,110 @@
+package command
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/milosgajdos/vaultops/vaulttest"
+	"github.com/mitchellh/cli"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatusCommand(t *testing.T) {
+	dir := makeTestDir(t)
+	defer os.RemoveAll(dir)
+	keyPath := filepath.Join(dir, "vault.json")
+
+	servers := makeTestCluster(t, 3, keyPath)
+	defer closeTestCluster(servers)
+	servers[2].SetPerfStandby(true)
+
+	config := makeTestManifest(t, dir, []string{servers[0].URL}, []string{servers[0].URL, servers[1].URL, servers[2].URL})
+
+	ui := cli.NewMockUi()
+	c := &StatusCommand{Meta: Meta{UI: ui}}
+	code := c.Run([]string{"-config", config})
+	assert.Equal(t, 0, code, ui.ErrorWriter.String())
+
+	out := ui.OutputWriter.String()
+	assert.Regexp(t, `HOST\s+ROLE\s+SEALED\s+UNSEAL PROGRESS\s+VERSION\s+LEADER`, out)
+	assert.Regexp(t, fmt.Sprintf(`%s\s+active\s+false\s+-\s+%s\s+%s`, servers[0].URL, vaulttest.DefaultVersion, servers[0].URL), out)
+	assert.Regexp(t, fmt.Sprintf(`%s\s+standby\s+false`, servers[1].URL), out)
+	assert.Regexp(t, fmt.Sprintf(`%s\s+perf-standby\s+false`, servers[2].URL), out)
+	assert.Contains(t, out, "Vault cluster is healthy")
+
+	// sealed host and version skew
+	servers[1].SetSealed(true)
+	servers[2].SetVersion("1.4.0")
+	submitTestKey(t, servers[1], servers[1].Keys()[0])
+
+	ui = cli.NewMockUi()
+	c = &StatusCommand{Meta: Meta{UI: ui}}
+	code = c.Run([]string{"-config", config})
+	assert.Equal(t, statusUnhealthy, code)
+
+	out = ui.OutputWriter.String()
+	assert.Regexp(t, fmt.Sprintf(`%s\s+sealed\s+true\s+1/2`, servers[1].URL), out)
+	assert.Contains(t, ui.ErrorWriter.String(), fmt.Sprintf("Version skew: 1.4.0 (1 hosts), %s (2 hosts)", vaulttest.DefaultVersion))
+	assert.Contains(t, ui.ErrorWriter.String(), fmt.Sprintf("Host: %s is sealed", servers[1].URL))
+	assert.Contains(t, ui.ErrorWriter.String(), "Vault cluster is not healthy")
+
+	// no active host
+	servers[1].SetSealed(false)
+	servers[0].SetStandby(true)
+	ui = cli.NewMockUi()
+	c = &StatusCommand{Meta: Meta{UI: ui}}
+	code = c.Run([]string{"-config", config})
+	assert.Equal(t, statusUnhealthy, code)
+	assert.Contains(t, ui.ErrorWriter.String(), "Expected 1 active host, found 0")
+}
+
+func TestStatusCommandRaft(t *testing.T) {
+	dir := makeTestDir(t)
+	defer os.RemoveAll(dir)
+	keyPath := filepath.Join(dir, "vault.json")
+
+	leader := vaulttest.NewServer()
+	defer leader.Close()
+	keys, token := leader.Initialize(1, 1)
+	leader.SetSealed(false)
+	writeTestKeys(t, keyPath, &VaultKeys{RootToken: token, MasterKeys: keys})
+
+	follower := vaulttest.NewServer()
+	defer follower.Close()
+	cfg := api.DefaultConfig()
+	cfg.Address = follower.URL
+	v, err := api.NewClient(cfg)
+	assert.NoError(t, err)
+	_, err = v.Sys().RaftJoin(&api.RaftJoinRequest{LeaderAPIAddr: leader.URL})
+	assert.NoError(t, err)
+	submitTestKey(t, follower, keys[0])
+
+	unreachable := vaulttest.NewServer()
+	unreachable.Close()
+
+	config := makeTestManifest(t, dir, []string{leader.URL}, []string{leader.URL, follower.URL, unreachable.URL})
+
+	ui := cli.NewMockUi()
+	c := &StatusCommand{Meta: Meta{UI: ui}}
+	code := c.Run([]string{"-config", config, "-raft", "-key-local-path", keyPath})
+	assert.Equal(t, statusUnhealthy, code)
+
+	out := ui.OutputWriter.String()
+	assert.Regexp(t, fmt.Sprintf(`%s\s+standby\s+false\s+-\s+%s\s+%s`, follower.URL, vaulttest.DefaultVersion, leader.URL), out)
+	assert.Regexp(t, fmt.Sprintf(`%s\s+unreachable\s+-\s+-\s+-\s+-`, unreachable.URL), out)
+	assert.Regexp(t, `RAFT NODE\s+ADDRESS\s+LEADER\s+VOTER`, out)
+	assert.Regexp(t, fmt.Sprintf(`%s\s+\S+\s+true\s+true`, leader.NodeID()), out)
+	assert.Regexp(t, fmt.Sprintf(`%s\s+\S+\s+false\s+true`, follower.NodeID()), out)
+	assert.Contains(t, ui.ErrorWriter.String(), fmt.Sprintf("Host: %s", unreachable.URL))
+	assert.NotContains(t, ui.ErrorWriter.String(), "Expected 1 active host")
+
+	// raft configuration requires a token
+	ui = cli.NewMockUi()
+	c = &StatusCommand{Meta: Meta{UI: ui}}
+	code = c.Run([]string{"-config", config, "-raft", "-key-local-path", filepath.Join(dir, "missing.json")})
+	assert.Equal(t, 1, code)
+	assert.Contains(t, ui.ErrorWriter.String(), "Failed to read vault keys")
+}
@@ -0,0 +1,112 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// StepDownCommand implements stepping down the active vault servers
+// It fulfills cli.Command interface
+type StepDownCommand struct {
+	// meta flags contain vault client config
+	Meta
+}
+
+// Run runs step-down command which makes the active vault servers step down
+// If step-down fails Run returns non-zero integer
+func (c *StepDownCommand) Run(args []string) int {
+	var mf maintenanceFlags
+	var wf waitFlags
+
+	flags := c.Meta.FlagSet("step-down", FlagSetDefault)
+	flags.Usage = func() { c.UI.Info(c.Help()) }
+	mf.register(flags)
+	wf.register(flags)
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	if err := wf.validate(); err != nil {
+		c.UI.Error(fmt.Sprintf("Failed to parse options: %v", err))
+		return 1
+	}
+	defer c.stopRenewal()
+
+	hosts, err := c.unsealHosts(mf.config)
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Failed to read vault hosts: %v", err))
+		return 1
+	}
+
+	// -timeout bounds waiting for the hosts as well as the step-down requests
+	ctx, cancel := wf.context()
+	defer cancel()
+
+	if wf.wait && !c.waitForHosts(ctx, hosts, &wf) {
+		return 1
+	}
+
+	token, ok := c.maintenanceToken(mf.token, hosts)
+	if !ok {
+		return 1
+	}
+
+	c.UI.Info("Attempting to step down active vault servers:")
+	for _, host := range hosts {
+		c.UI.Info(fmt.Sprintf("\t%s", host))
+	}
+
+	// only the active servers can step down
+	action := &hostAction{
+		name: "step down",
+		skip: func(h *api.HealthResponse) string {
+			switch {
+			case h.Sealed:
+				return "sealed"
+			case h.Standby:
+				return "standby"
+			}
+			return ""
+		},
+		run: func(ctx context.Context, v *api.Client) error {
+			return stepDownVault(ctx, v)
+		},
+	}
+
+	if code := c.runMaintenance(ctx, hosts, token, mf.order, action); code != 0 {
+		return code
+	}
+
+	c.UI.Info("Vault successfully stepped down")
+
+	return 0
+}
+
+// Synopsis provides a simple command description
+func (c *StepDownCommand) Synopsis() string {
+	return "Step down active Vault servers"
+}
+
+// Help returns detailed command help
+func (c *StepDownCommand) Help() string {
+	helpText := `
+Usage: vaultops step-down [options]
+
+    Make active Vault servers step down so that one of the standby
+    servers takes over. Sealed and standby servers are skipped.
+
+General Options:
+` + GeneralOptionsUsage() + `
+step-down Options:
+` + maintenanceOptionsUsage() + `
+  -wait				Wait until all vault servers are reachable before proceeding
+  -timeout=5m			Maximum time to wait for vault servers to become reachable
+				and to step down them
+  -retry-interval=1s		Initial interval between reachability checks; it grows
+				exponentially with each failed check
+`
+	return strings.TrimSpace(helpText)
+}
@@ -0,0 +1,46 @@
+package command
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mitchellh/cli"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStepDownCommand(t *testing.T) {
+	dir := makeTestDir(t)
+	defer os.RemoveAll(dir)
+	keyPath := filepath.Join(dir, "vault.json")
+
+	servers := makeTestCluster(t, 3, keyPath)
+	defer closeTestCluster(servers)
+	servers[2].SetSealed(true)
+
+	config := makeTestManifest(t, dir, []string{servers[0].URL}, []string{servers[0].URL, servers[1].URL, servers[2].URL})
+
+	ui := cli.NewMockUi()
+	c := &StepDownCommand{Meta: Meta{UI: ui}}
+	code := c.Run([]string{"-config", config, "-key-local-path", keyPath})
+	assert.Equal(t, 0, code, ui.ErrorWriter.String())
+	assert.True(t, servers[0].Standby())
+	assert.False(t, servers[0].Sealed())
+
+	out := ui.OutputWriter.String()
+	assert.Contains(t, out, fmt.Sprintf("Host: %s Sealed: false Standby: true", servers[0].URL))
+	assert.Contains(t, out, fmt.Sprintf("Host: %s skipped: standby", servers[1].URL))
+	assert.Contains(t, out, fmt.Sprintf("Host: %s skipped: sealed", servers[2].URL))
+	assert.Equal(t, 1, servers[0].Requests("/v1/sys/step-down"))
+	assert.Zero(t, servers[1].Requests("/v1/sys/step-down"))
+
+	// wrong token
+	servers[0].SetStandby(false)
+	ui = cli.NewMockUi()
+	c = &StepDownCommand{Meta: Meta{UI: ui}}
+	code = c.Run([]string{"-address", servers[0].URL, "-token", "foobar"})
+	assert.Equal(t, 1, code)
+	assert.Contains(t, ui.ErrorWriter.String(), fmt.Sprintf("Failed to step down %s", servers[0].URL))
+	assert.False(t, servers[0].Standby())
+}
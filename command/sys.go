@@ -0,0 +1,120 @@
+package command
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// The vault client api.Sys methods don't accept context, so the requests
+// which must be bounded by -timeout are sent via the functions below.
+
+// initStatus reads the init status of vault server
+func initStatus(ctx context.Context, v *api.Client) (bool, error) {
+	r := v.NewRequest(http.MethodGet, "/v1/sys/init")
+
+	resp, err := v.RawRequestWithContext(ctx, r)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	var result api.InitStatusResponse
+	err = resp.DecodeJSON(&result)
+	return result.Initialized, err
+}
+
+// initVault initializes vault server
+func initVault(ctx context.Context, v *api.Client, req *api.InitRequest) (*api.InitResponse, error) {
+	r := v.NewRequest(http.MethodPut, "/v1/sys/init")
+	if err := r.SetJSONBody(req); err != nil {
+		return nil, err
+	}
+
+	resp, err := v.RawRequestWithContext(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result api.InitResponse
+	err = resp.DecodeJSON(&result)
+	return &result, err
+}
+
+// sealStatus reads the seal status of vault server
+func sealStatus(ctx context.Context, v *api.Client) (*api.SealStatusResponse, error) {
+	return sealStatusRequest(ctx, v, v.NewRequest(http.MethodGet, "/v1/sys/seal-status"))
+}
+
+// unsealKey submits unseal key share to vault server
+func unsealKey(ctx context.Context, v *api.Client, key string) (*api.SealStatusResponse, error) {
+	r := v.NewRequest(http.MethodPut, "/v1/sys/unseal")
+	if err := r.SetJSONBody(map[string]interface{}{"key": key}); err != nil {
+		return nil, err
+	}
+
+	return sealStatusRequest(ctx, v, r)
+}
+
+// resetUnseal discards the unseal attempt in progress
+func resetUnseal(ctx context.Context, v *api.Client) (*api.SealStatusResponse, error) {
+	r := v.NewRequest(http.MethodPut, "/v1/sys/unseal")
+	if err := r.SetJSONBody(map[string]interface{}{"reset": true}); err != nil {
+		return nil, err
+	}
+
+	return sealStatusRequest(ctx, v, r)
+}
+
+// sealStatusRequest sends request r which returns seal status
+func sealStatusRequest(ctx context.Context, v *api.Client, r *api.Request) (*api.SealStatusResponse, error) {
+	resp, err := v.RawRequestWithContext(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result api.SealStatusResponse
+	err = resp.DecodeJSON(&result)
+	return &result, err
+}
+
+// raftJoin joins vault server to raft cluster
+func raftJoin(ctx context.Context, v *api.Client, req *api.RaftJoinRequest) (*api.RaftJoinResponse, error) {
+	r := v.NewRequest(http.MethodPost, "/v1/sys/storage/raft/join")
+	if err := r.SetJSONBody(req); err != nil {
+		return nil, err
+	}
+
+	resp, err := v.RawRequestWithContext(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result api.RaftJoinResponse
+	err = resp.DecodeJSON(&result)
+	return &result, err
+}
+
+// sealVault seals vault server
+func sealVault(ctx context.Context, v *api.Client) error {
+	return emptyRequest(ctx, v, v.NewRequest(http.MethodPut, "/v1/sys/seal"))
+}
+
+// stepDownVault makes active vault server step down
+func stepDownVault(ctx context.Context, v *api.Client) error {
+	return emptyRequest(ctx, v, v.NewRequest(http.MethodPut, "/v1/sys/step-down"))
+}
+
+// emptyRequest sends request r which returns no data
+func emptyRequest(ctx context.Context, v *api.Client, r *api.Request) error {
+	resp, err := v.RawRequestWithContext(ctx, r)
+	if err != nil {
+		return err
+	}
+
+	return resp.Body.Close()
+}
@@ -1,12 +1,13 @@
 package command
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
 	"github.com/hashicorp/vault/api"
 	"github.com/milosgajdos/vaultops/cipher"
-	"github.com/milosgajdos/vaultops/manifest"
+	"github.com/milosgajdos/vaultops/store"
 )
 
 // UnsealCommand implements vault unsealing
@@ -19,66 +20,138 @@ type UnsealCommand struct {
 // Run runs unsearl command which unseals vault servers
 // If unseal fails Run returns non-zero integer
 func (c *UnsealCommand) Run(args []string) int {
-	var status bool
+	var status, reset, interactive, storedKeys bool
 	var config string
+	var wf waitFlags
 	// create command flags
 	flags := c.Meta.FlagSet("unseal", FlagSetDefault)
 	flags.Usage = func() { c.UI.Error(c.Help()) }
 	flags.BoolVar(&status, "status", false, "")
+	flags.BoolVar(&reset, "reset", false, "")
+	flags.BoolVar(&interactive, "interactive", false, "")
+	flags.BoolVar(&storedKeys, "stored-keys", false, "")
 	flags.StringVar(&config, "config", "", "")
+	wf.register(flags)
 	if err := flags.Parse(args); err != nil {
 		return 1
 	}
 
+	if err := wf.validate(); err != nil {
+		c.UI.Error(fmt.Sprintf("Failed to parse options: %v", err))
+		return 1
+	}
+
+	// -timeout bounds waiting for the hosts as well as the unseal itself
+	ctx, cancel := wf.context()
+	defer cancel()
+
+	// report the seal status of all the clusters declared in the manifest
+	if status && c.allClusters(config) {
+		return c.runClusters(config, "unseal", func(m *Meta, hosts []string) int {
+			if wf.wait && !m.waitForHosts(ctx, hosts, &wf) {
+				return 1
+			}
+			return (&UnsealCommand{Meta: *m}).runSealStatus(ctx, hosts)
+		})
+	}
+
 	// get hosts against which we want to run unseal command
-	hosts, err := c.getRunHosts(config)
+	hosts, err := c.unsealHosts(config)
 	if err != nil {
 		c.UI.Error(fmt.Sprintf("Failed to read vault hosts: %v", err))
 		return 1
 	}
 
-	if status {
-		return c.runSealStatus(hosts)
-	}
-	// create vault keys store handle
-	s, err := VaultKeyStore(c.flagKeyStore, &c.Meta)
-	if err != nil {
-		c.UI.Error(fmt.Sprintf("Failed to create %s store: %v", c.flagKeyStore, err))
+	if wf.wait && !c.waitForHosts(ctx, hosts, &wf) {
 		return 1
 	}
-	// if kms provider not empty, initialize cipher
-	var cphr cipher.Cipher
-	if c.flagKMSProvider != "" {
-		cphr, err = VaultKeyCipher(&c.Meta)
-		if err != nil {
-			c.UI.Error(fmt.Sprintf("Failed to create %s cipher: %v", c.flagKMSProvider, err))
+
+	if status {
+		return c.runSealStatus(ctx, hosts)
+	}
+
+	// interactive unseal only uses the stored keys when asked to
+	vk := new(VaultKeys)
+	if !interactive || storedKeys {
+		if vk = c.readKeys(); vk == nil {
 			return 1
 		}
 	}
+
+	c.UI.Info("Attempting to unseal vault cluster:")
+	for _, host := range hosts {
+		c.UI.Info(fmt.Sprintf("\t%s", host))
+	}
+
+	if interactive {
+		return c.runInteractiveUnseal(hosts, vk, reset)
+	}
+
+	return c.runUnseal(ctx, hosts, vk, reset)
+}
+
+// readKeys reads vault keys from the configured key store
+// It reports the error and returns nil if the keys could not be read.
+func (m *Meta) readKeys() *VaultKeys {
+	vk, err := m.loadKeys()
+	if err != nil {
+		// report the error as a sentence
+		msg := err.Error()
+		m.UI.Error(strings.ToUpper(msg[:1]) + msg[1:])
+		return nil
+	}
+
+	return vk
+}
+
+// loadKeys reads vault keys from the configured key store
+func (m *Meta) loadKeys() (*VaultKeys, error) {
+	s, cphr, err := m.keyStore()
+	if err != nil {
+		return nil, err
+	}
 	// read vault keys
 	vk := new(VaultKeys)
 	if _, err := vk.Read(s, cphr); err != nil {
-		c.UI.Error(fmt.Sprintf("Failed to read vault keys: %v", err))
-		return 1
+		return nil, fmt.Errorf("failed to read vault keys: %v", err)
 	}
 
-	c.UI.Info("Attempting to unseal vault cluster:")
-	for _, host := range hosts {
-		c.UI.Info(fmt.Sprintf("\t%s", host))
+	return vk, nil
+}
+
+// keyStore returns the configured vault keys store and the cipher
+// which encrypts the keys; the cipher is nil if no KMS provider is configured
+func (m *Meta) keyStore() (store.Store, cipher.Cipher, error) {
+	ks, cc, err := m.keysConfig()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read key store configuration: %v", err)
+	}
+	// create vault keys store handle
+	s, err := VaultKeyStore(ks)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create %s store: %v", ks.Type, err)
+	}
+	// if kms provider not empty, initialize cipher
+	var cphr cipher.Cipher
+	if cc.Provider != "" {
+		cphr, err = VaultKeyCipher(cc)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create %s cipher: %v", cc.Provider, err)
+		}
 	}
 
-	return c.runUnseal(hosts, vk)
+	return s, cphr, nil
 }
 
-// runHosts retrieves a list of hosts agsints which the Init cmd should be run from configuration and returns it
-func (c *UnsealCommand) getRunHosts(config string) ([]string, error) {
+// unsealHosts retrieves a list of hosts against which the Unseal cmd should be run from configuration and returns it
+func (m *Meta) unsealHosts(config string) ([]string, error) {
 	if config != "" {
-		m, err := manifest.Parse(config)
+		mf, err := m.parseManifest(config)
 		if err != nil {
 			return nil, err
 		}
 
-		hosts, err := m.GetHosts("init")
+		hosts, err := m.manifestHosts(mf, "unseal")
 		if err != nil {
 			return nil, err
 		}
@@ -86,7 +159,7 @@ func (c *UnsealCommand) getRunHosts(config string) ([]string, error) {
 	}
 
 	// if no config is supplied read environment
-	cfg, err := c.Config("")
+	cfg, err := m.Config("")
 	if err != nil {
 		return nil, err
 	}
@@ -95,7 +168,7 @@ func (c *UnsealCommand) getRunHosts(config string) ([]string, error) {
 }
 
 // runUnsealStatus checks unseal status of vault server
-func (c *UnsealCommand) runSealStatus(hosts []string) int {
+func (c *UnsealCommand) runSealStatus(ctx context.Context, hosts []string) int {
 	type res struct {
 		host string
 		resp *api.SealStatusResponse
@@ -112,7 +185,7 @@ func (c *UnsealCommand) runSealStatus(hosts []string) int {
 		go func(h string) {
 			// check status and send down the status channel
 			c.UI.Info(fmt.Sprintf("Reading seal status of host: %s", h))
-			resp, err := v.Sys().SealStatus()
+			resp, err := sealStatus(ctx, v)
 			statChan <- &res{host: h, resp: resp, err: err}
 		}(host)
 	}
@@ -136,67 +209,47 @@ func (c *UnsealCommand) runSealStatus(hosts []string) int {
 
 // runUnseal attempts to unseal vault hosts using the keys
 // unseal action requires vault root token to be supplied via keys as well as unseal keys
-func (c *UnsealCommand) runUnseal(hosts []string, vk *VaultKeys) int {
-	if vk.RootToken == "" || vk.MasterKeys == nil {
-		c.UI.Error("No vault keys providedd")
+// If reset is true, the unseal attempts in progress are discarded before the keys are submitted.
+// It returns non-zero if any of the hosts remains sealed once all the keys have been submitted.
+// The unseal requests fail once ctx is done.
+func (c *UnsealCommand) runUnseal(ctx context.Context, hosts []string, vk *VaultKeys, reset bool) int {
+	if vk.Token() == "" || vk.MasterKeys == nil {
+		c.UI.Error("No vault keys provided")
 		return 1
 	}
 
 	type res struct {
-		host string
-		resp *api.SealStatusResponse
-		err  error
+		host   string
+		report *unsealReport
+		err    error
 	}
 	statChan := make(chan *res, 1)
 
 	// check status of each host concurrently
 	for _, host := range hosts {
-		v, err := c.Client(host, vk.RootToken)
+		v, err := c.Client(host, vk.Token())
 		if err != nil {
 			c.UI.Error(fmt.Sprintf("Failed to fetch Vault client: %v", err))
 			return 1
 		}
 
 		go func(h string) {
-			// check status and send down the status channel
-			resp, err := v.Sys().SealStatus()
-			if err != nil {
-				c.UI.Error(fmt.Sprintf("Failed to read seal status of %s: %v", h, err))
-				statChan <- &res{host: h, resp: resp, err: err}
-				return
-			}
-			// if the host is unsealed, don't do anything
-			if !resp.Sealed {
-				statChan <- &res{host: h, resp: resp, err: err}
-				return
-			}
-			// if unseal threshold is bigger than the number of supplied master keys
-			// we only attempt len(keys) unseals
-			t := resp.T
-			if t > len(vk.MasterKeys) {
-				t = len(vk.MasterKeys)
-			}
-			// attempt to unseal vault nodes with all the keys; bail on error
-			// otherwise we return the latest unseal response
 			c.UI.Info(fmt.Sprintf("Attempting to unseal host: %s", h))
-			for i := 0; i < t; i++ {
-				resp, err = v.Sys().Unseal(vk.MasterKeys[i])
-				if err != nil {
-					break
-				}
-			}
-			statChan <- &res{host: h, resp: resp, err: err}
+			report, err := unsealHost(ctx, v, vk.MasterKeys, reset)
+			statChan <- &res{host: h, report: report, err: err}
 		}(host)
 	}
 	// collect the results
 	var errStatus bool
 	for i := 0; i < len(hosts); i++ {
 		status := <-statChan
+		c.reportUnseal(status.host, status.report)
 		if status.err != nil {
 			c.UI.Error(fmt.Sprintf("Failed to unseal %s: %v", status.host, status.err))
 			errStatus = true
 			continue
 		}
+		resp := status.report.status
 		c.UI.Info(fmt.Sprintf(
 			"Host %s: \n"+
 				"\tSealed: %v\n"+
@@ -205,12 +258,16 @@ func (c *UnsealCommand) runUnseal(hosts []string, vk *VaultKeys) int {
 				"\tUnseal Progress: %d\n"+
 				"\tUnseal Nonce: %v",
 			status.host,
-			status.resp.Sealed,
-			status.resp.N,
-			status.resp.T,
-			status.resp.Progress,
-			status.resp.Nonce,
+			resp.Sealed,
+			resp.N,
+			resp.T,
+			resp.Progress,
+			resp.Nonce,
 		))
+		if resp.Sealed {
+			c.UI.Error(fmt.Sprintf("Host %s still sealed: progress %d/%d", status.host, resp.Progress, resp.T))
+			errStatus = true
+		}
 	}
 	// if at least one error encounctered we return non-zero
 	if errStatus {
@@ -222,6 +279,114 @@ func (c *UnsealCommand) runUnseal(hosts []string, vk *VaultKeys) int {
 	return 0
 }
 
+// unsealShare is the outcome of a single unseal key share submission
+type unsealShare struct {
+	// key is the index of the submitted key share
+	key int
+	// progress is the unseal progress after the key share was submitted
+	progress int
+	// duplicate is true if vault ignored the key share as it had already been submitted
+	duplicate bool
+}
+
+// outcome describes the outcome of the key share submission
+func (s unsealShare) outcome() string {
+	if s.duplicate {
+		return "ignored: already submitted"
+	}
+
+	return "accepted"
+}
+
+// unsealReport reports the unseal of a vault server
+type unsealReport struct {
+	// status is the seal status after the unseal
+	status *api.SealStatusResponse
+	// progress is the unseal progress the unseal resumed from
+	progress int
+	// reset is true if the unseal attempt in progress was discarded
+	reset bool
+	// shares are the outcomes of the submitted key shares
+	shares []unsealShare
+}
+
+// unsealHost attempts to unseal vault server using the keys and reports the outcome.
+// The unseal resumes from the current unseal progress: distinct keys are submitted one by one
+// until the server is unsealed, so the keys which other operators or previous runs have already
+// submitted in the current unseal attempt are reported as duplicates and don't count towards
+// the threshold. If reset is true, the unseal attempt in progress is discarded first.
+// If an unseal request fails, the returned report contains the key shares submitted so far.
+// The requests fail once ctx is done.
+func unsealHost(ctx context.Context, v *api.Client, keys []string, reset bool) (*unsealReport, error) {
+	resp, err := sealStatus(ctx, v)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &unsealReport{status: resp, progress: resp.Progress}
+	// if the host is unsealed, don't do anything
+	if !resp.Sealed {
+		return report, nil
+	}
+
+	if reset && resp.Progress > 0 {
+		resp, err = resetUnseal(ctx, v)
+		if err != nil {
+			return report, fmt.Errorf("failed to reset unseal: %v", err)
+		}
+		report.status, report.progress, report.reset = resp, resp.Progress, true
+	}
+
+	seen := make(map[string]bool)
+	for i, key := range keys {
+		if !resp.Sealed {
+			break
+		}
+
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		next, err := unsealKey(ctx, v, key)
+		if err != nil {
+			return report, fmt.Errorf("key share %d: %v", i+1, err)
+		}
+
+		share := unsealShare{
+			key:       i,
+			progress:  next.Progress,
+			duplicate: next.Sealed && next.Progress == resp.Progress && next.Nonce == resp.Nonce,
+		}
+		// vault resets the progress once it's unsealed
+		if !next.Sealed {
+			share.progress = next.T
+		}
+		report.shares = append(report.shares, share)
+		report.status, resp = next, next
+	}
+
+	return report, nil
+}
+
+// reportUnseal prints the outcome of the unseal of vault host
+func (m *Meta) reportUnseal(host string, r *unsealReport) {
+	if r == nil {
+		return
+	}
+
+	if r.reset {
+		m.UI.Info(fmt.Sprintf("Host %s: discarded unseal attempt in progress", host))
+	} else if r.progress > 0 {
+		m.UI.Info(fmt.Sprintf("Host %s: resuming unseal attempt at progress %d/%d", host, r.progress, r.status.T))
+	}
+
+	for _, share := range r.shares {
+		m.UI.Info(fmt.Sprintf("Host %s: key share %d %s. Unseal progress: %d/%d",
+			host, share.key+1, share.outcome(), share.progress, r.status.T))
+	}
+}
+
 // Synopsis provides a simple command description
 func (c *UnsealCommand) Synopsis() string {
 	return "Unseal a Vault server"
@@ -244,7 +409,19 @@ General Options:
 unseal Options:
 
     -status 			Don't unseal the server, only check the seal status
+				of all the clusters in the config file unless -cluster is set
+    -reset			Discard the unseal attempt in progress before submitting the keys
+    -interactive		Prompt for the unseal key shares instead of reading them from key store;
+				exits with 2 if any of the servers remains sealed
+    -stored-keys		Submit the stored keys before prompting for the key shares
+				in interactive mode
     -config			Path to a config file which contains a list of vault servers
+    -wait				Wait until all vault servers are reachable before proceeding
+    -timeout=5m			Maximum time to wait for vault servers to become reachable
+				and to unseal them; key shares entered in interactive mode
+				are not limited by it
+    -retry-interval=1s		Initial interval between reachability checks; it grows
+				exponentially with each failed check
 `
 	return strings.TrimSpace(helpText)
 }
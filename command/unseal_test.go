@@ -0,0 +1,233 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/milosgajdos/vaultops/vaulttest"
+	"github.com/mitchellh/cli"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeTestKeys writes unencrypted vault keys into path
+func writeTestKeys(t *testing.T, path string, vk *VaultKeys) {
+	data, err := json.Marshal(vk)
+	assert.NoError(t, err)
+	assert.NoError(t, ioutil.WriteFile(path, data, 0600))
+}
+
+func TestUnsealCommandStatus(t *testing.T) {
+	s := vaulttest.NewServer()
+	defer s.Close()
+	s.Initialize(5, 3)
+
+	ui := cli.NewMockUi()
+	c := &UnsealCommand{Meta: Meta{UI: ui}}
+	code := c.Run([]string{"-address", s.URL, "-status"})
+	assert.Equal(t, 0, code)
+	assert.Contains(t, ui.OutputWriter.String(), fmt.Sprintf("Host: %s Sealed: true", s.URL))
+
+	s.Fail("/v1/sys/seal-status", http.StatusInternalServerError, 1)
+	ui = cli.NewMockUi()
+	c = &UnsealCommand{Meta: Meta{UI: ui}}
+	code = c.Run([]string{"-address", s.URL, "-status"})
+	assert.Equal(t, 1, code)
+	assert.Contains(t, ui.ErrorWriter.String(), "Failed to read seal status")
+}
+
+func TestUnsealCommand(t *testing.T) {
+	dir := makeTestDir(t)
+	defer os.RemoveAll(dir)
+	keyPath := filepath.Join(dir, "vault.json")
+
+	s := vaulttest.NewServer()
+	defer s.Close()
+	keys, token := s.Initialize(5, 3)
+	writeTestKeys(t, keyPath, &VaultKeys{RootToken: token, MasterKeys: keys})
+
+	ui := cli.NewMockUi()
+	c := &UnsealCommand{Meta: Meta{UI: ui}}
+	code := c.Run([]string{"-address", s.URL, "-key-local-path", keyPath})
+	assert.Equal(t, 0, code, ui.ErrorWriter.String())
+	assert.False(t, s.Sealed())
+	assert.Contains(t, ui.OutputWriter.String(), "Vault successfully unsealed")
+	// only the threshold number of keys is submitted
+	assert.Equal(t, 3, s.Requests("/v1/sys/unseal"))
+
+	// unsealed server is left alone
+	ui = cli.NewMockUi()
+	c = &UnsealCommand{Meta: Meta{UI: ui}}
+	code = c.Run([]string{"-address", s.URL, "-key-local-path", keyPath})
+	assert.Equal(t, 0, code, ui.ErrorWriter.String())
+	assert.Equal(t, 3, s.Requests("/v1/sys/unseal"))
+}
+
+func TestUnsealCommandPartialKeys(t *testing.T) {
+	dir := makeTestDir(t)
+	defer os.RemoveAll(dir)
+	keyPath := filepath.Join(dir, "vault.json")
+
+	s := vaulttest.NewServer()
+	defer s.Close()
+	keys, token := s.Initialize(5, 3)
+	writeTestKeys(t, keyPath, &VaultKeys{RootToken: token, MasterKeys: keys[:2]})
+
+	ui := cli.NewMockUi()
+	c := &UnsealCommand{Meta: Meta{UI: ui}}
+	code := c.Run([]string{"-address", s.URL, "-key-local-path", keyPath})
+	assert.Equal(t, 1, code)
+	assert.True(t, s.Sealed())
+	assert.Equal(t, 2, s.Progress())
+	assert.Contains(t, ui.OutputWriter.String(), "Unseal Progress: 2")
+	assert.NotContains(t, ui.OutputWriter.String(), "Vault successfully unsealed")
+	assert.Contains(t, ui.ErrorWriter.String(), fmt.Sprintf("Host %s still sealed: progress 2/3", s.URL))
+}
+
+// submitTestKey submits unseal key to vault server s
+func submitTestKey(t *testing.T, s *vaulttest.Server, key string) {
+	cfg := api.DefaultConfig()
+	cfg.Address = s.URL
+	v, err := api.NewClient(cfg)
+	assert.NoError(t, err)
+	_, err = v.Sys().Unseal(key)
+	assert.NoError(t, err)
+}
+
+func TestUnsealCommandResume(t *testing.T) {
+	dir := makeTestDir(t)
+	defer os.RemoveAll(dir)
+	keyPath := filepath.Join(dir, "vault.json")
+
+	s := vaulttest.NewServer()
+	defer s.Close()
+	keys, token := s.Initialize(5, 3)
+	writeTestKeys(t, keyPath, &VaultKeys{RootToken: token, MasterKeys: keys})
+
+	// another operator has already submitted the second key share
+	submitTestKey(t, s, keys[1])
+
+	ui := cli.NewMockUi()
+	c := &UnsealCommand{Meta: Meta{UI: ui}}
+	code := c.Run([]string{"-address", s.URL, "-key-local-path", keyPath})
+	assert.Equal(t, 0, code, ui.ErrorWriter.String())
+	assert.False(t, s.Sealed())
+	assert.Equal(t, 4, s.Requests("/v1/sys/unseal"))
+
+	out := ui.OutputWriter.String()
+	assert.Contains(t, out, fmt.Sprintf("Host %s: resuming unseal attempt at progress 1/3", s.URL))
+	assert.Contains(t, out, fmt.Sprintf("Host %s: key share 1 accepted. Unseal progress: 2/3", s.URL))
+	assert.Contains(t, out, fmt.Sprintf("Host %s: key share 2 ignored: already submitted. Unseal progress: 2/3", s.URL))
+	assert.Contains(t, out, fmt.Sprintf("Host %s: key share 3 accepted. Unseal progress: 3/3", s.URL))
+}
+
+func TestUnsealCommandReset(t *testing.T) {
+	dir := makeTestDir(t)
+	defer os.RemoveAll(dir)
+	keyPath := filepath.Join(dir, "vault.json")
+
+	s := vaulttest.NewServer()
+	defer s.Close()
+	keys, token := s.Initialize(5, 3)
+	// duplicate keys are only submitted once
+	writeTestKeys(t, keyPath, &VaultKeys{RootToken: token, MasterKeys: []string{keys[0], keys[0], keys[1]}})
+
+	// stale unseal attempt
+	submitTestKey(t, s, keys[4])
+
+	ui := cli.NewMockUi()
+	c := &UnsealCommand{Meta: Meta{UI: ui}}
+	code := c.Run([]string{"-address", s.URL, "-key-local-path", keyPath, "-reset"})
+	// the stale key share was discarded, so two key shares don't unseal the server
+	assert.Equal(t, 1, code)
+	assert.True(t, s.Sealed())
+	assert.Equal(t, 2, s.Progress())
+	assert.Equal(t, 4, s.Requests("/v1/sys/unseal"))
+	assert.Contains(t, ui.OutputWriter.String(), fmt.Sprintf("Host %s: discarded unseal attempt in progress", s.URL))
+
+	// unseal resumes from the current progress
+	ui = cli.NewMockUi()
+	c = &UnsealCommand{Meta: Meta{UI: ui}}
+	writeTestKeys(t, keyPath, &VaultKeys{RootToken: token, MasterKeys: keys[:3]})
+	code = c.Run([]string{"-address", s.URL, "-key-local-path", keyPath})
+	assert.Equal(t, 0, code, ui.ErrorWriter.String())
+	assert.False(t, s.Sealed())
+}
+
+func TestUnsealCommandManifest(t *testing.T) {
+	dir := makeTestDir(t)
+	defer os.RemoveAll(dir)
+	keyPath := filepath.Join(dir, "vault.json")
+
+	leader := vaulttest.NewServer()
+	defer leader.Close()
+	keys, token := leader.Initialize(3, 2)
+	writeTestKeys(t, keyPath, &VaultKeys{RootToken: token, MasterKeys: keys})
+
+	follower := vaulttest.NewServer()
+	defer follower.Close()
+	follower.InitializeWithKeys(keys, 2, token)
+
+	config := makeTestManifest(t, dir, []string{leader.URL}, []string{leader.URL, follower.URL})
+
+	ui := cli.NewMockUi()
+	c := &UnsealCommand{Meta: Meta{UI: ui}}
+	code := c.Run([]string{"-config", config, "-key-local-path", keyPath})
+	assert.Equal(t, 0, code, ui.ErrorWriter.String())
+	assert.False(t, leader.Sealed())
+	assert.False(t, follower.Sealed())
+
+	ui = cli.NewMockUi()
+	c = &UnsealCommand{Meta: Meta{UI: ui}}
+	code = c.Run([]string{"-config", config, "-status"})
+	assert.Equal(t, 0, code, ui.ErrorWriter.String())
+	assert.Contains(t, ui.OutputWriter.String(), fmt.Sprintf("Host: %s Sealed: false", leader.URL))
+	assert.Contains(t, ui.OutputWriter.String(), fmt.Sprintf("Host: %s Sealed: false", follower.URL))
+}
+
+func TestUnsealCommandErrors(t *testing.T) {
+	dir := makeTestDir(t)
+	defer os.RemoveAll(dir)
+	keyPath := filepath.Join(dir, "vault.json")
+	emptyPath := filepath.Join(dir, "empty.json")
+	writeTestKeys(t, emptyPath, &VaultKeys{})
+
+	s := vaulttest.NewServer()
+	defer s.Close()
+	keys, token := s.Initialize(3, 2)
+	writeTestKeys(t, keyPath, &VaultKeys{RootToken: token, MasterKeys: keys})
+
+	testCases := []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"-foobar"}, ""},
+		{[]string{"-config", filepath.Join(dir, "foobar.yaml")}, "Failed to read vault hosts"},
+		{[]string{"-address", s.URL, "-key-store", "foobar"}, "Failed to create foobar store"},
+		{[]string{"-address", s.URL, "-key-local-path", keyPath, "-kms-provider", "foobar"}, "Failed to create foobar cipher"},
+		{[]string{"-address", s.URL, "-key-local-path", filepath.Join(dir, "missing.json")}, "Failed to read vault keys"},
+		{[]string{"-address", s.URL, "-key-local-path", emptyPath}, "No vault keys provided"},
+	}
+
+	for _, tc := range testCases {
+		ui := cli.NewMockUi()
+		c := &UnsealCommand{Meta: Meta{UI: ui}}
+		code := c.Run(tc.args)
+		assert.Equal(t, 1, code)
+		assert.Contains(t, ui.ErrorWriter.String(), tc.err)
+	}
+
+	// failed unseal request
+	s.Fail("/v1/sys/unseal", http.StatusInternalServerError, 1)
+	ui := cli.NewMockUi()
+	c := &UnsealCommand{Meta: Meta{UI: ui}}
+	code := c.Run([]string{"-address", s.URL, "-key-local-path", keyPath})
+	assert.Equal(t, 1, code)
+	assert.Contains(t, ui.ErrorWriter.String(), fmt.Sprintf("Failed to unseal %s", s.URL))
+	assert.True(t, s.Sealed())
+}
@@ -0,0 +1,323 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/milosgajdos/vaultops/restart"
+	"github.com/milosgajdos/vaultops/restart/k8s"
+	"github.com/milosgajdos/vaultops/restart/shell"
+)
+
+// upgradeOpts configure the upgrade of vault hosts
+type upgradeOpts struct {
+	// version is the expected vault version after the upgrade
+	version string
+	// timeout is the maximum time allowed for restarting a single host
+	timeout time.Duration
+	// retryInterval is the initial interval between host health checks
+	retryInterval time.Duration
+}
+
+// UpgradeCommand implements rolling upgrade of vault cluster
+// It fulfills cli.Command interface
+type UpgradeCommand struct {
+	// meta flags contain vault client config
+	Meta
+	// restarter restarts vault hosts; if set, it overrides the restart flags
+	restarter restart.Restarter
+}
+
+// Run runs upgrade command which restarts vault cluster hosts one at a time,
+// standby hosts first, unseals them and steps down the active host before restarting it.
+// If the upgrade of any host fails, the upgrade is aborted and Run returns non-zero integer.
+func (c *UpgradeCommand) Run(args []string) int {
+	var config, restartCommand, restartShell string
+	var restartPods bool
+	var opts upgradeOpts
+
+	flags := c.Meta.FlagSet("upgrade", FlagSetDefault)
+	flags.Usage = func() { c.UI.Info(c.Help()) }
+	flags.StringVar(&config, "config", "", "")
+	flags.StringVar(&restartCommand, "restart-command", "", "")
+	flags.StringVar(&restartShell, "restart-shell", "sh", "")
+	flags.BoolVar(&restartPods, "restart-pods", false, "")
+	flags.StringVar(&opts.version, "version", "", "")
+	flags.DurationVar(&opts.timeout, "restart-timeout", 10*time.Minute, "")
+	flags.DurationVar(&opts.retryInterval, "retry-interval", time.Second, "")
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	hosts, err := c.unsealHosts(config)
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Failed to read vault hosts: %v", err))
+		return 1
+	}
+
+	r := c.restarter
+	if r == nil {
+		r, err = c.newRestarter(config, restartCommand, restartShell, restartPods)
+		if err != nil {
+			c.UI.Error(fmt.Sprintf("Failed to create restart hook: %v", err))
+			return 1
+		}
+	}
+
+	vk := c.readKeys()
+	if vk == nil {
+		return 1
+	}
+
+	if vk.Token() == "" || vk.MasterKeys == nil {
+		c.UI.Error("No vault keys provided")
+		return 1
+	}
+
+	c.UI.Info("Attempting rolling upgrade of vault cluster:")
+	for _, host := range hosts {
+		c.UI.Info(fmt.Sprintf("\t%s", host))
+	}
+
+	// the upgrade only starts if the cluster is healthy
+	statuses := make([]*hostStatus, len(hosts))
+	for i, host := range hosts {
+		v, err := c.Client(host, vk.Token())
+		if err != nil {
+			c.UI.Error(fmt.Sprintf("Failed to fetch Vault client: %v", err))
+			return 1
+		}
+		statuses[i] = readHostStatus(host, v, false)
+	}
+
+	if _, issues := checkClusterStatus(statuses); len(issues) > 0 {
+		for _, issue := range issues {
+			c.UI.Error(issue)
+		}
+		c.UI.Error("Upgrade aborted: vault cluster is not healthy")
+		return 1
+	}
+
+	c.renewAdminToken(hosts, vk)
+
+	var active string
+	var standbys []string
+	for _, s := range statuses {
+		if s.role() == "active" {
+			active = s.host
+			continue
+		}
+		standbys = append(standbys, s.host)
+	}
+
+	for i, host := range standbys {
+		newHost, err := c.upgradeHost(host, r, vk, &opts)
+		if err != nil {
+			c.UI.Error(fmt.Sprintf("Upgrade aborted: failed to upgrade %s: %v", host, err))
+			return 1
+		}
+		standbys[i] = newHost
+	}
+
+	if opts.version != "" && c.runsVersion(active, vk.Token(), opts.version) {
+		c.UI.Info(fmt.Sprintf("Host: %s already runs version %s: skipped", active, opts.version))
+		c.UI.Info("Vault cluster successfully upgraded")
+		return 0
+	}
+
+	if len(standbys) > 0 {
+		c.UI.Info(fmt.Sprintf("Host: %s stepping down", active))
+		if err := c.stepDown(active, standbys, vk.Token(), &opts); err != nil {
+			c.UI.Error(fmt.Sprintf("Upgrade aborted: failed to step down %s: %v", active, err))
+			return 1
+		}
+	}
+
+	if _, err := c.upgradeHost(active, r, vk, &opts); err != nil {
+		c.UI.Error(fmt.Sprintf("Upgrade aborted: failed to upgrade %s: %v", active, err))
+		return 1
+	}
+
+	c.UI.Info("Vault cluster successfully upgraded")
+
+	return 0
+}
+
+// newRestarter creates vault hosts restart hook
+// Exactly one of command or pods must be set. If pods is true, the pods are
+// looked up using Kubernetes discovery configured in the manifest read from config
+// or in the manifest of the cluster selected via -cluster.
+func (m *Meta) newRestarter(config, command, sh string, pods bool) (restart.Restarter, error) {
+	switch {
+	case command != "" && pods:
+		return nil, fmt.Errorf("only one of -restart-command or -restart-pods can be set")
+	case command != "":
+		return shell.New(command, sh)
+	case pods:
+		if config == "" {
+			return nil, fmt.Errorf("-restart-pods requires -config")
+		}
+
+		mf, err := m.parseManifest(config)
+		if err != nil {
+			return nil, err
+		}
+
+		if mf.Hosts.Kubernetes == nil {
+			return nil, fmt.Errorf("no kubernetes discovery configured in %s", config)
+		}
+
+		return k8s.New(mf.Hosts.Kubernetes.Config())
+	}
+
+	return nil, fmt.Errorf("one of -restart-command or -restart-pods must be set")
+}
+
+// runsVersion returns true if vault host reports the given version
+func (c *UpgradeCommand) runsVersion(host, token, version string) bool {
+	v, err := c.Client(host, token)
+	if err != nil {
+		return false
+	}
+
+	health, err := checkHealth(context.Background(), v)
+	if err != nil {
+		return false
+	}
+
+	return health.Version == version
+}
+
+// upgradeHost restarts vault host, waits until it's reachable, unseals it and checks its version.
+// It returns the host URL after the restart.
+func (c *UpgradeCommand) upgradeHost(host string, r restart.Restarter, vk *VaultKeys, o *upgradeOpts) (string, error) {
+	if o.version != "" && c.runsVersion(host, vk.Token(), o.version) {
+		c.UI.Info(fmt.Sprintf("Host: %s already runs version %s: skipped", host, o.version))
+		return host, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), o.timeout)
+	defer cancel()
+
+	c.UI.Info(fmt.Sprintf("Host: %s restarting", host))
+	newHost, err := r.Restart(ctx, host)
+	if err != nil {
+		return "", err
+	}
+
+	if newHost != host {
+		c.UI.Info(fmt.Sprintf("Host: %s restarted as %s", host, newHost))
+	}
+
+	if _, err := c.waitForHost(ctx, newHost, o.retryInterval); err != nil {
+		return "", fmt.Errorf("host not reachable after restart: %v", err)
+	}
+
+	v, err := c.Client(newHost, vk.Token())
+	if err != nil {
+		return "", err
+	}
+
+	report, err := unsealHost(ctx, v, vk.MasterKeys, false)
+	c.reportUnseal(newHost, report)
+	if err != nil {
+		return "", fmt.Errorf("failed to unseal: %v", err)
+	}
+
+	if report.status.Sealed {
+		return "", fmt.Errorf("not enough keys: unseal progress %d/%d", report.status.Progress, report.status.T)
+	}
+
+	health, err := checkHealth(ctx, v)
+	if err != nil {
+		return "", err
+	}
+
+	if o.version != "" && health.Version != o.version {
+		return "", fmt.Errorf("host runs version %s, expected %s", health.Version, o.version)
+	}
+
+	c.UI.Info(fmt.Sprintf("Host: %s upgraded. Version: %s", newHost, health.Version))
+
+	return newHost, nil
+}
+
+// stepDown steps down the active host and waits until one of the standbys becomes active
+func (c *UpgradeCommand) stepDown(active string, standbys []string, token string, o *upgradeOpts) error {
+	v, err := c.Client(active, token)
+	if err != nil {
+		return err
+	}
+
+	if err := v.Sys().StepDown(); err != nil {
+		return err
+	}
+
+	clients := make([]*api.Client, len(standbys))
+	for i, host := range standbys {
+		if clients[i], err = c.Client(host, token); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), o.timeout)
+	defer cancel()
+
+	for attempt := 0; ; attempt++ {
+		for i, v := range clients {
+			health, err := checkHealth(ctx, v)
+			if err == nil && health.Initialized && !health.Sealed && !health.Standby {
+				c.UI.Info(fmt.Sprintf("Host: %s is active", standbys[i]))
+				return nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("no standby host became active: %v", ctx.Err())
+		case <-time.After(backoff(o.retryInterval, attempt)):
+		}
+	}
+}
+
+// Synopsis provides a simple command description
+func (c *UpgradeCommand) Synopsis() string {
+	return "Perform a rolling upgrade of a Vault cluster"
+}
+
+// Help returns detailed command help
+func (c *UpgradeCommand) Help() string {
+	helpText := `
+Usage: vaultops upgrade [options]
+
+    Perform a rolling upgrade of a Vault cluster.
+
+    The standby servers are restarted one at a time using the restart hook.
+    Each restarted server must become reachable again; it's then unsealed
+    with the stored keys and its version is checked. Once all the standby
+    servers are upgraded, the active server steps down and is upgraded
+    the same way. The upgrade is aborted on the first failure.
+
+    The restart hook either runs a shell command with the server URL
+    in VAULTOPS_HOST and VAULT_ADDR environment variables, or deletes the
+    pod of the server found via the kubernetes discovery of the manifest
+    and waits for the pod to be recreated.
+
+General Options:
+` + GeneralOptionsUsage() + `
+upgrade Options:
+
+  -config			Path to a config file which contains a list of vault servers
+  -restart-command		Shell command which restarts a vault server
+  -restart-shell=sh		Shell which runs -restart-command
+  -restart-pods			Restart vault servers by deleting their kubernetes pods
+  -version			Expected vault version after the upgrade; the servers
+				which already run it are not restarted
+  -restart-timeout=10m		Maximum time to restart, unseal and check a single server
+  -retry-interval=1s		Initial interval between reachability checks
+`
+	return strings.TrimSpace(helpText)
+}
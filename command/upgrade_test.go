@@ -0,0 +1,182 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/milosgajdos/vaultops/vaulttest"
+	"github.com/mitchellh/cli"
+	"github.com/stretchr/testify/assert"
+)
+
+// testRestarter emulates vault server upgrades by sealing
+// the restarted servers and changing their version
+type testRestarter struct {
+	mu        sync.Mutex
+	servers   map[string]*vaulttest.Server
+	version   string
+	fail      string
+	restarted []string
+}
+
+func newTestRestarter(version string, servers []*vaulttest.Server) *testRestarter {
+	r := &testRestarter{
+		servers: make(map[string]*vaulttest.Server),
+		version: version,
+	}
+
+	for _, s := range servers {
+		r.servers[s.URL] = s
+	}
+
+	return r
+}
+
+func (r *testRestarter) Restart(ctx context.Context, host string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if host == r.fail {
+		return "", fmt.Errorf("restart failed")
+	}
+
+	s := r.servers[host]
+	s.SetSealed(true)
+	s.SetVersion(r.version)
+	r.restarted = append(r.restarted, host)
+
+	return host, nil
+}
+
+// promoteOnStepDown makes standby active once active steps down
+func promoteOnStepDown(active, standby *vaulttest.Server) {
+	go func() {
+		for i := 0; i < 1000; i++ {
+			if active.Standby() {
+				standby.SetStandby(false)
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+}
+
+func TestUpgradeCommand(t *testing.T) {
+	dir := makeTestDir(t)
+	defer os.RemoveAll(dir)
+	keyPath := filepath.Join(dir, "vault.json")
+
+	servers := makeTestCluster(t, 3, keyPath)
+	defer closeTestCluster(servers)
+	config := makeTestManifest(t, dir, []string{servers[0].URL}, []string{servers[0].URL, servers[1].URL, servers[2].URL})
+
+	// the first standby has already been upgraded
+	servers[1].SetVersion("1.6.0")
+	promoteOnStepDown(servers[0], servers[2])
+
+	r := newTestRestarter("1.6.0", servers)
+	ui := cli.NewMockUi()
+	c := &UpgradeCommand{Meta: Meta{UI: ui}, restarter: r}
+	code := c.Run([]string{"-config", config, "-key-local-path", keyPath, "-version", "1.6.0", "-retry-interval", "1ms"})
+	assert.Equal(t, 0, code, ui.ErrorWriter.String())
+	assert.Equal(t, []string{servers[2].URL, servers[0].URL}, r.restarted)
+
+	for _, s := range servers {
+		assert.False(t, s.Sealed())
+	}
+	assert.True(t, servers[0].Standby())
+	assert.False(t, servers[2].Standby())
+
+	out := ui.OutputWriter.String()
+	assert.Contains(t, out, fmt.Sprintf("Host: %s already runs version 1.6.0: skipped", servers[1].URL))
+	assert.Contains(t, out, fmt.Sprintf("Host: %s upgraded. Version: 1.6.0", servers[2].URL))
+	assert.Contains(t, out, fmt.Sprintf("Host: %s is active", servers[2].URL))
+	assert.Contains(t, out, fmt.Sprintf("Host: %s upgraded. Version: 1.6.0", servers[0].URL))
+	assert.Contains(t, out, "Vault cluster successfully upgraded")
+}
+
+func TestUpgradeCommandAbort(t *testing.T) {
+	dir := makeTestDir(t)
+	defer os.RemoveAll(dir)
+	keyPath := filepath.Join(dir, "vault.json")
+
+	servers := makeTestCluster(t, 3, keyPath)
+	defer closeTestCluster(servers)
+	config := makeTestManifest(t, dir, []string{servers[0].URL}, []string{servers[0].URL, servers[1].URL, servers[2].URL})
+
+	// failed restart
+	r := newTestRestarter("1.6.0", servers)
+	r.fail = servers[1].URL
+	ui := cli.NewMockUi()
+	c := &UpgradeCommand{Meta: Meta{UI: ui}, restarter: r}
+	code := c.Run([]string{"-config", config, "-key-local-path", keyPath})
+	assert.Equal(t, 1, code)
+	assert.Contains(t, ui.ErrorWriter.String(), fmt.Sprintf("Upgrade aborted: failed to upgrade %s: restart failed", servers[1].URL))
+	assert.Empty(t, r.restarted)
+	assert.Zero(t, servers[0].Requests("/v1/sys/step-down"))
+
+	// unexpected version
+	r = newTestRestarter("1.5.1", servers)
+	ui = cli.NewMockUi()
+	c = &UpgradeCommand{Meta: Meta{UI: ui}, restarter: r}
+	code = c.Run([]string{"-config", config, "-key-local-path", keyPath, "-version", "1.6.0", "-retry-interval", "1ms"})
+	assert.Equal(t, 1, code)
+	assert.Contains(t, ui.ErrorWriter.String(), "host runs version 1.5.1, expected 1.6.0")
+	assert.Len(t, r.restarted, 1)
+
+	// unhealthy cluster
+	ui = cli.NewMockUi()
+	c = &UpgradeCommand{Meta: Meta{UI: ui}, restarter: r}
+	servers[2].SetSealed(true)
+	code = c.Run([]string{"-config", config, "-key-local-path", keyPath})
+	assert.Equal(t, 1, code)
+	assert.Contains(t, ui.ErrorWriter.String(), "Upgrade aborted: vault cluster is not healthy")
+
+	// no standby becomes active
+	servers[2].SetSealed(false)
+	servers[1].SetVersion(vaulttest.DefaultVersion)
+	r = newTestRestarter(vaulttest.DefaultVersion, servers)
+	ui = cli.NewMockUi()
+	c = &UpgradeCommand{Meta: Meta{UI: ui}, restarter: r}
+	code = c.Run([]string{"-config", config, "-key-local-path", keyPath, "-restart-timeout", "50ms", "-retry-interval", "1ms"})
+	assert.Equal(t, 1, code)
+	assert.Contains(t, ui.ErrorWriter.String(), fmt.Sprintf("Upgrade aborted: failed to step down %s: no standby host became active", servers[0].URL))
+}
+
+func TestUpgradeCommandErrors(t *testing.T) {
+	dir := makeTestDir(t)
+	defer os.RemoveAll(dir)
+	keyPath := filepath.Join(dir, "vault.json")
+
+	servers := makeTestCluster(t, 1, keyPath)
+	defer closeTestCluster(servers)
+	s := servers[0]
+	config := makeTestManifest(t, dir, []string{s.URL}, []string{s.URL})
+
+	testCases := []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"-foobar"}, ""},
+		{[]string{"-config", filepath.Join(dir, "foobar.yaml")}, "Failed to read vault hosts"},
+		{[]string{"-address", s.URL}, "one of -restart-command or -restart-pods must be set"},
+		{[]string{"-address", s.URL, "-restart-command", "true", "-restart-pods"}, "only one of -restart-command or -restart-pods"},
+		{[]string{"-address", s.URL, "-restart-pods"}, "-restart-pods requires -config"},
+		{[]string{"-config", config, "-restart-pods"}, "no kubernetes discovery configured"},
+		{[]string{"-address", s.URL, "-restart-command", "true", "-key-local-path", filepath.Join(dir, "missing.json")}, "Failed to read vault keys"},
+		{[]string{"-address", s.URL, "-restart-command", "false", "-key-local-path", keyPath}, "restart command failed"},
+	}
+
+	for _, tc := range testCases {
+		ui := cli.NewMockUi()
+		c := &UpgradeCommand{Meta: Meta{UI: ui}}
+		code := c.Run(tc.args)
+		assert.Equal(t, 1, code)
+		assert.Contains(t, ui.ErrorWriter.String(), tc.err)
+	}
+}
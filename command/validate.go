@@ -0,0 +1,105 @@
+package command
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/milosgajdos/vaultops/manifest"
+)
+
+// ValidateCommand implements manifest validation
+// It fulfills cli.Command interface
+type ValidateCommand struct {
+	// meta flags contain vault client config
+	Meta
+}
+
+// Run runs validate command which validates the manifest and reports its errors
+// If the manifest is not valid Run returns non-zero integer
+func (c *ValidateCommand) Run(args []string) int {
+	var config string
+	var schema bool
+
+	flags := c.Meta.FlagSet("validate", FlagSetNone)
+	flags.Usage = func() { c.UI.Info(c.Help()) }
+	flags.StringVar(&config, "config", "", "")
+	flags.BoolVar(&schema, "schema", false, "")
+	flags.StringVar(&c.flagFormat, "config-format", "", "")
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	if schema {
+		data, err := manifest.Schema()
+		if err != nil {
+			c.UI.Error(fmt.Sprintf("Failed to generate manifest schema: %v", err))
+			return 1
+		}
+		c.UI.Output(strings.TrimSuffix(string(data), "\n"))
+		return 0
+	}
+
+	if config == "" {
+		c.UI.Error("No config file provided")
+		return 1
+	}
+
+	if _, err := c.readManifest(config); err != nil {
+		errs, ok := err.(manifest.Errors)
+		if !ok {
+			c.UI.Error(fmt.Sprintf("Failed to read %s: %v", config, err))
+			return 1
+		}
+
+		for _, e := range errs {
+			// errors in included files are reported with the included file
+			file := config
+			if e.File != "" {
+				file = e.File
+			}
+
+			switch {
+			case e.Line == 0:
+				c.UI.Error(fmt.Sprintf("%s: %s", file, e.Msg))
+			case e.Column == 0:
+				c.UI.Error(fmt.Sprintf("%s:%d: %s", file, e.Line, e.Msg))
+			default:
+				c.UI.Error(fmt.Sprintf("%s:%d:%d: %s", file, e.Line, e.Column, e.Msg))
+			}
+		}
+		c.UI.Error(fmt.Sprintf("Manifest %s is not valid", config))
+		return 1
+	}
+
+	c.UI.Info(fmt.Sprintf("Manifest %s is valid", config))
+
+	return 0
+}
+
+// Synopsis provides a simple command description
+func (c *ValidateCommand) Synopsis() string {
+	return "Validate a vaultops manifest"
+}
+
+// Help returns detailed command help
+func (c *ValidateCommand) Help() string {
+	helpText := `
+Usage: vaultops validate [options]
+
+    Validate a vaultops manifest.
+
+    The manifest must not contain unknown fields. The hosts must be valid
+    unique http(s) URLs, the key threshold must not be greater than the number
+    of key shares and the key store type and KMS provider must be supported.
+    All the errors are reported along with their line and column.
+    The manifest can be written in YAML, JSON or HCL.
+
+validate Options:
+
+  -config			Path to the config file to validate
+  -config-format		Format of the config file: yaml, json or hcl
+				Unless set, the format is detected by the file extension
+  -schema			Print JSON Schema of the manifest instead
+`
+	return strings.TrimSpace(helpText)
+}
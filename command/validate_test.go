@@ -0,0 +1,81 @@
+package command
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mitchellh/cli"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateCommand(t *testing.T) {
+	dir := makeTestDir(t)
+	defer os.RemoveAll(dir)
+
+	valid := filepath.Join(dir, "valid.yaml")
+	assert.NoError(t, ioutil.WriteFile(valid, []byte("hosts:\n  unseal:\n    - http://vault-0:8200\n"), 0600))
+
+	ui := cli.NewMockUi()
+	c := &ValidateCommand{Meta: Meta{UI: ui}}
+	code := c.Run([]string{"-config", valid})
+	assert.Equal(t, 0, code, ui.ErrorWriter.String())
+	assert.Contains(t, ui.OutputWriter.String(), "Manifest "+valid+" is valid")
+
+	invalid := filepath.Join(dir, "invalid.yaml")
+	data := `hosts:
+  unsael:
+    - http://vault-0:8200
+keys:
+  shares: 3
+  threshold: 5
+`
+	assert.NoError(t, ioutil.WriteFile(invalid, []byte(data), 0600))
+
+	ui = cli.NewMockUi()
+	c = &ValidateCommand{Meta: Meta{UI: ui}}
+	code = c.Run([]string{"-config", invalid})
+	assert.Equal(t, 1, code)
+	out := ui.ErrorWriter.String()
+	assert.Contains(t, out, invalid+`:2:3: unknown field "unsael", did you mean "unseal"?`)
+	assert.Contains(t, out, "Manifest "+invalid+" is not valid")
+
+	// missing file
+	ui = cli.NewMockUi()
+	c = &ValidateCommand{Meta: Meta{UI: ui}}
+	code = c.Run([]string{"-config", filepath.Join(dir, "missing.yaml")})
+	assert.Equal(t, 1, code)
+	assert.Contains(t, ui.ErrorWriter.String(), "Failed to read")
+
+	// HCL manifest
+	hcl := filepath.Join(dir, "invalid.hcl")
+	assert.NoError(t, ioutil.WriteFile(hcl, []byte("hosts {\n  unsael = [\"http://vault-0:8200\"]\n}\n"), 0600))
+
+	ui = cli.NewMockUi()
+	c = &ValidateCommand{Meta: Meta{UI: ui}}
+	code = c.Run([]string{"-config", hcl})
+	assert.Equal(t, 1, code)
+	assert.Contains(t, ui.ErrorWriter.String(), hcl+`:2:3: unknown field "unsael", did you mean "unseal"?`)
+
+	// format set explicitly
+	conf := filepath.Join(dir, "vaultops.conf")
+	assert.NoError(t, ioutil.WriteFile(conf, []byte(`{"hosts": {"unseal": ["http://vault-0:8200"]}}`), 0600))
+
+	ui = cli.NewMockUi()
+	c = &ValidateCommand{Meta: Meta{UI: ui}}
+	code = c.Run([]string{"-config", conf, "-config-format", "json"})
+	assert.Equal(t, 0, code, ui.ErrorWriter.String())
+
+	ui = cli.NewMockUi()
+	c = &ValidateCommand{Meta: Meta{UI: ui}}
+	code = c.Run([]string{"-config", conf, "-config-format", "toml"})
+	assert.Equal(t, 1, code)
+	assert.Contains(t, ui.ErrorWriter.String(), `unsupported manifest format "toml"`)
+
+	ui = cli.NewMockUi()
+	c = &ValidateCommand{Meta: Meta{UI: ui}}
+	code = c.Run([]string{"-schema"})
+	assert.Equal(t, 0, code, ui.ErrorWriter.String())
+	assert.Contains(t, ui.OutputWriter.String(), `"$schema": "http://json-schema.org/draft-07/schema#"`)
+}
@@ -14,13 +14,27 @@ type VaultKeys struct {
 	RootToken string `json:"root_token,omitempty"`
 	// MasterKeys are vault master keys used to unseal vault servers
 	MasterKeys []string `json:"master_keys,omitempty"`
+	// AdminToken is periodic orphan token which replaces the root token
+	AdminToken string `json:"admin_token,omitempty"`
+	// RootRevoked is true if the root token has been revoked
+	RootRevoked bool `json:"root_revoked,omitempty"`
+}
+
+// Token returns vault token used to talk to vault:
+// the admin token if it has been created, otherwise the root token
+func (v *VaultKeys) Token() string {
+	if v.AdminToken != "" {
+		return v.AdminToken
+	}
+
+	return v.RootToken
 }
 
 // Write writes vault keys in store and encrypts them with cipher c
 func (v *VaultKeys) Write(s store.Store, c cipher.Cipher) (int, error) {
-	k := &VaultKeys{v.RootToken, v.MasterKeys}
+	k := *v
 	// encode vault keys into json
-	data, err := json.Marshal(k)
+	data, err := json.Marshal(&k)
 	if err != nil {
 		return 0, err
 	}
@@ -57,8 +71,7 @@ func (v *VaultKeys) Read(s store.Store, c cipher.Cipher) (int, error) {
 	if err := json.Unmarshal(keys, k); err != nil {
 		return 0, err
 	}
-	v.RootToken = k.RootToken
-	v.MasterKeys = k.MasterKeys
+	*v = *k
 
 	return len(data), nil
 }
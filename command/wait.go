@@ -0,0 +1,167 @@
+package command
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+const (
+	// healthPath is vault health API path
+	healthPath = "/v1/sys/health"
+	// maxRetryInterval is the maximum interval between health checks
+	maxRetryInterval = 30 * time.Second
+	// healthCheckTimeout is the maximum time allowed for a single health check
+	healthCheckTimeout = 10 * time.Second
+)
+
+var (
+	// jitter randomizes retry intervals so the clients don't retry in lockstep
+	jitter   = rand.New(rand.NewSource(time.Now().UnixNano()))
+	jitterMu sync.Mutex
+)
+
+// waitFlags configure waiting for vault hosts to become reachable
+type waitFlags struct {
+	wait          bool
+	timeout       time.Duration
+	retryInterval time.Duration
+}
+
+// register registers wait flags in flag set f
+func (w *waitFlags) register(f *flag.FlagSet) {
+	f.BoolVar(&w.wait, "wait", false, "")
+	f.DurationVar(&w.timeout, "timeout", 5*time.Minute, "")
+	f.DurationVar(&w.retryInterval, "retry-interval", time.Second, "")
+}
+
+// validate checks the wait flags
+func (w *waitFlags) validate() error {
+	if w.timeout <= 0 {
+		return fmt.Errorf("invalid -timeout %s: must be positive", w.timeout)
+	}
+
+	if w.retryInterval <= 0 {
+		return fmt.Errorf("invalid -retry-interval %s: must be positive", w.retryInterval)
+	}
+
+	return nil
+}
+
+// context returns context which is done once -timeout elapses
+func (w *waitFlags) context() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), w.timeout)
+}
+
+// backoff returns the interval to wait before the given retry attempt.
+// The interval grows exponentially from base up to maxRetryInterval
+// and a random jitter of up to half of the interval is subtracted from it.
+func backoff(base time.Duration, attempt int) time.Duration {
+	d := base
+	for i := 0; i < attempt && d < maxRetryInterval; i++ {
+		d *= 2
+	}
+
+	if d > maxRetryInterval {
+		d = maxRetryInterval
+	}
+
+	if d <= 1 {
+		return d
+	}
+
+	jitterMu.Lock()
+	j := time.Duration(jitter.Int63n(int64(d / 2)))
+	jitterMu.Unlock()
+
+	return d - j
+}
+
+// waitForHosts waits until all vault hosts are reachable.
+// It returns false if any of the hosts did not become reachable before ctx is done.
+func (m *Meta) waitForHosts(ctx context.Context, hosts []string, w *waitFlags) bool {
+	type res struct {
+		host   string
+		health *api.HealthResponse
+		err    error
+	}
+	resChan := make(chan *res, len(hosts))
+
+	m.UI.Info(fmt.Sprintf("Waiting up to %s for vault hosts to become reachable", w.timeout))
+	for _, host := range hosts {
+		go func(h string) {
+			health, err := m.waitForHost(ctx, h, w.retryInterval)
+			resChan <- &res{host: h, health: health, err: err}
+		}(host)
+	}
+
+	ok := true
+	for i := 0; i < len(hosts); i++ {
+		r := <-resChan
+		if r.err != nil {
+			m.UI.Error(fmt.Sprintf("Host: %s not reachable: %v", r.host, r.err))
+			ok = false
+			continue
+		}
+		m.UI.Info(fmt.Sprintf("Host: %s reachable. Initialized: %v Sealed: %v", r.host, r.health.Initialized, r.health.Sealed))
+	}
+
+	return ok
+}
+
+// waitForHost polls vault host health until the host is reachable or ctx is done
+func (m *Meta) waitForHost(ctx context.Context, host string, interval time.Duration) (*api.HealthResponse, error) {
+	v, err := m.Client(host, "")
+	if err != nil {
+		return nil, err
+	}
+	// we do the retries ourselves
+	v.SetMaxRetries(0)
+
+	for attempt := 0; ; attempt++ {
+		health, err := checkHealth(ctx, v)
+		if err == nil {
+			return health, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("gave up after %d attempts: %v", attempt+1, err)
+		case <-time.After(backoff(interval, attempt)):
+		}
+	}
+}
+
+// checkHealth reads vault health status
+// Any health status means vault is reachable, so all health status codes are treated as success.
+func checkHealth(ctx context.Context, v *api.Client) (*api.HealthResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	r := v.NewRequest("GET", healthPath)
+	r.Params.Add("uninitcode", "200")
+	r.Params.Add("sealedcode", "200")
+	r.Params.Add("standbycode", "200")
+	r.Params.Add("drsecondarycode", "200")
+	r.Params.Add("performancestandbycode", "200")
+
+	resp, err := v.RawRequestWithContext(ctx, r)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	health := new(api.HealthResponse)
+	if err := resp.DecodeJSON(health); err != nil {
+		return nil, fmt.Errorf("invalid health response: %v", err)
+	}
+
+	return health, nil
+}
@@ -0,0 +1,161 @@
+package command
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/milosgajdos/vaultops/vaulttest"
+	"github.com/mitchellh/cli"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackoff(t *testing.T) {
+	base := 100 * time.Millisecond
+	for attempt := 0; attempt < 10; attempt++ {
+		max := base << uint(attempt)
+		if max > maxRetryInterval {
+			max = maxRetryInterval
+		}
+
+		d := backoff(base, attempt)
+		assert.True(t, d > max/2 && d <= max, "attempt %d: %s", attempt, d)
+	}
+
+	assert.Equal(t, time.Duration(0), backoff(0, 3))
+}
+
+func TestWaitForHosts(t *testing.T) {
+	s := vaulttest.NewServer()
+	defer s.Close()
+	s.Fail("/v1/sys/health", http.StatusBadGateway, 2)
+
+	ui := cli.NewMockUi()
+	c := &InitCommand{Meta: Meta{UI: ui}}
+	code := c.Run([]string{"-address", s.URL, "-status", "-wait", "-retry-interval", "1ms"})
+	assert.Equal(t, 0, code, ui.ErrorWriter.String())
+	assert.Equal(t, 3, s.Requests("/v1/sys/health"))
+	assert.Contains(t, ui.OutputWriter.String(), fmt.Sprintf("Host: %s reachable. Initialized: false Sealed: true", s.URL))
+
+	// unreachable server
+	s.Fail("/v1/sys/health", http.StatusBadGateway, -1)
+	ui = cli.NewMockUi()
+	u := &UnsealCommand{Meta: Meta{UI: ui}}
+	code = u.Run([]string{"-address", s.URL, "-status", "-wait", "-timeout", "50ms", "-retry-interval", "1ms"})
+	assert.Equal(t, 1, code)
+	assert.Contains(t, ui.ErrorWriter.String(), fmt.Sprintf("Host: %s not reachable: gave up after", s.URL))
+	assert.Zero(t, s.Requests("/v1/sys/seal-status"))
+}
+
+func TestWaitTimeout(t *testing.T) {
+	dir := makeTestDir(t)
+	defer os.RemoveAll(dir)
+	keyPath := filepath.Join(dir, "vault.json")
+
+	s := vaulttest.NewServer()
+	defer s.Close()
+	s.SetLatency(500 * time.Millisecond)
+
+	// -timeout bounds the init requests
+	ui := cli.NewMockUi()
+	c := &InitCommand{Meta: Meta{UI: ui}}
+	code := c.Run([]string{"-address", s.URL, "-key-local-path", keyPath, "-timeout", "50ms"})
+	assert.Equal(t, 1, code)
+	assert.Contains(t, ui.ErrorWriter.String(), fmt.Sprintf("Failed to initialize %s", s.URL))
+	assert.Contains(t, ui.ErrorWriter.String(), "context deadline exceeded")
+
+	// -timeout bounds the unseal requests
+	keys, token := s.Initialize(1, 1)
+	writeTestKeys(t, keyPath, &VaultKeys{RootToken: token, MasterKeys: keys})
+	ui = cli.NewMockUi()
+	u := &UnsealCommand{Meta: Meta{UI: ui}}
+	code = u.Run([]string{"-address", s.URL, "-key-local-path", keyPath, "-timeout", "50ms"})
+	assert.Equal(t, 1, code)
+	assert.Contains(t, ui.ErrorWriter.String(), fmt.Sprintf("Failed to unseal %s", s.URL))
+	assert.Contains(t, ui.ErrorWriter.String(), "context deadline exceeded")
+}
+
+func TestWaitTimeoutRequests(t *testing.T) {
+	dir := makeTestDir(t)
+	defer os.RemoveAll(dir)
+	keyPath := filepath.Join(dir, "vault.json")
+
+	// -timeout bounds the bootstrap requests which follow the wait
+	s := vaulttest.NewServer()
+	defer s.Close()
+	s.SetPathLatency("/v1/sys/init", 500*time.Millisecond)
+
+	ui := cli.NewMockUi()
+	b := &BootstrapCommand{Meta: Meta{UI: ui}}
+	code := b.Run([]string{"-leader", s.URL, "-key-local-path", keyPath, "-wait", "-timeout", "100ms"})
+	assert.Equal(t, 1, code)
+	assert.Contains(t, ui.OutputWriter.String(), fmt.Sprintf("Host: %s reachable", s.URL))
+	assert.Contains(t, ui.ErrorWriter.String(), fmt.Sprintf("Failed to initialize leader %s", s.URL))
+	assert.Contains(t, ui.ErrorWriter.String(), "context deadline exceeded")
+	assert.False(t, s.Initialized())
+
+	// -timeout bounds the health checks and the maintenance requests
+	servers := makeTestCluster(t, 1, keyPath)
+	defer closeTestCluster(servers)
+	for _, tc := range []struct {
+		path string
+		cmd  cli.Command
+	}{
+		{"/v1/sys/health", &SealCommand{Meta: Meta{UI: ui}}},
+		{"/v1/sys/seal", &SealCommand{Meta: Meta{UI: ui}}},
+		{"/v1/sys/step-down", &StepDownCommand{Meta: Meta{UI: ui}}},
+	} {
+		servers[0].SetPathLatency(tc.path, 500*time.Millisecond)
+		ui.ErrorWriter.Reset()
+
+		code := tc.cmd.Run([]string{"-address", servers[0].URL, "-key-local-path", keyPath, "-timeout", "100ms"})
+		assert.Equal(t, 1, code, tc.path)
+		assert.Contains(t, ui.ErrorWriter.String(), "context deadline exceeded", tc.path)
+
+		servers[0].SetPathLatency(tc.path, 0)
+	}
+}
+
+func TestWaitFlagsValidate(t *testing.T) {
+	testCases := []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"-timeout", "0s"}, "invalid -timeout 0s: must be positive"},
+		{[]string{"-timeout", "-1m"}, "invalid -timeout -1m0s: must be positive"},
+		{[]string{"-retry-interval", "0s"}, "invalid -retry-interval 0s: must be positive"},
+		{[]string{"-retry-interval", "-1s"}, "invalid -retry-interval -1s: must be positive"},
+	}
+
+	for _, tc := range testCases {
+		for _, cmd := range []cli.Command{
+			&InitCommand{}, &UnsealCommand{}, &BootstrapCommand{}, &SealCommand{}, &StepDownCommand{},
+		} {
+			ui := cli.NewMockUi()
+			args := append([]string{"-wait"}, tc.args...)
+			var code int
+			switch c := cmd.(type) {
+			case *InitCommand:
+				c.UI = ui
+				code = c.Run(args)
+			case *UnsealCommand:
+				c.UI = ui
+				code = c.Run(args)
+			case *BootstrapCommand:
+				c.UI = ui
+				code = c.Run(args)
+			case *SealCommand:
+				c.UI = ui
+				code = c.Run(args)
+			case *StepDownCommand:
+				c.UI = ui
+				code = c.Run(args)
+			}
+			assert.Equal(t, 1, code, tc.args)
+			assert.Contains(t, ui.ErrorWriter.String(), "Failed to parse options: "+tc.err, tc.args)
+		}
+	}
+}
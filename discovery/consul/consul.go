@@ -0,0 +1,216 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DefaultAddress is the default Consul HTTP API address
+	DefaultAddress = "http://127.0.0.1:8500"
+	// DefaultService is the default vault service name
+	DefaultService = "vault"
+	// DefaultScheme is the default vault URL scheme
+	DefaultScheme = "http"
+)
+
+// Config configures Consul catalog discovery
+type Config struct {
+	// Address is Consul HTTP API address
+	// If empty, CONSUL_HTTP_ADDR environment variable or DefaultAddress is used.
+	Address string
+	// Token is Consul ACL token
+	// If empty, CONSUL_HTTP_TOKEN environment variable is used.
+	Token string
+	// Service is the name of vault service
+	Service string
+	// Tags filter the service instances by tags
+	Tags []string
+	// Datacenter is Consul datacenter
+	Datacenter string
+	// Passing returns only the service instances with passing health checks
+	Passing bool
+	// Scheme is the vault URL scheme
+	Scheme string
+}
+
+// Discoverer discovers vault hosts via Consul catalog
+type Discoverer struct {
+	client *http.Client
+	config Config
+}
+
+// catalogService is Consul catalog service instance
+type catalogService struct {
+	Node           string
+	Address        string
+	ServiceAddress string
+	ServicePort    int
+}
+
+// healthService is Consul health service instance
+type healthService struct {
+	Node struct {
+		Node    string
+		Address string
+	}
+	Service struct {
+		Address string
+		Port    int
+	}
+}
+
+// New creates new Consul discoverer configured via c and returns it.
+// It returns error if c is invalid.
+func New(c *Config) (*Discoverer, error) {
+	return NewWithClient(http.DefaultClient, c)
+}
+
+// NewWithClient creates new Consul discoverer which uses client to talk to Consul API.
+// It returns error if c is invalid.
+func NewWithClient(client *http.Client, c *Config) (*Discoverer, error) {
+	config := *c
+
+	if config.Address == "" {
+		config.Address = os.Getenv("CONSUL_HTTP_ADDR")
+	}
+
+	if config.Address == "" {
+		config.Address = DefaultAddress
+	}
+
+	// CONSUL_HTTP_ADDR is allowed to omit the scheme
+	if !strings.Contains(config.Address, "://") {
+		config.Address = "http://" + config.Address
+	}
+
+	if _, err := url.Parse(config.Address); err != nil {
+		return nil, fmt.Errorf("invalid Consul address %q: %v", config.Address, err)
+	}
+
+	if config.Token == "" {
+		config.Token = os.Getenv("CONSUL_HTTP_TOKEN")
+	}
+
+	if config.Service == "" {
+		config.Service = DefaultService
+	}
+
+	if config.Scheme == "" {
+		config.Scheme = DefaultScheme
+	}
+
+	return &Discoverer{
+		client: client,
+		config: config,
+	}, nil
+}
+
+// get queries Consul API path and decodes the response into v
+func (d *Discoverer) get(ctx context.Context, path string, v interface{}) error {
+	query := url.Values{}
+	for _, tag := range d.config.Tags {
+		query.Add("tag", tag)
+	}
+
+	if d.config.Datacenter != "" {
+		query.Set("dc", d.config.Datacenter)
+	}
+
+	if d.config.Passing {
+		query.Set("passing", "true")
+	}
+
+	u := strings.TrimSuffix(d.config.Address, "/") + path + "/" + url.PathEscape(d.config.Service)
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+
+	if d.config.Token != "" {
+		req.Header.Set("X-Consul-Token", d.config.Token)
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to query Consul service %s: %v", d.config.Service, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to query Consul service %s: %s", d.config.Service, resp.Status)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode Consul service %s: %v", d.config.Service, err)
+	}
+
+	return nil
+}
+
+// Discover returns vault URLs of Consul service instances
+// Health checks are only taken into account when Passing is set.
+func (d *Discoverer) Discover(ctx context.Context) ([]string, error) {
+	type instance struct {
+		node string
+		addr string
+		port int
+	}
+
+	var instances []instance
+
+	if d.config.Passing {
+		var services []healthService
+		if err := d.get(ctx, "/v1/health/service", &services); err != nil {
+			return nil, err
+		}
+
+		for _, s := range services {
+			addr := s.Service.Address
+			if addr == "" {
+				addr = s.Node.Address
+			}
+			instances = append(instances, instance{s.Node.Node, addr, s.Service.Port})
+		}
+	} else {
+		var services []catalogService
+		if err := d.get(ctx, "/v1/catalog/service", &services); err != nil {
+			return nil, err
+		}
+
+		for _, s := range services {
+			addr := s.ServiceAddress
+			if addr == "" {
+				addr = s.Address
+			}
+			instances = append(instances, instance{s.Node, addr, s.ServicePort})
+		}
+	}
+
+	sort.Slice(instances, func(i, j int) bool {
+		if instances[i].node != instances[j].node {
+			return instances[i].node < instances[j].node
+		}
+		return instances[i].port < instances[j].port
+	})
+
+	hosts := make([]string, len(instances))
+	for i, s := range instances {
+		hosts[i] = d.config.Scheme + "://" + net.JoinHostPort(s.addr, strconv.Itoa(s.port))
+	}
+
+	return hosts, nil
+}
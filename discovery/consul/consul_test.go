@@ -0,0 +1,156 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testNode struct {
+	node    string
+	addr    string
+	svcAddr string
+	port    int
+	dc      string
+	tags    []string
+	passing bool
+}
+
+var testNodes = []testNode{
+	{"node-2", "10.0.0.2", "", 8200, "dc1", []string{"standby"}, true},
+	{"node-1", "10.0.0.1", "192.168.0.1", 8200, "dc1", []string{"active"}, true},
+	{"node-3", "10.0.0.3", "", 8200, "dc1", []string{"standby"}, false},
+	{"node-4", "10.1.0.1", "", 8300, "dc2", []string{"active"}, true},
+}
+
+func hasTags(n testNode, tags []string) bool {
+	for _, tag := range tags {
+		found := false
+		for _, t := range n.tags {
+			if t == tag {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// newTestServer returns fake Consul catalog and health API server
+func newTestServer(t *testing.T) *httptest.Server {
+	filter := func(r *http.Request, passing bool) []testNode {
+		q := r.URL.Query()
+		dc := q.Get("dc")
+		if dc == "" {
+			dc = "dc1"
+		}
+
+		var nodes []testNode
+		for _, n := range testNodes {
+			if n.dc != dc || !hasTags(n, q["tag"]) || (passing && !n.passing) {
+				continue
+			}
+			nodes = append(nodes, n)
+		}
+		return nodes
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/catalog/service/vault", func(w http.ResponseWriter, r *http.Request) {
+		out := []map[string]interface{}{}
+		for _, n := range filter(r, false) {
+			out = append(out, map[string]interface{}{
+				"Node":           n.node,
+				"Address":        n.addr,
+				"ServiceAddress": n.svcAddr,
+				"ServicePort":    n.port,
+				"ServiceTags":    n.tags,
+			})
+		}
+		json.NewEncoder(w).Encode(out)
+	})
+	mux.HandleFunc("/v1/health/service/vault", func(w http.ResponseWriter, r *http.Request) {
+		out := []map[string]interface{}{}
+		for _, n := range filter(r, r.URL.Query().Get("passing") != "") {
+			out = append(out, map[string]interface{}{
+				"Node":    map[string]interface{}{"Node": n.node, "Address": n.addr},
+				"Service": map[string]interface{}{"Address": n.svcAddr, "Port": n.port, "Tags": n.tags},
+			})
+		}
+		json.NewEncoder(w).Encode(out)
+	})
+	mux.HandleFunc("/v1/catalog/service/secret", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Consul-Token") != "secret" {
+			http.Error(w, "ACL not found", http.StatusForbidden)
+			return
+		}
+		json.NewEncoder(w).Encode([]interface{}{})
+	})
+
+	return httptest.NewServer(mux)
+}
+
+func TestNew(t *testing.T) {
+	d, err := New(&Config{})
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultAddress, d.config.Address)
+	assert.Equal(t, DefaultService, d.config.Service)
+	assert.Equal(t, DefaultScheme, d.config.Scheme)
+
+	d, err = New(&Config{Address: "consul.example.com:8500"})
+	assert.NoError(t, err)
+	assert.Equal(t, "http://consul.example.com:8500", d.config.Address)
+
+	_, err = New(&Config{Address: "http://[::1"})
+	assert.Error(t, err)
+}
+
+func TestDiscover(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+
+	testCases := []struct {
+		config   Config
+		expected []string
+	}{
+		{Config{}, []string{"http://192.168.0.1:8200", "http://10.0.0.2:8200", "http://10.0.0.3:8200"}},
+		{Config{Passing: true, Scheme: "https"}, []string{"https://192.168.0.1:8200", "https://10.0.0.2:8200"}},
+		{Config{Tags: []string{"standby"}}, []string{"http://10.0.0.2:8200", "http://10.0.0.3:8200"}},
+		{Config{Tags: []string{"standby"}, Passing: true}, []string{"http://10.0.0.2:8200"}},
+		{Config{Datacenter: "dc2"}, []string{"http://10.1.0.1:8300"}},
+		{Config{Datacenter: "dc3"}, []string{}},
+	}
+
+	for _, tc := range testCases {
+		tc.config.Address = s.URL
+		d, err := New(&tc.config)
+		assert.NoError(t, err)
+
+		hosts, err := d.Discover(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, tc.expected, hosts)
+	}
+
+	// ACL token
+	d, err := New(&Config{Address: s.URL, Service: "secret"})
+	assert.NoError(t, err)
+	_, err = d.Discover(context.Background())
+	assert.Error(t, err)
+
+	d, err = New(&Config{Address: s.URL, Service: "secret", Token: "secret"})
+	assert.NoError(t, err)
+	_, err = d.Discover(context.Background())
+	assert.NoError(t, err)
+
+	// unknown service
+	d, err = New(&Config{Address: s.URL, Service: "foo"})
+	assert.NoError(t, err)
+	_, err = d.Discover(context.Background())
+	assert.Error(t, err)
+}
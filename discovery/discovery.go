@@ -0,0 +1,10 @@
+// Package discovery provides an interface for discovering vault hosts at runtime
+package discovery
+
+import "context"
+
+// Discoverer discovers vault hosts
+type Discoverer interface {
+	// Discover returns a list of discovered vault server URLs
+	Discover(ctx context.Context) ([]string, error)
+}
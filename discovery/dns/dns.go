@@ -0,0 +1,109 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DefaultScheme is the default vault URL scheme
+	DefaultScheme = "http"
+)
+
+// Resolver looks up DNS SRV records
+type Resolver interface {
+	// LookupSRV looks up SRV records of the given service, protocol and domain name
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+// Config configures DNS SRV discovery
+type Config struct {
+	// Name is the SRV record name e.g. _vault._tcp.example.com
+	Name string
+	// Scheme is the vault URL scheme
+	Scheme string
+	// Server is the address of DNS server to query e.g. 10.0.0.2:53
+	// If empty, the system resolver is used.
+	Server string
+}
+
+// Discoverer discovers vault hosts via DNS SRV records
+type Discoverer struct {
+	resolver Resolver
+	name     string
+	scheme   string
+}
+
+// New creates new DNS SRV discoverer configured via c and returns it.
+// It returns error if c is invalid.
+func New(c *Config) (*Discoverer, error) {
+	var resolver = net.DefaultResolver
+
+	if c.Server != "" {
+		server := c.Server
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, server)
+			},
+		}
+	}
+
+	return NewWithResolver(resolver, c)
+}
+
+// NewWithResolver creates new DNS SRV discoverer which uses resolver to look up SRV records.
+// It returns error if c is invalid.
+func NewWithResolver(resolver Resolver, c *Config) (*Discoverer, error) {
+	if c.Name == "" {
+		return nil, fmt.Errorf("SRV record name must be specified")
+	}
+
+	scheme := c.Scheme
+	if scheme == "" {
+		scheme = DefaultScheme
+	}
+
+	return &Discoverer{
+		resolver: resolver,
+		name:     c.Name,
+		scheme:   scheme,
+	}, nil
+}
+
+// Discover returns vault URLs of SRV record targets
+// The URLs are ordered by SRV record priority and target name.
+func (d *Discoverer) Discover(ctx context.Context) ([]string, error) {
+	_, records, err := d.resolver.LookupSRV(ctx, "", "", d.name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up SRV record %s: %v", d.name, err)
+	}
+
+	// resolvers shuffle the records by weight, but we want stable order
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Priority != records[j].Priority {
+			return records[i].Priority < records[j].Priority
+		}
+		if records[i].Target != records[j].Target {
+			return records[i].Target < records[j].Target
+		}
+		return records[i].Port < records[j].Port
+	})
+
+	hosts := make([]string, len(records))
+	for i, r := range records {
+		target := strings.TrimSuffix(r.Target, ".")
+		hosts[i] = d.scheme + "://" + net.JoinHostPort(target, strconv.Itoa(int(r.Port)))
+	}
+
+	return hosts, nil
+}
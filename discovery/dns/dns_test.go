@@ -0,0 +1,112 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// startTestServer starts fake DNS server which answers SRV queries for the given records
+func startTestServer(t *testing.T, records map[string][]dnsmessage.SRVResource) (string, func()) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to start DNS server: %v", err)
+	}
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+
+			var req dnsmessage.Message
+			if err := req.Unpack(buf[:n]); err != nil || len(req.Questions) != 1 {
+				continue
+			}
+
+			q := req.Questions[0]
+			resp := dnsmessage.Message{
+				Header: dnsmessage.Header{
+					ID:            req.ID,
+					Response:      true,
+					Authoritative: true,
+				},
+				Questions: req.Questions,
+			}
+
+			srvs, ok := records[q.Name.String()]
+			switch {
+			case !ok:
+				resp.RCode = dnsmessage.RCodeNameError
+			case q.Type == dnsmessage.TypeSRV:
+				for i := range srvs {
+					resp.Answers = append(resp.Answers, dnsmessage.Resource{
+						Header: dnsmessage.ResourceHeader{
+							Name:  q.Name,
+							Type:  dnsmessage.TypeSRV,
+							Class: dnsmessage.ClassINET,
+							TTL:   60,
+						},
+						Body: &srvs[i],
+					})
+				}
+			}
+
+			out, err := resp.Pack()
+			if err != nil {
+				continue
+			}
+			conn.WriteTo(out, addr)
+		}
+	}()
+
+	return conn.LocalAddr().String(), func() { conn.Close() }
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(&Config{})
+	assert.Error(t, err)
+
+	d, err := New(&Config{Name: "_vault._tcp.example.com", Server: "127.0.0.1"})
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultScheme, d.scheme)
+}
+
+func TestDiscover(t *testing.T) {
+	target := func(s string) dnsmessage.Name {
+		return dnsmessage.MustNewName(s)
+	}
+
+	records := map[string][]dnsmessage.SRVResource{
+		"_vault._tcp.example.com.": {
+			{Priority: 10, Weight: 5, Port: 8200, Target: target("vault-2.example.com.")},
+			{Priority: 10, Weight: 50, Port: 8200, Target: target("vault-1.example.com.")},
+			{Priority: 1, Weight: 5, Port: 8300, Target: target("vault-0.example.com.")},
+		},
+	}
+
+	addr, stop := startTestServer(t, records)
+	defer stop()
+
+	d, err := New(&Config{Name: "_vault._tcp.example.com.", Scheme: "https", Server: addr})
+	assert.NoError(t, err)
+
+	hosts, err := d.Discover(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"https://vault-0.example.com:8300",
+		"https://vault-1.example.com:8200",
+		"https://vault-2.example.com:8200",
+	}, hosts)
+
+	d, err = New(&Config{Name: "_foo._tcp.example.com.", Server: addr})
+	assert.NoError(t, err)
+
+	_, err = d.Discover(context.Background())
+	assert.Error(t, err)
+}
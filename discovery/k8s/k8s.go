@@ -0,0 +1,236 @@
+package k8s
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"text/template"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/milosgajdos/vaultops/store/k8s"
+)
+
+const (
+	// DefaultScheme is the default vault URL scheme
+	DefaultScheme = "http"
+	// DefaultPort is the default vault API port
+	DefaultPort = 8200
+	// DefaultTemplate is the default vault URL template
+	DefaultTemplate = "{{.Scheme}}://{{.IP}}:{{.Port}}"
+)
+
+// Config configures Kubernetes discovery
+// Exactly one of Selector, StatefulSet or Service must be set.
+type Config struct {
+	// Namespace is the namespace of vault pods
+	Namespace string
+	// Selector is the label selector of vault pods
+	Selector string
+	// StatefulSet is the name of the vault StatefulSet
+	StatefulSet string
+	// Service is the name of the vault Service
+	Service string
+	// Scheme is the vault URL scheme
+	Scheme string
+	// Port is the vault API port
+	Port int
+	// Template is the vault URL template
+	Template string
+	// Kubeconfig is a path to kubeconfig file
+	Kubeconfig string
+	// Context is kubeconfig context
+	Context string
+}
+
+// Pod is a discovered vault pod
+// Its fields can be used in the vault URL template.
+type Pod struct {
+	// Name is the pod name
+	Name string
+	// UID is the pod UID; it changes when the pod is recreated
+	UID string
+	// Namespace is the pod namespace
+	Namespace string
+	// IP is the pod IP address
+	IP string
+	// Hostname is the pod hostname
+	Hostname string
+	// Subdomain is the pod subdomain
+	Subdomain string
+	// Scheme is the vault URL scheme
+	Scheme string
+	// Port is the vault API port
+	Port int
+	// URL is the vault URL of the pod
+	URL string
+}
+
+// Discoverer discovers vault pods via Kubernetes API
+type Discoverer struct {
+	client kubernetes.Interface
+	config Config
+	tmpl   *template.Template
+}
+
+// New creates new Kubernetes discoverer configured via c and returns it.
+// It returns error if the Kubernetes client fails to be created or if c is invalid.
+func New(c *Config) (*Discoverer, error) {
+	client, err := k8s.NewClient(c.Kubeconfig, c.Context)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewWithClient(client, c)
+}
+
+// NewWithClient creates new Kubernetes discoverer which uses client to talk to Kubernetes API.
+// It returns error if c is invalid.
+func NewWithClient(client kubernetes.Interface, c *Config) (*Discoverer, error) {
+	var set int
+	for _, s := range []string{c.Selector, c.StatefulSet, c.Service} {
+		if s != "" {
+			set++
+		}
+	}
+
+	if set != 1 {
+		return nil, fmt.Errorf("exactly one of selector, statefulset or service must be specified")
+	}
+
+	config := *c
+	if config.Namespace == "" {
+		config.Namespace = metav1.NamespaceDefault
+	}
+
+	if config.Scheme == "" {
+		config.Scheme = DefaultScheme
+	}
+
+	if config.Port == 0 {
+		config.Port = DefaultPort
+	}
+
+	if config.Template == "" {
+		config.Template = DefaultTemplate
+	}
+
+	tmpl, err := template.New("url").Option("missingkey=error").Parse(config.Template)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL template %q: %v", config.Template, err)
+	}
+
+	return &Discoverer{
+		client: client,
+		config: config,
+		tmpl:   tmpl,
+	}, nil
+}
+
+// selector returns vault pods label selector
+func (d *Discoverer) selector(ctx context.Context) (string, error) {
+	switch {
+	case d.config.StatefulSet != "":
+		sts, err := d.client.AppsV1().StatefulSets(d.config.Namespace).Get(ctx, d.config.StatefulSet, metav1.GetOptions{})
+		if err != nil {
+			return "", fmt.Errorf("failed to read statefulset %s in namespace %s: %v", d.config.StatefulSet, d.config.Namespace, err)
+		}
+
+		if sts.Spec.Selector == nil {
+			return "", fmt.Errorf("statefulset %s in namespace %s has no selector", d.config.StatefulSet, d.config.Namespace)
+		}
+
+		selector, err := metav1.LabelSelectorAsSelector(sts.Spec.Selector)
+		if err != nil {
+			return "", fmt.Errorf("invalid selector of statefulset %s: %v", d.config.StatefulSet, err)
+		}
+
+		return selector.String(), nil
+	case d.config.Service != "":
+		svc, err := d.client.CoreV1().Services(d.config.Namespace).Get(ctx, d.config.Service, metav1.GetOptions{})
+		if err != nil {
+			return "", fmt.Errorf("failed to read service %s in namespace %s: %v", d.config.Service, d.config.Namespace, err)
+		}
+
+		if len(svc.Spec.Selector) == 0 {
+			return "", fmt.Errorf("service %s in namespace %s has no selector", d.config.Service, d.config.Namespace)
+		}
+
+		return labels.SelectorFromSet(svc.Spec.Selector).String(), nil
+	}
+
+	return d.config.Selector, nil
+}
+
+// Pods returns running vault pods sorted by their names
+func (d *Discoverer) Pods(ctx context.Context) ([]Pod, error) {
+	selector, err := d.selector(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := d.client.CoreV1().Pods(d.config.Namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods in namespace %s: %v", d.config.Namespace, err)
+	}
+
+	pods := make([]Pod, 0, len(list.Items))
+	for _, p := range list.Items {
+		// sealed vault pods are usually not ready so we only skip the pods that are not running
+		if p.Status.Phase != corev1.PodRunning || p.Status.PodIP == "" || p.DeletionTimestamp != nil {
+			continue
+		}
+
+		pod := Pod{
+			Name:      p.Name,
+			UID:       string(p.UID),
+			Namespace: p.Namespace,
+			IP:        p.Status.PodIP,
+			Hostname:  p.Spec.Hostname,
+			Subdomain: p.Spec.Subdomain,
+			Scheme:    d.config.Scheme,
+			Port:      d.config.Port,
+		}
+
+		if pod.Hostname == "" {
+			pod.Hostname = p.Name
+		}
+
+		var buf bytes.Buffer
+		if err := d.tmpl.Execute(&buf, pod); err != nil {
+			return nil, fmt.Errorf("failed to render URL of pod %s: %v", p.Name, err)
+		}
+		pod.URL = buf.String()
+
+		pods = append(pods, pod)
+	}
+
+	// StatefulSet pods are sorted by their ordinals
+	sort.Slice(pods, func(i, j int) bool {
+		if len(pods[i].Name) != len(pods[j].Name) {
+			return len(pods[i].Name) < len(pods[j].Name)
+		}
+		return pods[i].Name < pods[j].Name
+	})
+
+	return pods, nil
+}
+
+// Discover returns the URLs of running vault pods
+func (d *Discoverer) Discover(ctx context.Context) ([]string, error) {
+	pods, err := d.Pods(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	hosts := make([]string, len(pods))
+	for i, p := range pods {
+		hosts[i] = p.URL
+	}
+
+	return hosts, nil
+}
@@ -0,0 +1,125 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func makePod(name, ip string, phase corev1.PodPhase, labels map[string]string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "vault",
+			Labels:    labels,
+		},
+		Spec: corev1.PodSpec{
+			Subdomain: "vault-internal",
+		},
+		Status: corev1.PodStatus{
+			Phase: phase,
+			PodIP: ip,
+		},
+	}
+}
+
+func makeTestClient() *fake.Clientset {
+	vaultLabels := map[string]string{"app": "vault"}
+
+	objects := []runtime.Object{
+		makePod("vault-10", "10.0.0.11", corev1.PodRunning, vaultLabels),
+		makePod("vault-1", "10.0.0.2", corev1.PodRunning, vaultLabels),
+		makePod("vault-0", "10.0.0.1", corev1.PodRunning, vaultLabels),
+		makePod("vault-2", "", corev1.PodPending, vaultLabels),
+		makePod("consul-0", "10.0.0.100", corev1.PodRunning, map[string]string{"app": "consul"}),
+		&appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "vault", Namespace: "vault"},
+			Spec: appsv1.StatefulSetSpec{
+				Selector: &metav1.LabelSelector{MatchLabels: vaultLabels},
+			},
+		},
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "vault-internal", Namespace: "vault"},
+			Spec:       corev1.ServiceSpec{Selector: vaultLabels},
+		},
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "headless", Namespace: "vault"},
+		},
+	}
+
+	return fake.NewSimpleClientset(objects...)
+}
+
+func TestNewWithClient(t *testing.T) {
+	client := makeTestClient()
+
+	testCases := []*Config{
+		{},
+		{Selector: "app=vault", Service: "vault"},
+		{Selector: "app=vault", Template: "{{.Foo"},
+	}
+
+	for _, c := range testCases {
+		d, err := NewWithClient(client, c)
+		assert.Error(t, err)
+		assert.Nil(t, d)
+	}
+
+	d, err := NewWithClient(client, &Config{Selector: "app=vault"})
+	assert.NoError(t, err)
+	assert.Equal(t, metav1.NamespaceDefault, d.config.Namespace)
+	assert.Equal(t, DefaultScheme, d.config.Scheme)
+	assert.Equal(t, DefaultPort, d.config.Port)
+}
+
+func TestDiscover(t *testing.T) {
+	client := makeTestClient()
+	expected := []string{"http://10.0.0.1:8200", "http://10.0.0.2:8200", "http://10.0.0.11:8200"}
+
+	testCases := []*Config{
+		{Namespace: "vault", Selector: "app=vault"},
+		{Namespace: "vault", StatefulSet: "vault"},
+		{Namespace: "vault", Service: "vault-internal"},
+	}
+
+	for _, c := range testCases {
+		d, err := NewWithClient(client, c)
+		assert.NoError(t, err)
+		hosts, err := d.Discover(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, expected, hosts)
+	}
+
+	// custom scheme, port and template
+	d, err := NewWithClient(client, &Config{
+		Namespace: "vault",
+		Selector:  "app=vault",
+		Scheme:    "https",
+		Port:      8300,
+		Template:  "{{.Scheme}}://{{.Hostname}}.{{.Subdomain}}.{{.Namespace}}.svc:{{.Port}}",
+	})
+	assert.NoError(t, err)
+	pods, err := d.Pods(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, pods, 3)
+	assert.Equal(t, "vault-0", pods[0].Name)
+	assert.Equal(t, "https://vault-0.vault-internal.vault.svc:8300", pods[0].URL)
+
+	// missing resources
+	for _, c := range []*Config{
+		{Namespace: "vault", StatefulSet: "foo"},
+		{Namespace: "vault", Service: "foo"},
+		{Namespace: "vault", Service: "headless"},
+	} {
+		d, err := NewWithClient(client, c)
+		assert.NoError(t, err)
+		_, err = d.Discover(context.Background())
+		assert.Error(t, err)
+	}
+}
@@ -5,13 +5,16 @@ go 1.14
 require (
 	cloud.google.com/go/storage v1.10.0
 	github.com/aws/aws-sdk-go v1.33.17
+	github.com/hashicorp/hcl/v2 v2.8.2
 	github.com/hashicorp/vault/api v1.0.4
 	github.com/mitchellh/cli v1.1.1
 	github.com/stretchr/testify v1.6.1
+	github.com/zclconf/go-cty v1.2.0
+	golang.org/x/net v0.0.0-20200520182314-0ba52f642ac2
 	golang.org/x/oauth2 v0.0.0-20200107190931-bf48bf16ab8d
 	google.golang.org/api v0.29.0
-	gopkg.in/yaml.v2 v2.3.0
-	gopkg.in/yaml.v3 v3.0.0-20200615113413-eeeca48fe776 // indirect
+	gopkg.in/yaml.v2 v2.3.0 // indirect
+	gopkg.in/yaml.v3 v3.0.0-20200615113413-eeeca48fe776
 	k8s.io/api v0.18.6
 	k8s.io/apimachinery v0.18.6
 	k8s.io/client-go v0.18.6
@@ -47,15 +47,80 @@ func Commands() map[string]cli.CommandFactory {
 	}
 
 	return map[string]cli.CommandFactory{
+		"apply": func() (cli.Command, error) {
+			return &command.ApplyCommand{
+				Meta: *meta,
+			}, nil
+		},
+		"bootstrap": func() (cli.Command, error) {
+			return &command.BootstrapCommand{
+				Meta: *meta,
+			}, nil
+		},
+		"generate-root": func() (cli.Command, error) {
+			return &command.GenerateRootCommand{
+				Meta: *meta,
+			}, nil
+		},
 		"init": func() (cli.Command, error) {
 			return &command.InitCommand{
 				Meta: *meta,
 			}, nil
 		},
+		"revoke-root": func() (cli.Command, error) {
+			return &command.RevokeRootCommand{
+				Meta: *meta,
+			}, nil
+		},
+		"seal": func() (cli.Command, error) {
+			return &command.SealCommand{
+				Meta: *meta,
+			}, nil
+		},
+		"snapshot": func() (cli.Command, error) {
+			return &command.SnapshotCommand{
+				Meta: *meta,
+			}, nil
+		},
+		"snapshot save": func() (cli.Command, error) {
+			return &command.SnapshotSaveCommand{
+				Meta: *meta,
+			}, nil
+		},
+		"snapshot restore": func() (cli.Command, error) {
+			return &command.SnapshotRestoreCommand{
+				Meta: *meta,
+			}, nil
+		},
+		"snapshot list": func() (cli.Command, error) {
+			return &command.SnapshotListCommand{
+				Meta: *meta,
+			}, nil
+		},
+		"status": func() (cli.Command, error) {
+			return &command.StatusCommand{
+				Meta: *meta,
+			}, nil
+		},
+		"step-down": func() (cli.Command, error) {
+			return &command.StepDownCommand{
+				Meta: *meta,
+			}, nil
+		},
 		"unseal": func() (cli.Command, error) {
 			return &command.UnsealCommand{
 				Meta: *meta,
 			}, nil
 		},
+		"upgrade": func() (cli.Command, error) {
+			return &command.UpgradeCommand{
+				Meta: *meta,
+			}, nil
+		},
+		"validate": func() (cli.Command, error) {
+			return &command.ValidateCommand{
+				Meta: *meta,
+			}, nil
+		},
 	}
 }
@@ -0,0 +1,122 @@
+package manifest
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ClusterNames returns the sorted names of the clusters declared in the manifest
+func (m *Manifest) ClusterNames() []string {
+	names := make([]string, 0, len(m.Clusters))
+	for name := range m.Clusters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Select returns the manifest of the named cluster.
+// Each section set in the cluster replaces the same section of the default
+// cluster; the sections which are not set are inherited from the default cluster.
+// The keys section is merged field by field since key shares and key threshold
+// only make sense together.
+// The returned manifest is a copy: resolving its references doesn't modify m.
+func (m *Manifest) Select(name string) (*Manifest, error) {
+	c, ok := m.Clusters[name]
+	if !ok {
+		if len(m.Clusters) == 0 {
+			return nil, fmt.Errorf("cluster %s not found: manifest declares no clusters", name)
+		}
+		return nil, fmt.Errorf("cluster %s not found: expected one of %s", name, strings.Join(m.ClusterNames(), ", "))
+	}
+
+	sel := m.Cluster
+	if c != nil {
+		if !reflect.ValueOf(c.Hosts).IsZero() {
+			sel.Hosts = c.Hosts
+		}
+		if c.Keys != nil {
+			sel.Keys = mergeKeys(sel.Keys, c.Keys)
+		}
+		if c.KeyStore != nil {
+			sel.KeyStore = c.KeyStore
+		}
+		if c.Cipher != nil {
+			sel.Cipher = c.Cipher
+		}
+		if c.Audit != nil {
+			sel.Audit = c.Audit
+		}
+		if c.Secrets != nil {
+			sel.Secrets = c.Secrets
+		}
+		if c.Admin != nil {
+			sel.Admin = c.Admin
+		}
+		if c.Auth != nil {
+			sel.Auth = c.Auth
+		}
+	}
+
+	return &Manifest{
+		Cluster: copyValue(reflect.ValueOf(sel)).Interface().(Cluster),
+		refs:    m.refs,
+	}, nil
+}
+
+// mergeKeys returns keys k with the fields set in override replacing the fields of k
+func mergeKeys(k, override *Keys) *Keys {
+	var merged Keys
+	if k != nil {
+		merged = *k
+	}
+
+	if override.Shares != 0 {
+		merged.Shares = override.Shares
+	}
+	if override.Threshold != 0 {
+		merged.Threshold = override.Threshold
+	}
+
+	return &merged
+}
+
+// copyValue returns a deep copy of v
+func copyValue(v reflect.Value) reflect.Value {
+	c := reflect.New(v.Type()).Elem()
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			c.Set(reflect.New(v.Type().Elem()))
+			c.Elem().Set(copyValue(v.Elem()))
+		}
+	case reflect.Struct:
+		c.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if f := c.Field(i); f.CanSet() {
+				f.Set(copyValue(v.Field(i)))
+			}
+		}
+	case reflect.Slice:
+		if !v.IsNil() {
+			c.Set(reflect.MakeSlice(v.Type(), v.Len(), v.Len()))
+			for i := 0; i < v.Len(); i++ {
+				c.Index(i).Set(copyValue(v.Index(i)))
+			}
+		}
+	case reflect.Map:
+		if !v.IsNil() {
+			c.Set(reflect.MakeMapWithSize(v.Type(), v.Len()))
+			for _, k := range v.MapKeys() {
+				c.SetMapIndex(k, copyValue(v.MapIndex(k)))
+			}
+		}
+	default:
+		c.Set(v)
+	}
+
+	return c
+}
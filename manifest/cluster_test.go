@@ -0,0 +1,153 @@
+package manifest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var clustersManifest = `hosts:
+  unseal:
+    - https://vault-0.local:8200
+keys:
+  shares: 5
+  threshold: 3
+keystore:
+  type: local
+  local_path: /tmp/vault.keys
+audit:
+  - type: file
+    options:
+      file_path: /var/log/vault/audit.log
+clusters:
+  staging:
+    hosts:
+      unseal:
+        - address: https://vault-0.staging:8200
+          token: ${keystore:root_token}
+    keys:
+      threshold: 4
+  prod-eu:
+    hosts:
+      unseal:
+        - https://vault-0.prod-eu:8200
+        - https://vault-1.prod-eu:8200
+    keystore:
+      type: s3
+      bucket: prod-eu-keys
+      key: vault.keys
+    cipher:
+      provider: aws
+      aws:
+        region: eu-west-1
+        key_id: alias/vault
+    audit:
+      - type: syslog
+        path: syslog/prod
+        local: true
+`
+
+func TestSelect(t *testing.T) {
+	m, err := Decode([]byte(clustersManifest))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"prod-eu", "staging"}, m.ClusterNames())
+
+	prod, err := m.Select("prod-eu")
+	assert.NoError(t, err)
+	assert.Equal(t, []Host{{Address: "https://vault-0.prod-eu:8200"}, {Address: "https://vault-1.prod-eu:8200"}}, prod.Hosts.Unseal)
+	assert.Equal(t, &KeyStore{Type: "s3", Bucket: "prod-eu-keys", Key: "vault.keys"}, prod.KeyStore)
+	assert.Equal(t, "alias/vault", prod.Cipher.AWS.KeyID)
+	assert.Equal(t, []Audit{{Type: "syslog", Path: "syslog/prod", Local: true}}, prod.Audit)
+	assert.Equal(t, "syslog/prod", prod.Audit[0].GetPath())
+	// sections which are not set are inherited from the default cluster
+	assert.Equal(t, &Keys{Shares: 5, Threshold: 3}, prod.Keys)
+	assert.Nil(t, prod.Clusters)
+
+	// selected manifest is a copy of the parsed one
+	prod.Keys.Shares = 7
+	assert.Equal(t, 5, m.Keys.Shares)
+
+	staging, err := m.Select("staging")
+	assert.NoError(t, err)
+	assert.Equal(t, &KeyStore{Type: "local", LocalPath: "/tmp/vault.keys"}, staging.KeyStore)
+	// keys are merged field by field
+	assert.Equal(t, &Keys{Shares: 5, Threshold: 4}, staging.Keys)
+	assert.Equal(t, &Keys{Shares: 5, Threshold: 3}, m.Keys)
+	assert.Equal(t, m.Audit, staging.Audit)
+	assert.Equal(t, "file", staging.Audit[0].GetPath())
+
+	// references are resolved in the selected cluster only
+	assert.NoError(t, m.Resolve(testResolver{}))
+	assert.True(t, staging.HasRefs())
+	assert.NoError(t, staging.Resolve(testResolver{"keystore:root_token": "s.staging"}))
+	assert.Equal(t, "s.staging", staging.Hosts.Unseal[0].Token)
+	assert.Equal(t, "${keystore:root_token}", m.Clusters["staging"].Hosts.Unseal[0].Token)
+
+	_, err = m.Select("prod-us")
+	assert.EqualError(t, err, "cluster prod-us not found: expected one of prod-eu, staging")
+
+	_, err = new(Manifest).Select("prod-us")
+	assert.EqualError(t, err, "cluster prod-us not found: manifest declares no clusters")
+}
+
+func TestValidateClusters(t *testing.T) {
+	testCases := []struct {
+		data string
+		errs Errors
+	}{
+		{
+			data: `clusters:
+  staging:
+    hosts:
+      unseal:
+        - https://vault-0.staging:8200
+        - https://vault-0.staging:8200
+    keystore:
+      type: s4
+  prod:
+    keys:
+      shares: 3
+      threshold: 5
+`,
+			errs: Errors{
+				{Line: 6, Column: 11, Msg: "duplicate unseal host https://vault-0.staging:8200: already listed on line 5"},
+				{Line: 8, Column: 13, Msg: `unsupported key store type "s4": expected one of local, s3, gcs, k8s, secretsmanager, ssm, gcpsm`},
+				{Line: 12, Column: 18, Msg: "key threshold 5 is greater than key shares 3"},
+			},
+		},
+		{
+			// the clusters are validated merged with the default cluster
+			data: `keys:
+  shares: 5
+  threshold: 3
+keystore:
+  type: s4
+clusters:
+  staging:
+    keys:
+      shares: 2
+  prod:
+    keys:
+      threshold: 6
+`,
+			errs: Errors{
+				{Line: 3, Column: 14, Msg: "key threshold 3 is greater than key shares 2"},
+				{Line: 5, Column: 9, Msg: `unsupported key store type "s4": expected one of local, s3, gcs, k8s, secretsmanager, ssm, gcpsm`},
+				{Line: 12, Column: 18, Msg: "key threshold 6 is greater than key shares 5"},
+			},
+		},
+		{
+			data: "clusters:\n  prod:\n    cihper:\n      provider: aws\n",
+			errs: Errors{{Line: 3, Column: 5, Msg: `unknown field "cihper", did you mean "cipher"?`}},
+		},
+		{
+			data: "clusters:\n  prod:\n    keystore:\n      key: ${keystore:root_token}\n",
+			errs: Errors{{Line: 4, Column: 12, Msg: "reference ${keystore:root_token} is not allowed in keystore section"}},
+		},
+	}
+
+	for _, tc := range testCases {
+		_, err := Decode([]byte(tc.data))
+		assert.Equal(t, tc.errs, err)
+	}
+}
@@ -0,0 +1,219 @@
+package manifest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// Format is manifest file format
+type Format string
+
+const (
+	// YAML is YAML manifest format
+	YAML Format = "yaml"
+	// JSON is JSON manifest format
+	JSON Format = "json"
+	// HCL is HCL2 native syntax manifest format
+	HCL Format = "hcl"
+)
+
+var (
+	// Formats are the supported manifest formats
+	Formats = []Format{YAML, JSON, HCL}
+)
+
+// FormatOf returns the format of manifest file stored in path detected by its extension:
+// .json files are JSON, .hcl files are HCL, all the other files are YAML
+func FormatOf(path string) Format {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return JSON
+	case ".hcl":
+		return HCL
+	}
+
+	return YAML
+}
+
+// checkFormat checks format is supported
+func checkFormat(format Format) error {
+	for _, f := range Formats {
+		if f == format {
+			return nil
+		}
+	}
+
+	names := make([]string, len(Formats))
+	for i, f := range Formats {
+		names[i] = string(f)
+	}
+
+	return fmt.Errorf("unsupported manifest format %q: expected one of %s", format, strings.Join(names, ", "))
+}
+
+// parse parses data in the given format into YAML node.
+// It returns nil node if data is empty.
+func (d *decoder) parse(data []byte, format Format) (*yaml.Node, Errors) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, nil
+	}
+
+	switch format {
+	case JSON:
+		return jsonNode(data)
+	case HCL:
+		return hclNode(data)
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, yamlErrors(err)
+	}
+	if len(root.Content) == 0 {
+		return nil, nil
+	}
+
+	return root.Content[0], nil
+}
+
+// jsonNode parses JSON data into YAML node
+func jsonNode(data []byte) (*yaml.Node, Errors) {
+	// YAML parser accepts JSON, but it accepts much more than JSON, too
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		if se, ok := err.(*json.SyntaxError); ok {
+			// the offset points past the invalid byte
+			line, column := position(data, se.Offset-1)
+			return nil, Errors{{Line: line, Column: column, Msg: se.Error()}}
+		}
+		return nil, Errors{{Msg: err.Error()}}
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, yamlErrors(err)
+	}
+	n := root.Content[0]
+	tagExprs(n)
+
+	return n, nil
+}
+
+// exprTag tags the JSON and HCL strings which contain ${...} expressions
+// until the expressions are expanded: see exprType
+const exprTag = "!expr"
+
+// tagExprs tags the strings of YAML node n which contain ${...} expressions with exprTag:
+// JSON and HCL strings are always quoted, but the expanded numbers and booleans must keep their types
+func tagExprs(n *yaml.Node) {
+	if n.Kind == yaml.ScalarNode && n.ShortTag() == "!!str" && strings.Contains(n.Value, "${") {
+		n.Tag = exprTag
+	}
+
+	if n.Kind == yaml.MappingNode {
+		for i := 1; i < len(n.Content); i += 2 {
+			tagExprs(n.Content[i])
+		}
+		return
+	}
+	for _, c := range n.Content {
+		tagExprs(c)
+	}
+}
+
+// exprType returns the tag of the expanded value of the string tagged with exprTag.
+// The numbers and booleans keep their types; any other value, including null, remains a string.
+func exprType(value string) string {
+	switch tag := (&yaml.Node{Kind: yaml.ScalarNode, Value: value}).ShortTag(); tag {
+	case "!!int", "!!float", "!!bool":
+		return tag
+	}
+
+	return "!!str"
+}
+
+// position returns the line and column of byte offset in data
+func position(data []byte, offset int64) (int, int) {
+	switch {
+	case offset < 0:
+		offset = 0
+	case offset > int64(len(data)):
+		offset = int64(len(data))
+	}
+
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := int(offset) - bytes.LastIndexByte(before, '\n')
+
+	return line, column
+}
+
+// Encode encodes the manifest in the given format.
+// The manifest can be decoded from the returned data using DecodeFormat.
+// The references to values stored outside of the manifest are kept unresolved.
+func (m *Manifest) Encode(format Format) ([]byte, error) {
+	if err := checkFormat(format); err != nil {
+		return nil, err
+	}
+
+	var n yaml.Node
+	if err := n.Encode(m); err != nil {
+		return nil, err
+	}
+	m.escape(&n, nil)
+
+	switch format {
+	case JSON:
+		var v interface{}
+		if err := n.Decode(&v); err != nil {
+			return nil, err
+		}
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(data, '\n'), nil
+	case HCL:
+		return hclEncode(&n)
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&n); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// escape escapes the dollar signs in the strings of YAML node n
+// so they are not expanded when the encoded manifest is decoded.
+// Until the references to values stored outside of the manifest are resolved, the strings
+// of the sections which can contain references are already escaped. path are the mapping
+// keys leading to n.
+func (m *Manifest) escape(n *yaml.Node, path []string) {
+	if n.Kind == yaml.ScalarNode && n.ShortTag() == "!!str" && strings.Contains(n.Value, "$") {
+		if len(m.refs) == 0 || contains(refSections, section(path)) {
+			n.Value = escape(n.Value)
+		}
+	}
+
+	if n.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			m.escape(n.Content[i+1], append(path[:len(path):len(path)], n.Content[i].Value))
+		}
+		return
+	}
+	for _, c := range n.Content {
+		m.escape(c, path)
+	}
+}
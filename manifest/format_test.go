@@ -0,0 +1,443 @@
+package manifest
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var formatManifests = map[Format]string{
+	YAML: `hosts:
+  init:
+    - https://vault-0.${VAULTOPS_TEST_ENV}:8200
+  unseal:
+    - https://vault-0.${VAULTOPS_TEST_ENV}:8200
+    - address: https://vault-1.${VAULTOPS_TEST_ENV}:8200
+      tls_skip_verify: true
+      token: ${keystore:root_token}
+  consul:
+    service: vault
+    tags: [active, standby]
+keys:
+  shares: ${VAULTOPS_TEST_SHARES}
+  threshold: 3
+keystore:
+  type: k8s
+  bucket: vault-keys
+  key: pa$$word
+  kubernetes:
+    namespace: vault
+    timeout: 10s
+    labels:
+      app.kubernetes.io/name: vault
+cipher:
+  provider: aws
+  aws:
+    region: eu-west-1
+    key_id: alias/vault
+audit:
+  - type: file
+    options:
+      file_path: /var/log/vault/audit.log
+  - type: syslog
+    path: syslog/local
+    local: true
+secrets:
+  - mount: secret
+    path: db
+    data:
+      username:
+        value: app
+      password:
+        encrypted: c2VjcmV0
+  - mount: kv
+    path: api
+    version: 1
+    data:
+      token:
+        store: secrets/api-token
+admin:
+  revoke_root: true
+  policy: automation
+  rules: 'path "sys/*" { capabilities = ["read"] }'
+  period: 24h
+auth:
+  method: aws
+  role: vaultops
+  aws:
+    region: eu-west-1
+    header_value: vault.example.com
+clusters:
+  prod:
+    hosts:
+      unseal:
+        - https://vault-0.prod:8200
+  staging:
+    keys:
+      shares: 1
+      threshold: 1
+`,
+	JSON: `{
+  "hosts": {
+    "init": ["https://vault-0.${VAULTOPS_TEST_ENV}:8200"],
+    "unseal": [
+      "https://vault-0.${VAULTOPS_TEST_ENV}:8200",
+      {
+        "address": "https://vault-1.${VAULTOPS_TEST_ENV}:8200",
+        "tls_skip_verify": true,
+        "token": "${keystore:root_token}"
+      }
+    ],
+    "consul": {"service": "vault", "tags": ["active", "standby"]}
+  },
+  "keys": {"shares": "${VAULTOPS_TEST_SHARES}", "threshold": 3},
+  "keystore": {
+    "type": "k8s",
+    "bucket": "vault-keys",
+    "key": "pa$$word",
+    "kubernetes": {
+      "namespace": "vault",
+      "timeout": "10s",
+      "labels": {"app.kubernetes.io/name": "vault"}
+    }
+  },
+  "cipher": {"provider": "aws", "aws": {"region": "eu-west-1", "key_id": "alias/vault"}},
+  "audit": [
+    {"type": "file", "options": {"file_path": "/var/log/vault/audit.log"}},
+    {"type": "syslog", "path": "syslog/local", "local": true}
+  ],
+  "secrets": [
+    {
+      "mount": "secret",
+      "path": "db",
+      "data": {"username": {"value": "app"}, "password": {"encrypted": "c2VjcmV0"}}
+    },
+    {"mount": "kv", "path": "api", "version": 1, "data": {"token": {"store": "secrets/api-token"}}}
+  ],
+  "admin": {
+    "revoke_root": true,
+    "policy": "automation",
+    "rules": "path \"sys/*\" { capabilities = [\"read\"] }",
+    "period": "24h"
+  },
+  "auth": {
+    "method": "aws",
+    "role": "vaultops",
+    "aws": {"region": "eu-west-1", "header_value": "vault.example.com"}
+  },
+  "clusters": {
+    "prod": {"hosts": {"unseal": ["https://vault-0.prod:8200"]}},
+    "staging": {"keys": {"shares": 1, "threshold": 1}}
+  }
+}
+`,
+	HCL: `hosts {
+  init = ["https://vault-0.$${VAULTOPS_TEST_ENV}:8200"]
+
+  unseal {
+    address = "https://vault-0.$${VAULTOPS_TEST_ENV}:8200"
+  }
+  unseal {
+    address         = "https://vault-1.$${VAULTOPS_TEST_ENV}:8200"
+    tls_skip_verify = true
+    token           = "$${keystore:root_token}"
+  }
+
+  consul {
+    service = "vault"
+    tags    = ["active", "standby"]
+  }
+}
+
+keys {
+  shares    = "$${VAULTOPS_TEST_SHARES}"
+  threshold = 3
+}
+
+keystore {
+  type   = "k8s"
+  bucket = "vault-keys"
+  key    = "pa$$word"
+
+  kubernetes {
+    namespace = "vault"
+    timeout   = "10s"
+    labels = {
+      "app.kubernetes.io/name" = "vault"
+    }
+  }
+}
+
+cipher {
+  provider = "aws"
+  aws {
+    region = "eu-west-1"
+    key_id = "alias/vault"
+  }
+}
+
+audit {
+  type = "file"
+  options = {
+    file_path = "/var/log/vault/audit.log"
+  }
+}
+audit {
+  type  = "syslog"
+  path  = "syslog/local"
+  local = true
+}
+
+secrets {
+  mount = "secret"
+  path  = "db"
+
+  data "username" {
+    value = "app"
+  }
+  data "password" {
+    encrypted = "c2VjcmV0"
+  }
+}
+secrets {
+  mount   = "kv"
+  path    = "api"
+  version = 1
+  data = {
+    token = { store = "secrets/api-token" }
+  }
+}
+
+admin {
+  revoke_root = true
+  policy      = "automation"
+  rules       = "path \"sys/*\" { capabilities = [\"read\"] }"
+  period      = "24h"
+}
+
+auth {
+  method = "aws"
+  role   = "vaultops"
+  aws {
+    region       = "eu-west-1"
+    header_value = "vault.example.com"
+  }
+}
+
+clusters "prod" {
+  hosts {
+    unseal = ["https://vault-0.prod:8200"]
+  }
+}
+
+clusters "staging" {
+  keys {
+    shares    = 1
+    threshold = 1
+  }
+}
+`,
+}
+
+func TestFormats(t *testing.T) {
+	os.Setenv("VAULTOPS_TEST_ENV", "prod")
+	defer os.Unsetenv("VAULTOPS_TEST_ENV")
+	os.Setenv("VAULTOPS_TEST_SHARES", "5")
+	defer os.Unsetenv("VAULTOPS_TEST_SHARES")
+
+	expected, err := Decode([]byte(formatManifests[YAML]))
+	assert.NoError(t, err)
+	assert.Equal(t, 5, expected.Keys.Shares)
+	assert.Equal(t, "pa$word", expected.KeyStore.Key)
+	assert.Equal(t, "https://vault-1.prod:8200", expected.Hosts.Unseal[1].Address)
+	assert.Len(t, expected.Audit, 2)
+	assert.Equal(t, SecretValue{Encrypted: "c2VjcmV0"}, expected.Secrets[0].Data["password"])
+	assert.Equal(t, 2, expected.Secrets[0].GetVersion())
+	assert.Equal(t, "kv/api", expected.Secrets[1].GetPath())
+	assert.Equal(t, 1, expected.Secrets[1].GetVersion())
+	assert.Equal(t, &Admin{RevokeRoot: true, Policy: "automation", Rules: `path "sys/*" { capabilities = ["read"] }`, Period: 24 * time.Hour}, expected.Admin)
+	assert.Equal(t, &Auth{Method: "aws", Role: "vaultops",
+		AWS: AWSAuth{AWS: AWS{Region: "eu-west-1"}, HeaderValue: "vault.example.com"}}, expected.Auth)
+
+	for format, data := range formatManifests {
+		m, err := DecodeFormat([]byte(data), format)
+		assert.NoError(t, err, format)
+		if err != nil {
+			continue
+		}
+		assert.Equal(t, expected.Cluster, m.Cluster, format)
+		assert.Equal(t, expected.Clusters, m.Clusters, format)
+
+		// references are kept in all formats
+		assert.True(t, m.HasRefs(), format)
+		assert.NoError(t, m.Resolve(testResolver{"keystore:root_token": "s.root"}), format)
+		assert.Equal(t, "s.root", m.Hosts.Unseal[1].Token, format)
+	}
+}
+
+func TestEncode(t *testing.T) {
+	os.Setenv("VAULTOPS_TEST_ENV", "prod")
+	defer os.Unsetenv("VAULTOPS_TEST_ENV")
+	os.Setenv("VAULTOPS_TEST_SHARES", "5")
+	defer os.Unsetenv("VAULTOPS_TEST_SHARES")
+
+	for _, from := range Formats {
+		m, err := DecodeFormat([]byte(formatManifests[from]), from)
+		assert.NoError(t, err, from)
+		if err != nil {
+			continue
+		}
+
+		// the manifest survives the round trip through every format
+		for _, to := range Formats {
+			data, err := m.Encode(to)
+			assert.NoError(t, err, "%s -> %s", from, to)
+
+			rt, err := DecodeFormat(data, to)
+			assert.NoError(t, err, "%s -> %s:\n%s", from, to, data)
+			if err != nil {
+				continue
+			}
+			assert.Equal(t, m.Cluster, rt.Cluster, "%s -> %s", from, to)
+			assert.Equal(t, m.Clusters, rt.Clusters, "%s -> %s", from, to)
+			assert.True(t, rt.HasRefs(), "%s -> %s", from, to)
+		}
+	}
+
+	_, err := new(Manifest).Encode("toml")
+	assert.EqualError(t, err, `unsupported manifest format "toml": expected one of yaml, json, hcl`)
+}
+
+func TestFormatExprTypes(t *testing.T) {
+	for name, value := range map[string]string{
+		"VAULTOPS_TEST_SHARES":    "5",
+		"VAULTOPS_TEST_NULL":      "null",
+		"VAULTOPS_TEST_TILDE":     "~",
+		"VAULTOPS_TEST_BOOL":      "true",
+		"VAULTOPS_TEST_NAMESPACE": "1e3",
+	} {
+		os.Setenv(name, value)
+		defer os.Unsetenv(name)
+	}
+
+	manifests := map[Format]string{
+		JSON: `{
+  "hosts": {
+    "unseal": [{"address": "https://vault-0:8200", "namespace": "${VAULTOPS_TEST_NAMESPACE}"}]
+  },
+  "keys": {"shares": "${VAULTOPS_TEST_SHARES}"},
+  "keystore": {"type": "s3", "bucket": "${VAULTOPS_TEST_NULL}", "key": "${VAULTOPS_TEST_TILDE}"},
+  "admin": {"revoke_root": "${VAULTOPS_TEST_BOOL}"},
+  "cipher": {"provider": "aws", "aws": {"key_id": "${VAULTOPS_TEST_BOOL}"}}
+}
+`,
+		HCL: `hosts {
+  unseal {
+    address   = "https://vault-0:8200"
+    namespace = "$${VAULTOPS_TEST_NAMESPACE}"
+  }
+}
+
+keys {
+  shares = "$${VAULTOPS_TEST_SHARES}"
+}
+
+keystore {
+  type   = "s3"
+  bucket = "$${VAULTOPS_TEST_NULL}"
+  key    = "$${VAULTOPS_TEST_TILDE}"
+}
+
+admin {
+  revoke_root = "$${VAULTOPS_TEST_BOOL}"
+}
+
+cipher {
+  provider = "aws"
+  aws {
+    key_id = "$${VAULTOPS_TEST_BOOL}"
+  }
+}
+`,
+	}
+
+	for format, data := range manifests {
+		m, err := DecodeFormat([]byte(data), format)
+		assert.NoError(t, err, format)
+		if err != nil {
+			continue
+		}
+
+		// the expanded numbers and booleans keep their types,
+		// but the strings are not read as null
+		assert.Equal(t, 5, m.Keys.Shares, format)
+		assert.True(t, m.Admin.RevokeRoot, format)
+		assert.Equal(t, "null", m.KeyStore.Bucket, format)
+		assert.Equal(t, "~", m.KeyStore.Key, format)
+		assert.Equal(t, "true", m.Cipher.AWS.KeyID, format)
+		assert.Equal(t, "1e3", m.Hosts.Unseal[0].Namespace, format)
+	}
+}
+
+func TestFormatErrors(t *testing.T) {
+	testCases := []struct {
+		format Format
+		data   string
+		err    string
+	}{
+		{JSON, "{\n  \"hosts\": {\n    \"unseal\": [,]\n  }\n}\n", "line 3, column 16: invalid character ',' looking for beginning of value"},
+		{JSON, `{"hosts": {"unsael": []}}`, `line 1, column 12: unknown field "unsael", did you mean "unseal"?`},
+		{JSON, `{"keys": {"shares": 3, "threshold": 5}}`, "line 1, column 37: key threshold 5 is greater than key shares 3"},
+		{HCL, "hosts {\n  unsael = []\n}\n", `line 2, column 3: unknown field "unsael", did you mean "unseal"?`},
+		{HCL, "keys {\n  shares    = 3\n  threshold = 5\n}\n", "line 3, column 15: key threshold 5 is greater than key shares 3"},
+		{HCL, "keys {\n  shares = 3\n}\nkeys {\n  threshold = 2\n}\n", "line 4, column 1: keys is already defined on line 1"},
+		{HCL, "hosts {\n  unseal = [\"https://${VAULT_HOST}:8200\"]\n}\n", "line 2, column 24: variables are not allowed: escape manifest expressions as $${...}"},
+		{HCL, "clusters \"prod\" \"eu\" {\n}\n", "line 1, column 1: block clusters must have at most one label"},
+		{HCL, "hosts {\n", "line 2, column 1: Argument or block definition required; An argument or block definition is required here."},
+		{"toml", "", `unsupported manifest format "toml": expected one of yaml, json, hcl`},
+	}
+
+	for _, tc := range testCases {
+		m, err := DecodeFormat([]byte(tc.data), tc.format)
+		assert.Nil(t, m, tc.data)
+		assert.EqualError(t, err, tc.err, tc.data)
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	dir, err := ioutil.TempDir("", "manifest")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"vaultops.yml":  "hosts:\n  unseal:\n    - https://vault-0:8200\n",
+		"vaultops.json": `{"hosts": {"unseal": ["https://vault-0:8200"]}}`,
+		"vaultops.hcl":  "hosts {\n  unseal = [\"https://vault-0:8200\"]\n}\n",
+		"vaultops.conf": "hosts {\n  unseal = [\"https://vault-0:8200\"]\n}\n",
+	}
+	for name, data := range files {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0600))
+	}
+
+	for _, name := range []string{"vaultops.yml", "vaultops.json", "vaultops.hcl"} {
+		m, err := Parse(filepath.Join(dir, name))
+		assert.NoError(t, err, name)
+		assert.Equal(t, []Host{{Address: "https://vault-0:8200"}}, m.Hosts.Unseal, name)
+	}
+
+	// the format of files with unknown extensions must be set explicitly
+	_, err = Parse(filepath.Join(dir, "vaultops.conf"))
+	assert.Error(t, err)
+	m, err := ParseFormat(filepath.Join(dir, "vaultops.conf"), HCL)
+	assert.NoError(t, err)
+	assert.Equal(t, []Host{{Address: "https://vault-0:8200"}}, m.Hosts.Unseal)
+
+	assert.Equal(t, YAML, FormatOf("vaultops.yaml"))
+	assert.Equal(t, JSON, FormatOf("vaultops.JSON"))
+	assert.Equal(t, HCL, FormatOf("/etc/vaultops/vaultops.hcl"))
+	assert.Equal(t, YAML, FormatOf("vaultops"))
+}
@@ -0,0 +1,23 @@
+//go:build ignore
+// +build ignore
+
+// gen generates JSON Schema of the manifest and stores it in schema.json
+package main
+
+import (
+	"io/ioutil"
+	"log"
+
+	"github.com/milosgajdos/vaultops/manifest"
+)
+
+func main() {
+	data, err := manifest.Schema()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile("schema.json", data, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,387 @@
+package manifest
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// hclNode parses HCL data into YAML node.
+// Blocks are mapped onto manifest objects: labeled blocks are the entries
+// of maps, e.g. clusters "prod" { ... }, and repeated blocks are the items
+// of lists, e.g. unseal { address = "..." }. Attributes are mapped onto
+// manifest fields. Strings are HCL templates: the manifest expressions
+// must be escaped as $${...} so HCL doesn't try to interpolate them.
+func hclNode(data []byte) (*yaml.Node, Errors) {
+	file, diags := hclsyntax.ParseConfig(data, "", hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return nil, hclErrors(diags)
+	}
+
+	n, errs := hclBody(file.Body.(*hclsyntax.Body), reflect.TypeOf((*Manifest)(nil)).Elem())
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	tagExprs(n)
+
+	return n, nil
+}
+
+// hclErrors converts HCL diagnostics to Errors
+func hclErrors(diags hcl.Diagnostics) Errors {
+	var errs Errors
+	for _, diag := range diags {
+		if diag.Severity != hcl.DiagError {
+			continue
+		}
+
+		msg := diag.Summary
+		switch {
+		case diag.Summary == "Variables not allowed":
+			msg = "variables are not allowed: escape manifest expressions as $${...}"
+		case diag.Detail != "":
+			msg = fmt.Sprintf("%s; %s", diag.Summary, diag.Detail)
+		}
+
+		e := &Error{Msg: msg}
+		if diag.Subject != nil {
+			e.Line, e.Column = diag.Subject.Start.Line, diag.Subject.Start.Column
+		}
+		errs = append(errs, e)
+	}
+
+	return errs
+}
+
+// hclBody converts HCL body to YAML mapping node.
+// The body is decoded into the value of type t which
+// tells apart the blocks of lists and maps from objects.
+func hclBody(body *hclsyntax.Body, t reflect.Type) (*yaml.Node, Errors) {
+	known := make(map[string]reflect.Type)
+	if t = elem(t); t != nil && t.Kind() == reflect.Struct {
+		for _, f := range fields(t) {
+			known[f.name] = elem(f.typ)
+		}
+	}
+
+	// keep the attributes and blocks in the order they appear in the body
+	type item struct {
+		name  string
+		rng   hcl.Range
+		attr  *hclsyntax.Attribute
+		block *hclsyntax.Block
+	}
+	var items []item
+	for name, attr := range body.Attributes {
+		items = append(items, item{name: name, rng: attr.NameRange, attr: attr})
+	}
+	for _, block := range body.Blocks {
+		items = append(items, item{name: block.Type, rng: block.TypeRange, block: block})
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].rng.Start.Byte < items[j].rng.Start.Byte })
+
+	// seen are the values defined in the body; the blocks of lists and maps are merged
+	type seen struct {
+		line  int
+		value *yaml.Node
+		merge yaml.Kind
+	}
+	defined := make(map[string]*seen)
+
+	n := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: body.SrcRange.Start.Line, Column: body.SrcRange.Start.Column}
+	var errs Errors
+	for _, it := range items {
+		ft := known[it.name]
+
+		var merge yaml.Kind
+		switch {
+		case it.block == nil:
+		case len(it.block.Labels) == 1:
+			merge = yaml.MappingNode
+		case len(it.block.Labels) == 0 && ft != nil && ft.Kind() == reflect.Slice:
+			merge = yaml.SequenceNode
+		}
+
+		s, ok := defined[it.name]
+		if ok && (merge == 0 || merge != s.merge) {
+			errs = append(errs, &Error{Line: it.rng.Start.Line, Column: it.rng.Start.Column,
+				Msg: fmt.Sprintf("%s is already defined on line %d", it.name, s.line)})
+			continue
+		}
+
+		var value *yaml.Node
+		var valueErrs Errors
+		switch {
+		case it.attr != nil:
+			value, valueErrs = hclExpr(it.attr.Expr)
+		case len(it.block.Labels) > 1:
+			valueErrs = Errors{{Line: it.rng.Start.Line, Column: it.rng.Start.Column,
+				Msg: fmt.Sprintf("block %s must have at most one label", it.name)}}
+		case merge == yaml.MappingNode:
+			// labeled blocks are the entries of a map
+			value, valueErrs = hclBody(it.block.Body, mapElem(ft))
+		case merge == yaml.SequenceNode:
+			// repeated blocks are the items of a list
+			value, valueErrs = hclBody(it.block.Body, ft.Elem())
+		default:
+			value, valueErrs = hclBody(it.block.Body, ft)
+		}
+		if len(valueErrs) > 0 {
+			errs = append(errs, valueErrs...)
+			continue
+		}
+
+		if merge != 0 {
+			if !ok {
+				s = &seen{line: it.rng.Start.Line, merge: merge, value: &yaml.Node{Kind: merge, Line: value.Line, Column: value.Column}}
+				s.value.Tag = "!!seq"
+				if merge == yaml.MappingNode {
+					s.value.Tag = "!!map"
+				}
+			}
+			if merge == yaml.MappingNode {
+				lr := it.block.LabelRanges[0]
+				key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: it.block.Labels[0], Line: lr.Start.Line, Column: lr.Start.Column}
+				s.value.Content = append(s.value.Content, key)
+			}
+			s.value.Content = append(s.value.Content, value)
+			if ok {
+				continue
+			}
+			value = s.value
+		} else {
+			s = &seen{line: it.rng.Start.Line}
+		}
+
+		defined[it.name] = s
+		key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: it.name, Line: it.rng.Start.Line, Column: it.rng.Start.Column}
+		n.Content = append(n.Content, key, value)
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	return n, nil
+}
+
+// hclExpr converts HCL expression to YAML node
+func hclExpr(expr hclsyntax.Expression) (*yaml.Node, Errors) {
+	rng := expr.Range()
+	switch e := expr.(type) {
+	case *hclsyntax.TupleConsExpr:
+		n := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Line: rng.Start.Line, Column: rng.Start.Column}
+		var errs Errors
+		for _, item := range e.Exprs {
+			c, cErrs := hclExpr(item)
+			if len(cErrs) > 0 {
+				errs = append(errs, cErrs...)
+				continue
+			}
+			n.Content = append(n.Content, c)
+		}
+		return n, errs
+	case *hclsyntax.ObjectConsExpr:
+		n := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: rng.Start.Line, Column: rng.Start.Column}
+		var errs Errors
+		for _, item := range e.Items {
+			k, diags := item.KeyExpr.Value(nil)
+			if diags.HasErrors() {
+				errs = append(errs, hclErrors(diags)...)
+				continue
+			}
+			kr := item.KeyExpr.Range()
+			if k.IsNull() || !k.Type().Equals(cty.String) {
+				errs = append(errs, &Error{Line: kr.Start.Line, Column: kr.Start.Column, Msg: "object key must be a string"})
+				continue
+			}
+			v, vErrs := hclExpr(item.ValueExpr)
+			if len(vErrs) > 0 {
+				errs = append(errs, vErrs...)
+				continue
+			}
+			key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: k.AsString(), Line: kr.Start.Line, Column: kr.Start.Column}
+			n.Content = append(n.Content, key, v)
+		}
+		return n, errs
+	}
+
+	v, diags := expr.Value(nil)
+	if diags.HasErrors() {
+		return nil, hclErrors(diags)
+	}
+
+	return ctyNode(v, rng)
+}
+
+// ctyNode converts HCL value v found at range rng to YAML node
+func ctyNode(v cty.Value, rng hcl.Range) (*yaml.Node, Errors) {
+	n := &yaml.Node{Line: rng.Start.Line, Column: rng.Start.Column}
+	t := v.Type()
+	switch {
+	case v.IsNull():
+		n.Kind, n.Tag, n.Value = yaml.ScalarNode, "!!null", "null"
+	case !v.IsKnown():
+		return nil, Errors{{Line: n.Line, Column: n.Column, Msg: "value is not known"}}
+	case t == cty.String:
+		n.Kind, n.Tag, n.Value, n.Style = yaml.ScalarNode, "!!str", v.AsString(), yaml.DoubleQuotedStyle
+	case t == cty.Bool:
+		n.Kind, n.Tag, n.Value = yaml.ScalarNode, "!!bool", fmt.Sprint(v.True())
+	case t == cty.Number:
+		n.Kind, n.Tag = yaml.ScalarNode, "!!float"
+		f := v.AsBigFloat()
+		n.Value = f.Text('g', -1)
+		if f.IsInt() {
+			n.Tag, n.Value = "!!int", f.Text('f', 0)
+		}
+	case t.IsTupleType() || t.IsListType() || t.IsSetType():
+		n.Kind, n.Tag = yaml.SequenceNode, "!!seq"
+		for it := v.ElementIterator(); it.Next(); {
+			_, e := it.Element()
+			c, errs := ctyNode(e, rng)
+			if len(errs) > 0 {
+				return nil, errs
+			}
+			n.Content = append(n.Content, c)
+		}
+	case t.IsObjectType() || t.IsMapType():
+		n.Kind, n.Tag = yaml.MappingNode, "!!map"
+		for it := v.ElementIterator(); it.Next(); {
+			k, e := it.Element()
+			c, errs := ctyNode(e, rng)
+			if len(errs) > 0 {
+				return nil, errs
+			}
+			key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: k.AsString(), Line: n.Line, Column: n.Column}
+			n.Content = append(n.Content, key, c)
+		}
+	default:
+		return nil, Errors{{Line: n.Line, Column: n.Column, Msg: fmt.Sprintf("unsupported value type %s", t.FriendlyName())}}
+	}
+
+	return n, nil
+}
+
+// elem returns the type t points to or t if it's not a pointer
+func elem(t reflect.Type) reflect.Type {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	return t
+}
+
+// mapElem returns the element type of map type t or nil if t is not a map
+func mapElem(t reflect.Type) reflect.Type {
+	if t == nil || t.Kind() != reflect.Map {
+		return nil
+	}
+
+	return t.Elem()
+}
+
+// hclEncode encodes YAML node n of the manifest as HCL
+func hclEncode(n *yaml.Node) ([]byte, error) {
+	f := hclwrite.NewEmptyFile()
+	if err := hclEncodeBody(n, reflect.TypeOf((*Manifest)(nil)).Elem(), f.Body(), true); err != nil {
+		return nil, err
+	}
+
+	return hclwrite.Format(f.Bytes()), nil
+}
+
+// hclEncodeBody encodes YAML mapping node n of the value of type t into HCL body.
+// Objects are encoded as blocks and maps of objects as labeled blocks.
+// If top is true, the blocks are separated by empty lines.
+func hclEncodeBody(n *yaml.Node, t reflect.Type, body *hclwrite.Body, top bool) error {
+	known := make(map[string]reflect.Type)
+	if t = elem(t); t != nil && t.Kind() == reflect.Struct {
+		for _, f := range fields(t) {
+			known[f.name] = elem(f.typ)
+		}
+	}
+
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		name, value := n.Content[i].Value, n.Content[i+1]
+		ft := known[name]
+
+		switch {
+		case value.Kind == yaml.MappingNode && ft != nil && ft.Kind() == reflect.Struct:
+			if top && i > 0 {
+				body.AppendNewline()
+			}
+			block := body.AppendNewBlock(name, nil)
+			if err := hclEncodeBody(value, ft, block.Body(), false); err != nil {
+				return err
+			}
+		case value.Kind == yaml.MappingNode && ft != nil && ft.Kind() == reflect.Map && elem(ft.Elem()).Kind() == reflect.Struct:
+			for j := 0; j+1 < len(value.Content); j += 2 {
+				if top && (i > 0 || j > 0) {
+					body.AppendNewline()
+				}
+				block := body.AppendNewBlock(name, []string{value.Content[j].Value})
+				if err := hclEncodeBody(value.Content[j+1], ft.Elem(), block.Body(), false); err != nil {
+					return err
+				}
+			}
+		default:
+			v, err := ctyValue(value)
+			if err != nil {
+				return fmt.Errorf("failed to encode %s: %v", name, err)
+			}
+			body.SetAttributeValue(name, v)
+		}
+	}
+
+	return nil
+}
+
+// ctyValue converts YAML node n to HCL value
+func ctyValue(n *yaml.Node) (cty.Value, error) {
+	switch n.Kind {
+	case yaml.SequenceNode:
+		if len(n.Content) == 0 {
+			return cty.EmptyTupleVal, nil
+		}
+		values := make([]cty.Value, len(n.Content))
+		for i, c := range n.Content {
+			v, err := ctyValue(c)
+			if err != nil {
+				return cty.NilVal, err
+			}
+			values[i] = v
+		}
+		return cty.TupleVal(values), nil
+	case yaml.MappingNode:
+		if len(n.Content) == 0 {
+			return cty.EmptyObjectVal, nil
+		}
+		values := make(map[string]cty.Value)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			v, err := ctyValue(n.Content[i+1])
+			if err != nil {
+				return cty.NilVal, err
+			}
+			values[n.Content[i].Value] = v
+		}
+		return cty.ObjectVal(values), nil
+	case yaml.ScalarNode:
+		switch n.ShortTag() {
+		case "!!int", "!!float":
+			return cty.ParseNumberVal(n.Value)
+		case "!!bool":
+			return cty.BoolVal(n.Value == "true"), nil
+		case "!!null":
+			return cty.NullVal(cty.DynamicPseudoType), nil
+		}
+		return cty.StringVal(n.Value), nil
+	}
+
+	return cty.NilVal, fmt.Errorf("unsupported YAML node kind %v", n.Kind)
+}
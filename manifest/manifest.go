@@ -1,53 +1,614 @@
 package manifest
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 
-	yaml "gopkg.in/yaml.v2"
+	"github.com/milosgajdos/vaultops/discovery"
+	"github.com/milosgajdos/vaultops/discovery/consul"
+	"github.com/milosgajdos/vaultops/discovery/dns"
+	"github.com/milosgajdos/vaultops/discovery/k8s"
+	yaml "gopkg.in/yaml.v3"
 )
 
+const (
+	// discoveryTimeout is the maximum time allowed for vault hosts discovery
+	discoveryTimeout = 30 * time.Second
+)
+
+// Kubernetes configures discovery of vault pods via Kubernetes API
+type Kubernetes struct {
+	// Namespace is the namespace of vault pods
+	Namespace string `yaml:"namespace,omitempty"`
+	// Selector is the label selector of vault pods
+	Selector string `yaml:"selector,omitempty"`
+	// StatefulSet is the name of vault StatefulSet whose pods are discovered
+	StatefulSet string `yaml:"statefulset,omitempty"`
+	// Service is the name of vault Service whose pods are discovered
+	Service string `yaml:"service,omitempty"`
+	// Scheme is vault URL scheme
+	Scheme string `yaml:"scheme,omitempty"`
+	// Port is vault API port
+	Port int `yaml:"port,omitempty"`
+	// Template is vault URL template
+	Template string `yaml:"template,omitempty"`
+	// Kubeconfig is a path to kubeconfig file
+	Kubeconfig string `yaml:"kubeconfig,omitempty"`
+	// Context is kubeconfig context
+	Context string `yaml:"context,omitempty"`
+}
+
+// Config returns Kubernetes discovery configuration
+func (k *Kubernetes) Config() *k8s.Config {
+	return &k8s.Config{
+		Namespace:   k.Namespace,
+		Selector:    k.Selector,
+		StatefulSet: k.StatefulSet,
+		Service:     k.Service,
+		Scheme:      k.Scheme,
+		Port:        k.Port,
+		Template:    k.Template,
+		Kubeconfig:  k.Kubeconfig,
+		Context:     k.Context,
+	}
+}
+
+// DNS configures discovery of vault servers via DNS SRV records
+type DNS struct {
+	// Name is the SRV record name
+	Name string `yaml:"name,omitempty"`
+	// Scheme is vault URL scheme
+	Scheme string `yaml:"scheme,omitempty"`
+	// Server is the address of DNS server
+	Server string `yaml:"server,omitempty"`
+}
+
+// Config returns DNS discovery configuration
+func (d *DNS) Config() *dns.Config {
+	return &dns.Config{
+		Name:   d.Name,
+		Scheme: d.Scheme,
+		Server: d.Server,
+	}
+}
+
+// Consul configures discovery of vault servers via Consul catalog
+type Consul struct {
+	// Address is Consul HTTP API address
+	Address string `yaml:"address,omitempty"`
+	// Token is Consul ACL token
+	Token string `yaml:"token,omitempty"`
+	// Service is vault service name
+	Service string `yaml:"service,omitempty"`
+	// Tags filter vault service instances by tags
+	Tags []string `yaml:"tags,omitempty"`
+	// Datacenter is Consul datacenter
+	Datacenter string `yaml:"datacenter,omitempty"`
+	// Passing filters out vault service instances with failing health checks
+	Passing bool `yaml:"passing,omitempty"`
+	// Scheme is vault URL scheme
+	Scheme string `yaml:"scheme,omitempty"`
+}
+
+// Config returns Consul discovery configuration
+func (c *Consul) Config() *consul.Config {
+	return &consul.Config{
+		Address:    c.Address,
+		Token:      c.Token,
+		Service:    c.Service,
+		Tags:       c.Tags,
+		Datacenter: c.Datacenter,
+		Passing:    c.Passing,
+		Scheme:     c.Scheme,
+	}
+}
+
+// Host is a vault server
+// In the manifest the host is either the vault server URL or an object which contains
+// the URL along with the client settings which override the global command line flags.
+type Host struct {
+	// Address is the vault server URL
+	Address string `yaml:"address"`
+	// CACert is a path to PEM encoded CA cert file used to verify the server certificate
+	CACert string `yaml:"ca_cert,omitempty"`
+	// CAPath is a path to a directory of PEM encoded CA cert files
+	CAPath string `yaml:"ca_path,omitempty"`
+	// ClientCert is a path to PEM encoded client certificate
+	ClientCert string `yaml:"client_cert,omitempty"`
+	// ClientKey is a path to PEM encoded client certificate key
+	ClientKey string `yaml:"client_key,omitempty"`
+	// TLSServerName is the server name used to verify the server certificate
+	TLSServerName string `yaml:"tls_server_name,omitempty"`
+	// TLSSkipVerify disables the server certificate verification
+	TLSSkipVerify *bool `yaml:"tls_skip_verify,omitempty"`
+	// Token is vault token
+	Token string `yaml:"token,omitempty"`
+	// Namespace is Vault Enterprise namespace
+	Namespace string `yaml:"namespace,omitempty"`
+}
+
+// UnmarshalYAML decodes host either from its URL or from an object
+func (h *Host) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*h = Host{Address: value.Value}
+		return nil
+	}
+
+	// host avoids recursive calls of UnmarshalYAML
+	type host Host
+	var out host
+	if err := value.Decode(&out); err != nil {
+		return err
+	}
+
+	*h = Host(out)
+
+	return nil
+}
+
+// MarshalYAML encodes host which has no client settings as its URL
+func (h Host) MarshalYAML() (interface{}, error) {
+	if h == (Host{Address: h.Address}) {
+		return h.Address, nil
+	}
+
+	type host Host
+	return host(h), nil
+}
+
+// addresses returns the addresses of hosts
+func addresses(hosts []Host) []string {
+	out := make([]string, len(hosts))
+	for i, h := range hosts {
+		out[i] = h.Address
+	}
+
+	return out
+}
+
 // Hosts are vault server hosts to initialize and unseal
 type Hosts struct {
 	// Init is a slice of vault servers to initialize
-	Init []string `yaml:"init,omitempty"`
+	Init []Host `yaml:"init,omitempty"`
 	// Unseal is a slice of vault servers to unseal
-	Unseal []string `yaml:"unseal,omitempty"`
+	Unseal []Host `yaml:"unseal,omitempty"`
+	// Kubernetes discovers vault servers via Kubernetes API
+	Kubernetes *Kubernetes `yaml:"kubernetes,omitempty"`
+	// DNS discovers vault servers via DNS SRV records
+	DNS *DNS `yaml:"dns,omitempty"`
+	// Consul discovers vault servers via Consul catalog
+	Consul *Consul `yaml:"consul,omitempty"`
+}
+
+// Discoverers returns vault hosts discoverers configured in manifest
+func (h *Hosts) Discoverers() ([]discovery.Discoverer, error) {
+	var discoverers []discovery.Discoverer
+
+	if h.Kubernetes != nil {
+		d, err := k8s.New(h.Kubernetes.Config())
+		if err != nil {
+			return nil, fmt.Errorf("Kubernetes discovery: %v", err)
+		}
+		discoverers = append(discoverers, d)
+	}
+
+	if h.DNS != nil {
+		d, err := dns.New(h.DNS.Config())
+		if err != nil {
+			return nil, fmt.Errorf("DNS discovery: %v", err)
+		}
+		discoverers = append(discoverers, d)
+	}
+
+	if h.Consul != nil {
+		d, err := consul.New(h.Consul.Config())
+		if err != nil {
+			return nil, fmt.Errorf("Consul discovery: %v", err)
+		}
+		discoverers = append(discoverers, d)
+	}
+
+	return discoverers, nil
+}
+
+// Discover discovers vault hosts using all configured discoverers
+func (h *Hosts) Discover(ctx context.Context) ([]string, error) {
+	discoverers, err := h.Discoverers()
+	if err != nil {
+		return nil, err
+	}
+
+	var hosts []string
+	for _, d := range discoverers {
+		found, err := d.Discover(ctx)
+		if err != nil {
+			return nil, err
+		}
+		hosts = append(hosts, found...)
+	}
+
+	return hosts, nil
+}
+
+// AWS configures AWS session
+type AWS struct {
+	// Region is AWS region
+	Region string `yaml:"region,omitempty"`
+	// Profile is AWS shared config profile
+	Profile string `yaml:"profile,omitempty"`
+	// RoleARN is ARN of AWS IAM role to assume
+	RoleARN string `yaml:"role_arn,omitempty"`
+	// ExternalID is external ID used when assuming RoleARN
+	ExternalID string `yaml:"external_id,omitempty"`
+}
+
+// S3 configures AWS S3 key store
+type S3 struct {
+	// Endpoint is custom S3 endpoint
+	Endpoint string `yaml:"endpoint,omitempty"`
+	// ForcePathStyle enables path-style bucket addressing
+	ForcePathStyle bool `yaml:"force_path_style,omitempty"`
+	// SSE is server-side encryption of stored keys
+	SSE string `yaml:"sse,omitempty"`
+	// SSEKMSKeyID is AWS KMS key ID used for aws:kms server-side encryption
+	SSEKMSKeyID string `yaml:"sse_kms_key_id,omitempty"`
+}
+
+// SecretsManager configures AWS Secrets Manager key store
+type SecretsManager struct {
+	// VersionStage is the secret version stage to write and read
+	VersionStage string `yaml:"version_stage,omitempty"`
+	// KMSKeyID is AWS KMS key ID used to encrypt newly created secret
+	KMSKeyID string `yaml:"kms_key_id,omitempty"`
+}
+
+// SSM configures AWS SSM Parameter Store key store
+type SSM struct {
+	// KMSKeyID is AWS KMS key ID used to encrypt SecureString parameter
+	KMSKeyID string `yaml:"kms_key_id,omitempty"`
+}
+
+// GCPSecretManager configures GCP Secret Manager key store
+type GCPSecretManager struct {
+	// Project is GCP project of the secret
+	Project string `yaml:"project,omitempty"`
+	// Version is the secret version to read vault keys from
+	Version string `yaml:"version,omitempty"`
+	// DisableOld disables previous secret versions when storing vault keys
+	DisableOld bool `yaml:"disable_old,omitempty"`
+}
+
+// KubernetesSecret configures Kubernetes secret key store
+type KubernetesSecret struct {
+	// Namespace is the namespace of the secret
+	Namespace string `yaml:"namespace,omitempty"`
+	// Kubeconfig is a path to kubeconfig file
+	Kubeconfig string `yaml:"kubeconfig,omitempty"`
+	// Context is kubeconfig context
+	Context string `yaml:"context,omitempty"`
+	// Timeout is Kubernetes API request timeout
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// Labels are added to the secret
+	Labels map[string]string `yaml:"labels,omitempty"`
+	// Annotations are added to the secret
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+	// Owner is the owner of the secret in Kind/name format
+	Owner string `yaml:"owner,omitempty"`
+	// Immutable makes the secret immutable
+	Immutable bool `yaml:"immutable,omitempty"`
+}
+
+// KeyStore configures the store of vault keys
+type KeyStore struct {
+	// Type is the store type: local, s3, gcs, k8s, secretsmanager, ssm or gcpsm
+	Type string `yaml:"type,omitempty"`
+	// Bucket is remote storage bucket (in case of k8s it's the secret name)
+	Bucket string `yaml:"bucket,omitempty"`
+	// Key is remote storage key (in case of k8s it's the secret key,
+	// in case of AWS Secrets Manager, SSM and GCP Secret Manager it's the secret name)
+	Key string `yaml:"key,omitempty"`
+	// LocalPath is a path to locally stored keys
+	LocalPath string `yaml:"local_path,omitempty"`
+	// AWS configures AWS session of AWS stores
+	AWS AWS `yaml:"aws,omitempty"`
+	// S3 configures AWS S3 store
+	S3 S3 `yaml:"s3,omitempty"`
+	// SecretsManager configures AWS Secrets Manager store
+	SecretsManager SecretsManager `yaml:"secretsmanager,omitempty"`
+	// SSM configures AWS SSM Parameter Store store
+	SSM SSM `yaml:"ssm,omitempty"`
+	// GCPSecretManager configures GCP Secret Manager store
+	GCPSecretManager GCPSecretManager `yaml:"gcpsm,omitempty"`
+	// Kubernetes configures Kubernetes secret store
+	Kubernetes KubernetesSecret `yaml:"kubernetes,omitempty"`
+}
+
+// AWSKMS configures AWS KMS cipher
+type AWSKMS struct {
+	// AWS configures AWS session
+	AWS `yaml:",inline"`
+	// KeyID is AWS KMS key ID
+	KeyID string `yaml:"key_id,omitempty"`
+}
+
+// GCPKMS configures GCP Cloud KMS cipher
+type GCPKMS struct {
+	// Project is GCP project name
+	Project string `yaml:"project,omitempty"`
+	// Region is GCP region
+	Region string `yaml:"region,omitempty"`
+	// KeyRing is GCP KMS key ring
+	KeyRing string `yaml:"key_ring,omitempty"`
+	// CryptoKey is GCP KMS crypto key id
+	CryptoKey string `yaml:"crypto_key,omitempty"`
+}
+
+// Cipher configures the encryption of vault keys
+type Cipher struct {
+	// Provider is KMS provider: aws or gcp
+	Provider string `yaml:"provider,omitempty"`
+	// AWS configures AWS KMS
+	AWS AWSKMS `yaml:"aws,omitempty"`
+	// GCP configures GCP Cloud KMS
+	GCP GCPKMS `yaml:"gcp,omitempty"`
+}
+
+// Keys configures vault master key shares
+type Keys struct {
+	// Shares is the number of key shares to split the master key into
+	Shares int `yaml:"shares,omitempty"`
+	// Threshold is the number of key shares required to reconstruct the master key
+	Threshold int `yaml:"threshold,omitempty"`
+}
+
+// Audit configures vault audit device
+type Audit struct {
+	// Path is the path the audit device is enabled at; it defaults to the device type
+	Path string `yaml:"path,omitempty"`
+	// Type is audit device type: file, syslog or socket
+	Type string `yaml:"type"`
+	// Description is human friendly description of the audit device
+	Description string `yaml:"description,omitempty"`
+	// Local enables the audit device on the local cluster only
+	Local bool `yaml:"local,omitempty"`
+	// Options are audit device type specific options, e.g. file_path of file device
+	Options map[string]string `yaml:"options,omitempty"`
+}
+
+// GetPath returns the path the audit device is enabled at without leading and trailing slashes.
+// If the path is not set, the device is enabled at the path named after its type.
+func (a *Audit) GetPath() string {
+	if path := strings.Trim(a.Path, "/"); path != "" {
+		return path
+	}
+
+	return a.Type
+}
+
+// SecretValue is a value of KV secret.
+// Exactly one of its fields must be set.
+type SecretValue struct {
+	// Value is plain text value
+	Value string `yaml:"value,omitempty"`
+	// Encrypted is base64 encoded value encrypted with the configured cipher
+	Encrypted string `yaml:"encrypted,omitempty"`
+	// Store is the key the value is stored under in the configured key store.
+	// The stored value is decrypted with the configured cipher, if any.
+	Store string `yaml:"store,omitempty"`
+}
+
+// Secret configures KV secret
+type Secret struct {
+	// Mount is the path the KV secrets engine is mounted at
+	Mount string `yaml:"mount"`
+	// Path is the secret path in the KV secrets engine
+	Path string `yaml:"path"`
+	// Version is KV secrets engine version: 1 or 2; it defaults to 2
+	Version int `yaml:"version,omitempty"`
+	// Data are the secret values keyed by their names
+	Data map[string]SecretValue `yaml:"data"`
+}
+
+// GetVersion returns KV secrets engine version of the secret
+func (s *Secret) GetVersion() int {
+	if s.Version == 0 {
+		return 2
+	}
+
+	return s.Version
+}
+
+// GetPath returns the secret path prefixed with the mount path without leading and trailing slashes
+func (s *Secret) GetPath() string {
+	return strings.Trim(s.Mount, "/") + "/" + strings.Trim(s.Path, "/")
+}
+
+// Admin configures the admin token which replaces the initial root token
+type Admin struct {
+	// RevokeRoot revokes the root token once the admin token is created and stored
+	RevokeRoot bool `yaml:"revoke_root,omitempty"`
+	// Policy is the name of the admin token policy
+	Policy string `yaml:"policy,omitempty"`
+	// Rules are HCL rules of the admin token policy
+	Rules string `yaml:"rules,omitempty"`
+	// Period is the admin token period: the token expires unless it's renewed within it
+	Period time.Duration `yaml:"period,omitempty"`
+}
+
+// AWSAuth configures aws auth method login
+type AWSAuth struct {
+	// AWS configures AWS session whose credentials sign the login request
+	AWS `yaml:",inline"`
+	// HeaderValue is the value of X-Vault-AWS-IAM-Server-ID header of the login request
+	HeaderValue string `yaml:"header_value,omitempty"`
+}
+
+// GCPAuth configures gcp auth method login
+type GCPAuth struct {
+	// ServiceAccount is the email of GCP service account which signs the login JWT
+	ServiceAccount string `yaml:"service_account,omitempty"`
+}
+
+// Auth configures the auth method vaultops logs in with instead of using the stored token
+type Auth struct {
+	// Method is the auth method type: approle, kubernetes, aws, gcp or cert
+	Method string `yaml:"method,omitempty"`
+	// Mount is the path the auth method is mounted at; it defaults to the method type
+	Mount string `yaml:"mount,omitempty"`
+	// Role is the role to log in as; cert auth method uses it as the certificate role name
+	Role string `yaml:"role,omitempty"`
+	// RoleID is approle role ID
+	RoleID string `yaml:"role_id,omitempty"`
+	// SecretID is approle secret ID
+	SecretID string `yaml:"secret_id,omitempty"`
+	// JWTPath is the path to Kubernetes service account token
+	JWTPath string `yaml:"jwt_path,omitempty"`
+	// AWS configures aws auth method login
+	AWS AWSAuth `yaml:"aws,omitempty"`
+	// GCP configures gcp auth method login
+	GCP GCPAuth `yaml:"gcp,omitempty"`
+}
+
+// Cluster holds the setup configuration of a vault cluster
+type Cluster struct {
+	Hosts `yaml:"hosts,omitempty"`
+	// Keys configures vault master key shares
+	Keys *Keys `yaml:"keys,omitempty"`
+	// KeyStore configures the store of vault keys
+	KeyStore *KeyStore `yaml:"keystore,omitempty"`
+	// Cipher configures the encryption of vault keys
+	Cipher *Cipher `yaml:"cipher,omitempty"`
+	// Audit lists vault audit devices
+	Audit []Audit `yaml:"audit,omitempty"`
+	// Secrets lists KV secrets
+	Secrets []Secret `yaml:"secrets,omitempty"`
+	// Admin configures the admin token which replaces the root token
+	Admin *Admin `yaml:"admin,omitempty"`
+	// Auth configures the auth method vaultops logs in with
+	Auth *Auth `yaml:"auth,omitempty"`
 }
 
 // Manifest holds vault setup configuration
 type Manifest struct {
-	Hosts `yaml:"hosts,omitempty"`
+	// Cluster is the configuration of the default cluster.
+	// Its sections are the defaults of the named clusters.
+	Cluster `yaml:",inline"`
+	// Clusters are the named clusters
+	Clusters map[string]*Cluster `yaml:"clusters,omitempty"`
+	// refs are the positions of the references to values stored outside of the manifest
+	// Until they're resolved, the dollar signs in the manifest strings stay escaped.
+	refs map[string]*Error
+	// mu guards the resolution of the references: the manifest is resolved
+	// once the vault keys are stored, e.g. by one of the goroutines per host
+	mu sync.Mutex
+}
+
+// Host returns the host with the given address listed in the manifest.
+// The init hosts take precedence over the unseal hosts.
+func (m *Manifest) Host(address string) (*Host, bool) {
+	address = strings.TrimSuffix(address, "/")
+	for _, hosts := range [][]Host{m.Hosts.Init, m.Hosts.Unseal} {
+		for i := range hosts {
+			if strings.TrimSuffix(hosts[i].Address, "/") == address {
+				h := hosts[i]
+				return &h, true
+			}
+		}
+	}
+
+	return nil, false
 }
 
 // GetHosts returns hosts for given command
+// Discovered hosts are added to the unseal hosts. Unless init hosts are listed
+// explicitly, the first discovered host is used for initialization.
 func (m *Manifest) GetHosts(cmd string) ([]string, error) {
 	var hosts []string
 	// if no hosts found, return erro
 	switch cmd {
 	case "init":
-		hosts = append(hosts, m.Hosts.Init...)
+		hosts = append(hosts, addresses(m.Hosts.Init)...)
+		if len(hosts) > 0 {
+			return hosts, nil
+		}
 	case "unseal":
-		hosts = append(hosts, m.Hosts.Unseal...)
+		hosts = append(hosts, addresses(m.Hosts.Unseal)...)
 	default:
 		return nil, fmt.Errorf("Unsupported command: %s", cmd)
 	}
 
-	return hosts, nil
+	ctx, cancel := context.WithTimeout(context.Background(), discoveryTimeout)
+	defer cancel()
+
+	discovered, err := m.Hosts.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return mergeHosts(cmd, hosts, discovered), nil
+}
+
+// mergeHosts merges discovered hosts into hosts for the given command
+func mergeHosts(cmd string, hosts, discovered []string) []string {
+	if cmd == "init" {
+		if len(hosts) == 0 && len(discovered) > 0 {
+			return []string{discovered[0]}
+		}
+		return hosts
+	}
+
+	seen := make(map[string]bool)
+	for _, h := range hosts {
+		seen[h] = true
+	}
+
+	for _, h := range discovered {
+		if !seen[h] {
+			hosts = append(hosts, h)
+			seen[h] = true
+		}
+	}
+
+	return hosts
 }
 
 // Parse parses configuration file stored in path and returns pointer to Manifest
-// It fails with error if the supplied configuration file can not be read or parsed as valid config
+// It fails with error if the supplied configuration file can not be read or parsed as valid config.
+// The format of the file is detected by its extension. The files included
+// in the manifest are looked up relative to the directory of path.
 func Parse(path string) (*Manifest, error) {
+	return ParseFormat(path, "")
+}
+
+// ParseFormat parses configuration file stored in path in the given format.
+// If format is empty, it's detected by the file extension.
+func ParseFormat(path string, format Format) (*Manifest, error) {
 	f, err := ioutil.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
 
-	var m Manifest
-	if err := yaml.Unmarshal(f, &m); err != nil {
-		return nil, err
+	if format == "" {
+		format = FormatOf(path)
 	}
 
-	return &m, nil
+	return newDecoder(filepath.Dir(path)).decode(f, format)
+}
+
+// Decode decodes manifest from YAML data and validates it.
+// Unknown fields are rejected. If the manifest is not valid, the returned
+// error is Errors which reports the positions of the invalid fields.
+// The files included in the manifest are looked up relative to the working directory.
+func Decode(data []byte) (*Manifest, error) {
+	return DecodeFormat(data, YAML)
+}
+
+// DecodeFormat decodes manifest from data in the given format and validates it
+func DecodeFormat(data []byte, format Format) (*Manifest, error) {
+	return newDecoder(".").decode(data, format)
 }
@@ -1,11 +1,16 @@
 package manifest
 
 import (
+	"fmt"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	yaml "gopkg.in/yaml.v3"
 )
 
 // makeTestFile creates a temporary test file and writes data into it
@@ -46,11 +51,8 @@ hosts:
 	valid := `
 hosts:
   init:
-    - one
-    - two
-mounts:
-  - path: vPath
-    type: pki
+    - http://one:8200
+    - http://two:8200
 `
 	vPath, err := makeTestFile([]byte(valid))
 	defer os.Remove(vPath)
@@ -58,7 +60,128 @@ mounts:
 	m, err = Parse(vPath)
 	assert.NoError(t, err)
 	assert.NotNil(t, m)
-	assert.EqualValues(t, m.Hosts.Init, []string{"one", "two"})
+	assert.EqualValues(t, m.Hosts.Init, []Host{{Address: "http://one:8200"}, {Address: "http://two:8200"}})
+}
+
+func TestParseKeyStore(t *testing.T) {
+	data := `
+keystore:
+  type: k8s
+  bucket: vault-keys
+  key: keys
+  aws:
+    region: eu-west-1
+  kubernetes:
+    namespace: vault
+    timeout: 10s
+    labels:
+      app: vault
+    immutable: true
+cipher:
+  provider: aws
+  aws:
+    key_id: alias/vault
+    region: eu-west-2
+    role_arn: arn:aws:iam::123456789012:role/vaultops
+  gcp:
+    key_ring: ring
+`
+	path, err := makeTestFile([]byte(data))
+	defer os.Remove(path)
+	assert.NoError(t, err)
+
+	m, err := Parse(path)
+	assert.NoError(t, err)
+
+	assert.Equal(t, &KeyStore{
+		Type:   "k8s",
+		Bucket: "vault-keys",
+		Key:    "keys",
+		AWS:    AWS{Region: "eu-west-1"},
+		Kubernetes: KubernetesSecret{
+			Namespace: "vault",
+			Timeout:   10 * time.Second,
+			Labels:    map[string]string{"app": "vault"},
+			Immutable: true,
+		},
+	}, m.KeyStore)
+
+	assert.Equal(t, &Cipher{
+		Provider: "aws",
+		AWS: AWSKMS{
+			AWS:   AWS{Region: "eu-west-2", RoleARN: "arn:aws:iam::123456789012:role/vaultops"},
+			KeyID: "alias/vault",
+		},
+		GCP: GCPKMS{KeyRing: "ring"},
+	}, m.Cipher)
+}
+
+func TestHost(t *testing.T) {
+	data := `
+hosts:
+  init:
+    - address: https://vault-0:8200/
+      ca_cert: /etc/vault/ca-a.pem
+      tls_skip_verify: true
+      namespace: team-a
+  unseal:
+    - https://vault-0:8200
+    - address: https://vault-1:8200
+      ca_path: /etc/vault/ca-b
+      client_cert: /etc/vault/client.pem
+      client_key: /etc/vault/client-key.pem
+      tls_server_name: vault.internal
+      token: s.token
+`
+	path, err := makeTestFile([]byte(data))
+	defer os.Remove(path)
+	assert.NoError(t, err)
+
+	m, err := Parse(path)
+	assert.NoError(t, err)
+
+	hosts, err := m.GetHosts("unseal")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"https://vault-0:8200", "https://vault-1:8200"}, hosts)
+
+	// init hosts take precedence
+	h, ok := m.Host("https://vault-0:8200")
+	assert.True(t, ok)
+	assert.Equal(t, "/etc/vault/ca-a.pem", h.CACert)
+	assert.True(t, *h.TLSSkipVerify)
+	assert.Equal(t, "team-a", h.Namespace)
+
+	h, ok = m.Host("https://vault-1:8200/")
+	assert.True(t, ok)
+	assert.Equal(t, Host{
+		Address:       "https://vault-1:8200",
+		CAPath:        "/etc/vault/ca-b",
+		ClientCert:    "/etc/vault/client.pem",
+		ClientKey:     "/etc/vault/client-key.pem",
+		TLSServerName: "vault.internal",
+		Token:         "s.token",
+	}, *h)
+
+	_, ok = m.Host("https://vault-2:8200")
+	assert.False(t, ok)
+
+	// hosts without settings are encoded as URLs
+	out, err := yaml.Marshal(m.Hosts.Unseal)
+	assert.NoError(t, err)
+	assert.Contains(t, string(out), "- https://vault-0:8200\n")
+	assert.Contains(t, string(out), "tls_server_name: vault.internal")
+
+	// host address is required
+	invalid := `
+hosts:
+  unseal:
+    - ca_cert: /etc/vault/ca.pem
+`
+	invPath, err := makeTestFile([]byte(invalid))
+	defer os.Remove(invPath)
+	assert.NoError(t, err)
+	_, err = Parse(invPath)
+	assert.Error(t, err)
 }
 
 func TestGetHosts(t *testing.T) {
@@ -111,3 +234,111 @@ func TestGetHosts(t *testing.T) {
 	_, err = m.GetHosts("foobar")
 	assert.Error(t, err)
 }
+
+func TestKubernetesDiscovery(t *testing.T) {
+	data := `hosts:
+  unseal:
+    - http://192.168.1.101:8200
+  kubernetes:
+    namespace: vault
+    statefulset: vault
+    scheme: https
+    port: 8300
+    template: "{{.Scheme}}://{{.Hostname}}.vault-internal:{{.Port}}"
+`
+	path, err := makeTestFile([]byte(data))
+	defer os.Remove(path)
+	assert.NoError(t, err)
+	m, err := Parse(path)
+	assert.NoError(t, err)
+	assert.NotNil(t, m.Hosts.Kubernetes)
+
+	c := m.Hosts.Kubernetes.Config()
+	assert.Equal(t, "vault", c.Namespace)
+	assert.Equal(t, "vault", c.StatefulSet)
+	assert.Equal(t, "https", c.Scheme)
+	assert.Equal(t, 8300, c.Port)
+	assert.Equal(t, "{{.Scheme}}://{{.Hostname}}.vault-internal:{{.Port}}", c.Template)
+
+	// invalid kubeconfig fails the discovery
+	m.Hosts.Kubernetes.Kubeconfig = "foobar"
+	_, err = m.GetHosts("unseal")
+	assert.Error(t, err)
+
+	// explicit init hosts don't require discovery
+	m.Hosts.Init = []Host{{Address: "http://192.168.1.101:8200"}}
+	hosts, err := m.GetHosts("init")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"http://192.168.1.101:8200"}, hosts)
+}
+
+func TestMergeHosts(t *testing.T) {
+	discovered := []string{"http://10.0.0.1:8200", "http://10.0.0.2:8200"}
+
+	testCases := []struct {
+		cmd      string
+		hosts    []string
+		expected []string
+	}{
+		{"init", nil, discovered[:1]},
+		{"init", []string{"http://10.0.0.2:8200"}, []string{"http://10.0.0.2:8200"}},
+		{"unseal", nil, discovered},
+		{"unseal", []string{"http://10.0.0.2:8200", "http://10.0.0.3:8200"},
+			[]string{"http://10.0.0.2:8200", "http://10.0.0.3:8200", "http://10.0.0.1:8200"}},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, mergeHosts(tc.cmd, tc.hosts, discovered))
+	}
+
+	assert.Empty(t, mergeHosts("init", nil, nil))
+}
+
+func TestConsulDiscovery(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/health/service/vault", r.URL.Path)
+		assert.Equal(t, "dc1", r.URL.Query().Get("dc"))
+		assert.Equal(t, "true", r.URL.Query().Get("passing"))
+		fmt.Fprint(w, `[
+			{"Node": {"Node": "vault-1", "Address": "10.0.0.2"}, "Service": {"Port": 8200}},
+			{"Node": {"Node": "vault-0", "Address": "10.0.0.1"}, "Service": {"Port": 8200}}
+		]`)
+	}))
+	defer s.Close()
+
+	data := `hosts:
+  unseal:
+    - https://10.0.0.1:8200
+  consul:
+    address: %s
+    datacenter: dc1
+    passing: true
+    scheme: https
+  dns:
+    name: _vault._tcp.example.com
+`
+	path, err := makeTestFile([]byte(fmt.Sprintf(data, s.URL)))
+	defer os.Remove(path)
+	assert.NoError(t, err)
+	m, err := Parse(path)
+	assert.NoError(t, err)
+	assert.NotNil(t, m.Hosts.Consul)
+	assert.NotNil(t, m.Hosts.DNS)
+	assert.Equal(t, "_vault._tcp.example.com", m.Hosts.DNS.Config().Name)
+
+	// only use Consul
+	m.Hosts.DNS = nil
+
+	hosts, err := m.GetHosts("unseal")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"https://10.0.0.1:8200", "https://10.0.0.2:8200"}, hosts)
+
+	hosts, err = m.GetHosts("init")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"https://10.0.0.1:8200"}, hosts)
+
+	// DNS discovery requires SRV record name
+	m.Hosts.DNS = &DNS{}
+	_, err = m.GetHosts("unseal")
+	assert.Error(t, err)
+}
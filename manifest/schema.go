@@ -0,0 +1,136 @@
+package manifest
+
+//go:generate go run gen.go
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const (
+	// schemaURI is the URI of JSON Schema draft the manifest schema conforms to
+	schemaURI = "http://json-schema.org/draft-07/schema#"
+)
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	hostType     = reflect.TypeOf(Host{})
+	// enums are the allowed values of manifest fields
+	enums = map[reflect.Type]map[string][]string{
+		reflect.TypeOf(KeyStore{}): {"type": KeyStoreTypes},
+		reflect.TypeOf(Cipher{}):   {"provider": CipherProviders},
+		reflect.TypeOf(Audit{}):    {"type": AuditTypes},
+		reflect.TypeOf(Auth{}):     {"method": AuthMethods},
+	}
+)
+
+// field is a manifest field
+type field struct {
+	// name is the YAML field name
+	name string
+	// typ is the field type
+	typ reflect.Type
+}
+
+// fields returns YAML fields of struct type t including the fields of inlined structs
+func fields(t reflect.Type) []field {
+	var out []field
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+
+		tag := strings.Split(f.Tag.Get("yaml"), ",")
+		if tag[0] == "-" {
+			continue
+		}
+
+		inline := false
+		for _, opt := range tag[1:] {
+			inline = inline || opt == "inline"
+		}
+		if inline {
+			out = append(out, fields(f.Type)...)
+			continue
+		}
+
+		name := tag[0]
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		out = append(out, field{name: name, typ: f.Type})
+	}
+
+	return out
+}
+
+// schema returns JSON Schema of Go type t
+func schema(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == durationType:
+		return map[string]interface{}{"type": "string", "pattern": `^([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+$`}
+	case t == hostType:
+		// hosts are either URLs or objects
+		host := map[string]interface{}{"type": "string", "format": "uri"}
+		object := objectSchema(t)
+		object["required"] = []string{"address"}
+		return map[string]interface{}{"oneOf": []interface{}{host, object}}
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		return objectSchema(t)
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schema(t.Elem())}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	}
+
+	return map[string]interface{}{"type": "string"}
+}
+
+// objectSchema returns JSON Schema of struct type t
+func objectSchema(t reflect.Type) map[string]interface{} {
+	props := make(map[string]interface{})
+	for _, f := range fields(t) {
+		s := schema(f.typ)
+		if values, ok := enums[t][f.name]; ok {
+			s["enum"] = values
+		}
+		props[f.name] = s
+	}
+
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           props,
+		"additionalProperties": false,
+	}
+}
+
+// Schema returns JSON Schema of the manifest generated from the manifest types
+func Schema() ([]byte, error) {
+	s := schema(reflect.TypeOf((*Manifest)(nil)).Elem())
+	s["$schema"] = schemaURI
+	s["title"] = "vaultops manifest"
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append(data, '\n'), nil
+}
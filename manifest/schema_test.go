@@ -0,0 +1,29 @@
+package manifest
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchema(t *testing.T) {
+	data, err := Schema()
+	assert.NoError(t, err)
+
+	// the published schema is up to date
+	published, err := ioutil.ReadFile("schema.json")
+	assert.NoError(t, err)
+	assert.Equal(t, string(data), string(published), "run go generate ./manifest")
+
+	var s struct {
+		Properties map[string]struct {
+			Properties map[string]json.RawMessage `json:"properties"`
+		} `json:"properties"`
+	}
+	assert.NoError(t, json.Unmarshal(data, &s))
+	assert.Contains(t, s.Properties["hosts"].Properties, "unseal")
+	assert.Contains(t, s.Properties["keystore"].Properties, "local_path")
+	assert.JSONEq(t, `{"type": "string", "enum": ["aws", "gcp"]}`, string(s.Properties["cipher"].Properties["provider"]))
+}
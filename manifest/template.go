@@ -0,0 +1,434 @@
+package manifest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+const (
+	// includeTag is YAML tag of the values which are read from included files
+	includeTag = "!include"
+	// RefKeyStore is the source of the references to vault keys stored in the key store
+	RefKeyStore = "keystore"
+)
+
+var (
+	// exprRe matches escaped dollar signs and ${...} expressions
+	exprRe = regexp.MustCompile(`\$\$|\$\{([^}]*)\}`)
+	// envRe matches environment variable names
+	envRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	// refSections are the manifest sections which can't contain references:
+	// they are needed to resolve the references
+	refSections = []string{"keystore", "cipher"}
+)
+
+// Resolver resolves references to values stored outside of the manifest
+type Resolver interface {
+	// Resolve returns the value of key stored in source
+	Resolve(source, key string) (string, error)
+}
+
+// decoder decodes manifest from YAML
+type decoder struct {
+	// dir is the directory the included files are looked up in
+	dir string
+	// files are the included files the YAML nodes were read from
+	files map[*yaml.Node]string
+	// stack are the files being included; it prevents include cycles
+	stack []string
+	// refs are the positions of the references found in the manifest
+	refs map[string]*Error
+	// expanded are the scalar nodes whose ${...} expressions have been expanded
+	expanded []*yaml.Node
+}
+
+// newDecoder returns manifest decoder which looks up included files in dir
+func newDecoder(dir string) *decoder {
+	return &decoder{
+		dir:   dir,
+		files: make(map[*yaml.Node]string),
+		refs:  make(map[string]*Error),
+	}
+}
+
+// decode decodes manifest from data in the given format and validates it
+func (d *decoder) decode(data []byte, format Format) (*Manifest, error) {
+	if err := checkFormat(format); err != nil {
+		return nil, err
+	}
+
+	doc, errs := d.parse(data, format)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	m := new(Manifest)
+	// empty manifest
+	if doc == nil {
+		return m, nil
+	}
+
+	errs = d.include(doc, d.dir)
+	if len(errs) == 0 {
+		errs = d.interpolate(doc, nil)
+	}
+	// the dollar signs stay escaped until the references are resolved
+	if len(errs) == 0 && len(d.refs) == 0 {
+		for _, n := range d.expanded {
+			n.Value = unescape(n.Value, nil)
+		}
+	}
+
+	if len(errs) == 0 {
+		errs = d.checkFields(doc, reflect.TypeOf(m).Elem())
+		if err := doc.Decode(m); err != nil {
+			errs = append(errs, yamlErrors(err)...)
+		}
+	}
+
+	if len(errs) == 0 {
+		errs = d.validate(m, doc)
+	}
+
+	if len(errs) > 0 {
+		errs.sort()
+		return nil, errs
+	}
+
+	if len(d.refs) > 0 {
+		m.refs = d.refs
+	}
+
+	return m, nil
+}
+
+// include replaces the !include nodes found in YAML node n with the content of the included files.
+// The included files are looked up relative to dir.
+func (d *decoder) include(n *yaml.Node, dir string) Errors {
+	if n.Tag != includeTag {
+		var errs Errors
+		for _, c := range n.Content {
+			errs = append(errs, d.include(c, dir)...)
+		}
+		return errs
+	}
+
+	if n.Kind != yaml.ScalarNode || n.Value == "" {
+		return Errors{d.errorAt(n, "%s requires a file path", includeTag)}
+	}
+
+	path, err := d.expand(n, includeTag+" path")
+	if err != nil {
+		return Errors{err}
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+
+	for _, f := range d.stack {
+		if f == path {
+			return Errors{d.errorAt(n, "include cycle: %s", strings.Join(append(d.stack, path), " -> "))}
+		}
+	}
+
+	data, readErr := ioutil.ReadFile(path)
+	if readErr != nil {
+		return Errors{d.errorAt(n, "failed to include file: %v", readErr)}
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		errs := yamlErrors(err)
+		for _, e := range errs {
+			e.File = path
+		}
+		return errs
+	}
+
+	if len(root.Content) == 0 {
+		return Errors{d.errorAt(n, "included file %s is empty", path)}
+	}
+	included := root.Content[0]
+
+	d.stack = append(d.stack, path)
+	defer func() { d.stack = d.stack[:len(d.stack)-1] }()
+
+	d.mark(included, path)
+	if errs := d.include(included, filepath.Dir(path)); len(errs) > 0 {
+		return errs
+	}
+
+	*n = *included
+	d.files[n] = path
+
+	return nil
+}
+
+// mark records that YAML node n and its children were read from file
+func (d *decoder) mark(n *yaml.Node, file string) {
+	d.files[n] = file
+	for _, c := range n.Content {
+		d.mark(c, file)
+	}
+}
+
+// interpolate expands the ${...} expressions in the scalar values of YAML node n.
+// The dollar signs in the expanded values are escaped, so the references to values
+// stored outside of the manifest can be told apart from the escaped expressions.
+// They are unescaped once the references are resolved.
+// path are the mapping keys leading to n.
+func (d *decoder) interpolate(n *yaml.Node, path []string) Errors {
+	var errs Errors
+	switch n.Kind {
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for _, c := range n.Content {
+			errs = append(errs, d.interpolate(c, path)...)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			p := append(path[:len(path):len(path)], n.Content[i].Value)
+			errs = append(errs, d.interpolate(n.Content[i+1], p)...)
+		}
+	case yaml.ScalarNode:
+		if !strings.Contains(n.Value, "$") {
+			return nil
+		}
+
+		// references can't be used in the sections needed to resolve them
+		var noRefs string
+		if section := section(path); contains(refSections, section) {
+			noRefs = section + " section"
+		}
+
+		value, err := d.expand(n, noRefs)
+		if err != nil {
+			return Errors{err}
+		}
+
+		// plain scalars are resolved again, so the expanded numbers and booleans keep their types
+		if n.Style == 0 && value != n.Value {
+			n.Tag = ""
+		}
+		// JSON and HCL strings stay quoted, so the expanded null is not read as null
+		if n.Tag == exprTag {
+			n.Tag = exprType(value)
+		}
+		// the sections which can't contain references are needed before the references are resolved
+		if noRefs != "" {
+			value = unescape(value, nil)
+		} else {
+			d.expanded = append(d.expanded, n)
+		}
+		n.Value = value
+	}
+
+	return errs
+}
+
+// section returns the manifest section at path: either
+// the top level section or the section of a named cluster
+func section(path []string) string {
+	switch {
+	case len(path) == 0:
+		return ""
+	case path[0] != "clusters":
+		return path[0]
+	case len(path) > 2:
+		return path[2]
+	}
+
+	return ""
+}
+
+// expand expands the ${...} expressions in the value of scalar node n.
+// The references to values stored outside of the manifest are kept
+// so they can be resolved later. Unless noRefs is empty, references
+// are not allowed: noRefs describes the value in the error message.
+func (d *decoder) expand(n *yaml.Node, noRefs string) (string, *Error) {
+	var err *Error
+	value := exprRe.ReplaceAllStringFunc(n.Value, func(expr string) string {
+		if err != nil {
+			return expr
+		}
+
+		if expr == "$$" {
+			return expr
+		}
+		body := expr[2 : len(expr)-1]
+
+		// environment variable with default value
+		if i := strings.Index(body, ":-"); i >= 0 {
+			name, def := body[:i], body[i+2:]
+			if !envRe.MatchString(name) {
+				err = d.errorAt(n, "invalid environment variable name in %s", expr)
+				return expr
+			}
+			if v := os.Getenv(name); v != "" {
+				return escape(v)
+			}
+			return escape(def)
+		}
+
+		// reference to a value stored outside of the manifest
+		if i := strings.Index(body, ":"); i >= 0 {
+			source, key := body[:i], body[i+1:]
+			switch {
+			case source != RefKeyStore:
+				err = d.errorAt(n, "unsupported reference source %q in %s: expected %s", source, expr, RefKeyStore)
+			case key == "":
+				err = d.errorAt(n, "reference %s does not specify a key", expr)
+			case noRefs != "":
+				err = d.errorAt(n, "reference %s is not allowed in %s", expr, noRefs)
+			}
+			if _, ok := d.refs[expr]; !ok && err == nil {
+				d.refs[expr] = d.errorAt(n, "")
+			}
+			return expr
+		}
+
+		if !envRe.MatchString(body) {
+			err = d.errorAt(n, "invalid environment variable name in %s", expr)
+			return expr
+		}
+
+		v, ok := os.LookupEnv(body)
+		if !ok {
+			err = d.errorAt(n, "environment variable %s is not set", body)
+			return expr
+		}
+
+		return escape(v)
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	return value, nil
+}
+
+// escape escapes the dollar signs in s
+func escape(s string) string {
+	return strings.Replace(s, "$", "$$", -1)
+}
+
+// unescape unescapes the dollar signs in s and replaces the references to values
+// stored outside of the manifest with their values. The references missing from
+// values are kept.
+func unescape(s string, values map[string]string) string {
+	return exprRe.ReplaceAllStringFunc(s, func(expr string) string {
+		if expr == "$$" {
+			return "$"
+		}
+		if v, ok := values[expr]; ok {
+			return v
+		}
+		return expr
+	})
+}
+
+// HasRefs returns true if the manifest contains references to values stored outside of it
+func (m *Manifest) HasRefs() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.refs) > 0
+}
+
+// Resolve resolves the references to values stored outside of the manifest
+// using resolver r. References are ${source:key} expressions, e.g. ${keystore:root_token}.
+// Only the references found in the default cluster are resolved: named clusters
+// are resolved in the manifests returned by Select.
+// It fails with Error at the position of the first reference which can't be resolved.
+// Resolve can be called from multiple goroutines: once the references are resolved, it does nothing.
+func (m *Manifest) Resolve(r Resolver) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.refs) == 0 {
+		return nil
+	}
+	cluster := reflect.ValueOf(&m.Cluster).Elem()
+
+	// resolve the references in the order they appear in the manifest
+	var exprs []string
+	walkRefStrings(cluster, func(s string) string {
+		for _, expr := range exprRe.FindAllString(s, -1) {
+			if _, ok := m.refs[expr]; ok && !contains(exprs, expr) {
+				exprs = append(exprs, expr)
+			}
+		}
+		return s
+	})
+	sort.Slice(exprs, func(i, j int) bool { return m.refs[exprs[i]].before(m.refs[exprs[j]]) })
+
+	values := make(map[string]string)
+	for _, expr := range exprs {
+		pos := m.refs[expr]
+		body := expr[2 : len(expr)-1]
+		i := strings.Index(body, ":")
+		v, err := r.Resolve(body[:i], body[i+1:])
+		if err != nil {
+			e := *pos
+			e.Msg = fmt.Sprintf("unresolved reference %s: %v", expr, err)
+			return &e
+		}
+		values[expr] = v
+	}
+
+	// the escaped dollar signs are unescaped in the same pass, so the escaped expressions are kept
+	walkRefStrings(cluster, func(s string) string { return unescape(s, values) })
+	m.refs = nil
+
+	return nil
+}
+
+// walkRefStrings replaces the strings of the sections of cluster c which can contain references
+// with the values returned by fn
+func walkRefStrings(c reflect.Value, fn func(string) string) {
+	for i := 0; i < c.NumField(); i++ {
+		name := strings.Split(c.Type().Field(i).Tag.Get("yaml"), ",")[0]
+		if !contains(refSections, name) {
+			walkStrings(c.Field(i), fn)
+		}
+	}
+}
+
+// walkStrings replaces the strings of v containing dollar signs with the values returned by fn
+func walkStrings(v reflect.Value, fn func(string) string) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			walkStrings(v.Elem(), fn)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if f := v.Field(i); f.CanSet() {
+				walkStrings(f, fn)
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			walkStrings(v.Index(i), fn)
+		}
+	case reflect.Map:
+		for _, k := range v.MapKeys() {
+			e := reflect.New(v.Type().Elem()).Elem()
+			e.Set(v.MapIndex(k))
+			walkStrings(e, fn)
+			v.SetMapIndex(k, e)
+		}
+	case reflect.String:
+		if s := v.String(); strings.Contains(s, "$") {
+			v.SetString(fn(s))
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package manifest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testResolver map[string]string
+
+func (r testResolver) Resolve(source, key string) (string, error) {
+	v, ok := r[source+":"+key]
+	if !ok {
+		return "", fmt.Errorf("key %s not found", key)
+	}
+
+	return v, nil
+}
+
+func TestInterpolate(t *testing.T) {
+	os.Setenv("VAULTOPS_TEST_ENV", "prod")
+	defer os.Unsetenv("VAULTOPS_TEST_ENV")
+	os.Setenv("VAULTOPS_TEST_SHARES", "7")
+	defer os.Unsetenv("VAULTOPS_TEST_SHARES")
+
+	data := `hosts:
+  unseal:
+    - https://vault-0.${VAULTOPS_TEST_ENV}:8200
+    - address: https://vault-1.${VAULTOPS_TEST_ENV}:8200
+      token: "${keystore:root_token}"
+      namespace: ${VAULTOPS_TEST_NAMESPACE:-default}
+keys:
+  shares: ${VAULTOPS_TEST_SHARES}
+  threshold: ${VAULTOPS_TEST_THRESHOLD:-3}
+keystore:
+  bucket: vault-${VAULTOPS_TEST_ENV}-keys
+  key: pa$$word
+`
+	m, err := Decode([]byte(data))
+	assert.NoError(t, err)
+	assert.Equal(t, "https://vault-0.prod:8200", m.Hosts.Unseal[0].Address)
+	assert.Equal(t, "https://vault-1.prod:8200", m.Hosts.Unseal[1].Address)
+	assert.Equal(t, "default", m.Hosts.Unseal[1].Namespace)
+	assert.Equal(t, &Keys{Shares: 7, Threshold: 3}, m.Keys)
+	assert.Equal(t, "vault-prod-keys", m.KeyStore.Bucket)
+	assert.Equal(t, "pa$word", m.KeyStore.Key)
+
+	// references are resolved on request
+	assert.True(t, m.HasRefs())
+	assert.Equal(t, "${keystore:root_token}", m.Hosts.Unseal[1].Token)
+
+	err = m.Resolve(testResolver{})
+	assert.EqualError(t, err, "line 5, column 14: unresolved reference ${keystore:root_token}: key root_token not found")
+
+	assert.NoError(t, m.Resolve(testResolver{"keystore:root_token": "s.root"}))
+	assert.Equal(t, "s.root", m.Hosts.Unseal[1].Token)
+	assert.False(t, m.HasRefs())
+}
+
+func TestResolveEscapes(t *testing.T) {
+	os.Setenv("VAULTOPS_TEST_DOLLAR", "${keystore:root_token}")
+	defer os.Unsetenv("VAULTOPS_TEST_DOLLAR")
+
+	data := `hosts:
+  unseal:
+    - address: https://vault-0:8200
+      token: ${keystore:root_token}
+      namespace: $${keystore:root_token}
+    - address: https://vault-1:8200
+      token: $${keystore:root_token}-${keystore:root_token}-$$$${keystore:root_token}
+      namespace: ${VAULTOPS_TEST_DOLLAR}
+keystore:
+  key: $${keystore:root_token}
+`
+	m, err := Decode([]byte(data))
+	assert.NoError(t, err)
+	assert.Equal(t, "${keystore:root_token}", m.KeyStore.Key)
+
+	// the manifest is encoded with the escaped expressions intact
+	enc, err := m.Encode(YAML)
+	assert.NoError(t, err)
+	decoded, err := Decode(enc)
+	assert.NoError(t, err)
+
+	for _, m := range []*Manifest{m, decoded} {
+		assert.NoError(t, m.Resolve(testResolver{"keystore:root_token": "s.root"}))
+		assert.Equal(t, "s.root", m.Hosts.Unseal[0].Token)
+		assert.Equal(t, "${keystore:root_token}", m.Hosts.Unseal[0].Namespace)
+		assert.Equal(t, "${keystore:root_token}-s.root-$${keystore:root_token}", m.Hosts.Unseal[1].Token)
+		// environment variable values are not expanded
+		assert.Equal(t, "${keystore:root_token}", m.Hosts.Unseal[1].Namespace)
+		assert.Equal(t, "${keystore:root_token}", m.KeyStore.Key)
+	}
+}
+
+func TestInterpolateErrors(t *testing.T) {
+	testCases := []struct {
+		data string
+		err  string
+	}{
+		{
+			data: "hosts:\n  unseal:\n    - https://${VAULTOPS_TEST_UNSET}:8200\n",
+			err:  "line 3, column 7: environment variable VAULTOPS_TEST_UNSET is not set",
+		},
+		{
+			data: "hosts:\n  unseal:\n    - https://${VAULTOPS-HOST}:8200\n",
+			err:  "line 3, column 7: invalid environment variable name in ${VAULTOPS-HOST}",
+		},
+		{
+			data: "hosts:\n  unseal:\n    - address: https://vault:8200\n      token: ${vault:root_token}\n",
+			err:  `line 4, column 14: unsupported reference source "vault" in ${vault:root_token}: expected keystore`,
+		},
+		{
+			data: "keystore:\n  key: ${keystore:root_token}\n",
+			err:  "line 2, column 8: reference ${keystore:root_token} is not allowed in keystore section",
+		},
+	}
+
+	for _, tc := range testCases {
+		m, err := Decode([]byte(tc.data))
+		assert.Nil(t, m)
+		assert.EqualError(t, err, tc.err)
+	}
+}
+
+func TestInclude(t *testing.T) {
+	dir, err := ioutil.TempDir("", "manifest")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"manifest.yaml": `hosts:
+  unseal: !include hosts/unseal.yaml
+keystore: !include ${VAULTOPS_TEST_KEYSTORE:-keystore}.yaml
+`,
+		"hosts/unseal.yaml": `- https://vault-0:8200
+- !include vault-1.yaml
+`,
+		"hosts/vault-1.yaml": "https://vault-1:8200\n",
+		"keystore.yaml":      "type: s3\nbucket: vault-keys\n",
+		"invalid.yaml":       "keystore: !include invalid-keystore.yaml\n",
+		"invalid-keystore.yaml": `type: s3
+bukcet: vault-keys
+`,
+		"cycle.yaml":       "hosts: !include cycle-hosts.yaml\n",
+		"cycle-hosts.yaml": "unseal: !include cycle-hosts.yaml\n",
+		"missing.yaml":     "keystore: !include missing-keystore.yaml\n",
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+		assert.NoError(t, ioutil.WriteFile(path, []byte(data), 0600))
+	}
+
+	m, err := Parse(filepath.Join(dir, "manifest.yaml"))
+	assert.NoError(t, err)
+	assert.Equal(t, []Host{{Address: "https://vault-0:8200"}, {Address: "https://vault-1:8200"}}, m.Hosts.Unseal)
+	assert.Equal(t, &KeyStore{Type: "s3", Bucket: "vault-keys"}, m.KeyStore)
+
+	// errors in included files report the included file
+	_, err = Parse(filepath.Join(dir, "invalid.yaml"))
+	errs, ok := err.(Errors)
+	assert.True(t, ok)
+	assert.Equal(t, Errors{{
+		File:   filepath.Join(dir, "invalid-keystore.yaml"),
+		Line:   2,
+		Column: 1,
+		Msg:    `unknown field "bukcet", did you mean "bucket"?`,
+	}}, errs)
+
+	_, err = Parse(filepath.Join(dir, "cycle.yaml"))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "include cycle")
+
+	_, err = Parse(filepath.Join(dir, "missing.yaml"))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "line 1, column 11: failed to include file")
+}
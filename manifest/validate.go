@@ -0,0 +1,510 @@
+package manifest
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+var (
+	// KeyStoreTypes are the supported types of vault keys store
+	KeyStoreTypes = []string{"local", "s3", "gcs", "k8s", "secretsmanager", "ssm", "gcpsm"}
+	// CipherProviders are the supported KMS providers of vault keys cipher
+	CipherProviders = []string{"aws", "gcp"}
+	// AuthMethods are the supported types of auth methods vaultops logs in with
+	AuthMethods = []string{"approle", "kubernetes", "aws", "gcp", "cert"}
+	// AuditTypes are the supported types of vault audit devices
+	AuditTypes = []string{"file", "syslog", "socket"}
+	// auditOptions are the options required by audit device types
+	auditOptions = map[string][]string{
+		"file":   {"file_path"},
+		"socket": {"address"},
+	}
+)
+
+var (
+	// yamlErrRe matches the position of YAML decoding errors
+	yamlErrRe = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+)
+
+// Error is an error at the given position of the manifest
+type Error struct {
+	// File is the included file which contains the invalid field
+	// It's empty if the field is in the manifest file itself.
+	File string
+	// Line is the line of the invalid field
+	Line int
+	// Column is the column of the invalid field
+	Column int
+	// Msg is the error message
+	Msg string
+}
+
+// Error returns the error message prefixed with the position of the error
+func (e *Error) Error() string {
+	var pos string
+	switch {
+	case e.Line == 0:
+	case e.Column == 0:
+		pos = fmt.Sprintf("line %d: ", e.Line)
+	default:
+		pos = fmt.Sprintf("line %d, column %d: ", e.Line, e.Column)
+	}
+
+	if e.File != "" {
+		pos = e.File + ": " + pos
+	}
+
+	return pos + e.Msg
+}
+
+// Errors are the errors found in the manifest
+type Errors []*Error
+
+// Error returns all the error messages separated by semicolons
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+
+	return strings.Join(msgs, "; ")
+}
+
+// sort sorts the errors by their position
+func (e Errors) sort() {
+	sort.SliceStable(e, func(i, j int) bool { return e[i].before(e[j]) })
+}
+
+// before returns true if error e precedes error o in the manifest
+func (e *Error) before(o *Error) bool {
+	if e.File != o.File {
+		return e.File < o.File
+	}
+	if e.Line != o.Line {
+		return e.Line < o.Line
+	}
+
+	return e.Column < o.Column
+}
+
+// yamlErrors converts YAML decoding error to Errors
+func yamlErrors(err error) Errors {
+	switch e := err.(type) {
+	case *Error:
+		return Errors{e}
+	case *yaml.TypeError:
+		var errs Errors
+		for _, msg := range e.Errors {
+			errs = append(errs, yamlError(msg))
+		}
+		return errs
+	}
+
+	return Errors{yamlError(err.Error())}
+}
+
+// yamlError parses the position of YAML decoding error from its message
+func yamlError(msg string) *Error {
+	m := yamlErrRe.FindStringSubmatch(msg)
+	if m == nil {
+		return &Error{Msg: msg}
+	}
+	line, _ := strconv.Atoi(m[1])
+
+	return &Error{Line: line, Msg: m[2]}
+}
+
+// checkFields checks that YAML node n contains only the fields of type t
+// It returns an error for every unknown field found in n or in its children.
+func (d *decoder) checkFields(n *yaml.Node, t reflect.Type) Errors {
+	if n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	var errs Errors
+	switch t.Kind() {
+	case reflect.Struct:
+		// scalar hosts and invalid types are reported when decoding
+		if n.Kind != yaml.MappingNode {
+			return nil
+		}
+
+		known := make(map[string]reflect.Type)
+		var names []string
+		for _, f := range fields(t) {
+			known[f.name] = f.typ
+			names = append(names, f.name)
+		}
+
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			k, v := n.Content[i], n.Content[i+1]
+			ft, ok := known[k.Value]
+			if !ok {
+				msg := fmt.Sprintf("unknown field %q", k.Value)
+				if s := suggest(k.Value, names); s != "" {
+					msg = fmt.Sprintf("%s, did you mean %q?", msg, s)
+				}
+				errs = append(errs, d.errorAt(k, "%s", msg))
+				continue
+			}
+			errs = append(errs, d.checkFields(v, ft)...)
+		}
+	case reflect.Slice:
+		if n.Kind != yaml.SequenceNode {
+			return nil
+		}
+
+		for _, item := range n.Content {
+			errs = append(errs, d.checkFields(item, t.Elem())...)
+		}
+	case reflect.Map:
+		if n.Kind != yaml.MappingNode {
+			return nil
+		}
+
+		for i := 1; i < len(n.Content); i += 2 {
+			errs = append(errs, d.checkFields(n.Content[i], t.Elem())...)
+		}
+	}
+
+	return errs
+}
+
+// suggest returns the name which is the most similar to the misspelled name
+// or empty string if none of the names is similar enough
+func suggest(name string, names []string) string {
+	best, min := "", 3
+	for _, n := range names {
+		if d := distance(name, n); d < min {
+			best, min = n, d
+		}
+	}
+
+	return best
+}
+
+// distance returns Levenshtein distance of strings a and b
+func distance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j]+1, minInt(cur[j-1]+1, prev[j-1]+cost))
+		}
+		prev = cur
+	}
+
+	return prev[len(b)]
+}
+
+// minInt returns the smaller of a and b
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
+
+// find returns the node found at path in YAML node n.
+// The path elements are either mapping keys or sequence indices.
+// If the path can't be followed, the last node found on the path is returned.
+func find(n *yaml.Node, path ...interface{}) *yaml.Node {
+	for _, p := range path {
+		if n.Kind == yaml.AliasNode {
+			n = n.Alias
+		}
+
+		var next *yaml.Node
+		switch p := p.(type) {
+		case string:
+			if n.Kind != yaml.MappingNode {
+				return n
+			}
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				if n.Content[i].Value == p {
+					next = n.Content[i+1]
+				}
+			}
+		case int:
+			if n.Kind != yaml.SequenceNode || p >= len(n.Content) {
+				return n
+			}
+			next = n.Content[p]
+		}
+
+		if next == nil {
+			return n
+		}
+		n = next
+	}
+
+	return n
+}
+
+// errorAt returns manifest error at the position of YAML node n
+func (d *decoder) errorAt(n *yaml.Node, format string, args ...interface{}) *Error {
+	return &Error{File: d.files[n], Line: n.Line, Column: n.Column, Msg: fmt.Sprintf(format, args...)}
+}
+
+// contains returns true if s is in values
+func contains(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// validate checks the decoded manifest m is semantically valid.
+// The named clusters are validated as they're selected, i.e. merged with the default cluster.
+// The errors are reported at the positions of the invalid fields of YAML node root.
+func (d *decoder) validate(m *Manifest, root *yaml.Node) Errors {
+	errs := d.validateCluster(&m.Cluster, root)
+
+	// the errors in the sections inherited from the default cluster are only reported once
+	seen := make(map[Error]bool)
+	for _, err := range errs {
+		seen[*err] = true
+	}
+
+	for _, name := range m.ClusterNames() {
+		sel, err := m.Select(name)
+		if err != nil {
+			continue
+		}
+
+		n := mergeNode(root, find(root, "clusters", name), "keys")
+		for _, err := range d.validateCluster(&sel.Cluster, n) {
+			if !seen[*err] {
+				seen[*err] = true
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	return errs
+}
+
+// mergeNode returns mapping node with the fields of mapping node override replacing the fields of node n
+// the same way Select replaces the sections of the default cluster. The fields listed in nested are merged
+// field by field. It returns n if override is not a mapping node.
+func mergeNode(n, override *yaml.Node, nested ...string) *yaml.Node {
+	if n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	if override.Kind == yaml.AliasNode {
+		override = override.Alias
+	}
+	if n.Kind != yaml.MappingNode || override.Kind != yaml.MappingNode {
+		return n
+	}
+
+	merged := &yaml.Node{Kind: yaml.MappingNode, Line: override.Line, Column: override.Column}
+	fields := make(map[string]int)
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		fields[n.Content[i].Value] = len(merged.Content) + 1
+		merged.Content = append(merged.Content, n.Content[i], n.Content[i+1])
+	}
+
+	for i := 0; i+1 < len(override.Content); i += 2 {
+		key, value := override.Content[i], override.Content[i+1]
+		j, ok := fields[key.Value]
+		if !ok {
+			merged.Content = append(merged.Content, key, value)
+			continue
+		}
+
+		if contains(nested, key.Value) {
+			value = mergeNode(merged.Content[j], value)
+		}
+		merged.Content[j-1], merged.Content[j] = key, value
+	}
+
+	return merged
+}
+
+// validateCluster checks cluster c is semantically valid.
+// The errors are reported at the positions of the invalid fields of YAML node root.
+func (d *decoder) validateCluster(c *Cluster, root *yaml.Node) Errors {
+	var errs Errors
+
+	for _, list := range []struct {
+		name  string
+		hosts []Host
+	}{
+		{"init", c.Hosts.Init},
+		{"unseal", c.Hosts.Unseal},
+	} {
+		seen := make(map[string]int)
+		for i, h := range list.hosts {
+			n := find(root, "hosts", list.name, i, "address")
+			if h.Address == "" {
+				errs = append(errs, d.errorAt(n, "host address not specified"))
+				continue
+			}
+
+			u, err := url.Parse(h.Address)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				errs = append(errs, d.errorAt(n, "invalid %s host URL %q: expected http(s)://host:port", list.name, h.Address))
+				continue
+			}
+
+			addr := strings.TrimSuffix(h.Address, "/")
+			if line, ok := seen[addr]; ok {
+				errs = append(errs, d.errorAt(n, "duplicate %s host %s: already listed on line %d", list.name, h.Address, line))
+				continue
+			}
+			seen[addr] = n.Line
+		}
+	}
+
+	if k := c.Keys; k != nil {
+		if k.Shares < 0 {
+			errs = append(errs, d.errorAt(find(root, "keys", "shares"), "key shares must not be negative"))
+		}
+		if k.Threshold < 0 {
+			errs = append(errs, d.errorAt(find(root, "keys", "threshold"), "key threshold must not be negative"))
+		}
+		if k.Shares > 0 && k.Threshold > k.Shares {
+			errs = append(errs, d.errorAt(find(root, "keys", "threshold"),
+				"key threshold %d is greater than key shares %d", k.Threshold, k.Shares))
+		}
+	}
+
+	if ks := c.KeyStore; ks != nil && ks.Type != "" && !contains(KeyStoreTypes, ks.Type) {
+		errs = append(errs, d.errorAt(find(root, "keystore", "type"),
+			"unsupported key store type %q: expected one of %s", ks.Type, strings.Join(KeyStoreTypes, ", ")))
+	}
+
+	if cp := c.Cipher; cp != nil && cp.Provider != "" && !contains(CipherProviders, cp.Provider) {
+		errs = append(errs, d.errorAt(find(root, "cipher", "provider"),
+			"unsupported cipher provider %q: expected one of %s", cp.Provider, strings.Join(CipherProviders, ", ")))
+	}
+
+	if a := c.Auth; a != nil && a.Method != "" && !contains(AuthMethods, a.Method) {
+		errs = append(errs, d.errorAt(find(root, "auth", "method"),
+			"unsupported auth method %q: expected one of %s", a.Method, strings.Join(AuthMethods, ", ")))
+	}
+
+	paths := make(map[string]int)
+	for i, a := range c.Audit {
+		n := find(root, "audit", i)
+		switch {
+		case a.Type == "":
+			errs = append(errs, d.errorAt(n, "audit device type not specified"))
+			continue
+		case !contains(AuditTypes, a.Type):
+			errs = append(errs, d.errorAt(find(n, "type"),
+				"unsupported audit device type %q: expected one of %s", a.Type, strings.Join(AuditTypes, ", ")))
+			continue
+		}
+
+		for _, opt := range auditOptions[a.Type] {
+			if a.Options[opt] == "" {
+				errs = append(errs, d.errorAt(find(n, "options"), "%s audit device requires %s option", a.Type, opt))
+			}
+		}
+
+		path := a.GetPath()
+		if line, ok := paths[path]; ok {
+			errs = append(errs, d.errorAt(find(n, "path"), "duplicate audit device path %s: already listed on line %d", path, line))
+			continue
+		}
+		paths[path] = n.Line
+	}
+
+	if a := c.Admin; a != nil && a.Period < 0 {
+		errs = append(errs, d.errorAt(find(root, "admin", "period"), "admin token period must not be negative"))
+	}
+
+	secrets := make(map[string]int)
+	for i := range c.Secrets {
+		errs = append(errs, d.validateSecret(&c.Secrets[i], find(root, "secrets", i), secrets)...)
+	}
+
+	return errs
+}
+
+// validateSecret checks secret s is semantically valid.
+// The errors are reported at the positions of the invalid fields of YAML node n.
+// Paths maps the paths of the already validated secrets to their lines.
+func (d *decoder) validateSecret(s *Secret, n *yaml.Node, paths map[string]int) Errors {
+	var errs Errors
+
+	if strings.Trim(s.Mount, "/") == "" {
+		errs = append(errs, d.errorAt(find(n, "mount"), "secret mount not specified"))
+	}
+	if strings.Trim(s.Path, "/") == "" {
+		errs = append(errs, d.errorAt(find(n, "path"), "secret path not specified"))
+	}
+	if s.Version != 0 && s.Version != 1 && s.Version != 2 {
+		errs = append(errs, d.errorAt(find(n, "version"), "unsupported kv version %d: expected 1 or 2", s.Version))
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	path := s.GetPath()
+	if line, ok := paths[path]; ok {
+		return Errors{d.errorAt(find(n, "path"), "duplicate secret %s: already listed on line %d", path, line)}
+	}
+	paths[path] = n.Line
+
+	if len(s.Data) == 0 {
+		return Errors{d.errorAt(find(n, "data"), "secret %s has no data", path)}
+	}
+
+	names := make([]string, 0, len(s.Data))
+	for name := range s.Data {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		v := s.Data[name]
+		vn := find(n, "data", name)
+
+		var set int
+		for _, f := range []string{v.Value, v.Encrypted, v.Store} {
+			if f != "" {
+				set++
+			}
+		}
+		if set != 1 {
+			errs = append(errs, d.errorAt(vn, "secret value %s must set exactly one of value, encrypted, store", name))
+			continue
+		}
+
+		// references are resolved once the manifest is validated
+		if v.Encrypted != "" && !strings.Contains(v.Encrypted, "${") {
+			if _, err := base64.StdEncoding.DecodeString(v.Encrypted); err != nil {
+				errs = append(errs, d.errorAt(find(vn, "encrypted"), "invalid encrypted secret value %s: %v", name, err))
+			}
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,165 @@
+package manifest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeErrors(t *testing.T) {
+	testCases := []struct {
+		data string
+		errs Errors
+	}{
+		{
+			data: `hosts:
+  unsael:
+    - http://vault-0:8200
+`,
+			errs: Errors{{Line: 2, Column: 3, Msg: `unknown field "unsael", did you mean "unseal"?`}},
+		},
+		{
+			data: `hosts:
+  unseal:
+    - http://vault-0:8200
+    - address: http://vault-0:8200/
+      foo: bar
+`,
+			errs: Errors{{Line: 5, Column: 7, Msg: `unknown field "foo"`}},
+		},
+		{
+			data: `hosts:
+  unseal:
+    - http://vault-0:8200
+    - vault-1:8200
+    - address: http://vault-0:8200/
+`,
+			errs: Errors{
+				{Line: 4, Column: 7, Msg: `invalid unseal host URL "vault-1:8200": expected http(s)://host:port`},
+				{Line: 5, Column: 16, Msg: `duplicate unseal host http://vault-0:8200/: already listed on line 3`},
+			},
+		},
+		{
+			data: `keys:
+  shares: 3
+  threshold: 5
+keystore:
+  type: s4
+cipher:
+  provider: azure
+`,
+			errs: Errors{
+				{Line: 3, Column: 14, Msg: `key threshold 5 is greater than key shares 3`},
+				{Line: 5, Column: 9, Msg: `unsupported key store type "s4": expected one of local, s3, gcs, k8s, secretsmanager, ssm, gcpsm`},
+				{Line: 7, Column: 13, Msg: `unsupported cipher provider "azure": expected one of aws, gcp`},
+			},
+		},
+		{
+			data: `audit:
+  - type: file
+    options:
+      mode: "0600"
+  - type: syslog
+    path: file/
+  - type: socket
+  - type: kafka
+  - description: audit log
+`,
+			errs: Errors{
+				{Line: 4, Column: 7, Msg: `file audit device requires file_path option`},
+				{Line: 6, Column: 11, Msg: `duplicate audit device path file: already listed on line 2`},
+				{Line: 7, Column: 5, Msg: `socket audit device requires address option`},
+				{Line: 8, Column: 11, Msg: `unsupported audit device type "kafka": expected one of file, syslog, socket`},
+				{Line: 9, Column: 5, Msg: `audit device type not specified`},
+			},
+		},
+		{
+			data: `secrets:
+  - mount: secret
+    path: db
+    data:
+      password:
+        value: s3cr3t
+        store: secrets/db
+      username: {}
+      token:
+        encrypted: not base64
+  - mount: /secret/
+    path: db/
+    data:
+      password:
+        value: s3cr3t
+  - path: api
+    version: 3
+  - mount: kv
+    path: api
+`,
+			errs: Errors{
+				{Line: 6, Column: 9, Msg: `secret value password must set exactly one of value, encrypted, store`},
+				{Line: 8, Column: 17, Msg: `secret value username must set exactly one of value, encrypted, store`},
+				{Line: 10, Column: 20, Msg: `invalid encrypted secret value token: illegal base64 data at input byte 3`},
+				{Line: 12, Column: 11, Msg: `duplicate secret secret/db: already listed on line 2`},
+				{Line: 16, Column: 5, Msg: `secret mount not specified`},
+				{Line: 17, Column: 14, Msg: `unsupported kv version 3: expected 1 or 2`},
+				{Line: 18, Column: 5, Msg: `secret kv/api has no data`},
+			},
+		},
+		{
+			data: `admin:
+  revoke_root: true
+  period: -24h
+`,
+			errs: Errors{{Line: 3, Column: 11, Msg: `admin token period must not be negative`}},
+		},
+		{
+			data: `auth:
+  method: ldap
+`,
+			errs: Errors{{Line: 2, Column: 11, Msg: `unsupported auth method "ldap": expected one of approle, kubernetes, aws, gcp, cert`}},
+		},
+		{
+			data: `keys:
+  shares: five
+`,
+			errs: Errors{{Line: 2, Msg: "cannot unmarshal !!str `five` into int"}},
+		},
+		{
+			data: `hosts:
+  unseal:
+    - ca_cert: /etc/vault/ca.pem
+`,
+			errs: Errors{{Line: 3, Column: 7, Msg: "host address not specified"}},
+		},
+		{
+			data: "hosts:\n\tinit: []\n",
+			errs: Errors{{Line: 2, Msg: "found character that cannot start any token"}},
+		},
+	}
+
+	for _, tc := range testCases {
+		m, err := Decode([]byte(tc.data))
+		assert.Nil(t, m)
+		assert.Equal(t, tc.errs, err, tc.data)
+	}
+
+	// empty manifest
+	m, err := Decode(nil)
+	assert.NoError(t, err)
+	assert.NotNil(t, m)
+}
+
+func TestErrors(t *testing.T) {
+	errs := Errors{
+		{Msg: "foo"},
+		{Line: 1, Msg: "bar"},
+		{Line: 2, Column: 3, Msg: "baz"},
+	}
+	assert.EqualError(t, errs, "foo; line 1: bar; line 2, column 3: baz")
+}
+
+func TestSuggest(t *testing.T) {
+	names := []string{"init", "unseal", "kubernetes"}
+	assert.Equal(t, "unseal", suggest("unsael", names))
+	assert.Equal(t, "kubernetes", suggest("kubernets", names))
+	assert.Empty(t, suggest("dns", names))
+}
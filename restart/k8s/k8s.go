@@ -0,0 +1,109 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/milosgajdos/vaultops/discovery/k8s"
+	store "github.com/milosgajdos/vaultops/store/k8s"
+)
+
+const (
+	// DefaultPollInterval is the default interval of polling recreated pods
+	DefaultPollInterval = 2 * time.Second
+)
+
+// Restarter restarts vault hosts by deleting their pods
+// The pods are expected to be recreated by their controller e.g. StatefulSet.
+type Restarter struct {
+	client     kubernetes.Interface
+	discoverer *k8s.Discoverer
+	interval   time.Duration
+}
+
+// New creates new Kubernetes restarter which finds vault pods using Kubernetes
+// discovery configured via c and returns it.
+func New(c *k8s.Config) (*Restarter, error) {
+	client, err := store.NewClient(c.Kubeconfig, c.Context)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewWithClient(client, c)
+}
+
+// NewWithClient creates new Kubernetes restarter which uses client to talk to Kubernetes API.
+// It returns error if c is invalid.
+func NewWithClient(client kubernetes.Interface, c *k8s.Config) (*Restarter, error) {
+	d, err := k8s.NewWithClient(client, c)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Restarter{
+		client:     client,
+		discoverer: d,
+		interval:   DefaultPollInterval,
+	}, nil
+}
+
+// SetPollInterval sets the interval of polling recreated pods
+func (r *Restarter) SetPollInterval(d time.Duration) {
+	r.interval = d
+}
+
+// findPod returns running vault pod which matches the given predicate
+func (r *Restarter) findPod(ctx context.Context, match func(p k8s.Pod) bool) (*k8s.Pod, error) {
+	pods, err := r.discoverer.Pods(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range pods {
+		if match(p) {
+			return &p, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// Restart deletes the pod of vault host and waits until the pod is recreated and running.
+// It returns the URL of the recreated pod.
+func (r *Restarter) Restart(ctx context.Context, host string) (string, error) {
+	host = strings.TrimSuffix(host, "/")
+	pod, err := r.findPod(ctx, func(p k8s.Pod) bool { return strings.TrimSuffix(p.URL, "/") == host })
+	if err != nil {
+		return "", err
+	}
+
+	if pod == nil {
+		return "", fmt.Errorf("no running pod found for host %s", host)
+	}
+
+	if err := r.client.CoreV1().Pods(pod.Namespace).Delete(ctx, pod.Name, metav1.DeleteOptions{}); err != nil {
+		return "", fmt.Errorf("failed to delete pod %s: %v", pod.Name, err)
+	}
+
+	for {
+		recreated, err := r.findPod(ctx, func(p k8s.Pod) bool { return p.Name == pod.Name && p.UID != pod.UID })
+		if err != nil {
+			return "", err
+		}
+
+		if recreated != nil {
+			return recreated.URL, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", fmt.Errorf("pod %s was not recreated: %v", pod.Name, ctx.Err())
+		case <-time.After(r.interval):
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/milosgajdos/vaultops/discovery/k8s"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func makePod(name, uid, ip string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "vault",
+			UID:       types.UID(uid),
+			Labels:    map[string]string{"app": "vault"},
+		},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodRunning,
+			PodIP: ip,
+		},
+	}
+}
+
+func TestNewWithClient(t *testing.T) {
+	client := fake.NewSimpleClientset()
+
+	_, err := NewWithClient(client, &k8s.Config{Namespace: "vault"})
+	assert.Error(t, err)
+
+	r, err := NewWithClient(client, &k8s.Config{Namespace: "vault", Selector: "app=vault"})
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultPollInterval, r.interval)
+}
+
+func TestRestart(t *testing.T) {
+	client := fake.NewSimpleClientset(makePod("vault-0", "uid-0", "10.0.0.1"), makePod("vault-1", "uid-1", "10.0.0.2"))
+
+	r, err := NewWithClient(client, &k8s.Config{Namespace: "vault", Selector: "app=vault"})
+	assert.NoError(t, err)
+	r.SetPollInterval(time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// emulate the StatefulSet controller recreating the deleted pod with a new IP
+	go func() {
+		for {
+			if _, err := client.CoreV1().Pods("vault").Get(ctx, "vault-1", metav1.GetOptions{}); err != nil {
+				// nolint:errcheck
+				client.CoreV1().Pods("vault").Create(ctx, makePod("vault-1", "uid-2", "10.0.0.3"), metav1.CreateOptions{})
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	host, err := r.Restart(ctx, "http://10.0.0.2:8200/")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://10.0.0.3:8200", host)
+
+	_, err = r.Restart(ctx, "http://10.0.0.100:8200")
+	assert.Error(t, err)
+
+	// the pod is never recreated
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = r.Restart(ctx, "http://10.0.0.1:8200")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "pod vault-0 was not recreated")
+}
@@ -0,0 +1,11 @@
+// Package restart provides an interface for restarting vault hosts
+package restart
+
+import "context"
+
+// Restarter restarts vault hosts
+type Restarter interface {
+	// Restart restarts vault host and returns its URL once it's been restarted.
+	// The returned URL differs from host if the host address changes on restart.
+	Restart(ctx context.Context, host string) (string, error)
+}
@@ -0,0 +1,62 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+const (
+	// HostEnv is the environment variable which contains the URL of the restarted host
+	HostEnv = "VAULTOPS_HOST"
+	// maxOutput is the maximum length of command output reported on failure
+	maxOutput = 512
+)
+
+// Restarter restarts vault hosts by running a shell command
+type Restarter struct {
+	command string
+	shell   string
+}
+
+// New creates new shell restarter which runs command in shell and returns it.
+// The URL of the restarted host is passed to the command via VAULTOPS_HOST
+// and VAULT_ADDR environment variables. If shell is empty, sh is used.
+func New(command, shell string) (*Restarter, error) {
+	if command == "" {
+		return nil, fmt.Errorf("empty restart command")
+	}
+
+	if shell == "" {
+		shell = "sh"
+	}
+
+	return &Restarter{
+		command: command,
+		shell:   shell,
+	}, nil
+}
+
+// Restart runs the restart command for host and waits for it to finish.
+// It returns error if the command fails.
+func (r *Restarter) Restart(ctx context.Context, host string) (string, error) {
+	cmd := exec.CommandContext(ctx, r.shell, "-c", r.command)
+	cmd.Env = append(os.Environ(), HostEnv+"="+host, "VAULT_ADDR="+host)
+
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+
+	if err := cmd.Run(); err != nil {
+		output := strings.TrimSpace(out.String())
+		if len(output) > maxOutput {
+			output = "..." + output[len(output)-maxOutput:]
+		}
+		return "", fmt.Errorf("restart command failed: %v: %s", err, output)
+	}
+
+	return host, nil
+}
@@ -0,0 +1,44 @@
+package shell
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	_, err := New("", "")
+	assert.Error(t, err)
+
+	r, err := New("true", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "sh", r.shell)
+}
+
+func TestRestart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vaultops")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "out")
+
+	r, err := New("printf '%s %s' \"$VAULTOPS_HOST\" \"$VAULT_ADDR\" > "+out, "")
+	assert.NoError(t, err)
+
+	host, err := r.Restart(context.Background(), "http://vault-0:8200")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://vault-0:8200", host)
+
+	data, err := ioutil.ReadFile(out)
+	assert.NoError(t, err)
+	assert.Equal(t, "http://vault-0:8200 http://vault-0:8200", string(data))
+
+	r, err = New("echo restart failed; exit 3", "")
+	assert.NoError(t, err)
+	_, err = r.Restart(context.Background(), "http://vault-0:8200")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "restart failed")
+}
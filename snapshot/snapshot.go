@@ -0,0 +1,346 @@
+// Package snapshot stores encrypted vault raft snapshots in vault key stores.
+//
+// Key stores only allow to write and read data stored under a single key, so
+// the snapshots are stored in a ring of retain slots: the newest snapshot
+// replaces the oldest one. The index of the stored snapshots, along with their
+// checksums, is stored under a separate key.
+//
+// Snapshots are streamed through the cipher into the store without reading
+// them into memory, so they can only be stored in stores which implement
+// store.Streamer.
+package snapshot
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/milosgajdos/vaultops/cipher"
+	"github.com/milosgajdos/vaultops/store"
+)
+
+const (
+	// DefaultRetain is the default number of retained snapshots
+	DefaultRetain = 5
+)
+
+// StoreFunc returns store handle for the given key
+type StoreFunc func(key string) (store.Store, error)
+
+// Entry is a stored snapshot
+type Entry struct {
+	// Slot is the snapshot slot
+	Slot int `json:"slot"`
+	// Key is the store key of the snapshot
+	Key string `json:"key"`
+	// Created is the snapshot creation time
+	Created time.Time `json:"created"`
+	// Size is the size of the unencrypted snapshot in bytes
+	Size int `json:"size"`
+	// SHA256 is hex encoded SHA256 checksum of the unencrypted snapshot
+	SHA256 string `json:"sha256"`
+	// Encrypted is true if the snapshot is encrypted
+	Encrypted bool `json:"encrypted"`
+}
+
+// Index is snapshot index
+type Index struct {
+	// Next is the slot of the next snapshot
+	Next int `json:"next"`
+	// Snapshots are stored snapshots ordered from the newest to the oldest
+	Snapshots []Entry `json:"snapshots"`
+}
+
+// Repository stores snapshots in store
+type Repository struct {
+	stores StoreFunc
+	prefix string
+	retain int
+	cipher cipher.StreamCipher
+}
+
+// NewRepository creates new snapshot repository and returns it.
+// Snapshots are stored under keys prefixed with prefix in the stores returned by stores.
+// If c is not nil, the snapshots are encrypted with c. Repository retains at most
+// retain snapshots. It returns error if retain is not positive.
+func NewRepository(prefix string, retain int, stores StoreFunc, c cipher.StreamCipher) (*Repository, error) {
+	if retain < 1 {
+		return nil, fmt.Errorf("invalid number of retained snapshots: %d", retain)
+	}
+
+	if prefix == "" {
+		return nil, fmt.Errorf("empty snapshot key prefix")
+	}
+
+	return &Repository{
+		stores: stores,
+		prefix: prefix,
+		retain: retain,
+		cipher: c,
+	}, nil
+}
+
+// indexKey returns snapshot index key
+func (r *Repository) indexKey() string {
+	return r.prefix + ".index"
+}
+
+// slotKey returns snapshot key of the given slot
+func (r *Repository) slotKey(slot int) string {
+	return fmt.Sprintf("%s.%d", r.prefix, slot)
+}
+
+// streamer returns the store of the snapshot stored under key
+func (r *Repository) streamer(key string) (store.Streamer, error) {
+	s, err := r.stores(key)
+	if err != nil {
+		return nil, err
+	}
+
+	st, ok := s.(store.Streamer)
+	if !ok {
+		return nil, fmt.Errorf("store of snapshot %s does not support streaming", key)
+	}
+
+	return st, nil
+}
+
+// Index reads snapshot index and returns it.
+// It returns empty index if no snapshots have been stored yet.
+func (r *Repository) Index() (*Index, error) {
+	s, err := r.stores(r.indexKey())
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadAll(s)
+	if err != nil {
+		if serr, ok := err.(*store.Error); ok && serr.Code == store.ErrNotFound {
+			return &Index{}, nil
+		}
+		return nil, fmt.Errorf("failed to read snapshot index: %v", err)
+	}
+
+	index := new(Index)
+	if len(data) == 0 {
+		return index, nil
+	}
+
+	if err := json.Unmarshal(data, index); err != nil {
+		return nil, fmt.Errorf("failed to decode snapshot index: %v", err)
+	}
+
+	return index, nil
+}
+
+// writeIndex stores snapshot index
+func (r *Repository) writeIndex(index *Index) error {
+	out, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+
+	s, err := r.stores(r.indexKey())
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.Write(out); err != nil {
+		return fmt.Errorf("failed to store snapshot index: %v", err)
+	}
+
+	return nil
+}
+
+// Save streams snapshot read from snap created at the given time into the store and returns its index entry.
+// The oldest snapshots are replaced once the number of retained snapshots is reached.
+func (r *Repository) Save(snap io.Reader, created time.Time) (*Entry, error) {
+	index, err := r.Index()
+	if err != nil {
+		return nil, err
+	}
+
+	slot := index.Next % r.retain
+	entry := Entry{
+		Slot:      slot,
+		Key:       r.slotKey(slot),
+		Created:   created.UTC(),
+		Encrypted: r.cipher != nil,
+	}
+
+	st, err := r.streamer(entry.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	// the new snapshot replaces the snapshot stored in the same slot
+	snapshots := []Entry{entry}
+	for _, e := range index.Snapshots {
+		if e.Slot != slot && len(snapshots) < r.retain {
+			snapshots = append(snapshots, e)
+		}
+	}
+
+	// the replaced snapshot is removed from the index before it's overwritten
+	// so that it's never restored if the new snapshot fails to be stored
+	if len(snapshots)-1 < len(index.Snapshots) {
+		index.Snapshots = snapshots[1:]
+		if err := r.writeIndex(index); err != nil {
+			return nil, err
+		}
+	}
+
+	sum := &checksum{h: sha256.New()}
+	data := io.TeeReader(snap, sum)
+	if r.cipher != nil {
+		enc := encryptReader(r.cipher, data)
+		defer enc.Close()
+		data = enc
+	}
+
+	if _, err := st.WriteFrom(data); err != nil {
+		return nil, fmt.Errorf("failed to store snapshot: %v", err)
+	}
+
+	entry.Size = int(sum.n)
+	entry.SHA256 = hex.EncodeToString(sum.h.Sum(nil))
+
+	index.Snapshots = snapshots
+	index.Snapshots[0] = entry
+	index.Next = (slot + 1) % r.retain
+	if err := r.writeIndex(index); err != nil {
+		return nil, err
+	}
+
+	return &entry, nil
+}
+
+// Load returns reader of the n-th newest snapshot along with its index entry.
+// The newest snapshot has number 0. The snapshot checksum is verified before
+// the reader is returned; the returned reader verifies it again once the whole
+// snapshot has been read and fails if the snapshot has been modified since.
+func (r *Repository) Load(n int) (io.ReadCloser, *Entry, error) {
+	index, err := r.Index()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if n < 0 || n >= len(index.Snapshots) {
+		return nil, nil, fmt.Errorf("snapshot %d not found: %d snapshots stored", n, len(index.Snapshots))
+	}
+	entry := index.Snapshots[n]
+
+	rc, err := r.open(&entry)
+	if err != nil {
+		return nil, nil, err
+	}
+	_, err = io.Copy(ioutil.Discard, rc)
+	rc.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rc, err = r.open(&entry)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return rc, &entry, nil
+}
+
+// open returns reader which decrypts the snapshot of entry and verifies its checksum
+func (r *Repository) open(entry *Entry) (io.ReadCloser, error) {
+	if entry.Encrypted && r.cipher == nil {
+		return nil, fmt.Errorf("snapshot %s is encrypted: no cipher provided", entry.Key)
+	}
+
+	st, err := r.streamer(entry.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	rc, err := st.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot: %v", err)
+	}
+
+	var data io.Reader = rc
+	if entry.Encrypted {
+		data, err = r.cipher.DecryptStream(rc)
+		if err != nil {
+			rc.Close()
+			return nil, fmt.Errorf("failed to decrypt snapshot: %v", err)
+		}
+	}
+
+	return &verifyReader{r: data, c: rc, entry: entry, sum: &checksum{h: sha256.New()}}, nil
+}
+
+// checksum computes the checksum and the size of the data written to it
+type checksum struct {
+	h hash.Hash
+	n int64
+}
+
+func (c *checksum) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return c.h.Write(p)
+}
+
+// verifyReader verifies the snapshot checksum once the whole snapshot has been read
+type verifyReader struct {
+	r     io.Reader
+	c     io.Closer
+	entry *Entry
+	sum   *checksum
+}
+
+func (v *verifyReader) Read(p []byte) (int, error) {
+	n, err := v.r.Read(p)
+	// nolint:errcheck
+	v.sum.Write(p[:n])
+
+	switch err {
+	case nil:
+	case io.EOF:
+		if v.sum.n != int64(v.entry.Size) || hex.EncodeToString(v.sum.h.Sum(nil)) != v.entry.SHA256 {
+			return n, fmt.Errorf("snapshot %s integrity check failed: checksum mismatch", v.entry.Key)
+		}
+	default:
+		return n, fmt.Errorf("failed to read snapshot %s: %v", v.entry.Key, err)
+	}
+
+	return n, err
+}
+
+func (v *verifyReader) Close() error {
+	return v.c.Close()
+}
+
+// encryptReader returns reader which reads the data read from r encrypted with c
+// The returned reader must be closed once it's no longer read from.
+func encryptReader(c cipher.StreamCipher, r io.Reader) io.ReadCloser {
+	pr, pw := io.Pipe()
+
+	go func() {
+		enc, err := c.EncryptStream(pw)
+		if err != nil {
+			pw.CloseWithError(fmt.Errorf("failed to encrypt snapshot: %v", err))
+			return
+		}
+
+		if _, err := io.Copy(enc, r); err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+
+		pw.CloseWithError(enc.Close())
+	}()
+
+	return pr
+}
@@ -0,0 +1,222 @@
+package snapshot
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/milosgajdos/vaultops/store"
+	"github.com/stretchr/testify/assert"
+)
+
+// memStore is in-memory store
+type memStore struct {
+	data   map[string][]byte
+	key    string
+	reader *bytes.Reader
+}
+
+func (m *memStore) Write(p []byte) (int, error) {
+	m.data[m.key] = append([]byte(nil), p...)
+	return len(p), nil
+}
+
+func (m *memStore) Read(p []byte) (int, error) {
+	if m.reader == nil {
+		data, ok := m.data[m.key]
+		if !ok {
+			return 0, &store.Error{Code: store.ErrNotFound}
+		}
+		m.reader = bytes.NewReader(data)
+	}
+
+	return m.reader.Read(p)
+}
+
+func (m *memStore) WriteFrom(r io.Reader) (int64, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return int64(len(data)), err
+	}
+	m.data[m.key] = data
+	return int64(len(data)), nil
+}
+
+func (m *memStore) Open() (io.ReadCloser, error) {
+	data, ok := m.data[m.key]
+	if !ok {
+		return nil, &store.Error{Code: store.ErrNotFound}
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+func memStores(data map[string][]byte) StoreFunc {
+	return func(key string) (store.Store, error) {
+		return &memStore{data: data, key: key}, nil
+	}
+}
+
+// xorCipher is a toy stream cipher
+type xorCipher struct{}
+
+type xorStream struct {
+	r io.Reader
+	w io.Writer
+}
+
+func (x *xorStream) Read(p []byte) (int, error) {
+	n, err := x.r.Read(p)
+	for i := range p[:n] {
+		p[i] ^= 0x42
+	}
+	return n, err
+}
+
+func (x *xorStream) Write(p []byte) (int, error) {
+	out := make([]byte, len(p))
+	for i := range p {
+		out[i] = p[i] ^ 0x42
+	}
+	return x.w.Write(out)
+}
+
+func (x *xorStream) Close() error { return nil }
+
+func (xorCipher) EncryptStream(w io.Writer) (io.WriteCloser, error) { return &xorStream{w: w}, nil }
+func (xorCipher) DecryptStream(r io.Reader) (io.Reader, error)      { return &xorStream{r: r}, nil }
+
+// xor returns data xor-ed with xorCipher key
+func xor(data string) []byte {
+	out := []byte(data)
+	for i := range out {
+		out[i] ^= 0x42
+	}
+	return out
+}
+
+// load reads the n-th newest snapshot from r
+func load(r *Repository, n int) ([]byte, *Entry, error) {
+	rc, entry, err := r.Load(n)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rc.Close()
+
+	data, err := ioutil.ReadAll(rc)
+	return data, entry, err
+}
+
+func TestNewRepository(t *testing.T) {
+	stores := memStores(make(map[string][]byte))
+
+	_, err := NewRepository("vault.snap", 0, stores, nil)
+	assert.Error(t, err)
+
+	_, err = NewRepository("", 1, stores, nil)
+	assert.Error(t, err)
+
+	r, err := NewRepository("vault.snap", 1, stores, nil)
+	assert.NoError(t, err)
+
+	index, err := r.Index()
+	assert.NoError(t, err)
+	assert.Empty(t, index.Snapshots)
+}
+
+func TestSaveLoad(t *testing.T) {
+	data := make(map[string][]byte)
+	r, err := NewRepository("vault.snap", 3, memStores(data), xorCipher{})
+	assert.NoError(t, err)
+
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		entry, err := r.Save(strings.NewReader(fmt.Sprintf("snapshot %d", i)), now.Add(time.Duration(i)*time.Minute))
+		assert.NoError(t, err)
+		assert.Equal(t, i%3, entry.Slot)
+		assert.Equal(t, 10, entry.Size)
+		assert.True(t, entry.Encrypted)
+	}
+
+	// only the slots and the index are stored
+	assert.Len(t, data, 4)
+	assert.Equal(t, xor("snapshot 3"), data["vault.snap.0"])
+
+	index, err := r.Index()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, index.Next)
+	assert.Len(t, index.Snapshots, 3)
+
+	for i, expected := range []string{"snapshot 4", "snapshot 3", "snapshot 2"} {
+		snap, entry, err := load(r, i)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, string(snap))
+		assert.Equal(t, index.Snapshots[i], *entry)
+	}
+
+	_, _, err = r.Load(3)
+	assert.Error(t, err)
+
+	// tampered snapshot
+	data["vault.snap.1"] = xor("snapshot 5")
+	_, _, err = r.Load(0)
+	assert.Error(t, err)
+
+	// encrypted snapshot requires cipher
+	r, err = NewRepository("vault.snap", 3, memStores(data), nil)
+	assert.NoError(t, err)
+	_, _, err = r.Load(1)
+	assert.Error(t, err)
+
+	// corrupted index
+	data["vault.snap.index"] = []byte("foo")
+	_, err = r.Index()
+	assert.Error(t, err)
+	_, err = r.Save(strings.NewReader("snapshot"), now)
+	assert.Error(t, err)
+}
+
+func TestSaveErrors(t *testing.T) {
+	data := make(map[string][]byte)
+	r, err := NewRepository("vault.snap", 2, memStores(data), nil)
+	assert.NoError(t, err)
+
+	now := time.Now()
+	for i := 0; i < 2; i++ {
+		_, err := r.Save(strings.NewReader(fmt.Sprintf("snapshot %d", i)), now)
+		assert.NoError(t, err)
+	}
+
+	// the replaced snapshot is dropped from the index even if the new snapshot fails to be stored
+	_, err = r.Save(io.MultiReader(strings.NewReader("snap"), errReader{}), now)
+	assert.Error(t, err)
+	index, err := r.Index()
+	assert.NoError(t, err)
+	assert.Len(t, index.Snapshots, 1)
+	assert.Equal(t, "vault.snap.1", index.Snapshots[0].Key)
+
+	snap, _, err := load(r, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "snapshot 1", string(snap))
+
+	// stores which can't stream data
+	r, err = NewRepository("vault.snap", 2, func(key string) (store.Store, error) {
+		return &bytesStore{}, nil
+	}, nil)
+	assert.NoError(t, err)
+	_, err = r.Save(strings.NewReader("snapshot"), now)
+	assert.Error(t, err)
+}
+
+// errReader fails all reads
+type errReader struct{}
+
+func (errReader) Read(p []byte) (int, error) { return 0, fmt.Errorf("read error") }
+
+// bytesStore stores data in memory but can't stream it
+type bytesStore struct {
+	bytes.Buffer
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
@@ -12,34 +13,80 @@ import (
 
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/milosgajdos/vaultops/store"
 )
 
-var (
+const (
+	// DefaultTimeout is the default timeout of Kubernetes API requests
 	DefaultTimeout = 5 * time.Second
 )
 
+// Config configures Kubernetes store
+type Config struct {
+	// Kubeconfig is a path to kubeconfig file
+	Kubeconfig string
+	// Context is kubeconfig context to use
+	Context string
+	// Timeout is Kubernetes API request timeout
+	Timeout time.Duration
+	// Labels are added to the secret
+	Labels map[string]string
+	// Annotations are added to the secret
+	Annotations map[string]string
+	// Owner is the secret owner in Kind/name format e.g. Job/vault-init
+	// The owner must exist in the same namespace as the secret.
+	Owner string
+	// Immutable marks newly created secrets as immutable
+	Immutable bool
+}
+
 // K8s implements kubernetes store
 // It stores the secrets in kubernetes secret
 // under provided secret key
 type K8s struct {
-	client kubernetes.Interface
-	secret string
-	key    string
-	ns     string
-	reader *bytes.Buffer
-	ready  bool
+	client      kubernetes.Interface
+	secret      string
+	key         string
+	ns          string
+	timeout     time.Duration
+	labels      map[string]string
+	annotations map[string]string
+	owner       string
+	immutable   bool
+	reader      *bytes.Buffer
+	ready       bool
 }
 
-// NewStore creates a new Kubernetes secret store handle and returns it.
-// It returns error if the kubernetes client fails to be initialized.
-func NewStore(secret, key, ns string) (*K8s, error) {
-	kubeconfig := os.Getenv("KUBECONFIG")
-	if len(kubeconfig) == 0 {
-		kubeconfig = os.Getenv("HOME") + "/.kube/config"
+// NewConfig returns Kubernetes client configuration.
+// Unless either kubeconfig or kubeContext are supplied or KUBECONFIG environment variable is set,
+// it attempts to use in-cluster service account configuration first and falls back to
+// the default kubeconfig file when not running inside Kubernetes cluster.
+func NewConfig(kubeconfig, kubeContext string) (*rest.Config, error) {
+	if kubeconfig == "" && kubeContext == "" && os.Getenv("KUBECONFIG") == "" {
+		cfg, err := rest.InClusterConfig()
+		if err == nil {
+			return cfg, nil
+		}
+
+		if err != rest.ErrNotInCluster {
+			return nil, err
+		}
 	}
 
-	cfg, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = kubeconfig
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: kubeContext}
+
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides).ClientConfig()
+}
+
+// NewClient creates a new Kubernetes clientset and returns it.
+// See NewConfig for details about how the clientset is configured.
+func NewClient(kubeconfig, kubeContext string) (kubernetes.Interface, error) {
+	cfg, err := NewConfig(kubeconfig, kubeContext)
 	if err != nil {
 		return nil, fmt.Errorf("failed to configure k8s client: %s", err.Error())
 	}
@@ -49,18 +96,97 @@ func NewStore(secret, key, ns string) (*K8s, error) {
 		return nil, fmt.Errorf("failed building k8s clientset: %s", err.Error())
 	}
 
+	return client, nil
+}
+
+// NewStore creates a new Kubernetes secret store handle configured via c and returns it.
+// It returns error if the kubernetes client fails to be initialized.
+func NewStore(secret, key, ns string, c *Config) (*K8s, error) {
+	if c == nil {
+		c = &Config{}
+	}
+
+	client, err := NewClient(c.Kubeconfig, c.Context)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewStoreWithClient(client, secret, key, ns, c)
+}
+
+// NewStoreWithClient creates a new Kubernetes secret store handle which uses client
+// to talk to Kubernetes API. It returns error if the owner in c is not in Kind/name format.
+func NewStoreWithClient(client kubernetes.Interface, secret, key, ns string, c *Config) (*K8s, error) {
+	if c == nil {
+		c = &Config{}
+	}
+
+	if c.Owner != "" {
+		if parts := strings.Split(c.Owner, "/"); len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid secret owner %q: expected Kind/name", c.Owner)
+		}
+	}
+
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
 	return &K8s{
-		client: client,
-		secret: secret,
-		key:    key,
-		ns:     ns,
-		ready:  false,
+		client:      client,
+		secret:      secret,
+		key:         key,
+		ns:          ns,
+		timeout:     timeout,
+		labels:      c.Labels,
+		annotations: c.Annotations,
+		owner:       c.Owner,
+		immutable:   c.Immutable,
+		ready:       false,
 	}, nil
 }
 
+// ownerReference returns owner reference of the secret owner
+func (k *K8s) ownerReference(ctx context.Context) (*metav1.OwnerReference, error) {
+	parts := strings.Split(k.owner, "/")
+	kind, name := parts[0], parts[1]
+
+	var (
+		meta metav1.Object
+		err  error
+	)
+
+	ref := &metav1.OwnerReference{Name: name}
+
+	switch strings.ToLower(kind) {
+	case "pod":
+		ref.APIVersion, ref.Kind = "v1", "Pod"
+		meta, err = k.client.CoreV1().Pods(k.ns).Get(ctx, name, metav1.GetOptions{})
+	case "job":
+		ref.APIVersion, ref.Kind = "batch/v1", "Job"
+		meta, err = k.client.BatchV1().Jobs(k.ns).Get(ctx, name, metav1.GetOptions{})
+	case "statefulset":
+		ref.APIVersion, ref.Kind = "apps/v1", "StatefulSet"
+		meta, err = k.client.AppsV1().StatefulSets(k.ns).Get(ctx, name, metav1.GetOptions{})
+	case "deployment":
+		ref.APIVersion, ref.Kind = "apps/v1", "Deployment"
+		meta, err = k.client.AppsV1().Deployments(k.ns).Get(ctx, name, metav1.GetOptions{})
+	default:
+		return nil, fmt.Errorf("unsupported secret owner kind: %s", kind)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret owner %s in namespace %s: %v", k.owner, k.ns, err)
+	}
+
+	ref.UID = meta.GetUID()
+
+	return ref, nil
+}
+
 // Write writes data to K8s store
 func (k *K8s) Write(b []byte) (int, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), DefaultTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), k.timeout)
 	defer cancel()
 
 	secret, err := k.client.CoreV1().Secrets(k.ns).Get(ctx, k.secret, metav1.GetOptions{})
@@ -68,7 +194,9 @@ func (k *K8s) Write(b []byte) (int, error) {
 	if errors.IsNotFound(err) {
 		s := &corev1.Secret{
 			ObjectMeta: metav1.ObjectMeta{
-				Name: k.secret,
+				Name:        k.secret,
+				Labels:      k.labels,
+				Annotations: k.annotations,
 			},
 			Type: corev1.SecretTypeOpaque,
 			Data: map[string][]byte{
@@ -76,6 +204,19 @@ func (k *K8s) Write(b []byte) (int, error) {
 			},
 		}
 
+		if k.immutable {
+			immutable := true
+			s.Immutable = &immutable
+		}
+
+		if k.owner != "" {
+			ref, err := k.ownerReference(ctx)
+			if err != nil {
+				return 0, err
+			}
+			s.OwnerReferences = []metav1.OwnerReference{*ref}
+		}
+
 		if _, err := k.client.CoreV1().Secrets(k.ns).Create(ctx, s, metav1.CreateOptions{}); err != nil {
 			return 0, fmt.Errorf("failed to create secret %s in namespace %s: %v", k.secret, k.ns, err)
 		}
@@ -83,10 +224,36 @@ func (k *K8s) Write(b []byte) (int, error) {
 		return len(b), nil
 	}
 
+	if err != nil {
+		return 0, fmt.Errorf("failed to read secret %s in namespace %s: %v", k.secret, k.ns, err)
+	}
+
 	// compare the bytes and only update existing secrets if the bytes are not the same
 	if !bytes.Equal(secret.Data[k.key], b) {
+		if secret.Immutable != nil && *secret.Immutable {
+			return 0, fmt.Errorf("failed to update secret %s in namespace %s: secret is immutable: "+
+				"delete it or store the data in another secret", k.secret, k.ns)
+		}
+
+		if secret.Data == nil {
+			secret.Data = make(map[string][]byte)
+		}
 		secret.Data[k.key] = b
 
+		if len(k.labels) > 0 && secret.Labels == nil {
+			secret.Labels = make(map[string]string)
+		}
+		for name, val := range k.labels {
+			secret.Labels[name] = val
+		}
+
+		if len(k.annotations) > 0 && secret.Annotations == nil {
+			secret.Annotations = make(map[string]string)
+		}
+		for name, val := range k.annotations {
+			secret.Annotations[name] = val
+		}
+
 		if _, err := k.client.CoreV1().Secrets(k.ns).Update(ctx, secret, metav1.UpdateOptions{}); err != nil {
 			return 0, fmt.Errorf("failed to update secret %s in namespace %s: %v", k.secret, k.ns, err)
 		}
@@ -98,13 +265,13 @@ func (k *K8s) Write(b []byte) (int, error) {
 // Read reads data from k8s store
 func (k *K8s) Read(b []byte) (int, error) {
 	if !k.ready {
-		ctx, cancel := context.WithTimeout(context.Background(), DefaultTimeout)
+		ctx, cancel := context.WithTimeout(context.Background(), k.timeout)
 		defer cancel()
 
 		secret, err := k.client.CoreV1().Secrets(k.ns).Get(ctx, k.secret, metav1.GetOptions{})
 
 		if errors.IsNotFound(err) {
-			return 0, fmt.Errorf("failed to find secret %s in namespace %s: %v", k.secret, k.ns, err)
+			return 0, &store.Error{Code: store.ErrNotFound, Msg: fmt.Errorf("failed to find secret %s in namespace %s: %v", k.secret, k.ns, err)}
 		}
 
 		if err != nil {
@@ -0,0 +1,154 @@
+package k8s
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/milosgajdos/vaultops/store"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestNewStoreWithClient(t *testing.T) {
+	client := fake.NewSimpleClientset()
+
+	s, err := NewStoreWithClient(client, "secret", "key", "default", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultTimeout, s.timeout)
+
+	for _, owner := range []string{"foo", "Job/", "/foo", "Job/foo/bar"} {
+		s, err = NewStoreWithClient(client, "secret", "key", "default", &Config{Owner: owner})
+		assert.Error(t, err)
+		assert.Nil(t, s)
+	}
+}
+
+func TestWriteRead(t *testing.T) {
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "vault-init",
+			Namespace: "vault",
+			UID:       types.UID("job-uid"),
+		},
+	}
+	client := fake.NewSimpleClientset(job)
+
+	c := &Config{
+		Labels:      map[string]string{"app": "vault"},
+		Annotations: map[string]string{"owner": "vaultops"},
+		Owner:       "Job/vault-init",
+	}
+	s, err := NewStoreWithClient(client, "secret", "key", "vault", c)
+	assert.NoError(t, err)
+
+	// non-existent secret
+	_, err = s.Read(make([]byte, 5))
+	serr, ok := err.(*store.Error)
+	assert.True(t, ok)
+	assert.Equal(t, store.ErrNotFound, serr.Code)
+
+	data := []byte("testdata")
+	n, err := s.Write(data)
+	assert.NoError(t, err)
+	assert.Equal(t, len(data), n)
+
+	secret, err := client.CoreV1().Secrets("vault").Get(context.Background(), "secret", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, c.Labels, secret.Labels)
+	assert.Equal(t, c.Annotations, secret.Annotations)
+	assert.Nil(t, secret.Immutable)
+	assert.Len(t, secret.OwnerReferences, 1)
+	assert.Equal(t, "Job", secret.OwnerReferences[0].Kind)
+	assert.Equal(t, "batch/v1", secret.OwnerReferences[0].APIVersion)
+	assert.Equal(t, types.UID("job-uid"), secret.OwnerReferences[0].UID)
+
+	out, err := ioutil.ReadAll(s)
+	assert.NoError(t, err)
+	assert.Equal(t, data, out)
+
+	// existing secret is updated
+	data = []byte("newdata")
+	_, err = s.Write(data)
+	assert.NoError(t, err)
+	out, err = ioutil.ReadAll(s)
+	assert.NoError(t, err)
+	assert.Equal(t, data, out)
+
+	// non-existent owner
+	s, err = NewStoreWithClient(client, "other", "key", "vault", &Config{Owner: "Pod/foo"})
+	assert.NoError(t, err)
+	_, err = s.Write(data)
+	assert.Error(t, err)
+
+	// unsupported owner kind
+	s, err = NewStoreWithClient(client, "other", "key", "vault", &Config{Owner: "Foo/foo"})
+	assert.NoError(t, err)
+	_, err = s.Write(data)
+	assert.Error(t, err)
+}
+
+func TestWriteImmutable(t *testing.T) {
+	client := fake.NewSimpleClientset()
+
+	s, err := NewStoreWithClient(client, "secret", "key", "default", &Config{Immutable: true})
+	assert.NoError(t, err)
+
+	data := []byte("testdata")
+	_, err = s.Write(data)
+	assert.NoError(t, err)
+
+	secret, err := client.CoreV1().Secrets("default").Get(context.Background(), "secret", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.True(t, *secret.Immutable)
+
+	// writing the same data is a noop
+	_, err = s.Write(data)
+	assert.NoError(t, err)
+
+	_, err = s.Write([]byte("newdata"))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "secret is immutable")
+}
+
+func TestNewConfig(t *testing.T) {
+	kubeconfig := `apiVersion: v1
+kind: Config
+clusters:
+- name: one
+  cluster:
+    server: https://one.example.com
+- name: two
+  cluster:
+    server: https://two.example.com
+contexts:
+- name: one
+  context:
+    cluster: one
+- name: two
+  context:
+    cluster: two
+current-context: one
+`
+	f, err := ioutil.TempFile("", "kubeconfig")
+	assert.NoError(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+	_, err = f.Write([]byte(kubeconfig))
+	assert.NoError(t, err)
+
+	cfg, err := NewConfig(f.Name(), "")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://one.example.com", cfg.Host)
+
+	cfg, err = NewConfig(f.Name(), "two")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://two.example.com", cfg.Host)
+
+	_, err = NewConfig(f.Name(), "foobar")
+	assert.Error(t, err)
+}
@@ -1,6 +1,7 @@
 package local
 
 import (
+	"io"
 	"os"
 	"path/filepath"
 )
@@ -27,11 +28,62 @@ func NewStore(path string) (*Local, error) {
 }
 
 // Write writes data to local store
+// It replaces any data previously stored in the store.
 func (l *Local) Write(b []byte) (n int, err error) {
-	return l.f.Write(b)
+	if err := l.f.Truncate(0); err != nil {
+		return 0, err
+	}
+
+	n, err = l.f.WriteAt(b, 0)
+	if err != nil {
+		return n, err
+	}
+
+	// the data is read from the beginning of the store
+	if _, err := l.f.Seek(0, io.SeekStart); err != nil {
+		return n, err
+	}
+
+	return n, nil
 }
 
 // Read reads data from local store
+// Once all data has been read the next Read starts from the beginning of the store.
 func (l *Local) Read(b []byte) (n int, err error) {
-	return l.f.Read(b)
+	n, err = l.f.Read(b)
+	if err != nil {
+		if _, serr := l.f.Seek(0, io.SeekStart); serr != nil {
+			return n, serr
+		}
+	}
+
+	return n, err
+}
+
+// WriteFrom replaces the data stored in local store with the data read from r
+func (l *Local) WriteFrom(r io.Reader) (int64, error) {
+	if err := l.f.Truncate(0); err != nil {
+		return 0, err
+	}
+
+	if _, err := l.f.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	n, err := io.Copy(l.f, r)
+	if err != nil {
+		return n, err
+	}
+
+	// the data is read from the beginning of the store
+	if _, err := l.f.Seek(0, io.SeekStart); err != nil {
+		return n, err
+	}
+
+	return n, nil
+}
+
+// Open returns reader which reads the data stored in local store
+func (l *Local) Open() (io.ReadCloser, error) {
+	return os.Open(l.f.Name())
 }
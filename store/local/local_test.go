@@ -1,8 +1,10 @@
 package local
 
 import (
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -49,3 +51,66 @@ func TestWriteRead(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, n, len(data))
 }
+
+func TestOverwrite(t *testing.T) {
+	dir := os.TempDir()
+	fileName := "file3.tmp"
+	path := filepath.Join(dir, fileName)
+
+	s, err := NewStore(path)
+	defer os.Remove(path)
+	assert.NoError(t, err)
+
+	_, err = s.Write([]byte("longer testdata"))
+	assert.NoError(t, err)
+
+	data, err := ioutil.ReadAll(s)
+	assert.NoError(t, err)
+	assert.Equal(t, "longer testdata", string(data))
+
+	// write replaces previously stored data without leaving any trailing bytes
+	_, err = s.Write([]byte("testdata"))
+	assert.NoError(t, err)
+
+	stored, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "testdata", string(stored))
+
+	data, err = ioutil.ReadAll(s)
+	assert.NoError(t, err)
+	assert.Equal(t, "testdata", string(data))
+
+	// the data can be read repeatedly
+	data, err = ioutil.ReadAll(s)
+	assert.NoError(t, err)
+	assert.Equal(t, "testdata", string(data))
+}
+
+func TestWriteFromOpen(t *testing.T) {
+	dir := os.TempDir()
+	fileName := "file4.tmp"
+	path := filepath.Join(dir, fileName)
+
+	s, err := NewStore(path)
+	defer os.Remove(path)
+	assert.NoError(t, err)
+
+	_, err = s.Write([]byte("longer testdata"))
+	assert.NoError(t, err)
+
+	// stream replaces previously stored data
+	n, err := s.WriteFrom(strings.NewReader("testdata"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len("testdata")), n)
+
+	r, err := s.Open()
+	assert.NoError(t, err)
+	data, err := ioutil.ReadAll(r)
+	assert.NoError(t, err)
+	assert.NoError(t, r.Close())
+	assert.Equal(t, "testdata", string(data))
+
+	data, err = ioutil.ReadAll(s)
+	assert.NoError(t, err)
+	assert.Equal(t, "testdata", string(data))
+}
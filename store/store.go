@@ -1,6 +1,9 @@
 package store
 
-import "fmt"
+import (
+	"fmt"
+	"io"
+)
 
 const (
 	// ErrNotFound signals the data could not be found
@@ -15,6 +18,15 @@ type Store interface {
 	Read(p []byte) (int, error)
 }
 
+// Streamer is implemented by stores which can store data of arbitrary size
+// without reading it into memory
+type Streamer interface {
+	// WriteFrom replaces the stored data with the data read from r until EOF
+	WriteFrom(r io.Reader) (int64, error)
+	// Open returns reader which reads the stored data
+	Open() (io.ReadCloser, error)
+}
+
 // ErrorCode defines Store operation error code
 type ErrorCode int
 
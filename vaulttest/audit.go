@@ -0,0 +1,119 @@
+package vaulttest
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// auditPath is the path prefix of audit device endpoints
+const auditPath = "/v1/sys/audit/"
+
+// AuditDevices returns the audit devices enabled in the server keyed by their paths.
+// The paths end with a slash just like the paths returned by Vault.
+func (s *Server) AuditDevices() map[string]*api.Audit {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	devices := make(map[string]*api.Audit, len(s.audit))
+	for path, a := range s.audit {
+		devices[path] = copyAudit(a)
+	}
+
+	return devices
+}
+
+// EnableAudit enables audit device at path as if it was enabled via the API
+func (s *Server) EnableAudit(path string, opts *api.EnableAuditOptions) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.enableAudit(path, opts)
+}
+
+// enableAudit enables audit device at path. It must be called with s.mu held.
+func (s *Server) enableAudit(path string, opts *api.EnableAuditOptions) {
+	path = strings.Trim(path, "/") + "/"
+	if s.audit == nil {
+		s.audit = make(map[string]*api.Audit)
+	}
+
+	s.audit[path] = copyAudit(&api.Audit{
+		Type:        opts.Type,
+		Description: opts.Description,
+		Options:     opts.Options,
+		Local:       opts.Local,
+		Path:        path,
+	})
+}
+
+// copyAudit returns a copy of audit device a
+func copyAudit(a *api.Audit) *api.Audit {
+	c := *a
+	c.Options = make(map[string]string, len(a.Options))
+	for k, v := range a.Options {
+		c.Options[k] = v
+	}
+
+	return &c
+}
+
+func (s *Server) handleAudit(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.initialized || s.sealed {
+		respondError(w, http.StatusServiceUnavailable, "Vault is sealed")
+		return
+	}
+
+	if !s.authorized(r) {
+		respondError(w, http.StatusForbidden, "permission denied")
+		return
+	}
+
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, strings.TrimSuffix(auditPath, "/")), "/")
+	if path == "" {
+		if r.Method != http.MethodGet {
+			respondError(w, http.StatusMethodNotAllowed, "unsupported operation")
+			return
+		}
+
+		data := make(map[string]interface{}, len(s.audit))
+		for p, a := range s.audit {
+			data[p] = a
+		}
+		respond(w, http.StatusOK, map[string]interface{}{"data": data})
+		return
+	}
+	path += "/"
+
+	switch r.Method {
+	case http.MethodPut, http.MethodPost:
+		var opts api.EnableAuditOptions
+		if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		switch {
+		case opts.Type == "":
+			respondError(w, http.StatusBadRequest, "type is missing")
+			return
+		case s.audit[path] != nil:
+			respondError(w, http.StatusBadRequest, "path already in use")
+			return
+		}
+
+		s.enableAudit(path, &opts)
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		// disabling audit device which is not enabled is not an error
+		delete(s.audit, path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		respondError(w, http.StatusMethodNotAllowed, "unsupported operation")
+	}
+}
@@ -0,0 +1,127 @@
+package vaulttest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// authPath is the path prefix of auth method endpoints
+const authPath = "/v1/auth/"
+
+// LoginFunc checks the data sent to the login endpoint of an auth method.
+// It returns the token to issue or error if the login is rejected.
+type LoginFunc func(data map[string]interface{}) (*Token, error)
+
+// EnableAuth enables auth method mounted at path which checks the logins with login
+func (s *Server) EnableAuth(path string, login LoginFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.auth == nil {
+		s.auth = make(map[string]LoginFunc)
+	}
+	s.auth[strings.Trim(path, "/")] = login
+}
+
+// leaseDuration returns the lease duration of token t in seconds
+func leaseDuration(t *Token) int {
+	if t.Period > 0 {
+		return int(t.Period.Seconds())
+	}
+
+	return int(t.TTL.Seconds())
+}
+
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	path := strings.TrimPrefix(r.URL.Path, "/v1/")
+	mount := strings.Trim(strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, authPath), "login"), "/")
+	login, ok := s.auth[mount]
+	ready := s.initialized && !s.sealed
+	s.mu.Unlock()
+
+	if !ok || !strings.HasSuffix(r.URL.Path, "/login") {
+		respondError(w, http.StatusNotFound, fmt.Sprintf("no handler for route '%s'", path))
+		return
+	}
+
+	if r.Method != http.MethodPut && r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, "unsupported operation")
+		return
+	}
+
+	if !ready {
+		respondError(w, http.StatusServiceUnavailable, "Vault is sealed")
+		return
+	}
+
+	data := make(map[string]interface{})
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// login is called without holding the lock so it can inspect the server
+	t, err := login(data)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	token := "s." + randString(24)
+	s.mu.Lock()
+	s.addToken(token, t)
+	s.mu.Unlock()
+
+	respond(w, http.StatusOK, map[string]interface{}{
+		"auth": map[string]interface{}{
+			"client_token":   token,
+			"accessor":       randString(24),
+			"policies":       t.Policies,
+			"token_policies": t.Policies,
+			"lease_duration": leaseDuration(t),
+			"renewable":      leaseDuration(t) > 0,
+			"orphan":         t.Orphan,
+		},
+	})
+}
+
+func (s *Server) handleTokenRenewSelf(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.Method != http.MethodPut && r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, "unsupported operation")
+		return
+	}
+
+	if !s.initialized || s.sealed {
+		respondError(w, http.StatusServiceUnavailable, "Vault is sealed")
+		return
+	}
+
+	if !s.authorized(r) {
+		respondError(w, http.StatusForbidden, "permission denied")
+		return
+	}
+
+	token := r.Header.Get("X-Vault-Token")
+	t, ok := s.tokens[token]
+	if !ok || leaseDuration(t) == 0 {
+		respondError(w, http.StatusBadRequest, "lease is not renewable")
+		return
+	}
+
+	respond(w, http.StatusOK, map[string]interface{}{
+		"auth": map[string]interface{}{
+			"client_token":   token,
+			"policies":       t.Policies,
+			"token_policies": t.Policies,
+			"lease_duration": leaseDuration(t),
+			"renewable":      true,
+			"orphan":         t.Orphan,
+		},
+	})
+}
@@ -0,0 +1,146 @@
+package vaulttest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// OTPLength is the length of the one-time password which encodes the generated root tokens.
+// It matches the length of the tokens issued by the fake server.
+const OTPLength = 26
+
+// generateRoot holds the state of the root token generation
+type generateRoot struct {
+	nonce     string
+	otp       string
+	submitted []string
+}
+
+func (s *Server) handleGenerateRootAttempt(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodGet:
+		respond(w, http.StatusOK, s.generateRootStatus())
+	case http.MethodPut, http.MethodPost:
+		if !s.initialized || s.sealed {
+			respondError(w, http.StatusBadRequest, "Vault is sealed")
+			return
+		}
+
+		if s.generateRoot != nil {
+			respondError(w, http.StatusBadRequest, "root generation already in progress")
+			return
+		}
+
+		req := struct {
+			OTP    string `json:"otp"`
+			PGPKey string `json:"pgp_key"`
+		}{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		// unlike Vault, the fake server neither generates the one-time
+		// password nor encrypts the root token with a PGP key
+		if req.PGPKey != "" {
+			respondError(w, http.StatusBadRequest, "pgp_key is not supported")
+			return
+		}
+
+		if len(req.OTP) != OTPLength {
+			respondError(w, http.StatusBadRequest, "OTP string is wrong length")
+			return
+		}
+
+		s.generateRoot = &generateRoot{nonce: uuid(), otp: req.OTP}
+
+		respond(w, http.StatusOK, s.generateRootStatus())
+	case http.MethodDelete:
+		s.generateRoot = nil
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		respondError(w, http.StatusMethodNotAllowed, "unsupported operation")
+	}
+}
+
+func (s *Server) handleGenerateRootUpdate(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.Method != http.MethodPut && r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, "unsupported operation")
+		return
+	}
+
+	if s.generateRoot == nil {
+		respondError(w, http.StatusBadRequest, "no root generation in progress")
+		return
+	}
+
+	req := struct {
+		Key   string `json:"key"`
+		Nonce string `json:"nonce"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if req.Nonce != s.generateRoot.nonce {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("incorrect nonce supplied; nonce for this root generation operation is %s", s.generateRoot.nonce))
+		return
+	}
+
+	key, err := s.lookupKey(req.Key)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	for _, k := range s.generateRoot.submitted {
+		if k == key {
+			respondError(w, http.StatusBadRequest, "given key has already been provided during this generation operation")
+			return
+		}
+	}
+	s.generateRoot.submitted = append(s.generateRoot.submitted, key)
+
+	resp := s.generateRootStatus()
+	if len(s.generateRoot.submitted) >= s.threshold {
+		token := "s." + randString(OTPLength-2)
+		s.addToken(token, &Token{Policies: []string{"root"}, Orphan: true, DisplayName: "root"})
+
+		encoded := make([]byte, len(token))
+		for i := range encoded {
+			encoded[i] = token[i] ^ s.generateRoot.otp[i]
+		}
+		s.generateRoot = nil
+
+		resp.Complete = true
+		resp.EncodedToken = base64.RawStdEncoding.EncodeToString(encoded)
+		resp.EncodedRootToken = resp.EncodedToken
+	}
+
+	respond(w, http.StatusOK, resp)
+}
+
+// generateRootStatus returns current root token generation status. It must be called with s.mu held.
+func (s *Server) generateRootStatus() *api.GenerateRootStatusResponse {
+	status := &api.GenerateRootStatusResponse{Required: s.threshold, OTPLength: OTPLength}
+	if s.generateRoot == nil {
+		return status
+	}
+
+	status.Nonce = s.generateRoot.nonce
+	status.Started = true
+	status.Progress = len(s.generateRoot.submitted)
+
+	return status
+}
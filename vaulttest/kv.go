@@ -0,0 +1,187 @@
+package vaulttest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// kvMount is KV secrets engine mounted in the fake server
+type kvMount struct {
+	version int
+	secrets map[string]*kvSecret
+}
+
+// kvSecret is KV secret; KV version 1 secrets have a single version
+type kvSecret struct {
+	data    map[string]interface{}
+	version int
+}
+
+// MountKV mounts KV secrets engine of the given version (1 or 2) at path
+func (s *Server) MountKV(path string, version int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.kv == nil {
+		s.kv = make(map[string]*kvMount)
+	}
+	s.kv[strings.Trim(path, "/")] = &kvMount{version: version, secrets: make(map[string]*kvSecret)}
+}
+
+// KVSecret returns the data and the version of the secret stored at path which is prefixed with its mount path.
+// The version of KV version 1 secrets is always 1. It returns false if the secret does not exist.
+func (s *Server) KVSecret(path string) (map[string]interface{}, int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, key := s.kvLookup(path)
+	if m == nil || m.secrets[key] == nil {
+		return nil, 0, false
+	}
+	sec := m.secrets[key]
+
+	return copyData(sec.data), sec.version, true
+}
+
+// WriteKV writes data to secret stored at path which is prefixed with its mount path as if it was written via the API
+func (s *Server) WriteKV(path string, data map[string]interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, key := s.kvLookup(path)
+	if m == nil {
+		return fmt.Errorf("no KV secrets engine mounted at %s", path)
+	}
+	m.write(key, data)
+
+	return nil
+}
+
+// kvLookup returns KV mount of path and the path of the secret in the mount.
+// It returns nil mount if no KV secrets engine is mounted at path. It must be called with s.mu held.
+func (s *Server) kvLookup(path string) (*kvMount, string) {
+	path = strings.Trim(path, "/")
+	for mount, m := range s.kv {
+		if strings.HasPrefix(path, mount+"/") {
+			return m, strings.TrimPrefix(path, mount+"/")
+		}
+	}
+
+	return nil, ""
+}
+
+// write writes data to secret stored at key and returns its new version
+func (m *kvMount) write(key string, data map[string]interface{}) int {
+	sec, ok := m.secrets[key]
+	if !ok {
+		sec = new(kvSecret)
+		m.secrets[key] = sec
+	}
+
+	sec.data = copyData(data)
+	if m.version == 1 {
+		sec.version = 1
+	} else {
+		sec.version++
+	}
+
+	return sec.version
+}
+
+// copyData returns a copy of secret data
+func copyData(data map[string]interface{}) map[string]interface{} {
+	c := make(map[string]interface{}, len(data))
+	for k, v := range data {
+		c[k] = v
+	}
+
+	return c
+}
+
+func (s *Server) handleKV(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.initialized || s.sealed {
+		respondError(w, http.StatusServiceUnavailable, "Vault is sealed")
+		return
+	}
+
+	if !s.authorized(r) {
+		respondError(w, http.StatusForbidden, "permission denied")
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/v1/")
+	m, key := s.kvLookup(path)
+	if m == nil {
+		respondError(w, http.StatusNotFound, fmt.Sprintf("no handler for route '%s'", path))
+		return
+	}
+
+	if m.version == 2 {
+		if !strings.HasPrefix(key, "data/") {
+			respondError(w, http.StatusNotFound, "unsupported path")
+			return
+		}
+		key = strings.TrimPrefix(key, "data/")
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		sec, ok := m.secrets[key]
+		if !ok {
+			respond(w, http.StatusNotFound, map[string]interface{}{"errors": []string{}})
+			return
+		}
+
+		if m.version == 1 {
+			respond(w, http.StatusOK, map[string]interface{}{"data": sec.data})
+			return
+		}
+		respond(w, http.StatusOK, map[string]interface{}{
+			"data": map[string]interface{}{
+				"data":     sec.data,
+				"metadata": map[string]interface{}{"version": sec.version},
+			},
+		})
+	case http.MethodPut, http.MethodPost:
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if m.version == 1 {
+			m.write(key, body)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		data, ok := body["data"].(map[string]interface{})
+		if !ok {
+			respondError(w, http.StatusBadRequest, "no data provided")
+			return
+		}
+
+		if opts, ok := body["options"].(map[string]interface{}); ok {
+			if cas, ok := opts["cas"].(float64); ok {
+				var version int
+				if sec, ok := m.secrets[key]; ok {
+					version = sec.version
+				}
+				if int(cas) != version {
+					respondError(w, http.StatusBadRequest, "check-and-set parameter did not match the current version")
+					return
+				}
+			}
+		}
+
+		version := m.write(key, data)
+		respond(w, http.StatusOK, map[string]interface{}{"data": map[string]interface{}{"version": version}})
+	default:
+		respondError(w, http.StatusMethodNotAllowed, "unsupported operation")
+	}
+}
@@ -0,0 +1,304 @@
+package vaulttest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// registry keeps track of all running fake servers so that
+// the servers can join each other's raft clusters via their URLs
+var registry = struct {
+	sync.Mutex
+	servers map[string]*Server
+	nodes   int
+}{
+	servers: make(map[string]*Server),
+}
+
+// RaftServer is a raft cluster member as reported by the raft configuration endpoint
+type RaftServer struct {
+	NodeID          string `json:"node_id"`
+	Address         string `json:"address"`
+	Leader          bool   `json:"leader"`
+	Voter           bool   `json:"voter"`
+	ProtocolVersion string `json:"protocol_version"`
+}
+
+// register adds s to the servers registry and assigns it a raft node ID
+func register(s *Server) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	s.nodeID = fmt.Sprintf("node%d", registry.nodes)
+	registry.nodes++
+	registry.servers[s.URL] = s
+}
+
+// unregister removes s from the servers registry
+func unregister(s *Server) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	delete(registry.servers, s.URL)
+}
+
+// lookupServer returns a running server with the given URL
+func lookupServer(url string) (*Server, bool) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	s, ok := registry.servers[strings.TrimSuffix(url, "/")]
+
+	return s, ok
+}
+
+// RaftSnapshot returns the current raft snapshot of the server
+// The snapshot is opaque data which is replaced when a snapshot is restored.
+func (s *Server) RaftSnapshot() []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]byte(nil), s.snapshot...)
+}
+
+// SetRaftSnapshot replaces the raft snapshot of the server with a new one
+// which emulates changes of the data stored in the server.
+func (s *Server) SetRaftSnapshot() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.snapshot = newSnapshot(s.clusterID)
+}
+
+// SetNonVoter makes the server join raft clusters as a non-voter.
+// It must be called before the server is unsealed after joining the cluster.
+func (s *Server) SetNonVoter(nonVoter bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nonVoter = nonVoter
+}
+
+// NodeID returns raft node ID of the server
+func (s *Server) NodeID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.nodeID
+}
+
+// JoinRequest returns the last raft join request the server accepted or nil
+func (s *Server) JoinRequest() *api.RaftJoinRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.join == nil {
+		return nil
+	}
+	join := *s.join
+
+	return &join
+}
+
+// RaftServers returns the raft configuration of the cluster the server is a member of
+func (s *Server) RaftServers() []RaftServer {
+	s.mu.Lock()
+	leader := s.raftLeader
+	s.mu.Unlock()
+
+	if leader != nil {
+		return leader.RaftServers()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.raftServers()
+}
+
+// raftServers returns raft configuration of the leader. It must be called with s.mu held.
+func (s *Server) raftServers() []RaftServer {
+	servers := []RaftServer{{
+		NodeID:          s.nodeID,
+		Address:         strings.TrimPrefix(s.URL, "http://"),
+		Leader:          true,
+		Voter:           true,
+		ProtocolVersion: "3",
+	}}
+
+	return append(servers, s.raftPeers...)
+}
+
+// addRaftPeer adds peer to the raft configuration of the leader
+func (s *Server) addRaftPeer(peer RaftServer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.raftPeers {
+		if s.raftPeers[i].NodeID == peer.NodeID {
+			s.raftPeers[i] = peer
+			return
+		}
+	}
+
+	s.raftPeers = append(s.raftPeers, peer)
+}
+
+// joinRaftCluster adds the unsealed server into the raft cluster it has joined.
+// It must be called with s.mu held.
+func (s *Server) joinRaftCluster() {
+	if s.raftLeader == nil {
+		return
+	}
+
+	s.standby = true
+	s.raftLeader.addRaftPeer(RaftServer{
+		NodeID:          s.nodeID,
+		Address:         strings.TrimPrefix(s.URL, "http://"),
+		Voter:           !s.nonVoter,
+		ProtocolVersion: "3",
+	})
+}
+
+func (s *Server) handleRaftJoin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut && r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, "unsupported operation")
+		return
+	}
+
+	req := new(api.RaftJoinRequest)
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if req.LeaderAPIAddr == "" {
+		respondError(w, http.StatusBadRequest, "'leader_api_addr' parameter not supplied")
+		return
+	}
+
+	leader, ok := lookupServer(req.LeaderAPIAddr)
+	if !ok || leader == s {
+		respondError(w, http.StatusInternalServerError, fmt.Sprintf("failed to join raft cluster: leader %s not found", req.LeaderAPIAddr))
+		return
+	}
+
+	// the leader must be initialized and unsealed to accept new nodes
+	leader.mu.Lock()
+	ready := leader.initialized && !leader.sealed && leader.raftLeader == nil
+	shares, threshold := leader.shares, leader.threshold
+	keys, rootToken := copyKeys(leader.keys), leader.rootToken
+	clusterID, snapshot := leader.clusterID, leader.snapshot
+	leader.mu.Unlock()
+
+	if !ready {
+		respondError(w, http.StatusInternalServerError, fmt.Sprintf("failed to join raft cluster: leader %s is not active", req.LeaderAPIAddr))
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.initialized {
+		respondError(w, http.StatusBadRequest, "raft storage is already initialized")
+		return
+	}
+
+	// joined node shares the seal configuration of the leader
+	s.initialized = true
+	s.sealed = true
+	s.shares, s.threshold = shares, threshold
+	s.keys, s.rootToken = keys, rootToken
+	s.clusterID, s.snapshot = clusterID, snapshot
+	s.raftLeader = leader
+	s.join = req
+	s.resetUnseal()
+
+	respond(w, http.StatusOK, &api.RaftJoinResponse{Joined: true})
+}
+
+func (s *Server) handleRaftConfiguration(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, "unsupported operation")
+		return
+	}
+
+	s.mu.Lock()
+	ready := s.initialized && !s.sealed
+	s.mu.Unlock()
+
+	if !ready {
+		respondError(w, http.StatusServiceUnavailable, "Vault is sealed")
+		return
+	}
+
+	respond(w, http.StatusOK, map[string]interface{}{
+		"data": map[string]interface{}{
+			"config": map[string]interface{}{
+				"index":   1,
+				"servers": s.RaftServers(),
+			},
+		},
+	})
+}
+
+func (s *Server) handleRaftSnapshot(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.initialized || s.sealed {
+		respondError(w, http.StatusServiceUnavailable, "Vault is sealed")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		if r.URL.Path != "/v1/sys/storage/raft/snapshot" {
+			respondError(w, http.StatusMethodNotAllowed, "unsupported operation")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/gzip")
+		w.WriteHeader(http.StatusOK)
+		// nolint:errcheck
+		w.Write(s.snapshot)
+	case http.MethodPut, http.MethodPost:
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if !bytes.HasPrefix(data, []byte(snapshotPrefix)) {
+			respondError(w, http.StatusBadRequest, "failed to read snapshot file: invalid snapshot")
+			return
+		}
+
+		// only forced restore accepts snapshots of other clusters
+		force := strings.HasSuffix(r.URL.Path, "-force")
+		if !force && !bytes.HasPrefix(data, []byte(snapshotPrefix+s.clusterID)) {
+			respondError(w, http.StatusBadRequest, "failed to verify snapshot: snapshot is from a different cluster")
+			return
+		}
+
+		s.snapshot = data
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		respondError(w, http.StatusMethodNotAllowed, "unsupported operation")
+	}
+}
+
+// snapshotPrefix prefixes fake raft snapshots
+const snapshotPrefix = "vaulttest snapshot "
+
+// newSnapshot returns new fake raft snapshot of cluster with the given ID
+func newSnapshot(clusterID string) []byte {
+	return []byte(snapshotPrefix + clusterID + " " + randString(32))
+}
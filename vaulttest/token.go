@@ -0,0 +1,211 @@
+package vaulttest
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// policyPath is the path prefix of ACL policy endpoints
+const policyPath = "/v1/sys/policies/acl/"
+
+// Token is a token created via the token auth method or issued by an auth method login.
+// The fake server does not enforce token policies: any valid token is authorized.
+type Token struct {
+	// Policies are the token policies
+	Policies []string
+	// Period is the token period; zero for non-periodic tokens
+	Period time.Duration
+	// TTL is the token time to live; zero for tokens which are not renewable.
+	// The fake server doesn't expire tokens.
+	TTL time.Duration
+	// Orphan is true if the token has no parent
+	Orphan bool
+	// DisplayName is the token display name
+	DisplayName string
+}
+
+// Policy returns the rules of the named ACL policy and true if the policy exists
+func (s *Server) Policy(name string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rules, ok := s.policies[name]
+
+	return rules, ok
+}
+
+// Token returns the token created via the token auth method or issued by an auth method login
+// and true if the token is valid
+func (s *Server) Token(token string) (*Token, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.tokens[token]
+	if !ok {
+		return nil, false
+	}
+	c := *t
+	c.Policies = append([]string(nil), t.Policies...)
+
+	return &c, true
+}
+
+// AddToken makes token valid as if it was created via the token auth method.
+// This is handy for emulating tokens replicated to all the nodes of a cluster.
+func (s *Server) AddToken(token string, t *Token) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.addToken(token, t)
+}
+
+// addToken stores token t. It must be called with s.mu held.
+func (s *Server) addToken(token string, t *Token) {
+	if s.tokens == nil {
+		s.tokens = make(map[string]*Token)
+	}
+	c := *t
+	c.Policies = append([]string(nil), t.Policies...)
+	s.tokens[token] = &c
+}
+
+func (s *Server) handlePolicy(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.initialized || s.sealed {
+		respondError(w, http.StatusServiceUnavailable, "Vault is sealed")
+		return
+	}
+
+	if !s.authorized(r) {
+		respondError(w, http.StatusForbidden, "permission denied")
+		return
+	}
+
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, policyPath), "/")
+	if name == "" {
+		respondError(w, http.StatusBadRequest, "policy name is missing")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		rules, ok := s.policies[name]
+		if !ok {
+			respond(w, http.StatusNotFound, map[string]interface{}{"errors": []string{}})
+			return
+		}
+		respond(w, http.StatusOK, map[string]interface{}{"data": map[string]interface{}{"name": name, "policy": rules}})
+	case http.MethodPut, http.MethodPost:
+		var body struct {
+			Policy string `json:"policy"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if body.Policy == "" {
+			respondError(w, http.StatusBadRequest, "'policy' parameter not supplied or empty")
+			return
+		}
+
+		if s.policies == nil {
+			s.policies = make(map[string]string)
+		}
+		s.policies[name] = body.Policy
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		delete(s.policies, name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		respondError(w, http.StatusMethodNotAllowed, "unsupported operation")
+	}
+}
+
+func (s *Server) handleTokenCreateOrphan(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.Method != http.MethodPut && r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, "unsupported operation")
+		return
+	}
+
+	if !s.initialized || s.sealed {
+		respondError(w, http.StatusServiceUnavailable, "Vault is sealed")
+		return
+	}
+
+	if !s.authorized(r) {
+		respondError(w, http.StatusForbidden, "permission denied")
+		return
+	}
+
+	var req api.TokenCreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var period time.Duration
+	if req.Period != "" {
+		var err error
+		if period, err = time.ParseDuration(req.Period); err != nil {
+			respondError(w, http.StatusBadRequest, "invalid period: "+err.Error())
+			return
+		}
+	}
+
+	policies := req.Policies
+	if !req.NoDefaultPolicy {
+		policies = append([]string{"default"}, policies...)
+	}
+
+	token := "s." + randString(24)
+	s.addToken(token, &Token{Policies: policies, Period: period, Orphan: true, DisplayName: req.DisplayName})
+
+	respond(w, http.StatusOK, map[string]interface{}{
+		"auth": map[string]interface{}{
+			"client_token":   token,
+			"accessor":       randString(24),
+			"policies":       policies,
+			"token_policies": policies,
+			"lease_duration": int(period.Seconds()),
+			"renewable":      period > 0,
+			"orphan":         true,
+		},
+	})
+}
+
+func (s *Server) handleTokenRevokeSelf(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.Method != http.MethodPut && r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, "unsupported operation")
+		return
+	}
+
+	if !s.initialized || s.sealed {
+		respondError(w, http.StatusServiceUnavailable, "Vault is sealed")
+		return
+	}
+
+	if !s.authorized(r) {
+		respondError(w, http.StatusForbidden, "permission denied")
+		return
+	}
+
+	token := r.Header.Get("X-Vault-Token")
+	if token == s.rootToken {
+		s.rootToken = ""
+	}
+	delete(s.tokens, token)
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,812 @@
+// Package vaulttest provides an in-process fake Vault server which can be used
+// to test code that talks to Vault via its HTTP API.
+//
+// The fake server emulates a small subset of Vault system endpoints and lets the
+// tests script its state: whether it's initialized or sealed, what its unseal
+// threshold is, how long each request takes and which requests should fail.
+// Several fake servers can form an integrated storage (raft) cluster by joining
+// each other via the raft join endpoint. The fake server also keeps track
+// of the audit devices enabled via the audit endpoints, the ACL policies and the
+// tokens created via the token auth method and emulates KV secrets engines mounted
+// via MountKV and auth methods enabled via EnableAuth. Root tokens generated via the
+// generate-root endpoints are encoded with the one-time password of OTPLength.
+package vaulttest
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+const (
+	// DefaultVersion is the Vault version reported by the fake server
+	DefaultVersion = "1.5.0"
+	// keyLength is the length of generated unseal keys in bytes
+	keyLength = 33
+)
+
+// failure is a scripted request failure
+type failure struct {
+	code  int
+	count int
+}
+
+// rekey holds the state of the rekey operation
+type rekey struct {
+	nonce     string
+	shares    int
+	threshold int
+	submitted []string
+}
+
+// Server is a fake Vault server
+type Server struct {
+	// URL is the base URL of the fake server
+	URL string
+
+	srv *httptest.Server
+	mux *http.ServeMux
+
+	mu           sync.Mutex
+	initialized  bool
+	sealed       bool
+	standby      bool
+	perfStandby  bool
+	shares       int
+	threshold    int
+	keys         []string
+	rootToken    string
+	version      string
+	nonce        string
+	submitted    []string
+	rekey        *rekey
+	generateRoot *generateRoot
+	latency      time.Duration
+	delays       map[string]time.Duration
+	failures     map[string]*failure
+	requests     map[string]int
+	nodeID       string
+	nonVoter     bool
+	raftLeader   *Server
+	raftPeers    []RaftServer
+	join         *api.RaftJoinRequest
+	clusterID    string
+	snapshot     []byte
+	audit        map[string]*api.Audit
+	kv           map[string]*kvMount
+	policies     map[string]string
+	tokens       map[string]*Token
+	auth         map[string]LoginFunc
+}
+
+// NewServer starts a new uninitialized fake Vault server and returns it.
+// The server must be closed by calling Close when it's no longer needed.
+func NewServer() *Server {
+	s := &Server{
+		sealed:   true,
+		version:  DefaultVersion,
+		delays:   make(map[string]time.Duration),
+		failures: make(map[string]*failure),
+		requests: make(map[string]int),
+	}
+
+	s.mux = http.NewServeMux()
+	s.mux.HandleFunc("/v1/sys/init", s.handleInit)
+	s.mux.HandleFunc("/v1/sys/seal-status", s.handleSealStatus)
+	s.mux.HandleFunc("/v1/sys/unseal", s.handleUnseal)
+	s.mux.HandleFunc("/v1/sys/seal", s.handleSeal)
+	s.mux.HandleFunc("/v1/sys/step-down", s.handleStepDown)
+	s.mux.HandleFunc("/v1/sys/health", s.handleHealth)
+	s.mux.HandleFunc("/v1/sys/leader", s.handleLeader)
+	s.mux.HandleFunc("/v1/sys/rekey/init", s.handleRekeyInit)
+	s.mux.HandleFunc("/v1/sys/rekey/update", s.handleRekeyUpdate)
+	s.mux.HandleFunc("/v1/sys/generate-root/attempt", s.handleGenerateRootAttempt)
+	s.mux.HandleFunc("/v1/sys/generate-root/update", s.handleGenerateRootUpdate)
+	s.mux.HandleFunc("/v1/sys/storage/raft/join", s.handleRaftJoin)
+	s.mux.HandleFunc("/v1/sys/storage/raft/configuration", s.handleRaftConfiguration)
+	s.mux.HandleFunc("/v1/sys/storage/raft/snapshot", s.handleRaftSnapshot)
+	s.mux.HandleFunc("/v1/sys/storage/raft/snapshot-force", s.handleRaftSnapshot)
+	s.mux.HandleFunc("/v1/sys/audit", s.handleAudit)
+	s.mux.HandleFunc(auditPath, s.handleAudit)
+	s.mux.HandleFunc(policyPath, s.handlePolicy)
+	s.mux.HandleFunc("/v1/auth/token/create-orphan", s.handleTokenCreateOrphan)
+	s.mux.HandleFunc("/v1/auth/token/revoke-self", s.handleTokenRevokeSelf)
+	s.mux.HandleFunc("/v1/auth/token/renew-self", s.handleTokenRenewSelf)
+	s.mux.HandleFunc(authPath, s.handleLogin)
+	// all the other paths are served by the mounted KV secrets engines
+	s.mux.HandleFunc("/v1/", s.handleKV)
+
+	s.srv = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = s.srv.URL
+	register(s)
+
+	return s
+}
+
+// Close shuts down the fake server
+func (s *Server) Close() {
+	unregister(s)
+	s.srv.Close()
+}
+
+// Initialize initializes the server with given number of key shares and threshold.
+// The server remains sealed. It returns the generated unseal keys and root token.
+func (s *Server) Initialize(shares, threshold int) ([]string, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.initialize(shares, threshold)
+
+	return copyKeys(s.keys), s.rootToken
+}
+
+// InitializeWithKeys initializes the server with the given hex encoded unseal keys,
+// unseal threshold and root token. This is handy for emulating several nodes of
+// the same Vault cluster which share the unseal keys. The server remains sealed.
+func (s *Server) InitializeWithKeys(keys []string, threshold int, rootToken string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.initialize(len(keys), threshold)
+	s.keys = copyKeys(keys)
+	s.rootToken = rootToken
+}
+
+// SetSealed changes the seal state of the server
+func (s *Server) SetSealed(sealed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sealed = sealed
+	s.resetUnseal()
+}
+
+// SetStandby marks the server as a standby node
+func (s *Server) SetStandby(standby bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.standby = standby
+}
+
+// SetPerfStandby marks the server as a performance standby node.
+// Performance standby nodes are standby nodes which service read-only requests.
+func (s *Server) SetPerfStandby(perfStandby bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.perfStandby = perfStandby
+	if perfStandby {
+		s.standby = true
+	}
+}
+
+// SetVersion sets the Vault version reported by the server
+func (s *Server) SetVersion(version string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.version = version
+}
+
+// SetLatency delays every response of the server by d
+func (s *Server) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.latency = d
+}
+
+// SetPathLatency delays the responses to the requests to path by d on top of the
+// latency set via SetLatency. The path is the API path without query e.g. /v1/sys/init
+func (s *Server) SetPathLatency(path string, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if d <= 0 {
+		delete(s.delays, path)
+		return
+	}
+
+	s.delays[path] = d
+}
+
+// Fail makes the next count requests to path fail with HTTP status code.
+// If count is negative all the requests to path fail until Fail is called
+// again with zero count. The path is the API path without query e.g. /v1/sys/init
+func (s *Server) Fail(path string, code, count int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if count == 0 {
+		delete(s.failures, path)
+		return
+	}
+
+	s.failures[path] = &failure{code: code, count: count}
+}
+
+// Requests returns the number of requests the server received on path
+func (s *Server) Requests(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.requests[path]
+}
+
+// Initialized returns true if the server has been initialized
+func (s *Server) Initialized() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.initialized
+}
+
+// Sealed returns true if the server is sealed
+func (s *Server) Sealed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.sealed
+}
+
+// Standby returns true if the server is a standby node
+func (s *Server) Standby() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.standby
+}
+
+// Progress returns the number of unseal keys submitted in the current unseal attempt
+func (s *Server) Progress() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.submitted)
+}
+
+// Keys returns a copy of the hex encoded unseal keys of the server
+func (s *Server) Keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return copyKeys(s.keys)
+}
+
+// RootToken returns the server root token
+func (s *Server) RootToken() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.rootToken
+}
+
+// serveHTTP records the request, applies the scripted latency and failures
+// and dispatches the request to the endpoint handlers
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests[r.URL.Path]++
+	latency := s.latency + s.delays[r.URL.Path]
+	var code int
+	if f, ok := s.failures[r.URL.Path]; ok {
+		code = f.code
+		if f.count > 0 {
+			f.count--
+			if f.count == 0 {
+				delete(s.failures, r.URL.Path)
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	if latency > 0 {
+		time.Sleep(latency)
+	}
+
+	if code != 0 {
+		respondError(w, code, fmt.Sprintf("scripted failure of %s", r.URL.Path))
+		return
+	}
+
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) handleInit(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodGet:
+		respond(w, http.StatusOK, &api.InitStatusResponse{Initialized: s.initialized})
+	case http.MethodPut, http.MethodPost:
+		if s.initialized {
+			respondError(w, http.StatusBadRequest, "Vault is already initialized")
+			return
+		}
+
+		req := new(api.InitRequest)
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if req.SecretShares < 1 || req.SecretThreshold < 1 || req.SecretThreshold > req.SecretShares {
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("invalid seal configuration: shares %d, threshold %d",
+				req.SecretShares, req.SecretThreshold))
+			return
+		}
+
+		s.initialize(req.SecretShares, req.SecretThreshold)
+
+		respond(w, http.StatusOK, &api.InitResponse{
+			Keys:      copyKeys(s.keys),
+			KeysB64:   b64Keys(s.keys),
+			RootToken: s.rootToken,
+		})
+	default:
+		respondError(w, http.StatusMethodNotAllowed, "unsupported operation")
+	}
+}
+
+func (s *Server) handleSealStatus(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	respond(w, http.StatusOK, s.sealStatus())
+}
+
+func (s *Server) handleUnseal(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.Method != http.MethodPut && r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, "unsupported operation")
+		return
+	}
+
+	req := new(api.UnsealOpts)
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if !s.initialized {
+		respondError(w, http.StatusBadRequest, "Vault is not initialized")
+		return
+	}
+
+	if req.Reset {
+		s.resetUnseal()
+		respond(w, http.StatusOK, s.sealStatus())
+		return
+	}
+
+	if !s.sealed {
+		respond(w, http.StatusOK, s.sealStatus())
+		return
+	}
+
+	key, err := s.lookupKey(req.Key)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if s.nonce == "" {
+		s.nonce = uuid()
+	}
+
+	// Vault silently ignores the keys which have already been
+	// submitted in the current unseal attempt
+	for _, k := range s.submitted {
+		if k == key {
+			respond(w, http.StatusOK, s.sealStatus())
+			return
+		}
+	}
+	s.submitted = append(s.submitted, key)
+
+	if len(s.submitted) >= s.threshold {
+		s.sealed = false
+		s.resetUnseal()
+		s.joinRaftCluster()
+	}
+
+	respond(w, http.StatusOK, s.sealStatus())
+}
+
+func (s *Server) handleSeal(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.Method != http.MethodPut && r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, "unsupported operation")
+		return
+	}
+
+	if s.sealed {
+		respondError(w, http.StatusServiceUnavailable, "Vault is sealed")
+		return
+	}
+
+	if !s.authorized(r) {
+		respondError(w, http.StatusForbidden, "permission denied")
+		return
+	}
+
+	// like Vault, standby nodes can't be sealed via the API
+	if s.standby {
+		respondError(w, http.StatusInternalServerError, "vault cannot seal when in standby mode; please restart instead")
+		return
+	}
+
+	s.sealed = true
+	s.resetUnseal()
+	s.generateRoot = nil
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleStepDown(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.Method != http.MethodPut && r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, "unsupported operation")
+		return
+	}
+
+	if s.sealed {
+		respondError(w, http.StatusServiceUnavailable, "Vault is sealed")
+		return
+	}
+
+	if !s.authorized(r) {
+		respondError(w, http.StatusForbidden, "permission denied")
+		return
+	}
+
+	// unlike Vault, the fake server does not forward the requests
+	// from standby nodes to the active node
+	s.standby = true
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	code := http.StatusOK
+	switch {
+	case !s.initialized:
+		code = statusParam(r, "uninitcode", http.StatusNotImplemented)
+	case s.sealed:
+		code = statusParam(r, "sealedcode", http.StatusServiceUnavailable)
+	case s.standby && s.perfStandby:
+		code = statusParam(r, "performancestandbycode", 473)
+	case s.standby:
+		code = statusParam(r, "standbycode", http.StatusTooManyRequests)
+	}
+
+	respond(w, code, &api.HealthResponse{
+		Initialized:        s.initialized,
+		Sealed:             s.sealed,
+		Standby:            s.standby,
+		PerformanceStandby: s.standby && s.perfStandby,
+		ServerTimeUTC:      time.Now().UTC().Unix(),
+		Version:            s.version,
+	})
+}
+
+func (s *Server) handleLeader(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, "unsupported operation")
+		return
+	}
+
+	if !s.initialized || s.sealed {
+		respondError(w, http.StatusServiceUnavailable, "Vault is sealed")
+		return
+	}
+
+	resp := &api.LeaderResponse{
+		HAEnabled:   s.standby || s.raftLeader != nil || len(s.raftPeers) > 0,
+		IsSelf:      !s.standby,
+		PerfStandby: s.standby && s.perfStandby,
+	}
+
+	switch {
+	case !s.standby:
+		resp.LeaderAddress = s.URL
+	case s.raftLeader != nil:
+		resp.LeaderAddress = s.raftLeader.URL
+	}
+
+	respond(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleRekeyInit(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodGet:
+		respond(w, http.StatusOK, s.rekeyStatus())
+	case http.MethodPut, http.MethodPost:
+		if !s.initialized || s.sealed {
+			respondError(w, http.StatusBadRequest, "Vault is sealed")
+			return
+		}
+
+		if s.rekey != nil {
+			respondError(w, http.StatusBadRequest, "rekey already in progress")
+			return
+		}
+
+		req := new(api.RekeyInitRequest)
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if req.SecretShares < 1 || req.SecretThreshold < 1 || req.SecretThreshold > req.SecretShares {
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("invalid seal configuration: shares %d, threshold %d",
+				req.SecretShares, req.SecretThreshold))
+			return
+		}
+
+		s.rekey = &rekey{
+			nonce:     uuid(),
+			shares:    req.SecretShares,
+			threshold: req.SecretThreshold,
+		}
+
+		respond(w, http.StatusOK, s.rekeyStatus())
+	case http.MethodDelete:
+		s.rekey = nil
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		respondError(w, http.StatusMethodNotAllowed, "unsupported operation")
+	}
+}
+
+func (s *Server) handleRekeyUpdate(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.Method != http.MethodPut && r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, "unsupported operation")
+		return
+	}
+
+	if s.rekey == nil {
+		respondError(w, http.StatusBadRequest, "no rekey in progress")
+		return
+	}
+
+	req := struct {
+		Key   string `json:"key"`
+		Nonce string `json:"nonce"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if req.Nonce != s.rekey.nonce {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("incorrect nonce supplied; nonce for this rekey operation is %s", s.rekey.nonce))
+		return
+	}
+
+	key, err := s.lookupKey(req.Key)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	for _, k := range s.rekey.submitted {
+		if k == key {
+			respondError(w, http.StatusBadRequest, "given key has already been provided during this generation operation")
+			return
+		}
+	}
+	s.rekey.submitted = append(s.rekey.submitted, key)
+
+	resp := &api.RekeyUpdateResponse{Nonce: s.rekey.nonce}
+	if len(s.rekey.submitted) >= s.threshold {
+		s.shares, s.threshold = s.rekey.shares, s.rekey.threshold
+		s.keys = genKeys(s.shares)
+		s.rekey = nil
+
+		resp.Complete = true
+		resp.Keys = copyKeys(s.keys)
+		resp.KeysB64 = b64Keys(s.keys)
+	}
+
+	respond(w, http.StatusOK, resp)
+}
+
+// initialize generates new keys and root token and seals the server.
+// It must be called with s.mu held.
+func (s *Server) initialize(shares, threshold int) {
+	s.initialized = true
+	s.sealed = true
+	s.shares = shares
+	s.threshold = threshold
+	s.keys = genKeys(shares)
+	s.rootToken = "s." + randString(24)
+	s.clusterID = uuid()
+	s.snapshot = newSnapshot(s.clusterID)
+	s.resetUnseal()
+}
+
+// authorized returns true if the request carries the root token or a token created
+// via the token auth method. It must be called with s.mu held.
+func (s *Server) authorized(r *http.Request) bool {
+	token := r.Header.Get("X-Vault-Token")
+	if _, ok := s.tokens[token]; ok {
+		return true
+	}
+
+	return s.rootToken != "" && token == s.rootToken
+}
+
+// resetUnseal discards the current unseal attempt. It must be called with s.mu held.
+func (s *Server) resetUnseal() {
+	s.nonce = ""
+	s.submitted = nil
+}
+
+// lookupKey decodes hex or base64 encoded key and returns its hex encoding
+// if it's one of the server unseal keys. It must be called with s.mu held.
+func (s *Server) lookupKey(key string) (string, error) {
+	if key == "" {
+		return "", fmt.Errorf("missing required parameter 'key'")
+	}
+
+	raw, err := hex.DecodeString(key)
+	if err != nil {
+		raw, err = base64.StdEncoding.DecodeString(key)
+		if err != nil {
+			return "", fmt.Errorf("'key' must be a valid hex or base64 string")
+		}
+	}
+
+	encoded := hex.EncodeToString(raw)
+	for _, k := range s.keys {
+		if k == encoded {
+			return encoded, nil
+		}
+	}
+
+	return "", fmt.Errorf("invalid key")
+}
+
+// sealStatus returns current seal status. It must be called with s.mu held.
+func (s *Server) sealStatus() *api.SealStatusResponse {
+	return &api.SealStatusResponse{
+		Type:        "shamir",
+		Initialized: s.initialized,
+		Sealed:      s.sealed,
+		T:           s.threshold,
+		N:           s.shares,
+		Progress:    len(s.submitted),
+		Nonce:       s.nonce,
+		Version:     s.version,
+	}
+}
+
+// rekeyStatus returns current rekey status. It must be called with s.mu held.
+func (s *Server) rekeyStatus() *api.RekeyStatusResponse {
+	if s.rekey == nil {
+		return &api.RekeyStatusResponse{Required: s.threshold}
+	}
+
+	return &api.RekeyStatusResponse{
+		Nonce:    s.rekey.nonce,
+		Started:  true,
+		T:        s.rekey.threshold,
+		N:        s.rekey.shares,
+		Progress: len(s.rekey.submitted),
+		Required: s.threshold,
+	}
+}
+
+// statusParam returns HTTP status code from query parameter name or def
+func statusParam(r *http.Request, name string, def int) int {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def
+	}
+
+	code, err := strconv.Atoi(v)
+	if err != nil {
+		return def
+	}
+
+	return code
+}
+
+// respond writes JSON encoded body to w with the given HTTP status code
+func respond(w http.ResponseWriter, code int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	// nolint:errcheck
+	json.NewEncoder(w).Encode(body)
+}
+
+// respondError writes Vault API error to w with the given HTTP status code
+func respondError(w http.ResponseWriter, code int, msg string) {
+	respond(w, code, &api.ErrorResponse{Errors: []string{msg}})
+}
+
+// genKeys generates n random hex encoded unseal keys
+func genKeys(n int) []string {
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = hex.EncodeToString(randBytes(keyLength))
+	}
+
+	return keys
+}
+
+// copyKeys returns a copy of keys
+func copyKeys(keys []string) []string {
+	c := make([]string, len(keys))
+	copy(c, keys)
+
+	return c
+}
+
+// b64Keys re-encodes hex encoded keys with base64 encoding
+func b64Keys(keys []string) []string {
+	b64 := make([]string, len(keys))
+	for i, k := range keys {
+		raw, _ := hex.DecodeString(k)
+		b64[i] = base64.StdEncoding.EncodeToString(raw)
+	}
+
+	return b64
+}
+
+// uuid returns a random UUID formatted string
+func uuid() string {
+	b := randBytes(16)
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// randString returns a random alphanumeric string of length n
+func randString(n int) string {
+	const chars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+	var sb strings.Builder
+	for _, b := range randBytes(n) {
+		sb.WriteByte(chars[int(b)%len(chars)])
+	}
+
+	return sb.String()
+}
+
+// randBytes returns n random bytes
+func randBytes(n int) []byte {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+
+	return b
+}
@@ -0,0 +1,615 @@
+package vaulttest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func newClient(t *testing.T, addr string) *api.Client {
+	config := api.DefaultConfig()
+	config.Address = addr
+	// don't retry failed requests
+	config.MaxRetries = 0
+
+	client, err := api.NewClient(config)
+	assert.NoError(t, err)
+
+	return client
+}
+
+func TestInit(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	v := newClient(t, s.URL)
+
+	status, err := v.Sys().InitStatus()
+	assert.NoError(t, err)
+	assert.False(t, status)
+
+	// invalid threshold
+	_, err = v.Sys().Init(&api.InitRequest{SecretShares: 2, SecretThreshold: 3})
+	assert.Error(t, err)
+
+	resp, err := v.Sys().Init(&api.InitRequest{SecretShares: 5, SecretThreshold: 3})
+	assert.NoError(t, err)
+	assert.Len(t, resp.Keys, 5)
+	assert.Len(t, resp.KeysB64, 5)
+	assert.NotEmpty(t, resp.RootToken)
+	assert.Equal(t, resp.Keys, s.Keys())
+	assert.Equal(t, resp.RootToken, s.RootToken())
+	assert.True(t, s.Initialized())
+	assert.True(t, s.Sealed())
+
+	// already initialized
+	_, err = v.Sys().Init(&api.InitRequest{SecretShares: 5, SecretThreshold: 3})
+	assert.Error(t, err)
+	assert.Equal(t, 4, s.Requests("/v1/sys/init"))
+}
+
+func TestUnseal(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	v := newClient(t, s.URL)
+
+	// not initialized
+	_, err := v.Sys().Unseal("foo")
+	assert.Error(t, err)
+
+	keys, _ := s.Initialize(3, 2)
+
+	// invalid key
+	_, err = v.Sys().Unseal("foo")
+	assert.Error(t, err)
+
+	resp, err := v.Sys().Unseal(keys[0])
+	assert.NoError(t, err)
+	assert.True(t, resp.Sealed)
+	assert.Equal(t, 1, resp.Progress)
+	assert.NotEmpty(t, resp.Nonce)
+
+	// duplicate keys are ignored
+	resp, err = v.Sys().Unseal(keys[0])
+	assert.NoError(t, err)
+	assert.Equal(t, 1, resp.Progress)
+
+	// reset discards the progress
+	resp, err = v.Sys().ResetUnsealProcess()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, resp.Progress)
+
+	_, err = v.Sys().Unseal(keys[1])
+	assert.NoError(t, err)
+	resp, err = v.Sys().Unseal(keys[2])
+	assert.NoError(t, err)
+	assert.False(t, resp.Sealed)
+	assert.Equal(t, 0, resp.Progress)
+	assert.False(t, s.Sealed())
+
+	status, err := v.Sys().SealStatus()
+	assert.NoError(t, err)
+	assert.False(t, status.Sealed)
+	assert.Equal(t, 2, status.T)
+	assert.Equal(t, 3, status.N)
+}
+
+func TestHealth(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	v := newClient(t, s.URL)
+
+	resp, err := v.Sys().Health()
+	assert.NoError(t, err)
+	assert.False(t, resp.Initialized)
+	assert.Equal(t, DefaultVersion, resp.Version)
+
+	// default Vault health status codes
+	testCases := []struct {
+		setup func()
+		code  int
+	}{
+		{func() {}, http.StatusNotImplemented},
+		{func() { s.Initialize(1, 1) }, http.StatusServiceUnavailable},
+		{func() { s.SetSealed(false) }, http.StatusOK},
+		{func() { s.SetStandby(true) }, http.StatusTooManyRequests},
+		{func() { s.SetPerfStandby(true) }, 473},
+	}
+
+	for _, tc := range testCases {
+		tc.setup()
+		r, err := http.Get(s.URL + "/v1/sys/health")
+		assert.NoError(t, err)
+		r.Body.Close()
+		assert.Equal(t, tc.code, r.StatusCode)
+	}
+}
+
+func TestLeader(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	v := newClient(t, s.URL)
+
+	// sealed server does not know the leader
+	_, err := v.Sys().Leader()
+	assert.Error(t, err)
+
+	s.Initialize(1, 1)
+	s.SetSealed(false)
+	resp, err := v.Sys().Leader()
+	assert.NoError(t, err)
+	assert.False(t, resp.HAEnabled)
+	assert.True(t, resp.IsSelf)
+	assert.Equal(t, s.URL, resp.LeaderAddress)
+
+	s.SetPerfStandby(true)
+	resp, err = v.Sys().Leader()
+	assert.NoError(t, err)
+	assert.True(t, resp.HAEnabled)
+	assert.False(t, resp.IsSelf)
+	assert.True(t, resp.PerfStandby)
+}
+
+func TestSealStepDown(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.Initialize(1, 1)
+
+	v := newClient(t, s.URL)
+
+	// sealed server can't be sealed nor stepped down
+	assert.Error(t, v.Sys().Seal())
+	assert.Error(t, v.Sys().StepDown())
+
+	s.SetSealed(false)
+	// root token is required
+	assert.Error(t, v.Sys().Seal())
+	assert.Error(t, v.Sys().StepDown())
+
+	v.SetToken(s.RootToken())
+	assert.NoError(t, v.Sys().StepDown())
+	assert.True(t, s.Standby())
+	assert.False(t, s.Sealed())
+
+	// standby server can't be sealed
+	assert.Error(t, v.Sys().Seal())
+	assert.False(t, s.Sealed())
+
+	s.SetStandby(false)
+	assert.NoError(t, v.Sys().Seal())
+	assert.True(t, s.Sealed())
+}
+
+func TestRekey(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	v := newClient(t, s.URL)
+	keys, _ := s.Initialize(3, 2)
+
+	// sealed server can't be rekeyed
+	_, err := v.Sys().RekeyInit(&api.RekeyInitRequest{SecretShares: 5, SecretThreshold: 3})
+	assert.Error(t, err)
+
+	s.SetSealed(false)
+	status, err := v.Sys().RekeyInit(&api.RekeyInitRequest{SecretShares: 5, SecretThreshold: 3})
+	assert.NoError(t, err)
+	assert.True(t, status.Started)
+	assert.Equal(t, 2, status.Required)
+
+	// invalid nonce
+	_, err = v.Sys().RekeyUpdate(keys[0], "foo")
+	assert.Error(t, err)
+
+	resp, err := v.Sys().RekeyUpdate(keys[0], status.Nonce)
+	assert.NoError(t, err)
+	assert.False(t, resp.Complete)
+
+	resp, err = v.Sys().RekeyUpdate(keys[1], status.Nonce)
+	assert.NoError(t, err)
+	assert.True(t, resp.Complete)
+	assert.Len(t, resp.Keys, 5)
+	assert.Equal(t, resp.Keys, s.Keys())
+
+	status, err = v.Sys().RekeyStatus()
+	assert.NoError(t, err)
+	assert.False(t, status.Started)
+	assert.Equal(t, 3, status.Required)
+}
+
+func TestGenerateRoot(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	v := newClient(t, s.URL)
+	keys, _ := s.Initialize(3, 2)
+	s.SetSealed(false)
+
+	status, err := v.Sys().GenerateRootStatus()
+	assert.NoError(t, err)
+	assert.False(t, status.Started)
+	assert.Equal(t, OTPLength, status.OTPLength)
+
+	// invalid one-time password
+	_, err = v.Sys().GenerateRootInit("foo", "")
+	assert.Error(t, err)
+
+	otp := strings.Repeat("a", OTPLength)
+	status, err = v.Sys().GenerateRootInit(otp, "")
+	assert.NoError(t, err)
+	assert.True(t, status.Started)
+	assert.Equal(t, 2, status.Required)
+
+	resp, err := v.Sys().GenerateRootUpdate(keys[0], status.Nonce)
+	assert.NoError(t, err)
+	assert.False(t, resp.Complete)
+	assert.Equal(t, 1, resp.Progress)
+
+	// duplicate key share
+	_, err = v.Sys().GenerateRootUpdate(keys[0], status.Nonce)
+	assert.Error(t, err)
+
+	resp, err = v.Sys().GenerateRootUpdate(keys[1], status.Nonce)
+	assert.NoError(t, err)
+	assert.True(t, resp.Complete)
+
+	encoded, err := base64.RawStdEncoding.DecodeString(resp.EncodedToken)
+	assert.NoError(t, err)
+	token := make([]byte, len(encoded))
+	for i := range encoded {
+		token[i] = encoded[i] ^ otp[i]
+	}
+	_, ok := s.Token(string(token))
+	assert.True(t, ok)
+
+	status, err = v.Sys().GenerateRootStatus()
+	assert.NoError(t, err)
+	assert.False(t, status.Started)
+}
+
+func TestFailAndLatency(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	v := newClient(t, s.URL)
+
+	s.Fail("/v1/sys/seal-status", http.StatusInternalServerError, 1)
+	_, err := v.Sys().SealStatus()
+	assert.Error(t, err)
+	_, err = v.Sys().SealStatus()
+	assert.NoError(t, err)
+
+	s.Fail("/v1/sys/seal-status", http.StatusBadGateway, -1)
+	for i := 0; i < 3; i++ {
+		_, err = v.Sys().SealStatus()
+		assert.Error(t, err)
+	}
+	s.Fail("/v1/sys/seal-status", 0, 0)
+	_, err = v.Sys().SealStatus()
+	assert.NoError(t, err)
+
+	latency := 50 * time.Millisecond
+	s.SetLatency(latency)
+	start := time.Now()
+	_, err = v.Sys().SealStatus()
+	assert.NoError(t, err)
+	assert.True(t, time.Since(start) >= latency)
+
+	// the path latency only delays the requests to the path
+	s.SetLatency(0)
+	s.SetPathLatency("/v1/sys/init", time.Second)
+	start = time.Now()
+	_, err = v.Sys().SealStatus()
+	assert.NoError(t, err)
+	assert.True(t, time.Since(start) < time.Second)
+	s.SetPathLatency("/v1/sys/init", 0)
+	start = time.Now()
+	_, err = v.Sys().InitStatus()
+	assert.NoError(t, err)
+	assert.True(t, time.Since(start) < time.Second)
+}
+
+func TestRaft(t *testing.T) {
+	leader := NewServer()
+	defer leader.Close()
+	follower := NewServer()
+	defer follower.Close()
+
+	lv := newClient(t, leader.URL)
+	fv := newClient(t, follower.URL)
+
+	// leader is not initialized
+	_, err := fv.Sys().RaftJoin(&api.RaftJoinRequest{LeaderAPIAddr: leader.URL})
+	assert.Error(t, err)
+
+	keys, token := leader.Initialize(3, 2)
+	leader.SetSealed(false)
+
+	// unknown leader
+	_, err = fv.Sys().RaftJoin(&api.RaftJoinRequest{LeaderAPIAddr: "http://127.0.0.1:1"})
+	assert.Error(t, err)
+
+	resp, err := fv.Sys().RaftJoin(&api.RaftJoinRequest{LeaderAPIAddr: leader.URL, LeaderCACert: "CA"})
+	assert.NoError(t, err)
+	assert.True(t, resp.Joined)
+	assert.Equal(t, "CA", follower.JoinRequest().LeaderCACert)
+	assert.True(t, follower.Initialized())
+	assert.True(t, follower.Sealed())
+	assert.Equal(t, keys, follower.Keys())
+	assert.Equal(t, token, follower.RootToken())
+
+	// already joined
+	_, err = fv.Sys().RaftJoin(&api.RaftJoinRequest{LeaderAPIAddr: leader.URL})
+	assert.Error(t, err)
+
+	// follower shows up in raft configuration once it's unsealed
+	assert.Len(t, leader.RaftServers(), 1)
+	for _, key := range keys[:2] {
+		_, err = fv.Sys().Unseal(key)
+		assert.NoError(t, err)
+	}
+
+	r, err := lv.RawRequest(lv.NewRequest("GET", "/v1/sys/storage/raft/configuration"))
+	assert.NoError(t, err)
+	defer r.Body.Close()
+
+	secret, err := api.ParseSecret(r.Body)
+	assert.NoError(t, err)
+	servers := secret.Data["config"].(map[string]interface{})["servers"].([]interface{})
+	assert.Len(t, servers, 2)
+	assert.Equal(t, leader.NodeID(), servers[0].(map[string]interface{})["node_id"])
+	assert.Equal(t, follower.NodeID(), servers[1].(map[string]interface{})["node_id"])
+	assert.Equal(t, true, servers[1].(map[string]interface{})["voter"])
+	assert.Equal(t, leader.RaftServers(), follower.RaftServers())
+
+	health, err := fv.Sys().Health()
+	assert.NoError(t, err)
+	assert.True(t, health.Standby)
+}
+
+func TestRaftSnapshot(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	v := newClient(t, s.URL)
+	s.Initialize(1, 1)
+
+	// sealed server
+	var buf bytes.Buffer
+	assert.Error(t, v.Sys().RaftSnapshot(&buf))
+
+	s.SetSealed(false)
+	assert.NoError(t, v.Sys().RaftSnapshot(&buf))
+	assert.Equal(t, s.RaftSnapshot(), buf.Bytes())
+	snap := buf.Bytes()
+
+	s.SetRaftSnapshot()
+	assert.NotEqual(t, snap, s.RaftSnapshot())
+
+	assert.NoError(t, v.Sys().RaftSnapshotRestore(bytes.NewReader(snap), false))
+	assert.Equal(t, snap, s.RaftSnapshot())
+
+	// invalid snapshot
+	assert.Error(t, v.Sys().RaftSnapshotRestore(bytes.NewReader([]byte("foo")), true))
+
+	// snapshots of other clusters require forced restore
+	other := NewServer()
+	defer other.Close()
+	other.Initialize(1, 1)
+
+	assert.Error(t, v.Sys().RaftSnapshotRestore(bytes.NewReader(other.RaftSnapshot()), false))
+	assert.NoError(t, v.Sys().RaftSnapshotRestore(bytes.NewReader(other.RaftSnapshot()), true))
+	assert.Equal(t, other.RaftSnapshot(), s.RaftSnapshot())
+}
+
+func TestAudit(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	v := newClient(t, s.URL)
+	_, token := s.Initialize(1, 1)
+
+	opts := &api.EnableAuditOptions{Type: "file", Options: map[string]string{"file_path": "/var/log/vault/audit.log"}}
+
+	// sealed server
+	assert.Error(t, v.Sys().EnableAuditWithOptions("file", opts))
+
+	// missing token
+	s.SetSealed(false)
+	assert.Error(t, v.Sys().EnableAuditWithOptions("file", opts))
+
+	v.SetToken(token)
+	assert.NoError(t, v.Sys().EnableAuditWithOptions("file", opts))
+	// the path is already in use
+	assert.Error(t, v.Sys().EnableAuditWithOptions("file/", opts))
+	// the type is required
+	assert.Error(t, v.Sys().EnableAuditWithOptions("syslog", &api.EnableAuditOptions{}))
+
+	s.EnableAudit("syslog", &api.EnableAuditOptions{Type: "syslog", Local: true})
+
+	devices, err := v.Sys().ListAudit()
+	assert.NoError(t, err)
+	assert.Equal(t, s.AuditDevices(), devices)
+	assert.Equal(t, &api.Audit{Type: "file", Options: opts.Options, Path: "file/"}, devices["file/"])
+	assert.Equal(t, &api.Audit{Type: "syslog", Options: map[string]string{}, Local: true, Path: "syslog/"}, devices["syslog/"])
+
+	assert.NoError(t, v.Sys().DisableAudit("file"))
+	assert.NoError(t, v.Sys().DisableAudit("file"))
+	assert.Len(t, s.AuditDevices(), 1)
+}
+
+func TestKV(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	v := newClient(t, s.URL)
+	_, token := s.Initialize(1, 1)
+	s.SetSealed(false)
+	s.MountKV("kv", 1)
+	s.MountKV("secret", 2)
+
+	// missing token
+	_, err := v.Logical().Write("kv/db", map[string]interface{}{"password": "s3cr3t"})
+	assert.Error(t, err)
+
+	v.SetToken(token)
+
+	// KV version 1
+	_, err = v.Logical().Write("kv/db", map[string]interface{}{"password": "s3cr3t"})
+	assert.NoError(t, err)
+	secret, err := v.Logical().Read("kv/db")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"password": "s3cr3t"}, secret.Data)
+	data, version, ok := s.KVSecret("kv/db")
+	assert.True(t, ok)
+	assert.Equal(t, 1, version)
+	assert.Equal(t, map[string]interface{}{"password": "s3cr3t"}, data)
+
+	secret, err = v.Logical().Read("kv/api")
+	assert.NoError(t, err)
+	assert.Nil(t, secret)
+
+	// KV version 2 with check-and-set
+	write := func(cas int) error {
+		_, err := v.Logical().Write("secret/data/db", map[string]interface{}{
+			"data":    map[string]interface{}{"password": "s3cr3t"},
+			"options": map[string]interface{}{"cas": cas},
+		})
+		return err
+	}
+	assert.Error(t, write(1))
+	assert.NoError(t, write(0))
+	assert.Error(t, write(0))
+	assert.NoError(t, write(1))
+
+	secret, err = v.Logical().Read("secret/data/db")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"password": "s3cr3t"}, secret.Data["data"])
+	assert.Equal(t, "2", string(secret.Data["metadata"].(map[string]interface{})["version"].(json.Number)))
+
+	assert.NoError(t, s.WriteKV("secret/db", map[string]interface{}{"password": "changed"}))
+	_, version, _ = s.KVSecret("secret/db")
+	assert.Equal(t, 3, version)
+
+	// no KV secrets engine mounted
+	_, err = v.Logical().Write("foo/db", map[string]interface{}{"password": "s3cr3t"})
+	assert.Error(t, err)
+	assert.Error(t, s.WriteKV("foo/db", nil))
+}
+
+func TestTokens(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	v := newClient(t, s.URL)
+	_, root := s.Initialize(1, 1)
+	s.SetSealed(false)
+
+	// missing token
+	assert.Error(t, v.Sys().PutPolicy("admin", `path "sys/*" { capabilities = ["read"] }`))
+
+	v.SetToken(root)
+	assert.NoError(t, v.Sys().PutPolicy("admin", `path "sys/*" { capabilities = ["read"] }`))
+	rules, ok := s.Policy("admin")
+	assert.True(t, ok)
+	assert.Equal(t, `path "sys/*" { capabilities = ["read"] }`, rules)
+	assert.Error(t, v.Sys().PutPolicy("empty", ""))
+
+	secret, err := v.Auth().Token().CreateOrphan(&api.TokenCreateRequest{
+		Policies:    []string{"admin"},
+		Period:      "768h",
+		DisplayName: "admin",
+	})
+	assert.NoError(t, err)
+	token := secret.Auth.ClientToken
+	assert.Equal(t, 768*3600, secret.Auth.LeaseDuration)
+	assert.True(t, secret.Auth.Renewable)
+
+	tok, ok := s.Token(token)
+	assert.True(t, ok)
+	assert.Equal(t, &Token{Policies: []string{"default", "admin"}, Period: 768 * time.Hour, Orphan: true, DisplayName: "admin"}, tok)
+
+	// created tokens are authorized
+	v.SetToken(token)
+	assert.NoError(t, v.Sys().StepDown())
+
+	// root token is revoked
+	v.SetToken(root)
+	assert.NoError(t, v.Auth().Token().RevokeSelf(""))
+	assert.Empty(t, s.RootToken())
+	assert.Error(t, v.Sys().PutPolicy("admin", "foo"))
+
+	v.SetToken(token)
+	assert.NoError(t, v.Auth().Token().RevokeSelf(""))
+	_, ok = s.Token(token)
+	assert.False(t, ok)
+
+	s.AddToken("s.added", &Token{Policies: []string{"admin"}})
+	v.SetToken("s.added")
+	assert.NoError(t, v.Sys().PutPolicy("admin", "foo"))
+}
+
+func TestAuth(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	v := newClient(t, s.URL)
+	s.Initialize(1, 1)
+
+	s.EnableAuth("approle/", func(data map[string]interface{}) (*Token, error) {
+		if data["role_id"] != "role" {
+			return nil, errors.New("invalid role ID")
+		}
+		return &Token{Policies: []string{"default", "apply"}, TTL: time.Hour}, nil
+	})
+
+	// sealed server
+	_, err := v.Logical().Write("auth/approle/login", map[string]interface{}{"role_id": "role"})
+	assert.Error(t, err)
+	s.SetSealed(false)
+
+	_, err = v.Logical().Write("auth/approle/login", map[string]interface{}{"role_id": "foo"})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid role ID")
+
+	_, err = v.Logical().Write("auth/kubernetes/login", map[string]interface{}{"role": "foo"})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "no handler for route 'auth/kubernetes/login'")
+
+	secret, err := v.Logical().Write("auth/approle/login", map[string]interface{}{"role_id": "role"})
+	assert.NoError(t, err)
+	token := secret.Auth.ClientToken
+	assert.Equal(t, 3600, secret.Auth.LeaseDuration)
+	assert.True(t, secret.Auth.Renewable)
+	assert.Equal(t, []string{"default", "apply"}, secret.Auth.Policies)
+
+	tok, ok := s.Token(token)
+	assert.True(t, ok)
+	assert.Equal(t, time.Hour, tok.TTL)
+
+	// issued tokens are authorized and renewable
+	v.SetToken(token)
+	assert.NoError(t, v.Sys().StepDown())
+	secret, err = v.Auth().Token().RenewSelf(0)
+	assert.NoError(t, err)
+	assert.Equal(t, token, secret.Auth.ClientToken)
+	assert.Equal(t, 1, s.Requests("/v1/auth/token/renew-self"))
+
+	// tokens without TTL are not renewable
+	s.AddToken("s.static", &Token{Policies: []string{"default"}})
+	v.SetToken("s.static")
+	_, err = v.Auth().Token().RenewSelf(0)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "lease is not renewable")
+}